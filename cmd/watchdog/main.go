@@ -7,11 +7,14 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
 	"watchdog.onebusaway.org/internal/app"
 	"watchdog.onebusaway.org/internal/config"
+	"watchdog.onebusaway.org/internal/metrics"
 	"watchdog.onebusaway.org/internal/models"
 	"watchdog.onebusaway.org/internal/report"
 )
@@ -26,6 +29,21 @@ func main() {
 	flag.IntVar(&cfg.Port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.Env, "env", "development", "Environment (development|staging|production)")
 	flag.IntVar(&cfg.FetchInterval, "fetch-interval", 30, "Interval (in seconds) at which the application fetches data from realtime APIs and updates Prometheus metrics")
+	flag.IntVar(&cfg.CollectionWorkers, "collection-workers", 4, "Maximum number of servers whose metrics are collected concurrently")
+	flag.IntVar(&cfg.CollectionTimeout, "collection-timeout", 30, "Deadline (in seconds) for collecting the metrics of a single server")
+	flag.IntVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30, "Time (in seconds) to wait for in-flight metrics collections to finish on shutdown")
+	flag.IntVar(&cfg.MaxBundleSize, "max-bundle-size", 512, "Maximum size (in MB) of a downloaded GTFS static bundle")
+	flag.IntVar(&cfg.MaxRealtimeFeedSize, "max-realtime-feed-size", 16, "Maximum size (in MB) of a downloaded GTFS-RT feed")
+	flag.IntVar(&cfg.BundleSpoolThreshold, "bundle-spool-threshold", 32, "Size (in MB) above which GTFS static bundles are spooled to a temporary file while downloading; spooled bundles are still read back whole into memory to be parsed")
+	flag.IntVar(&cfg.BundleParseWorkers, "bundle-parse-workers", 2, "Maximum number of GTFS static bundles parsed concurrently; each one holds up to -max-bundle-size in memory, plus its parsed data")
+	flag.IntVar(&cfg.ServiceGapLookaheadDays, "service-gap-lookahead-days", 14, "Number of upcoming days checked for dates without any active GTFS service")
+	flag.IntVar(&cfg.BundleStopMoveThreshold, "bundle-stop-move-threshold", 100, "Distance (in meters) beyond which a stop is counted as moved between two GTFS bundles")
+	flag.IntVar(&cfg.BundleMaxStopsRemoved, "bundle-max-stops-removed", 10, "Percentage of stops a new GTFS bundle may remove before it is reported as a suspicious change")
+	flag.IntVar(&cfg.BundleMaxRoutesRemoved, "bundle-max-routes-removed", 10, "Percentage of routes a new GTFS bundle may remove before it is reported as a suspicious change")
+	flag.IntVar(&cfg.BundleDriftSampleSize, "bundle-drift-sample-size", 10, "Number of stops, and of routes, of the GTFS bundle looked up on the OBA server on each bundle drift check")
+	flag.IntVar(&cfg.ArrivalsSampleSize, "arrivals-sample-size", 5, "Number of stops whose arrivals are requested from the OBA server on each collection run")
+	flag.IntVar(&cfg.RealtimeFrozenThreshold, "realtime-frozen-threshold", 300, "Time (in seconds) the GTFS-RT feed header timestamp or content may stay unchanged before the feed is flagged as frozen")
+	flag.StringVar(&cfg.BundleCacheDir, "bundle-cache-dir", "", "Directory in which downloaded GTFS bundles are cached and loaded from on startup (disabled when empty)")
 
 	var (
 		showVersion = flag.Bool("version", false, "display version and exit")
@@ -64,8 +82,9 @@ func main() {
 	// This context will be used to manage the application's lifecycle and cancel operations when needed.
 	// It allows us to gracefully shut down the application and clean up resources.
 	// we will use it to cancel and clean up routines when the application is shutting down.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// It is canceled when the process receives SIGINT or SIGTERM (e.g. during a rolling deploy).
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Create a new HTTP client with a connection pool
 	// This client will be reused across the application to avoid creating new connections for each request.
@@ -119,7 +138,10 @@ func main() {
 
 	// From here we set up all dependencies and we are ready to start business logic.
 
-	// On startup, download GTFS static bundles for all configured servers
+	// On startup, load the GTFS static bundles cached on disk (if the cache is enabled), so that
+	// servers whose feed host is down still have a bundle, then download the bundles of all configured servers.
+	// Cached bundles that are still current are not parsed again.
+	app.GtfsService.LoadCachedBundles(ctx, servers)
 	app.GtfsService.DownloadGTFSBundles(ctx, servers, 20)
 
 	// This function starts the metrics collection process
@@ -128,11 +150,18 @@ func main() {
 	app.StartMetricsCollection(ctx)
 
 	// Cron job to download GTFS bundles for all servers every 24 hours
-	go app.GtfsService.RefreshGTFSBundles(ctx, servers, 24*time.Hour, 5)
+	go app.GtfsService.RefreshGTFSBundles(ctx, cfg.GetServers, 24*time.Hour, 5)
 
 	// Cron job to delete the data of vehicles that has not sent updates for 1 hour
 	go app.MetricsService.VehicleLastSeen.ClearRoutine(ctx, 15*time.Minute, time.Hour)
 
+	// Cron job to stop exporting metric series (vehicles, stops, clusters...) that were not refreshed within their TTL
+	go metrics.Series.SweepRoutine(ctx, time.Minute)
+
+	// Keep GTFS bundles and per-server state in sync with configuration changes:
+	// bootstrap added servers, re-download changed bundles, and evict removed servers.
+	go app.ReconcileConfigChanges(ctx, servers)
+
 	// If a remote URL is specified, refresh the configuration every minute
 	if *configURL != "" {
 		go app.ConfigService.RefreshConfig(ctx, *configURL, configAuthUser, configAuthPass, time.Minute, 20)
@@ -155,10 +184,46 @@ func main() {
 		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
-	logger.Info("starting server", "addr", srv.Addr, "env", cfg.Env)
-	err = srv.ListenAndServe()
-	report.ReportError(err, sentry.LevelFatal)
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("starting server", "addr", srv.Addr, "env", cfg.Env)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		report.ReportError(err, sentry.LevelFatal)
+		report.FlushSentry()
+		logger.Error(err.Error())
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// Graceful shutdown:
+	//   1. The canceled context has already stopped the ticker loops (metrics collection,
+	//      GTFS bundle refresh, config refresh, vehicle cleanup), so no new work is started.
+	//   2. In-flight metrics collections are given up to ShutdownTimeout seconds to finish,
+	//      so that a rolling deploy does not leave partially updated metrics behind.
+	//   3. The HTTP server stops accepting connections and finishes serving in-flight requests.
+	//   4. Buffered Sentry events are flushed.
+	// Restoring the default signal behavior first lets a second signal terminate the process immediately.
+	stop()
+	logger.Info("shutting down", "drain_timeout", time.Duration(cfg.ShutdownTimeout)*time.Second)
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancelDrain()
+	if err := app.Shutdown(drainCtx); err != nil {
+		logger.Warn("Metrics collections did not drain cleanly", "error", err)
+		report.ReportError(err, sentry.LevelWarning)
+	}
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), srv.WriteTimeout)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		logger.Error("HTTP server shutdown failed", "error", err)
+		report.ReportError(err, sentry.LevelError)
+	}
+
 	report.FlushSentry()
-	logger.Error(err.Error())
-	os.Exit(1)
+	logger.Info("server stopped")
 }
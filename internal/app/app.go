@@ -3,11 +3,15 @@ package app
 import (
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/checks"
 	"watchdog.onebusaway.org/internal/config"
 	"watchdog.onebusaway.org/internal/geo"
 	"watchdog.onebusaway.org/internal/gtfs"
 	"watchdog.onebusaway.org/internal/metrics"
+	"watchdog.onebusaway.org/internal/report"
 )
 
 // Application represents the main application structure.
@@ -21,6 +25,9 @@ type Application struct {
 	MetricsService *metrics.MetricsService
 	Logger         *slog.Logger
 	Version        string
+
+	checkRunner *checks.Runner       // Runs the registered checks for each server
+	collector   *collectionScheduler // Set by StartMetricsCollection; used to wait for in-flight runs
 }
 
 // New creates and wires all dependencies for the Application.
@@ -28,20 +35,48 @@ type Application struct {
 func New(cfg *config.Config, logger *slog.Logger, client *http.Client, version string) *Application {
 
 	staticStore := gtfs.NewStaticStore()
-	realtimeStore := gtfs.NewRealtimeStore()
+	// A GTFS-RT snapshot that was not refreshed for three fetch cycles is treated as missing,
+	// so checks never report metrics computed from an old feed.
+	realtimeStore := gtfs.NewRealtimeStore(3 * time.Duration(cfg.FetchInterval) * time.Second)
+	tripUpdatesStore := gtfs.NewRealtimeStore(3 * time.Duration(cfg.FetchInterval) * time.Second)
+	alertsStore := gtfs.NewRealtimeStore(3 * time.Duration(cfg.FetchInterval) * time.Second)
 	boundingBoxStore := geo.NewBoundingBoxStore()
 	vehicleLastSeen := metrics.NewVehicleLastSeen()
 	backoffStore := config.NewBackoffStore()
 
+	feedLimits := gtfs.NewFeedLimits(
+		int64(cfg.MaxBundleSize)<<20,
+		int64(cfg.MaxRealtimeFeedSize)<<20,
+		int64(cfg.BundleSpoolThreshold)<<20,
+		cfg.BundleParseWorkers,
+	)
+	feedLimits.OnLimitExceeded = metrics.RecordFeedSizeLimitExceeded
+
+	changelog := gtfs.NewBundleChangelog(0, gtfs.NewDiffThresholds(
+		float64(cfg.BundleStopMoveThreshold),
+		float64(cfg.BundleMaxStopsRemoved)/100,
+		float64(cfg.BundleMaxRoutesRemoved)/100,
+	))
+
+	// The watchdog still works without its bundle cache, only without warm restarts.
+	bundleCache, err := gtfs.NewBundleCache(cfg.BundleCacheDir)
+	if err != nil {
+		logger.Error("Failed to set up GTFS bundle cache, continuing without it", "error", err)
+		report.ReportError(err, sentry.LevelWarning)
+	}
+
 	configService := config.NewConfigService(logger, client, cfg, backoffStore)
-	gtfsService := gtfs.NewGtfsService(staticStore, realtimeStore, boundingBoxStore, logger, client)
-	metricsService := metrics.NewMetricsService(staticStore, realtimeStore, boundingBoxStore, vehicleLastSeen, logger, client)
+	gtfsService := gtfs.NewGtfsService(staticStore, realtimeStore, tripUpdatesStore, alertsStore, boundingBoxStore, logger, client, feedLimits, changelog, bundleCache)
+	gtfsService.OnRealtimeFetch = metrics.RecordRealtimeFetch
+	metricsService := metrics.NewMetricsService(staticStore, realtimeStore, tripUpdatesStore, alertsStore, boundingBoxStore, vehicleLastSeen, logger, client)
 
-	return &Application{
+	app := &Application{
 		ConfigService:  configService,
 		GtfsService:    gtfsService,
 		MetricsService: metricsService,
 		Logger:         logger,
 		Version:        version,
 	}
+	app.checkRunner = checks.NewRunner(app.newCheckRegistry(), logger)
+	return app
 }
@@ -0,0 +1,306 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/checks"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// Names of the built-in checks, as used in logs, metrics and the
+// `enabled_checks` / `disabled_checks` server configuration fields.
+const (
+	checkServerPing       = "server_ping"
+	checkStaticBundle     = "static_bundle"
+	checkBundleExpiration = "bundle_expiration"
+	checkBundleInfo       = "bundle_info"
+	checkServiceGaps      = "service_gaps"
+	checkBundleIntegrity  = "bundle_integrity"
+	checkBundleChanges    = "bundle_changes"
+	checkAgenciesCoverage = "agencies_with_coverage"
+	checkBundleDrift      = "bundle_drift"
+	checkRouteConsistency = "route_consistency"
+	checkStopArrivals     = "stop_arrivals"
+	checkObaAPIMetrics    = "oba_api_metrics"
+	checkGtfsRtFeed       = "gtfs_rt_feed"
+	checkGtfsRtFreshness  = "gtfs_rt_freshness"
+	checkVehicleCount     = "vehicle_count"
+	checkVehicleTelemetry = "vehicle_telemetry"
+	checkVehiclePositions = "vehicle_positions"
+	checkVehicleIntegrity = "vehicle_integrity"
+	checkVehicleTrips     = "vehicle_trips"
+	checkTripUpdatesFeed  = "trip_updates_feed"
+	checkTripUpdates      = "trip_updates"
+	checkAlertsFeed       = "alerts_feed"
+	checkServiceAlerts    = "service_alerts"
+)
+
+// bundleDriftInterval is the minimum time between two bundle drift checks of a server: each run
+// makes a few dozen OBA API calls, and a stale bundle is not a matter of seconds.
+const bundleDriftInterval = 10 * time.Minute
+
+// routeConsistencyInterval is the minimum time between two route consistency checks of a server:
+// each run lists every route of every agency, and the list only changes with the bundle. It must
+// stay below metrics.EntitySeriesTTL, or the route series expire between two runs.
+const routeConsistencyInterval = 5 * time.Minute
+
+// newCheckRegistry registers the built-in checks run for every server on each collection cycle.
+//
+// Order and dependencies:
+//   - server_ping runs first; every other check depends on it, so nothing else runs
+//     while a server is unreachable or in backoff.
+//   - static_bundle passes when the server's GTFS static bundle has been downloaded, and
+//     gates the checks that read it.
+//   - bundle_drift runs at most once every bundleDriftInterval.
+//   - route_consistency runs at most once every routeConsistencyInterval.
+//   - gtfs_rt_feed fetches the GTFS-RT snapshot that every vehicle check reads.
+//   - trip_updates_feed fetches the GTFS-RT TripUpdates snapshot read by trip_updates.
+//     It is skipped for servers without a `trip_update_url`.
+//   - alerts_feed fetches the GTFS-RT Service Alerts snapshot read by service_alerts.
+//     It is skipped for servers without an `alerts_url`.
+//
+// New checks are added here (or registered on the returned registry) without changing the collector.
+func (app *Application) newCheckRegistry() *checks.Registry {
+	registry := checks.NewRegistry()
+	registry.MustRegister(
+		checks.New(checkServerPing, nil, 0, app.runServerPing),
+		checks.New(checkStaticBundle, []string{checkServerPing}, 0, app.runStaticBundle),
+		checks.New(checkBundleExpiration, []string{checkStaticBundle}, 0, app.runBundleExpiration),
+		checks.New(checkBundleInfo, []string{checkStaticBundle}, 0, app.runBundleInfo),
+		checks.New(checkServiceGaps, []string{checkStaticBundle}, 0, app.runServiceGaps),
+		checks.New(checkBundleIntegrity, []string{checkStaticBundle}, 0, app.runBundleIntegrity),
+		checks.New(checkBundleChanges, []string{checkStaticBundle}, 0, app.runBundleChanges),
+		checks.New(checkAgenciesCoverage, []string{checkStaticBundle}, 0, app.runAgenciesWithCoverage),
+		checks.New(checkBundleDrift, []string{checkStaticBundle}, bundleDriftInterval, app.runBundleDrift),
+		checks.New(checkRouteConsistency, []string{checkStaticBundle}, routeConsistencyInterval, app.runRouteConsistency),
+		checks.New(checkStopArrivals, []string{checkStaticBundle}, 0, app.runStopArrivals),
+		checks.New(checkObaAPIMetrics, []string{checkServerPing}, 0, app.runObaAPIMetrics),
+		checks.New(checkGtfsRtFeed, []string{checkServerPing}, 0, app.runGtfsRtFeed),
+		checks.New(checkGtfsRtFreshness, []string{checkGtfsRtFeed}, 0, app.runGtfsRtFreshness),
+		checks.New(checkVehicleCount, []string{checkGtfsRtFeed}, 0, app.runVehicleCount),
+		checks.New(checkVehicleTelemetry, []string{checkGtfsRtFeed}, 0, app.runVehicleTelemetry),
+		checks.New(checkVehiclePositions, []string{checkGtfsRtFeed, checkStaticBundle}, 0, app.runVehiclePositions),
+		checks.New(checkVehicleIntegrity, []string{checkGtfsRtFeed}, 0, app.runVehicleIntegrity),
+		checks.New(checkVehicleTrips, []string{checkGtfsRtFeed, checkStaticBundle}, 0, app.runVehicleTrips),
+		checks.New(checkTripUpdatesFeed, []string{checkServerPing}, 0, app.runTripUpdatesFeed),
+		checks.New(checkTripUpdates, []string{checkTripUpdatesFeed, checkStaticBundle}, 0, app.runTripUpdates),
+		checks.New(checkAlertsFeed, []string{checkServerPing}, 0, app.runAlertsFeed),
+		checks.New(checkServiceAlerts, []string{checkAlertsFeed, checkStaticBundle}, 0, app.runServiceAlerts),
+	)
+	return registry
+}
+
+// runServerPing pings the server to track basic availability, honoring its backoff state.
+//
+// Exponential Backoff:
+//
+//	Unlike typical blocking backoff (e.g., retry loops with time.Sleep), this check uses a
+//	per-server backoff map (BackoffStore). Each server has a backoff delay and a calculated
+//	nextRetryAt timestamp. Before attempting a ping, the check verifies whether the current time
+//	is still before nextRetryAt; if so, it is skipped, and with it every check that depends on it.
+//
+//	When a server fails, its backoff delay is increased exponentially and nextRetryAt is updated.
+//	When a server responds successfully, its backoff state is reset.
+//
+// Why this design?
+//
+//	The StartMetricsCollection scheduler runs every `FetchInterval` (default: 30 seconds) for each server.
+//	If we used a standard blocking backoff inside a collection run, the backoff delay could exceed
+//	30 seconds and keep the server's run busy across ticks. By storing backoff state per server and
+//	checking it on each scheduled run, we ensure:
+//	  - No run is kept busy waiting for a retry.
+//	  - Retry intervals still grow exponentially.
+//	  - Retries align with the FetchInterval collection cycle, meaning the effective backoff wait time
+//	    is always a multiple of FetchInterval.
+func (app *Application) runServerPing(ctx context.Context, server models.ObaServer) checks.Result {
+	// Check if server has an active backoff period
+	nextRetryAt, exists := app.ConfigService.BackoffStore.NextRetryAt(server.ID)
+	if exists && time.Now().UTC().Before(nextRetryAt) {
+		// Still in backoff → skip this check and, through dependencies, every other check
+		return checks.Skipped(fmt.Errorf("skipping metrics collection for server %s due to backoff until %s", server.ObaBaseURL, nextRetryAt.Format(time.RFC3339)), sentry.LevelInfo)
+	}
+
+	if !app.MetricsService.ServerPing(ctx, server) {
+		// On ping failure → increase backoff for this server
+		app.ConfigService.BackoffStore.UpdateBackoff(server.ID)
+		return checks.Failed(fmt.Errorf("server ping failed for %s", server.ObaBaseURL))
+	}
+
+	// On successful ping → reset backoff for this server
+	app.ConfigService.BackoffStore.ResetBackoff(server.ID)
+	return checks.Passed()
+}
+
+// runStaticBundle passes when the GTFS static bundle of the server is available in the StaticStore.
+// A missing bundle has already been reported by the download routine, so it is only reported as a warning.
+func (app *Application) runStaticBundle(ctx context.Context, server models.ObaServer) checks.Result {
+	staticData, ok := app.GtfsService.StaticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return checks.Result{
+			Status: checks.StatusFailed,
+			Err:    fmt.Errorf("no GTFS static bundle available for server %d", server.ID),
+			Level:  sentry.LevelWarning,
+		}
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runBundleExpiration(ctx context.Context, server models.ObaServer) checks.Result {
+	if _, _, _, err := app.MetricsService.CheckBundleExpiration(time.Now().UTC(), server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to check GTFS bundle expiration: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runServiceGaps(ctx context.Context, server models.ObaServer) checks.Result {
+	if _, err := app.MetricsService.CheckServiceGaps(server, app.ConfigService.Config.ServiceGapLookaheadDays); err != nil {
+		return checks.Failed(fmt.Errorf("failed to check GTFS service gaps: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runBundleIntegrity(ctx context.Context, server models.ObaServer) checks.Result {
+	if _, err := app.MetricsService.ReportBundleIntegrity(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to report GTFS bundle integrity: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runBundleChanges(ctx context.Context, server models.ObaServer) checks.Result {
+	app.MetricsService.ReportBundleDiff(server, app.GtfsService.Changelog)
+	return checks.Passed()
+}
+
+func (app *Application) runBundleInfo(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.ReportBundleInfo(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to report GTFS bundle info: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runAgenciesWithCoverage(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.CheckAgenciesWithCoverageMatch(ctx, server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to check agencies with coverage match metric: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runBundleDrift(ctx context.Context, server models.ObaServer) checks.Result {
+	if _, err := app.MetricsService.CheckBundleDrift(ctx, server, app.ConfigService.Config.BundleDriftSampleSize); err != nil {
+		return checks.Failed(fmt.Errorf("failed to check GTFS bundle drift: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runRouteConsistency(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.CheckRouteConsistency(ctx, server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to check route consistency: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runStopArrivals(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.ProbeStopArrivals(ctx, server, app.ConfigService.Config.ArrivalsSampleSize); err != nil {
+		return checks.Failed(fmt.Errorf("failed to probe stop arrivals: %w", err))
+	}
+	return checks.Passed()
+}
+
+// runObaAPIMetrics fetches the metrics of the OBA metrics API. They cover every agency of the server,
+// and are labeled with all of its agencies, configured or discovered (see MetricsService.ObaAPIMetricsSlugID).
+func (app *Application) runObaAPIMetrics(ctx context.Context, server models.ObaServer) checks.Result {
+	slugID := app.MetricsService.ObaAPIMetricsSlugID(server)
+	if err := app.MetricsService.FetchObaAPIMetrics(ctx, slugID, server.ID, server.ObaBaseURL, server.ObaApiKey); err != nil {
+		return checks.Failed(fmt.Errorf("failed to fetch OBA API metrics: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runGtfsRtFeed(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.GtfsService.FetchAndStoreGTFSRTFeed(ctx, server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to fetch and store GTFS-RT feed: %w", err))
+	}
+	return checks.Passed()
+}
+
+// runGtfsRtFreshness flags a GTFS-RT feed that still parses but no longer changes.
+// A frozen feed is exported as a metric rather than failing the check: the feed was fetched fine.
+func (app *Application) runGtfsRtFreshness(ctx context.Context, server models.ObaServer) checks.Result {
+	threshold := time.Duration(app.ConfigService.Config.RealtimeFrozenThreshold) * time.Second
+	if _, err := app.MetricsService.TrackRealtimeFreshness(server, threshold); err != nil {
+		return checks.Failed(fmt.Errorf("failed to track GTFS-RT feed freshness: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runVehicleCount(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.CheckVehicleCountMatch(ctx, server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to check vehicle count match metric: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runVehicleTelemetry(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.TrackVehicleTelemetry(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to track vehicle reporting frequency: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runVehiclePositions(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.TrackInvalidVehiclesAndStoppedOutOfBounds(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to count invalid vehicle coordinates: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runVehicleIntegrity(ctx context.Context, server models.ObaServer) checks.Result {
+	if _, err := app.MetricsService.ReportRealtimeIntegrity(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to report GTFS-RT vehicle integrity: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runVehicleTrips(ctx context.Context, server models.ObaServer) checks.Result {
+	if _, err := app.MetricsService.TrackVehicleTrips(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to match GTFS-RT vehicle trips: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runTripUpdatesFeed(ctx context.Context, server models.ObaServer) checks.Result {
+	if server.TripUpdateUrl == "" {
+		return checks.Skipped(nil, sentry.LevelDebug)
+	}
+	if err := app.GtfsService.FetchAndStoreTripUpdatesFeed(ctx, server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to fetch and store GTFS-RT trip updates feed: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runTripUpdates(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.TrackTripUpdates(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to track GTFS-RT trip updates: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runAlertsFeed(ctx context.Context, server models.ObaServer) checks.Result {
+	if server.AlertsUrl == "" {
+		return checks.Skipped(nil, sentry.LevelDebug)
+	}
+	if err := app.GtfsService.FetchAndStoreAlertsFeed(ctx, server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to fetch and store GTFS-RT service alerts feed: %w", err))
+	}
+	return checks.Passed()
+}
+
+func (app *Application) runServiceAlerts(ctx context.Context, server models.ObaServer) checks.Result {
+	if err := app.MetricsService.TrackServiceAlerts(server); err != nil {
+		return checks.Failed(fmt.Errorf("failed to track GTFS-RT service alerts: %w", err))
+	}
+	return checks.Passed()
+}
@@ -0,0 +1,250 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/metrics"
+	"watchdog.onebusaway.org/internal/models"
+	"watchdog.onebusaway.org/internal/report"
+)
+
+const (
+	// defaultCollectionWorkers is used when no positive worker count is configured.
+	defaultCollectionWorkers = 4
+	// defaultCollectionTimeout is used when no positive per-server timeout is configured.
+	defaultCollectionTimeout = 30 * time.Second
+)
+
+// collectFunc collects metrics for a single server.
+// It must honor ctx cancellation so that the per-server deadline is effective.
+type collectFunc func(ctx context.Context, server models.ObaServer)
+
+// collectionScheduler dispatches per-server metric collection onto a bounded worker pool.
+//
+// On every tick, each configured server is handed to the pool unless its previous run
+// is still in progress, in which case the tick is skipped for that server
+// (recorded in metrics.CollectionSkippedTicks). This guarantees that:
+//   - One slow OBA server never delays the collection of the other servers.
+//   - A server never has two overlapping collection runs.
+//   - At most `workers` servers are collected at the same time.
+//
+// Each run gets its own context deadline (`timeout`) and recovers from panics,
+// so a misbehaving server cannot hang or crash the whole collection loop.
+//
+// Runs are deliberately not canceled together with the application context: on shutdown,
+// no new run is started, but runs already in progress are given a chance to finish (see drain)
+// so that they do not leave partially updated metrics behind.
+type collectionScheduler struct {
+	collect  collectFunc
+	logger   *slog.Logger
+	interval time.Duration
+	timeout  time.Duration
+
+	slots chan struct{} // Semaphore bounding the number of concurrent runs
+
+	runs       context.Context    // Parent context of every run; outlives the application context
+	cancelRuns context.CancelFunc // Aborts in-flight runs once the drain timeout has passed
+
+	mu       sync.Mutex
+	inFlight map[int]chan struct{} // Server IDs whose run is queued or in progress (or held), closed once released
+	draining bool                  // Set by drain; no run is dispatched afterwards
+
+	wg sync.WaitGroup // Tracks every dispatched run; only added to under mu while not draining
+}
+
+// newCollectionScheduler creates a collectionScheduler with the given pool size and per-server timeout.
+// Non-positive values fall back to defaultCollectionWorkers and defaultCollectionTimeout.
+//
+// Runs inherit the values of ctx but not its cancellation; they are only aborted by their own
+// deadline or by drain.
+func newCollectionScheduler(ctx context.Context, collect collectFunc, logger *slog.Logger, interval time.Duration, workers int, timeout time.Duration) *collectionScheduler {
+	if workers <= 0 {
+		workers = defaultCollectionWorkers
+	}
+	if timeout <= 0 {
+		timeout = defaultCollectionTimeout
+	}
+	runs, cancelRuns := context.WithCancel(context.WithoutCancel(ctx))
+	return &collectionScheduler{
+		collect:    collect,
+		logger:     logger,
+		interval:   interval,
+		timeout:    timeout,
+		slots:      make(chan struct{}, workers),
+		runs:       runs,
+		cancelRuns: cancelRuns,
+		inFlight:   make(map[int]chan struct{}),
+	}
+}
+
+// dispatch runs one collection cycle for the given servers.
+//
+// Runs still waiting for a free worker slot are dropped once ctx is done,
+// so no new collection starts after the application begins shutting down.
+// Once drain has been called, nothing is dispatched at all.
+//
+// It returns immediately after handing the servers to the pool; a background
+// goroutine records the cycle duration once every dispatched run has finished,
+// and counts the cycle as an overrun if it took longer than the fetch interval.
+func (s *collectionScheduler) dispatch(ctx context.Context, servers []models.ObaServer) {
+	start := time.Now()
+	var cycle sync.WaitGroup
+
+	for _, server := range servers {
+		acquired, draining := s.tryAcquire(server.ID)
+		if draining {
+			s.logger.Info("Not dispatching metrics collection, scheduler is draining")
+			break
+		}
+		if !acquired {
+			s.logger.Warn("Skipping metrics collection tick, previous run still in progress", "server_id", server.ID, "server_name", server.Name)
+			metrics.Series.Counter(metrics.CollectionSkippedTicks, server.ID, strconv.Itoa(server.ID)).Inc()
+			continue
+		}
+
+		cycle.Add(1)
+		go func(server models.ObaServer) {
+			defer s.wg.Done()
+			defer cycle.Done()
+			defer s.release(server.ID)
+			s.run(ctx, server)
+		}(server)
+	}
+
+	go func() {
+		cycle.Wait()
+		duration := time.Since(start)
+		metrics.CollectionCycleDuration.Observe(duration.Seconds())
+		if s.interval > 0 && duration > s.interval {
+			metrics.CollectionCycleOverruns.Inc()
+			s.logger.Warn("Metrics collection cycle overran the fetch interval", "duration", duration, "interval", s.interval)
+		}
+	}()
+}
+
+// run waits for a free worker slot, then collects metrics for a single server
+// under its own deadline, recovering from any panic raised by the collection.
+func (s *collectionScheduler) run(ctx context.Context, server models.ObaServer) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	defer func() { <-s.slots }()
+
+	serverID := strconv.Itoa(server.ID)
+	start := time.Now()
+	defer func() {
+		metrics.Series.Observer(metrics.ServerCollectionDuration, server.ID, serverID).Observe(time.Since(start).Seconds())
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("panic while collecting metrics for server %d: %v", server.ID, r)
+			s.logger.Error("Recovered from panic during metrics collection", "server_id", server.ID, "error", err, "stack", string(debug.Stack()))
+			report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+				Tags: map[string]string{
+					"server_id":   serverID,
+					"server_name": server.Name,
+				},
+				Level: sentry.LevelFatal,
+			})
+			metrics.Series.Counter(metrics.CollectionPanics, server.ID, serverID).Inc()
+		}
+	}()
+
+	runCtx, cancel := context.WithTimeout(s.runs, s.timeout)
+	defer cancel()
+	s.collect(runCtx, server)
+}
+
+// tryAcquire marks the server as in flight and adds its run to s.wg.
+// It does not acquire the server if it already has a queued or running collection,
+// or if the scheduler is draining.
+//
+// The draining flag is checked under the same lock drain sets it with, so that s.wg is never
+// added to while drain is waiting on it.
+func (s *collectionScheduler) tryAcquire(serverID int) (acquired, draining bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return false, true
+	}
+	if _, ok := s.inFlight[serverID]; ok {
+		return false, false
+	}
+	s.inFlight[serverID] = make(chan struct{})
+	s.wg.Add(1)
+	return true, false
+}
+
+// release marks the server's collection as finished, or ends a hold.
+func (s *collectionScheduler) release(serverID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if done, ok := s.inFlight[serverID]; ok {
+		close(done)
+		delete(s.inFlight, serverID)
+	}
+}
+
+// hold waits for the server's queued or running collection, if any, to finish, then marks the
+// server as in flight so that no collection starts for it until release is called.
+// It is used to evict a server's state without a run writing it back behind the eviction.
+// It returns ctx.Err() if ctx is done before the server could be held.
+func (s *collectionScheduler) hold(ctx context.Context, serverID int) error {
+	for {
+		s.mu.Lock()
+		done, ok := s.inFlight[serverID]
+		if !ok {
+			s.inFlight[serverID] = make(chan struct{})
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// wait blocks until every dispatched run has finished.
+func (s *collectionScheduler) wait() {
+	s.wg.Wait()
+}
+
+// drain stops dispatching new runs and waits for in-flight runs to finish, or until ctx is done.
+//
+// If ctx is done first, the remaining runs are canceled and drain waits for them to return
+// (runs honor cancellation, so this is quick) before reporting ctx's error.
+func (s *collectionScheduler) drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancelRuns()
+		return nil
+	case <-ctx.Done():
+		s.cancelRuns()
+		<-done
+		return fmt.Errorf("in-flight metrics collections did not finish before the drain timeout: %w", ctx.Err())
+	}
+}
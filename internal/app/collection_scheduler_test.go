@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/metrics"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestCollectionScheduler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("Skips tick while previous run is in progress", func(t *testing.T) {
+		server := models.ObaServer{ID: 101, Name: "slow"}
+		release := make(chan struct{})
+		var calls atomic.Int32
+		collect := func(ctx context.Context, server models.ObaServer) {
+			calls.Add(1)
+			<-release
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 2, time.Minute)
+		skippedBefore := testutil.ToFloat64(metrics.CollectionSkippedTicks.WithLabelValues("101"))
+
+		scheduler.dispatch(context.Background(), []models.ObaServer{server})
+		waitFor(t, func() bool { return calls.Load() == 1 })
+		scheduler.dispatch(context.Background(), []models.ObaServer{server})
+
+		close(release)
+		scheduler.wait()
+
+		if got := calls.Load(); got != 1 {
+			t.Errorf("expected 1 collection run, got %d", got)
+		}
+		if got := testutil.ToFloat64(metrics.CollectionSkippedTicks.WithLabelValues("101")) - skippedBefore; got != 1 {
+			t.Errorf("expected 1 skipped tick, got %v", got)
+		}
+	})
+
+	t.Run("Bounds concurrent runs by worker count", func(t *testing.T) {
+		var mu sync.Mutex
+		running, peak := 0, 0
+		collect := func(ctx context.Context, server models.ObaServer) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 2, time.Minute)
+
+		servers := []models.ObaServer{{ID: 201}, {ID: 202}, {ID: 203}, {ID: 204}, {ID: 205}}
+		scheduler.dispatch(context.Background(), servers)
+		scheduler.wait()
+
+		if peak > 2 {
+			t.Errorf("expected at most 2 concurrent runs, got %d", peak)
+		}
+	})
+
+	t.Run("Applies per-server deadline", func(t *testing.T) {
+		var deadlineExceeded atomic.Bool
+		collect := func(ctx context.Context, server models.ObaServer) {
+			<-ctx.Done()
+			deadlineExceeded.Store(ctx.Err() == context.DeadlineExceeded)
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 1, 10*time.Millisecond)
+
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 301}})
+		scheduler.wait()
+
+		if !deadlineExceeded.Load() {
+			t.Error("expected the collection context to hit its deadline")
+		}
+	})
+
+	t.Run("Recovers from panic", func(t *testing.T) {
+		collect := func(ctx context.Context, server models.ObaServer) {
+			panic("boom")
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 1, time.Minute)
+		panicsBefore := testutil.ToFloat64(metrics.CollectionPanics.WithLabelValues("401"))
+
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 401}})
+		scheduler.wait()
+
+		if got := testutil.ToFloat64(metrics.CollectionPanics.WithLabelValues("401")) - panicsBefore; got != 1 {
+			t.Errorf("expected 1 recovered panic, got %v", got)
+		}
+		scheduler.mu.Lock()
+		_, inFlight := scheduler.inFlight[401]
+		scheduler.mu.Unlock()
+		if inFlight {
+			t.Error("expected server to be released after a panic")
+		}
+	})
+
+	t.Run("Drain lets in-flight runs finish after the application context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		var completed atomic.Bool
+		collect := func(runCtx context.Context, server models.ObaServer) {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			completed.Store(runCtx.Err() == nil)
+		}
+		scheduler := newCollectionScheduler(ctx, collect, logger, time.Second, 1, time.Minute)
+
+		scheduler.dispatch(ctx, []models.ObaServer{{ID: 501}})
+		<-started
+		cancel()
+
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Second)
+		defer drainCancel()
+		if err := scheduler.drain(drainCtx); err != nil {
+			t.Fatalf("expected drain to succeed, got %v", err)
+		}
+		if !completed.Load() {
+			t.Error("expected the in-flight run to complete without being canceled")
+		}
+	})
+
+	t.Run("Hold waits for the in-flight run and blocks new ones until released", func(t *testing.T) {
+		started := make(chan struct{})
+		finish := make(chan struct{})
+		var calls atomic.Int32
+		collect := func(ctx context.Context, server models.ObaServer) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-finish
+			}
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 1, time.Minute)
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 801}})
+		<-started
+
+		held := make(chan error)
+		go func() { held <- scheduler.hold(context.Background(), 801) }()
+		select {
+		case <-held:
+			t.Fatal("expected hold to wait for the in-flight run")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(finish)
+		if err := <-held; err != nil {
+			t.Fatalf("expected hold to succeed, got %v", err)
+		}
+
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 801}})
+		scheduler.wait()
+		if got := calls.Load(); got != 1 {
+			t.Errorf("expected no run while the server is held, got %d runs", got)
+		}
+
+		scheduler.release(801)
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 801}})
+		scheduler.wait()
+		if got := calls.Load(); got != 2 {
+			t.Errorf("expected a run once the server is released, got %d runs", got)
+		}
+	})
+
+	t.Run("Nothing is dispatched once draining", func(t *testing.T) {
+		var calls atomic.Int32
+		collect := func(ctx context.Context, server models.ObaServer) {
+			calls.Add(1)
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 1, time.Minute)
+		if err := scheduler.drain(context.Background()); err != nil {
+			t.Fatalf("expected drain to succeed, got %v", err)
+		}
+
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 701}})
+		scheduler.wait()
+
+		if got := calls.Load(); got != 0 {
+			t.Errorf("expected no run after drain, got %d", got)
+		}
+	})
+
+	t.Run("Drain cancels runs after the drain timeout", func(t *testing.T) {
+		collect := func(runCtx context.Context, server models.ObaServer) {
+			<-runCtx.Done()
+		}
+		scheduler := newCollectionScheduler(context.Background(), collect, logger, time.Second, 1, time.Minute)
+		scheduler.dispatch(context.Background(), []models.ObaServer{{ID: 601}})
+
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer drainCancel()
+		if err := scheduler.drain(drainCtx); err == nil {
+			t.Error("expected drain to report the timeout, got nil")
+		}
+	})
+}
+
+// waitFor polls cond until it returns true or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
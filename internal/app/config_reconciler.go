@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+
+	"watchdog.onebusaway.org/internal/metrics"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// bundleBootstrapRetries is the maximum number of retries used when downloading the GTFS bundle
+// of a server added to (or changed in) the configuration at runtime.
+const bundleBootstrapRetries = 5
+
+// ReconcileConfigChanges keeps the application's per-server state in sync with the configuration.
+//
+// It subscribes to configuration updates (e.g. from ConfigService.RefreshConfig) and, on every
+// update, compares the configured servers with the ones the application already knows about:
+//   - Added servers are bootstrapped right away: their GTFS static bundle is downloaded and their
+//     bounding box computed, instead of waiting for a restart.
+//   - Servers whose `gtfs_url` changed have their previous bundle evicted and the new one downloaded.
+//   - Removed servers are evicted from every store (StaticStore, RealtimeStore, TripUpdatesStore, AlertsStore, BoundingBoxStore,
+//     Changelog, bundle cache, VehicleLastSeen, BackoffStore) and from the check runner, and every Prometheus series
+//     written for them is deleted, once their collection run in progress, if any, has finished.
+//
+// Parameters:
+//   - ctx: Context used to stop the routine and cancel in-progress downloads.
+//   - servers: The servers whose state was set up at startup (typically the ones passed to DownloadGTFSBundles).
+//
+// Bundle downloads happen synchronously within the routine, so that a server removed while its
+// bundle is still downloading is evicted only after the download completed, never before.
+// The routine blocks until ctx is canceled and is meant to be started in its own goroutine.
+func (app *Application) ReconcileConfigChanges(ctx context.Context, servers []models.ObaServer) {
+	known := make(map[int]models.ObaServer, len(servers))
+	for _, server := range servers {
+		known[server.ID] = server
+	}
+
+	updates := app.ConfigService.Config.Subscribe()
+
+	// The configuration may have changed between startup and the subscription above.
+	known = app.reconcileServers(ctx, known, app.ConfigService.Config.GetServers())
+
+	for {
+		select {
+		case <-ctx.Done():
+			app.Logger.Info("Stopping config reconciler routine")
+			return
+		case <-updates:
+			known = app.reconcileServers(ctx, known, app.ConfigService.Config.GetServers())
+		}
+	}
+}
+
+// reconcileServers applies the difference between the known servers and the current configuration,
+// and returns the new set of known servers, indexed by server ID.
+func (app *Application) reconcileServers(ctx context.Context, known map[int]models.ObaServer, current []models.ObaServer) map[int]models.ObaServer {
+	next := make(map[int]models.ObaServer, len(current))
+	var toDownload []models.ObaServer
+
+	for _, server := range current {
+		next[server.ID] = server
+
+		previous, exists := known[server.ID]
+		switch {
+		case !exists:
+			app.Logger.Info("Bootstrapping server added to the configuration", "server_id", server.ID, "server_name", server.Name)
+			toDownload = append(toDownload, server)
+		case previous.GtfsUrl != server.GtfsUrl:
+			app.Logger.Info("GTFS URL changed, re-downloading bundle", "server_id", server.ID, "old_gtfs_url", previous.GtfsUrl, "new_gtfs_url", server.GtfsUrl)
+			// Drop the previous bundle first, so that checks never compare the new feeds
+			// against a bundle that belongs to another GTFS URL.
+			// The changelog and cached bundle are dropped too: a bundle from another URL is not a new version of the previous one.
+			app.GtfsService.StaticStore.Delete(server.ID)
+			app.GtfsService.BoundingBoxStore.Delete(server.ID)
+			app.GtfsService.Changelog.Delete(server.ID)
+			app.deleteCachedBundle(server.ID)
+			toDownload = append(toDownload, server)
+		}
+	}
+
+	for id, server := range known {
+		if _, exists := next[id]; !exists {
+			app.Logger.Info("Evicting server removed from the configuration", "server_id", id, "server_name", server.Name)
+			app.evictServer(ctx, id)
+		}
+	}
+
+	if len(toDownload) > 0 {
+		app.GtfsService.DownloadGTFSBundles(ctx, toDownload, bundleBootstrapRetries)
+	}
+	return next
+}
+
+// evictServer removes every piece of state the application keeps for a server.
+//
+// A collection run of the server still in progress would write its state and metrics back after
+// the eviction, so eviction first waits for it and holds the server in the collection scheduler
+// until done. If ctx is done while waiting (the application is shutting down), nothing is evicted.
+func (app *Application) evictServer(ctx context.Context, serverID int) {
+	if app.collector != nil {
+		if err := app.collector.hold(ctx, serverID); err != nil {
+			app.Logger.Warn("Gave up evicting server, its metrics collection is still in progress", "server_id", serverID, "error", err)
+			return
+		}
+		defer app.collector.release(serverID)
+	}
+
+	app.GtfsService.StaticStore.Delete(serverID)
+	app.GtfsService.RealtimeStore.Delete(serverID)
+	app.GtfsService.TripUpdatesStore.Delete(serverID)
+	app.GtfsService.AlertsStore.Delete(serverID)
+	app.GtfsService.BoundingBoxStore.Delete(serverID)
+	app.GtfsService.Changelog.Delete(serverID)
+	app.deleteCachedBundle(serverID)
+	app.MetricsService.VehicleLastSeen.DeleteServer(serverID)
+	app.ConfigService.BackoffStore.ResetBackoff(serverID)
+	app.checkRunner.Forget(serverID)
+	metrics.Series.DeleteServer(serverID)
+}
+
+// deleteCachedBundle removes the bundle cached on disk for a server.
+// A failure is only logged: a stale cached bundle is never loaded for another GTFS URL.
+func (app *Application) deleteCachedBundle(serverID int) {
+	if err := app.GtfsService.Cache.Delete(serverID); err != nil {
+		app.Logger.Warn("Failed to delete cached GTFS bundle", "server_id", serverID, "error", err)
+	}
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"watchdog.onebusaway.org/internal/metrics"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestReconcileServers(t *testing.T) {
+	gtfsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "../../testdata/gtfs.zip")
+	}))
+	defer gtfsServer.Close()
+
+	ctx := context.Background()
+
+	t.Run("Bootstraps added servers", func(t *testing.T) {
+		app := newTestApplication(t)
+		existing := app.ConfigService.Config.Servers[0]
+		added := models.ObaServer{ID: 2, Name: "Added", GtfsUrl: gtfsServer.URL + "/gtfs.zip"}
+
+		known := app.reconcileServers(ctx, map[int]models.ObaServer{existing.ID: existing}, []models.ObaServer{existing, added})
+
+		if _, ok := known[added.ID]; !ok {
+			t.Fatal("expected added server to be known after reconciliation")
+		}
+		if _, ok := app.GtfsService.StaticStore.Get(added.ID); !ok {
+			t.Error("expected static bundle of added server to be downloaded")
+		}
+		if _, ok := app.GtfsService.BoundingBoxStore.Get(added.ID); !ok {
+			t.Error("expected bounding box of added server to be computed")
+		}
+	})
+
+	t.Run("Re-downloads bundle when GTFS URL changes", func(t *testing.T) {
+		app := newTestApplication(t)
+		previous := app.ConfigService.Config.Servers[0]
+		previous.GtfsUrl = "http://old.example.com/gtfs.zip"
+		oldBundle, _ := app.GtfsService.StaticStore.Get(previous.ID)
+		changed := previous
+		changed.GtfsUrl = gtfsServer.URL + "/gtfs.zip"
+
+		app.reconcileServers(ctx, map[int]models.ObaServer{previous.ID: previous}, []models.ObaServer{changed})
+
+		newBundle, ok := app.GtfsService.StaticStore.Get(changed.ID)
+		if !ok {
+			t.Fatal("expected static bundle to be re-downloaded")
+		}
+		if newBundle == oldBundle {
+			t.Error("expected static bundle to be replaced")
+		}
+	})
+
+	t.Run("Evicts removed servers from every store", func(t *testing.T) {
+		app := newTestApplication(t)
+		removed := app.ConfigService.Config.Servers[0]
+		app.MetricsService.VehicleLastSeen.Set(removed.ID, "vehicle-1", metrics.LastSeen{Time: time.Now()})
+		app.ConfigService.BackoffStore.UpdateBackoff(removed.ID)
+
+		known := app.reconcileServers(ctx, map[int]models.ObaServer{removed.ID: removed}, nil)
+
+		if len(known) != 0 {
+			t.Errorf("expected no known servers, got %d", len(known))
+		}
+		if _, ok := app.GtfsService.StaticStore.Get(removed.ID); ok {
+			t.Error("expected static bundle to be evicted")
+		}
+		if _, ok := app.GtfsService.RealtimeStore.Get(removed.ID); ok {
+			t.Error("expected GTFS-RT snapshot to be evicted")
+		}
+		if _, ok := app.GtfsService.BoundingBoxStore.Get(removed.ID); ok {
+			t.Error("expected bounding box to be evicted")
+		}
+		if app.MetricsService.VehicleLastSeen.Count(removed.ID) != 0 {
+			t.Error("expected tracked vehicles to be evicted")
+		}
+		if _, ok := app.ConfigService.BackoffStore.NextRetryAt(removed.ID); ok {
+			t.Error("expected backoff state to be evicted")
+		}
+	})
+
+	t.Run("Waits for the removed server's collection run before evicting it", func(t *testing.T) {
+		app := newTestApplication(t)
+		removed := app.ConfigService.Config.Servers[0]
+		started := make(chan struct{})
+		finish := make(chan struct{})
+		collect := func(ctx context.Context, server models.ObaServer) {
+			close(started)
+			<-finish
+		}
+		app.collector = newCollectionScheduler(ctx, collect, app.Logger, time.Second, 1, time.Minute)
+		app.collector.dispatch(ctx, []models.ObaServer{removed})
+		<-started
+
+		evicted := make(chan struct{})
+		go func() {
+			app.reconcileServers(ctx, map[int]models.ObaServer{removed.ID: removed}, nil)
+			close(evicted)
+		}()
+		select {
+		case <-evicted:
+			t.Fatal("expected eviction to wait for the in-flight collection run")
+		case <-time.After(20 * time.Millisecond):
+		}
+		if _, ok := app.GtfsService.StaticStore.Get(removed.ID); !ok {
+			t.Error("expected static bundle to be kept while the collection run is in progress")
+		}
+
+		close(finish)
+		<-evicted
+		if _, ok := app.GtfsService.StaticStore.Get(removed.ID); ok {
+			t.Error("expected static bundle to be evicted once the collection run finished")
+		}
+	})
+}
+
+func TestReconcileConfigChanges(t *testing.T) {
+	app := newTestApplication(t)
+	cfg := app.ConfigService.Config
+	server := cfg.Servers[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.ReconcileConfigChanges(ctx, []models.ObaServer{server})
+
+	cfg.UpdateConfig(nil)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := app.GtfsService.StaticStore.Get(server.ID); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected removed server to be evicted after a config update")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
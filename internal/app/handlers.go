@@ -3,6 +3,11 @@ package app
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"watchdog.onebusaway.org/internal/models"
 )
 
 // HealthStatus defines the structure of the JSON response returned by the
@@ -59,3 +64,146 @@ func (app *Application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.Logger.Warn("failed to write healthcheck response", "error", err)
 	}
 }
+
+// BundleValidationResponse defines the structure of the JSON response returned by the
+// bundle validation endpoint (/v1/servers/:id/bundle/validation).
+//
+// Fields:
+//   - ServerID: The ID of the server the bundle belongs to.
+//   - SHA256: The hash of the validated bundle file, to tell bundle versions apart.
+//   - TotalErrors: The number of referential-integrity errors, all rules included.
+//   - Report: The validation report: the error count of every rule and a sample of the errors.
+type BundleValidationResponse struct {
+	ServerID    int                      `json:"server_id"`
+	SHA256      string                   `json:"sha256,omitempty"`
+	TotalErrors int                      `json:"total_errors"`
+	Report      *models.ValidationReport `json:"report"`
+}
+
+// bundleValidationHandler responds with the referential-integrity report of the GTFS static
+// bundle currently stored for a server (see gtfs.validateBundle).
+//
+// It responds with HTTP 404 Not Found if the server is not configured, or if no validated
+// bundle is stored for it yet (e.g. while its first download is in progress).
+func (app *Application) bundleValidationHandler(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := app.configuredServerID(w, r)
+	if !ok {
+		return
+	}
+
+	staticData, ok := app.GtfsService.StaticStore.Get(serverID)
+	if !ok || staticData == nil || staticData.Validation == nil {
+		app.writeJSONError(w, http.StatusNotFound, "no validated GTFS bundle for this server")
+		return
+	}
+
+	response := BundleValidationResponse{
+		ServerID:    serverID,
+		SHA256:      staticData.Bundle.SHA256,
+		TotalErrors: staticData.Validation.TotalErrors(),
+		Report:      staticData.Validation,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Warn("failed to write bundle validation response", "error", err)
+	}
+}
+
+// BundleChangelogResponse defines the structure of the JSON response returned by the
+// bundle changelog endpoint (/v1/servers/:id/bundle/changes).
+//
+// Fields:
+//   - ServerID: The ID of the server the bundles belong to.
+//   - Changes: The diffs between consecutive bundles of the server, most recent first.
+type BundleChangelogResponse struct {
+	ServerID int                 `json:"server_id"`
+	Changes  []models.BundleDiff `json:"changes"`
+}
+
+// bundleChangelogHandler responds with the diffs between the consecutive GTFS static bundles
+// of a server (see gtfs.BundleChangelog). Servers whose bundle was never replaced have no changes.
+//
+// It responds with HTTP 404 Not Found if the server is not configured.
+func (app *Application) bundleChangelogHandler(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := app.configuredServerID(w, r)
+	if !ok {
+		return
+	}
+
+	response := BundleChangelogResponse{
+		ServerID: serverID,
+		Changes:  app.GtfsService.Changelog.Get(serverID),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Warn("failed to write bundle changelog response", "error", err)
+	}
+}
+
+// RealtimeIntegrityResponse defines the structure of the JSON response returned by the
+// realtime integrity endpoint (/v1/servers/:id/realtime/integrity).
+//
+// Fields:
+//   - ServerID: The ID of the server the feed belongs to.
+//   - FetchedAt: When the GTFS-RT vehicle positions snapshot was fetched.
+//   - Report: The duplicate vehicle IDs and the trips claimed by several vehicles in the snapshot.
+type RealtimeIntegrityResponse struct {
+	ServerID  int                             `json:"server_id"`
+	FetchedAt time.Time                       `json:"fetched_at"`
+	Report    *models.RealtimeIntegrityReport `json:"report"`
+}
+
+// realtimeIntegrityHandler responds with the duplicate vehicle IDs and the trips claimed by
+// several vehicles in the latest GTFS-RT vehicle positions snapshot of a server
+// (see gtfs.RealtimeSnapshot.Integrity).
+//
+// It responds with HTTP 404 Not Found if the server is not configured, or if no snapshot is
+// stored for it yet.
+func (app *Application) realtimeIntegrityHandler(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := app.configuredServerID(w, r)
+	if !ok {
+		return
+	}
+
+	snapshot, ok := app.GtfsService.RealtimeStore.Get(serverID)
+	if !ok || snapshot == nil || snapshot.Integrity == nil {
+		app.writeJSONError(w, http.StatusNotFound, "no GTFS-RT vehicle positions for this server")
+		return
+	}
+
+	response := RealtimeIntegrityResponse{
+		ServerID:  serverID,
+		FetchedAt: snapshot.FetchedAt,
+		Report:    snapshot.Integrity,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Warn("failed to write realtime integrity response", "error", err)
+	}
+}
+
+// configuredServerID returns the server ID of the `id` route parameter. If it is not the ID of
+// a configured server, it responds with HTTP 404 Not Found and returns false.
+func (app *Application) configuredServerID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	serverID, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		app.writeJSONError(w, http.StatusNotFound, "invalid server ID")
+		return 0, false
+	}
+	for _, server := range app.ConfigService.Config.GetServers() {
+		if server.ID == serverID {
+			return serverID, true
+		}
+	}
+	app.writeJSONError(w, http.StatusNotFound, "server not found")
+	return 0, false
+}
+
+// writeJSONError responds with the given status code and a JSON body of the form {"error": message}.
+func (app *Application) writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": message}); err != nil {
+		app.Logger.Warn("failed to write error response", "error", err)
+	}
+}
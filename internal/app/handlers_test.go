@@ -1,13 +1,16 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"watchdog.onebusaway.org/internal/config"
+	"watchdog.onebusaway.org/internal/gtfs"
 	"watchdog.onebusaway.org/internal/models"
 )
 
@@ -113,3 +116,143 @@ func TestHealthcheckHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestBundleValidationHandler(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.Routes(context.Background())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(rr, request)
+		return rr
+	}
+
+	t.Run("returns 404 before the bundle is validated", func(t *testing.T) {
+		if rr := get("/v1/servers/1/bundle/validation"); rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("returns 404 for unknown servers", func(t *testing.T) {
+		for _, path := range []string{"/v1/servers/42/bundle/validation", "/v1/servers/abc/bundle/validation"} {
+			if rr := get(path); rr.Code != http.StatusNotFound {
+				t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, rr.Code)
+			}
+		}
+	})
+
+	t.Run("returns the validation report", func(t *testing.T) {
+		staticData, _ := app.GtfsService.StaticStore.Get(1)
+		validated := *staticData
+		validated.Bundle.SHA256 = "abc"
+		validated.Validation = &models.ValidationReport{
+			ValidatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			Counts:      map[string]int{"trip_unknown_route": 2},
+			Issues: []models.ValidationIssue{
+				{Rule: "trip_unknown_route", File: "trips.txt", Line: 3, EntityID: "T1", Reference: "R9"},
+			},
+		}
+		app.GtfsService.StaticStore.Set(1, &validated)
+
+		rr := get("/v1/servers/1/bundle/validation")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var resp BundleValidationResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.ServerID != 1 || resp.SHA256 != "abc" || resp.TotalErrors != 2 {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+		if resp.Report == nil || len(resp.Report.Issues) != 1 || resp.Report.Issues[0].Reference != "R9" {
+			t.Errorf("unexpected report: %+v", resp.Report)
+		}
+	})
+}
+
+func TestBundleChangelogHandler(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.Routes(context.Background())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(rr, request)
+		return rr
+	}
+
+	if rr := get("/v1/servers/42/bundle/changes"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown server, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	app.GtfsService.Changelog.Record(1, models.BundleDiff{SHA256: "first"})
+	app.GtfsService.Changelog.Record(1, models.BundleDiff{SHA256: "second"})
+
+	rr := get("/v1/servers/1/bundle/changes")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp BundleChangelogResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.ServerID != 1 || len(resp.Changes) != 2 || resp.Changes[0].SHA256 != "second" {
+		t.Errorf("expected the 2 changes of server 1, most recent first, got %+v", resp)
+	}
+}
+
+func TestRealtimeIntegrityHandler(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.Routes(context.Background())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.ServeHTTP(rr, request)
+		return rr
+	}
+
+	if rr := get("/v1/servers/42/realtime/integrity"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown server, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	app.GtfsService.RealtimeStore.Delete(1)
+	if rr := get("/v1/servers/1/realtime/integrity"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without a GTFS-RT snapshot, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	app.GtfsService.RealtimeStore.Set(1, &gtfs.RealtimeSnapshot{
+		Data:      &models.RealtimeData{},
+		FetchedAt: time.Now().UTC(),
+		Integrity: &models.RealtimeIntegrityReport{
+			DuplicateVehicles: []models.DuplicateVehicle{{VehicleID: "bus-1", Count: 2}},
+			SharedTrips:       []models.SharedTrip{{TripID: "trip-1", StartDate: "20250310", VehicleIDs: []string{"bus-2", "bus-3"}}},
+		},
+	})
+
+	rr := get("/v1/servers/1/realtime/integrity")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp RealtimeIntegrityResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.ServerID != 1 || resp.Report == nil || len(resp.Report.DuplicateVehicles) != 1 || len(resp.Report.SharedTrips) != 1 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if shared := resp.Report.SharedTrips[0]; shared.TripID != "trip-1" || len(shared.VehicleIDs) != 2 {
+		t.Errorf("unexpected shared trip: %+v", shared)
+	}
+}
@@ -2,12 +2,9 @@ package app
 
 import (
 	"context"
-	"fmt"
 	"time"
 
-	"github.com/getsentry/sentry-go"
 	"watchdog.onebusaway.org/internal/models"
-	"watchdog.onebusaway.org/internal/report"
 )
 
 // StartMetricsCollection begins a background goroutine that continuously collects metrics
@@ -17,8 +14,16 @@ import (
 // The ticker triggers every `FetchInterval` seconds, allowing the application to periodically
 // collect and update metrics related to OBA servers listed in the config.
 //
-// The collection routine gracefully shuts down when the provided context is canceled,
-// allowing the application to cleanly exit or restart.
+// Servers are collected concurrently by a collectionScheduler:
+//   - At most `CollectionWorkers` servers are collected at the same time ("collection-workers" flag).
+//   - Each server run gets its own deadline of `CollectionTimeout` seconds ("collection-timeout" flag)
+//     and recovers from panics, so one slow or failing server never delays the others.
+//   - If a server's previous run is still in progress when the ticker fires, that tick is skipped
+//     for the server instead of starting an overlapping run.
+//
+// The collection routine stops ticking when the provided context is canceled; runs already
+// in progress keep going until Shutdown drains them, allowing the application to cleanly exit
+// or restart without leaving partially collected metrics.
 //
 // This function is the central entry point for periodic monitoring of external systems
 // like GTFS static bundles, real-time GTFS-RT feeds, and OBA APIs.
@@ -32,8 +37,18 @@ import (
 //   - If no servers are configured, the function silently waits and retries on next tick.
 //   - On shutdown (context canceled), it logs the stop and exits the goroutine cleanly.
 func (app *Application) StartMetricsCollection(ctx context.Context) {
-
-	ticker := time.NewTicker(time.Duration(app.ConfigService.Config.FetchInterval) * time.Second)
+	cfg := app.ConfigService.Config
+	interval := time.Duration(cfg.FetchInterval) * time.Second
+	app.collector = newCollectionScheduler(
+		ctx,
+		app.CollectMetricsForServer,
+		app.Logger,
+		interval,
+		cfg.CollectionWorkers,
+		time.Duration(cfg.CollectionTimeout)*time.Second,
+	)
+
+	ticker := time.NewTicker(interval)
 	go func() {
 		defer ticker.Stop()
 		for {
@@ -42,194 +57,42 @@ func (app *Application) StartMetricsCollection(ctx context.Context) {
 				app.Logger.Info("Stopping metrics collection routine")
 				return
 			case <-ticker.C:
-
-				servers := app.ConfigService.Config.GetServers()
-
-				for _, server := range servers {
-					app.CollectMetricsForServer(server)
-				}
+				app.collector.dispatch(ctx, cfg.GetServers())
 			}
 		}
 	}()
 }
 
-// CollectMetricsForServer performs all metric collection and validation logic for a single OBA server.
+// Shutdown waits for the metrics collections still in progress to finish.
 //
-// It sequentially runs a series of probes and validations against the given server:
-//  1. Pings the server to track basic availability.
-//  2. Checks GTFS static bundle expiration.
-//  3. Verifies agency coverage match (GTFS static vs real-time).
-//  4. Collects metrics from the OBA API endpoints.
-//  5. Fetches and stores GTFS-RT (realtime) vehicle positions feed.
-//  6. Validates consistency between expected and actual vehicle counts.
-//  7. Tracks frequency of vehicle telemetry reporting over time.
-//  8. Flags invalid vehicles and vehicles stopped outside bounds.
-//
-// Errors in each step are logged and reported to Sentry with contextual tags (e.g., server name, ID),
-// but the process continues unless the GTFS-RT feed fails — in which case the function returns early,
-// as later checks depend on the real-time data.
-//
-// Exponential Backoff:
-//
-//	Unlike typical blocking backoff (e.g., retry loops with time.Sleep), this function uses a
-//	per-server backoff map (BackoffStore). Each server has a backoff delay and a calculated
-//	nextRetryAt timestamp. Before attempting a ping, the function checks whether the current time
-//	is still before nextRetryAt; if so, the entire metrics collection for that server is skipped.
+// It is meant to be called after the context passed to StartMetricsCollection has been canceled;
+// ticks firing while it drains dispatch nothing. If ctx is done before every collection
+// finished, the remaining collections are canceled and an error is returned.
+// It is a no-op if StartMetricsCollection was never called.
+func (app *Application) Shutdown(ctx context.Context) error {
+	if app.collector == nil {
+		return nil
+	}
+	return app.collector.drain(ctx)
+}
+
+// CollectMetricsForServer performs all metric collection and validation logic for a single OBA server.
 //
-//	When a server fails, its backoff delay is increased exponentially and nextRetryAt is updated.
-//	When a server responds successfully, its backoff state is reset.
+// It runs the checks of the application's check registry against the server, except those
+// disabled in its configuration or whose interval has not elapsed since their last run.
+// The checks, their dependencies and intervals are listed in newCheckRegistry.
 //
-// Why this design?
+// Ordering, skipping checks whose dependencies did not pass (e.g. every vehicle check
+// when the GTFS-RT feed could not be fetched), and logging/reporting errors to Sentry
+// with contextual tags (server name, ID, check name) are handled by the checks.Runner.
 //
-//	  The StartMetricsCollection scheduler runs every `FetchInterval` (default: 30 seconds) for each server.
-//		If we used a standard blocking backoff inside CollectMetricsForServer, the backoff delay could exceed
-//	  30 seconds, causing overlapping goroutines (multiple retries running concurrently for the same
-//	  server). By storing backoff state per server and checking it on each scheduled run, we ensure:
-//	    - No overlapping goroutines per server.
-//	    - Retry intervals still grow exponentially.
-//	    - Retries align with the FetchInterval collection cycle, meaning the effective backoff wait time
-//	 			is always a multiple of FetchInterval.
-//	  This keeps retries predictable, efficient, and non-blocking across all monitored servers.
+// The provided context carries the per-server deadline set by the collection scheduler.
+// Once it is done, the remaining checks are skipped and the run ends early.
 //
 // Purpose:
 //   - Centralizes all server-level metric gathering for reusability and testability.
 //   - Ensures that all health and performance indicators are collected in one place.
 //   - Enables observability and alerting based on up-to-date, per-server insights.
-//
-// Design considerations:
-//   - Each metric function is isolated and logs its own errors to avoid full failure on one fault.
-//   - Sentry reports are tagged for fast debugging and correlation in distributed systems.
-//   - Dependencies are injected (via app fields) to support testability and separation of concerns.
-func (app *Application) CollectMetricsForServer(server models.ObaServer) {
-	// Check if server has an active backoff period
-	nextRetryAt, exists := app.ConfigService.BackoffStore.NextRetryAt(server.ID)
-	if exists && time.Now().UTC().Before(nextRetryAt) {
-		// Still in backoff → skip metrics collection
-		app.Logger.Info("Skipping metrics collection for server due to backoff", "server_id", server.ID, "next_retry_at", nextRetryAt)
-		report.ReportErrorWithSentryOptions(fmt.Errorf("skipping metrics collection for server %s due to backoff", server.ObaBaseURL), report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			ExtraContext: map[string]interface{}{
-				"oba_base_url": server.ObaBaseURL,
-			},
-			Level: sentry.LevelInfo,
-		})
-		return
-	}
-
-	ok := app.MetricsService.ServerPing(server)
-	if !ok {
-		// On ping failure → increase backoff for this server
-		app.Logger.Error("Server ping failed", "server_id", server.ID, "server_name", server.Name)
-		report.ReportErrorWithSentryOptions(fmt.Errorf("server ping failed for %s", server.ObaBaseURL), report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			ExtraContext: map[string]interface{}{
-				"oba_base_url": server.ObaBaseURL,
-			},
-			Level: sentry.LevelError,
-		})
-		app.ConfigService.BackoffStore.UpdateBackoff(server.ID)
-		app.Logger.Info("Skipping further metrics collection for server due to ping failure")
-		return
-	}
-
-	// On successful ping → reset backoff for this server
-	app.Logger.Info("Server ping successful", "server_id", server.ID, "server_name", server.Name)
-	app.ConfigService.BackoffStore.ResetBackoff(server.ID)
-
-	_, _, err := app.MetricsService.CheckBundleExpiration(time.Now().UTC(), server)
-	if err != nil {
-		app.Logger.Error("Failed to check GTFS bundle expiration", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			Level: sentry.LevelError,
-		})
-	}
-
-	err = app.MetricsService.CheckAgenciesWithCoverageMatch(server)
-
-	if err != nil {
-		app.Logger.Error("Failed to check agencies with coverage match metric", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			Level: sentry.LevelError,
-		})
-	}
-
-	err = app.MetricsService.FetchObaAPIMetrics(server.AgencyID, server.ID, server.ObaBaseURL, server.ObaApiKey)
-
-	if err != nil {
-		app.Logger.Error("Failed to fetch OBA API metrics", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			ExtraContext: map[string]interface{}{
-				"oba_base_url": server.ObaBaseURL,
-			},
-			Level: sentry.LevelError,
-		})
-	}
-	// Fetch and store GTFS-RT feed
-	// Note : All functions after FetchAndStoreGTFSRTFeed depend on this function
-	// on failure of this function we return and don't proceed
-	err = app.GtfsService.FetchAndStoreGTFSRTFeed(server)
-	if err != nil {
-		app.Logger.Error("Failed to fetch and store GTFS-RT feed", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			Level: sentry.LevelError,
-		})
-		return
-	}
-
-	err = app.MetricsService.CheckVehicleCountMatch(server)
-	if err != nil {
-		app.Logger.Error("Failed to check vehicle count match metric", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id":   fmt.Sprintf("%d", server.ID),
-				"server_name": server.Name,
-			},
-			Level: sentry.LevelError,
-		})
-	}
-
-	err = app.MetricsService.TrackVehicleTelemetry(server)
-	if err != nil {
-		app.Logger.Error("Failed to track vehicle reporting frequency", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id": fmt.Sprintf("%d", server.ID),
-			},
-			Level: sentry.LevelError,
-		})
-	}
-
-	err = app.MetricsService.TrackInvalidVehiclesAndStoppedOutOfBounds(server)
-	if err != nil {
-		app.Logger.Error("Failed to count invalid vehicle coordinates", "error", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: map[string]string{
-				"server_id": fmt.Sprintf("%d", server.ID),
-			},
-			Level: sentry.LevelError,
-		})
-	}
-
+func (app *Application) CollectMetricsForServer(ctx context.Context, server models.ObaServer) {
+	app.checkRunner.Run(ctx, server)
 }
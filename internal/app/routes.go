@@ -23,6 +23,16 @@ import (
 //   - GET /v1/healthcheck:
 //     Provides a JSON-formatted snapshot of the application's current health and readiness status.
 //     Handled by `app.healthcheckHandler`.
+//   - GET /v1/servers/:id/bundle/validation:
+//     Provides the referential-integrity report of the GTFS static bundle of a server.
+//     Handled by `app.bundleValidationHandler`.
+//   - GET /v1/servers/:id/bundle/changes:
+//     Provides the diffs between the consecutive GTFS static bundles of a server, most recent first.
+//     Handled by `app.bundleChangelogHandler`.
+//   - GET /v1/servers/:id/realtime/integrity:
+//     Provides the duplicate vehicle IDs and the trips claimed by several vehicles in the latest
+//     GTFS-RT vehicle positions snapshot of a server.
+//     Handled by `app.realtimeIntegrityHandler`.
 //   - GET /metrics:
 //     Exposes all Prometheus metrics collected by the application for scraping by Prometheus.
 //     Handled by a cached Prometheus handler (`middleware.NewCachedPromHandler`), which
@@ -54,6 +64,9 @@ func (app *Application) Routes(ctx context.Context) http.Handler {
 	// http.MethodPost are constants which equate to the strings "GET" and "POST"
 	// respectively.
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/servers/:id/bundle/validation", app.bundleValidationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/servers/:id/bundle/changes", app.bundleChangelogHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/servers/:id/realtime/integrity", app.realtimeIntegrityHandler)
 	router.Handler(http.MethodGet, "/metrics", middleware.NewCachedPromHandler(ctx, prometheus.DefaultGatherer, 10*time.Second))
 
 	// Wrap router with Sentry and SecurityHeaders middlewares
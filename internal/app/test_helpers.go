@@ -9,6 +9,7 @@ import (
 
 	remoteGtfs "github.com/OneBusAway/go-gtfs"
 	"github.com/prometheus/client_golang/prometheus"
+	"watchdog.onebusaway.org/internal/checks"
 	"watchdog.onebusaway.org/internal/config"
 	"watchdog.onebusaway.org/internal/geo"
 	"watchdog.onebusaway.org/internal/gtfs"
@@ -83,18 +84,28 @@ func newTestApplication(t *testing.T) *Application {
 		t.Fatal("Parsed GTFS-RT data is nil")
 	}
 	realtimeData := models.NewRealtimeData(gtfsRT)
-	realtimeStore := gtfs.NewRealtimeStore()
-	realtimeStore.Set(realtimeData)
-
+	realtimeStore := gtfs.NewRealtimeStore(time.Minute)
+	realtimeStore.Set(obaServer.ID, &gtfs.RealtimeSnapshot{
+		Data:          realtimeData,
+		FetchedAt:     time.Now().UTC(),
+		FeedTimestamp: gtfsRT.CreatedAt,
+		PayloadSize:   len(data),
+		SourceURL:     realtimeDataPath,
+	})
+
+	tripUpdatesStore := gtfs.NewRealtimeStore(time.Minute)
+	alertsStore := gtfs.NewRealtimeStore(time.Minute)
 	vehicleLastSeen := metrics.NewVehicleLastSeen()
 	backoffStore := config.NewBackoffStore()
-	return &Application{
+	app := &Application{
 		ConfigService:  config.NewConfigService(logger, client, cfg, backoffStore),
-		GtfsService:    gtfs.NewGtfsService(staticStore, realtimeStore, boundingBoxStore, logger, client),
-		MetricsService: metrics.NewMetricsService(staticStore, realtimeStore, boundingBoxStore, vehicleLastSeen, logger, client),
+		GtfsService:    gtfs.NewGtfsService(staticStore, realtimeStore, tripUpdatesStore, alertsStore, boundingBoxStore, logger, client, nil, nil, nil),
+		MetricsService: metrics.NewMetricsService(staticStore, realtimeStore, tripUpdatesStore, alertsStore, boundingBoxStore, vehicleLastSeen, logger, client),
 		Version:        "1.0.0",
 		Logger:         logger,
 	}
+	app.checkRunner = checks.NewRunner(app.newCheckRegistry(), logger)
+	return app
 }
 
 func getMetricsForTesting(t *testing.T, metric *prometheus.GaugeVec) {
@@ -0,0 +1,103 @@
+package checks
+
+import (
+	"context"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// Check is a single unit of monitoring work performed against one OBA server,
+// such as pinging the server, fetching its GTFS-RT feed or comparing vehicle counts.
+//
+// Checks are registered in a Registry and executed by a Runner, which takes care of
+// running them in dependency order, skipping checks whose dependencies did not pass,
+// honoring per-check intervals, and logging/reporting results to Sentry.
+// This keeps each check focused on its own logic: adding a new check only requires
+// implementing this interface and registering it, without touching the collection loop.
+type Check interface {
+	// Name uniquely identifies the check. It is used in logs, Sentry tags, metrics labels,
+	// and in the server configuration to enable or disable the check.
+	Name() string
+
+	// Dependencies lists the names of the checks that must pass before this check can run,
+	// e.g. vehicle checks depend on the check that fetches the GTFS-RT snapshot.
+	// Every dependency must be registered before the check itself.
+	Dependencies() []string
+
+	// Interval is the minimum time between two runs of the check for the same server.
+	// A value of zero runs the check on every collection cycle.
+	Interval() time.Duration
+
+	// Run executes the check for the given server.
+	// Implementations must honor ctx cancellation so that the per-server deadline is effective.
+	Run(ctx context.Context, server models.ObaServer) Result
+}
+
+// Status is the outcome of a single check run.
+type Status string
+
+const (
+	// StatusPassed means the check ran and completed successfully.
+	StatusPassed Status = "passed"
+	// StatusFailed means the check ran and encountered an error.
+	StatusFailed Status = "failed"
+	// StatusSkipped means the check did not run, e.g. because it is disabled for the server,
+	// one of its dependencies did not pass, or the check itself decided there was nothing to do.
+	StatusSkipped Status = "skipped"
+)
+
+// Result is the typed outcome returned by Check.Run.
+//
+// When Err is set, the Runner logs it and reports it to Sentry using Level,
+// tagged with the server and check names.
+type Result struct {
+	Status Status
+	Err    error
+	Level  sentry.Level
+}
+
+// Passed returns a successful result.
+func Passed() Result {
+	return Result{Status: StatusPassed}
+}
+
+// Failed returns a failed result that is reported at error level.
+func Failed(err error) Result {
+	return Result{Status: StatusFailed, Err: err, Level: sentry.LevelError}
+}
+
+// Skipped returns a skipped result. If reason is non-nil, it is reported at the given level.
+// Checks that skip dependents (e.g. a server in backoff) use it to explain why.
+func Skipped(reason error, level sentry.Level) Result {
+	return Result{Status: StatusSkipped, Err: reason, Level: level}
+}
+
+// New builds a Check from a name, its dependencies, an interval and a run function.
+// It is the simplest way to turn an existing service method into a check.
+//
+// Usage:
+//
+//	checks.New("vehicle_count", []string{"gtfs_rt_feed"}, 0, func(ctx context.Context, server models.ObaServer) checks.Result {
+//		...
+//	})
+func New(name string, dependencies []string, interval time.Duration, run func(ctx context.Context, server models.ObaServer) Result) Check {
+	return &funcCheck{name: name, dependencies: dependencies, interval: interval, run: run}
+}
+
+// funcCheck is the Check implementation returned by New.
+type funcCheck struct {
+	name         string
+	dependencies []string
+	interval     time.Duration
+	run          func(ctx context.Context, server models.ObaServer) Result
+}
+
+func (c *funcCheck) Name() string            { return c.name }
+func (c *funcCheck) Dependencies() []string  { return c.dependencies }
+func (c *funcCheck) Interval() time.Duration { return c.interval }
+
+func (c *funcCheck) Run(ctx context.Context, server models.ObaServer) Result {
+	return c.run(ctx, server)
+}
@@ -0,0 +1,76 @@
+package checks
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry holds the set of checks executed for every server, in execution order.
+//
+// Dependencies must be registered before the checks that depend on them, so the
+// registration order is always a valid execution order and dependency cycles are impossible.
+type Registry struct {
+	mu     sync.RWMutex
+	checks []Check
+	byName map[string]Check
+}
+
+// NewRegistry creates and returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]Check),
+	}
+}
+
+// Register adds a check to the registry.
+//
+// Returns an error if the check has no name, if a check with the same name is already
+// registered, or if one of its dependencies has not been registered yet.
+func (r *Registry) Register(check Check) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := check.Name()
+	if name == "" {
+		return fmt.Errorf("check name must not be empty")
+	}
+	if _, exists := r.byName[name]; exists {
+		return fmt.Errorf("check %q is already registered", name)
+	}
+	for _, dependency := range check.Dependencies() {
+		if _, exists := r.byName[dependency]; !exists {
+			return fmt.Errorf("check %q depends on %q, which is not registered", name, dependency)
+		}
+	}
+
+	r.checks = append(r.checks, check)
+	r.byName[name] = check
+	return nil
+}
+
+// MustRegister is like Register but panics if the check cannot be registered.
+// It is intended for built-in checks, where a registration error is a programming mistake.
+func (r *Registry) MustRegister(checks ...Check) {
+	for _, check := range checks {
+		if err := r.Register(check); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Checks returns the registered checks in execution order.
+func (r *Registry) Checks() []Check {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	checks := make([]Check, len(r.checks))
+	copy(checks, r.checks)
+	return checks
+}
+
+// Get returns the check registered under the given name, if any.
+func (r *Registry) Get(name string) (Check, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	check, exists := r.byName[name]
+	return check, exists
+}
@@ -0,0 +1,50 @@
+package checks
+
+import (
+	"context"
+	"testing"
+
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func noop(ctx context.Context, server models.ObaServer) Result {
+	return Passed()
+}
+
+func TestRegistryRegister(t *testing.T) {
+	t.Run("Keeps registration order", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.MustRegister(
+			New("first", nil, 0, noop),
+			New("second", []string{"first"}, 0, noop),
+		)
+
+		checks := registry.Checks()
+		if len(checks) != 2 || checks[0].Name() != "first" || checks[1].Name() != "second" {
+			t.Fatalf("unexpected registration order: %v", checks)
+		}
+		if _, ok := registry.Get("second"); !ok {
+			t.Error("expected registered check to be found by name")
+		}
+	})
+
+	t.Run("Rejects duplicate names", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.MustRegister(New("ping", nil, 0, noop))
+		if err := registry.Register(New("ping", nil, 0, noop)); err == nil {
+			t.Error("expected error for duplicate check name, got nil")
+		}
+	})
+
+	t.Run("Rejects empty names", func(t *testing.T) {
+		if err := NewRegistry().Register(New("", nil, 0, noop)); err == nil {
+			t.Error("expected error for empty check name, got nil")
+		}
+	})
+
+	t.Run("Rejects unregistered dependencies", func(t *testing.T) {
+		if err := NewRegistry().Register(New("vehicle_count", []string{"gtfs_rt_feed"}, 0, noop)); err == nil {
+			t.Error("expected error for unregistered dependency, got nil")
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/metrics"
+	"watchdog.onebusaway.org/internal/models"
+	"watchdog.onebusaway.org/internal/report"
+)
+
+// Runner executes the checks of a Registry against a server.
+//
+// For every server, the checks run one after another in registration order:
+//   - A check disabled for the server (see models.ObaServer.CheckEnabled) is skipped. The dependencies
+//     of an enabled check are enabled with it, unless they are listed in DisabledChecks: a check
+//     depending on such a check cannot run, and is skipped with a warning (see enabledChecks).
+//   - A check whose dependencies did not pass is skipped, without reporting,
+//     since the failing dependency has already been reported.
+//   - A check whose Interval has not yet elapsed since its last run for the server is not run again;
+//     its previous result is reused so that its dependents behave consistently.
+//   - Otherwise the check runs, and any error in its result is logged and reported to Sentry
+//     tagged with the server and check names.
+//
+// Every executed or skipped check increments metrics.CheckResults.
+// Once ctx is done (deadline exceeded or application shutting down), the remaining checks are not run.
+type Runner struct {
+	registry *Registry
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	lastRun map[int]map[string]lastRun // Last executed run of each check, indexed by server ID then check name
+	blocked map[int]map[string]string  // Disabled dependency already warned about, indexed by server ID then check name
+}
+
+// lastRun records when a check last ran for a server and what it returned.
+type lastRun struct {
+	at     time.Time
+	result Result
+}
+
+// NewRunner creates a Runner executing the checks of the given registry.
+func NewRunner(registry *Registry, logger *slog.Logger) *Runner {
+	return &Runner{
+		registry: registry,
+		logger:   logger,
+		lastRun:  make(map[int]map[string]lastRun),
+		blocked:  make(map[int]map[string]string),
+	}
+}
+
+// Run executes every registered check for the given server and returns the result of each check,
+// indexed by check name. Checks that were not reached because ctx was done are absent from the result.
+func (r *Runner) Run(ctx context.Context, server models.ObaServer) map[string]Result {
+	results := make(map[string]Result)
+	serverID := strconv.Itoa(server.ID)
+	checks := r.registry.Checks()
+	enabled, blockedBy := enabledChecks(server, checks)
+	r.warnBlocked(server, blockedBy)
+
+	for _, check := range checks {
+		name := check.Name()
+
+		if ctx.Err() != nil {
+			r.logger.Warn("Stopping checks for server before completion", "server_id", server.ID, "next_check", name, "error", ctx.Err())
+			report.ReportErrorWithSentryOptions(fmt.Errorf("checks for server %s stopped before %s: %w", server.ObaBaseURL, name, ctx.Err()), report.SentryReportOptions{
+				Tags:  r.tags(server, name),
+				Level: sentry.LevelWarning,
+			})
+			return results
+		}
+
+		if !enabled[name] {
+			r.logger.Debug("Skipping check disabled for server", "server_id", server.ID, "check", name)
+			results[name] = Skipped(nil, sentry.LevelDebug)
+			metrics.Series.Counter(metrics.CheckResults, server.ID, serverID, name, string(StatusSkipped)).Inc()
+			continue
+		}
+
+		if dependency, ok := r.failedDependency(check, results); ok {
+			r.logger.Info("Skipping check because a dependency did not pass", "server_id", server.ID, "check", name, "dependency", dependency)
+			results[name] = Skipped(nil, sentry.LevelDebug)
+			metrics.Series.Counter(metrics.CheckResults, server.ID, serverID, name, string(StatusSkipped)).Inc()
+			continue
+		}
+
+		now := time.Now()
+		if previous, ok := r.previousRun(server.ID, name); ok && now.Sub(previous.at) < check.Interval() {
+			results[name] = previous.result
+			continue
+		}
+
+		result := check.Run(ctx, server)
+		r.recordRun(server.ID, name, lastRun{at: now, result: result})
+		results[name] = result
+		metrics.Series.Counter(metrics.CheckResults, server.ID, serverID, name, string(result.Status)).Inc()
+
+		if result.Err != nil {
+			r.reportResult(server, name, result)
+		}
+	}
+	return results
+}
+
+// Forget drops the recorded runs of the given server, so that a server re-added later
+// starts with every check due. It is used to evict servers removed from the configuration.
+func (r *Runner) Forget(serverID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.lastRun, serverID)
+	delete(r.blocked, serverID)
+}
+
+// enabledChecks resolves which of the given checks, in registration order, run for the server.
+//
+// A check is enabled when models.ObaServer.CheckEnabled says so, or when an enabled check depends
+// on it, transitively: `enabled_checks: ["vehicle_count"]` also runs server_ping and gtfs_rt_feed.
+// Checks listed in DisabledChecks are never enabled, so the checks depending on them cannot run;
+// blockedBy holds, for each of those, the disabled check it depends on.
+func enabledChecks(server models.ObaServer, checks []Check) (enabled map[string]bool, blockedBy map[string]string) {
+	enabled = make(map[string]bool, len(checks))
+	for _, check := range checks {
+		enabled[check.Name()] = server.CheckEnabled(check.Name())
+	}
+	// Dependencies are registered before their dependents, so walking backwards
+	// enables the dependencies of a check before they are themselves visited.
+	for i := len(checks) - 1; i >= 0; i-- {
+		if !enabled[checks[i].Name()] {
+			continue
+		}
+		for _, dependency := range checks[i].Dependencies() {
+			if !slices.Contains(server.DisabledChecks, dependency) {
+				enabled[dependency] = true
+			}
+		}
+	}
+
+	blockedBy = make(map[string]string)
+	for _, check := range checks {
+		if !enabled[check.Name()] {
+			continue
+		}
+		for _, dependency := range check.Dependencies() {
+			if enabled[dependency] {
+				continue
+			}
+			if root, ok := blockedBy[dependency]; ok {
+				dependency = root
+			}
+			blockedBy[check.Name()] = dependency
+			enabled[check.Name()] = false
+			break
+		}
+	}
+	return enabled, blockedBy
+}
+
+// warnBlocked logs a warning for every check of the server that cannot run because it depends on
+// a disabled check. Each one is logged once, not on every run, until the server configuration changes.
+func (r *Runner) warnBlocked(server models.ObaServer, blockedBy map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	warned := r.blocked[server.ID]
+	for name, dependency := range blockedBy {
+		if warned[name] != dependency {
+			r.logger.Warn("Check cannot run because a check it depends on is disabled for server", "server_id", server.ID, "check", name, "dependency", dependency)
+		}
+	}
+	r.blocked[server.ID] = blockedBy
+}
+
+// failedDependency returns the first dependency of the check that did not pass in this run.
+func (r *Runner) failedDependency(check Check, results map[string]Result) (string, bool) {
+	for _, dependency := range check.Dependencies() {
+		if results[dependency].Status != StatusPassed {
+			return dependency, true
+		}
+	}
+	return "", false
+}
+
+// previousRun returns the last executed run of the check for the server, if any.
+func (r *Runner) previousRun(serverID int, name string) (lastRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.lastRun[serverID][name]
+	return run, ok
+}
+
+// recordRun stores the latest executed run of the check for the server.
+func (r *Runner) recordRun(serverID int, name string, run lastRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lastRun[serverID] == nil {
+		r.lastRun[serverID] = make(map[string]lastRun)
+	}
+	r.lastRun[serverID][name] = run
+}
+
+// reportResult logs the error carried by a result and reports it to Sentry at the result's level.
+func (r *Runner) reportResult(server models.ObaServer, name string, result Result) {
+	switch result.Level {
+	case sentry.LevelError, sentry.LevelFatal:
+		r.logger.Error("Check failed", "server_id", server.ID, "server_name", server.Name, "check", name, "error", result.Err)
+	case sentry.LevelWarning:
+		r.logger.Warn("Check reported a problem", "server_id", server.ID, "server_name", server.Name, "check", name, "error", result.Err)
+	default:
+		r.logger.Info("Check reported", "server_id", server.ID, "server_name", server.Name, "check", name, "status", result.Status, "reason", result.Err)
+	}
+
+	report.ReportErrorWithSentryOptions(result.Err, report.SentryReportOptions{
+		Tags: r.tags(server, name),
+		ExtraContext: map[string]interface{}{
+			"oba_base_url": server.ObaBaseURL,
+		},
+		Level: result.Level,
+	})
+}
+
+// tags returns the Sentry tags attached to every report made for a check run.
+func (r *Runner) tags(server models.ObaServer, name string) map[string]string {
+	return map[string]string{
+		"server_id":   strconv.Itoa(server.ID),
+		"server_name": server.Name,
+		"check":       name,
+	}
+}
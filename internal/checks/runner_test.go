@@ -0,0 +1,154 @@
+package checks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestRunnerRun(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := models.ObaServer{ID: 1, Name: "Test Server"}
+
+	failing := func(ctx context.Context, server models.ObaServer) Result {
+		return Failed(errors.New("feed unavailable"))
+	}
+
+	t.Run("Skips checks whose dependencies did not pass", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.MustRegister(
+			New("ping", nil, 0, noop),
+			New("feed", []string{"ping"}, 0, failing),
+			New("vehicles", []string{"feed"}, 0, noop),
+			New("api", []string{"ping"}, 0, noop),
+		)
+
+		results := NewRunner(registry, logger).Run(context.Background(), server)
+
+		expected := map[string]Status{
+			"ping":     StatusPassed,
+			"feed":     StatusFailed,
+			"vehicles": StatusSkipped,
+			"api":      StatusPassed,
+		}
+		for name, status := range expected {
+			if results[name].Status != status {
+				t.Errorf("check %s: expected status %s, got %s", name, status, results[name].Status)
+			}
+		}
+	})
+
+	t.Run("Skips checks disabled for the server", func(t *testing.T) {
+		registry := NewRegistry()
+		ran := false
+		registry.MustRegister(
+			New("feed", nil, 0, func(ctx context.Context, server models.ObaServer) Result {
+				ran = true
+				return Passed()
+			}),
+			New("vehicles", []string{"feed"}, 0, noop),
+		)
+		disabled := server
+		disabled.DisabledChecks = []string{"feed"}
+
+		results := NewRunner(registry, logger).Run(context.Background(), disabled)
+
+		if ran {
+			t.Error("expected disabled check not to run")
+		}
+		if results["feed"].Status != StatusSkipped || results["vehicles"].Status != StatusSkipped {
+			t.Errorf("expected disabled check and its dependents to be skipped, got %+v", results)
+		}
+	})
+
+	t.Run("Enabled checks enable their dependencies", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.MustRegister(
+			New("ping", nil, 0, noop),
+			New("feed", []string{"ping"}, 0, noop),
+			New("vehicles", []string{"feed"}, 0, noop),
+			New("api", []string{"ping"}, 0, noop),
+		)
+		selected := server
+		selected.EnabledChecks = []string{"vehicles"}
+
+		results := NewRunner(registry, logger).Run(context.Background(), selected)
+
+		expected := map[string]Status{
+			"ping":     StatusPassed,
+			"feed":     StatusPassed,
+			"vehicles": StatusPassed,
+			"api":      StatusSkipped,
+		}
+		for name, status := range expected {
+			if results[name].Status != status {
+				t.Errorf("check %s: expected status %s, got %s", name, status, results[name].Status)
+			}
+		}
+	})
+
+	t.Run("Disabled dependencies block enabled checks", func(t *testing.T) {
+		registry := NewRegistry()
+		registry.MustRegister(
+			New("ping", nil, 0, noop),
+			New("feed", []string{"ping"}, 0, noop),
+			New("vehicles", []string{"feed"}, 0, noop),
+		)
+		selected := server
+		selected.EnabledChecks = []string{"vehicles"}
+		selected.DisabledChecks = []string{"ping"}
+
+		enabled, blockedBy := enabledChecks(selected, registry.Checks())
+
+		if enabled["ping"] || enabled["feed"] || enabled["vehicles"] {
+			t.Errorf("expected no check to be enabled, got %v", enabled)
+		}
+		if blockedBy["feed"] != "ping" || blockedBy["vehicles"] != "ping" {
+			t.Errorf("expected feed and vehicles to be blocked by ping, got %v", blockedBy)
+		}
+	})
+
+	t.Run("Reuses previous result until interval elapses", func(t *testing.T) {
+		registry := NewRegistry()
+		runs := 0
+		registry.MustRegister(New("hourly", nil, time.Hour, func(ctx context.Context, server models.ObaServer) Result {
+			runs++
+			return Skipped(errors.New("nothing to do"), sentry.LevelDebug)
+		}))
+		runner := NewRunner(registry, logger)
+
+		runner.Run(context.Background(), server)
+		results := runner.Run(context.Background(), server)
+
+		if runs != 1 {
+			t.Errorf("expected check to run once within its interval, ran %d times", runs)
+		}
+		if results["hourly"].Status != StatusSkipped {
+			t.Errorf("expected previous result to be reused, got %s", results["hourly"].Status)
+		}
+	})
+
+	t.Run("Stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		registry := NewRegistry()
+		registry.MustRegister(
+			New("first", nil, 0, func(ctx context.Context, server models.ObaServer) Result {
+				cancel()
+				return Passed()
+			}),
+			New("second", nil, 0, noop),
+		)
+
+		results := NewRunner(registry, logger).Run(ctx, server)
+
+		if _, ok := results["second"]; ok {
+			t.Error("expected no check to run after the context was canceled")
+		}
+	})
+}
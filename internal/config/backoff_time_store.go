@@ -74,6 +74,7 @@ func (s *BackoffStore) UpdateBackoff(serverID int) {
 }
 
 // ResetBackoff removes any existing backoff data for the given server ID.
+// It is also used to evict servers that were removed from the configuration.
 func (s *BackoffStore) ResetBackoff(serverID int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -7,12 +7,57 @@ import (
 )
 
 // Config holds all the configuration settings for our application.
+//
+// CollectionWorkers bounds how many servers are collected concurrently, and
+// CollectionTimeout is the deadline (in seconds) given to each server's collection run.
+// ShutdownTimeout is how long (in seconds) in-flight collections may keep running after a shutdown signal.
+//
+// MaxBundleSize and MaxRealtimeFeedSize (in megabytes) cap the size of downloaded GTFS static bundles
+// and GTFS-RT feeds, BundleSpoolThreshold (in megabytes) is the size above which static bundles are
+// spooled to disk while downloading, and BundleParseWorkers bounds how many bundles are parsed at once.
+// Spooled bundles are read back whole to be parsed, so BundleParseWorkers × MaxBundleSize bounds the
+// memory holding bundles being parsed, while each download in progress holds at most BundleSpoolThreshold.
+//
+// ServiceGapLookaheadDays is the number of upcoming days checked for dates without any active service.
+//
+// When a bundle is replaced, stops that moved more than BundleStopMoveThreshold meters are counted as
+// moved, and a change removing more than BundleMaxStopsRemoved percent of the stops or
+// BundleMaxRoutesRemoved percent of the routes is reported to Sentry.
+//
+// BundleDriftSampleSize is the number of stops, and of routes, of the bundle looked up on the OBA server
+// to detect a server that serves another bundle.
+//
+// ArrivalsSampleSize is the number of stops whose arrivals are requested from the OBA server on each
+// collection run, to measure what riders see.
+//
+// RealtimeFrozenThreshold is how long (in seconds) the GTFS-RT feed header timestamp or content may
+// stay unchanged before the feed is flagged as frozen.
+//
+// BundleCacheDir is the directory downloaded bundles are cached in, to be loaded back on restart;
+// an empty BundleCacheDir disables the cache.
 type Config struct {
-	Port          int
-	Env           string
-	FetchInterval int
-	Mu            sync.RWMutex
-	Servers       []models.ObaServer
+	Port                    int
+	Env                     string
+	FetchInterval           int
+	CollectionWorkers       int
+	CollectionTimeout       int
+	ShutdownTimeout         int
+	MaxBundleSize           int
+	MaxRealtimeFeedSize     int
+	BundleSpoolThreshold    int
+	BundleParseWorkers      int
+	ServiceGapLookaheadDays int
+	BundleStopMoveThreshold int
+	BundleMaxStopsRemoved   int
+	BundleMaxRoutesRemoved  int
+	BundleDriftSampleSize   int
+	ArrivalsSampleSize      int
+	RealtimeFrozenThreshold int
+	BundleCacheDir          string
+	Mu                      sync.RWMutex
+	Servers                 []models.ObaServer
+
+	subscribers []chan struct{} // Notified by UpdateConfig; guarded by Mu
 }
 
 // NewConfig creates a new instance of a Config struct.
@@ -24,11 +69,32 @@ func NewConfig(port int, env string, servers []models.ObaServer) *Config {
 	}
 }
 
-// UpdateConfig safely updates the config servers.
+// UpdateConfig safely updates the config servers and notifies every subscriber.
 func (cfg *Config) UpdateConfig(newServers []models.ObaServer) {
 	cfg.Mu.Lock()
 	defer cfg.Mu.Unlock()
 	cfg.Servers = newServers
+	for _, ch := range cfg.subscribers {
+		// Notifications are coalesced: if the subscriber has not consumed the previous one yet,
+		// it will read the latest servers anyway when it does.
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel that receives a notification every time UpdateConfig is called.
+//
+// A notification carries no data: subscribers call GetServers to read the latest servers
+// and compare them with the ones they already know about. Several updates made while the
+// subscriber is busy are coalesced into a single notification.
+func (cfg *Config) Subscribe() <-chan struct{} {
+	cfg.Mu.Lock()
+	defer cfg.Mu.Unlock()
+	ch := make(chan struct{}, 1)
+	cfg.subscribers = append(cfg.subscribers, ch)
+	return ch
 }
 
 // GetServers safely returns a copy of the servers slice to avoid
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -60,7 +61,7 @@ func TestLoadConfigFromFile(t *testing.T) {
 			AgencyID:           "agency-1",
 		}
 
-		if servers[0] != expected {
+		if !reflect.DeepEqual(servers[0], expected) {
 			t.Errorf("expected %+v, got %+v", expected, servers[0])
 		}
 	})
@@ -130,7 +131,7 @@ func TestLoadConfigFromURL(t *testing.T) {
 			AgencyID:           "agency-1",
 		}
 
-		if servers[0] != expected {
+		if !reflect.DeepEqual(servers[0], expected) {
 			t.Errorf("Expected server %+v, got %+v", expected, servers[0])
 		}
 	})
@@ -142,3 +142,27 @@ func TestUpdateConfig(t *testing.T) {
 		t.Errorf("Expected server name to be updated to 'Server 1 Updated', got %s", config.Servers[0].Name)
 	}
 }
+
+func TestConfigSubscribe(t *testing.T) {
+	cfg := NewConfig(4000, "testing", nil)
+	updates := cfg.Subscribe()
+
+	cfg.UpdateConfig([]models.ObaServer{{ID: 1}})
+	cfg.UpdateConfig([]models.ObaServer{{ID: 1}, {ID: 2}})
+
+	select {
+	case <-updates:
+	default:
+		t.Fatal("expected a notification after UpdateConfig")
+	}
+
+	select {
+	case <-updates:
+		t.Error("expected consecutive updates to be coalesced into a single notification")
+	default:
+	}
+
+	if len(cfg.GetServers()) != 2 {
+		t.Errorf("expected subscriber to read the latest servers, got %d", len(cfg.GetServers()))
+	}
+}
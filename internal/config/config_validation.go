@@ -18,6 +18,9 @@ import (
 //
 // The GTFS-RT auth header pair (gtfs_rt_api_key / gtfs_rt_api_value) and
 // trip_update_url are intentionally optional and not validated here.
+// So are agency_id and agency_ids: the agencies of a server without them are
+// discovered at runtime. A blank agency ID is still rejected, as it is a typo
+// rather than an omission.
 //
 // It returns an error naming every missing field, or nil if the server is valid.
 func ValidateServer(server models.ObaServer) error {
@@ -36,13 +39,21 @@ func ValidateServer(server models.ObaServer) error {
 		{"oba_api_key", server.ObaApiKey},
 		{"gtfs_url", server.GtfsUrl},
 		{"vehicle_position_url", server.VehiclePositionUrl},
-		{"agency_id", server.AgencyID},
 	}
 	for _, field := range requiredStrings {
 		if strings.TrimSpace(field.value) == "" {
 			missing = append(missing, field.name)
 		}
 	}
+	if server.AgencyID != "" && strings.TrimSpace(server.AgencyID) == "" {
+		missing = append(missing, "agency_id")
+	}
+	for _, agencyID := range server.AgencyIDs {
+		if strings.TrimSpace(agencyID) == "" {
+			missing = append(missing, "agency_ids")
+			break
+		}
+	}
 
 	if len(missing) > 0 {
 		return fmt.Errorf("server %q (id %d) is missing required fields: %s",
@@ -36,6 +36,18 @@ func TestValidateServer(t *testing.T) {
 		}
 	})
 
+	t.Run("agencies may be omitted or listed", func(t *testing.T) {
+		s := validServer()
+		s.AgencyID = ""
+		if err := ValidateServer(s); err != nil {
+			t.Fatalf("expected no error for a server whose agencies are discovered, got: %v", err)
+		}
+		s.AgencyIDs = []string{"agency-1", "agency-2"}
+		if err := ValidateServer(s); err != nil {
+			t.Fatalf("expected no error for a list of agencies, got: %v", err)
+		}
+	})
+
 	t.Run("empty optional GTFS-RT auth fields are allowed", func(t *testing.T) {
 		s := validServer()
 		s.GtfsRtApiKey = ""
@@ -55,10 +67,10 @@ func TestValidateServer(t *testing.T) {
 		{"missing vehicle_position_url", func(s *models.ObaServer) { s.VehiclePositionUrl = "" }, "vehicle_position_url"},
 		{"missing oba_base_url", func(s *models.ObaServer) { s.ObaBaseURL = "" }, "oba_base_url"},
 		{"missing oba_api_key", func(s *models.ObaServer) { s.ObaApiKey = "" }, "oba_api_key"},
-		{"missing agency_id", func(s *models.ObaServer) { s.AgencyID = "" }, "agency_id"},
 		{"missing name", func(s *models.ObaServer) { s.Name = "" }, "name"},
 		{"missing id", func(s *models.ObaServer) { s.ID = 0 }, "id"},
 		{"whitespace-only agency_id", func(s *models.ObaServer) { s.AgencyID = "   " }, "agency_id"},
+		{"whitespace-only agency_ids entry", func(s *models.ObaServer) { s.AgencyIDs = []string{"agency-2", " "} }, "agency_ids"},
 		{"whitespace-only gtfs_url", func(s *models.ObaServer) { s.GtfsUrl = "  \t " }, "gtfs_url"},
 	}
 
@@ -88,7 +100,7 @@ func TestValidateServer(t *testing.T) {
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
-		for _, field := range []string{"gtfs_url", "vehicle_position_url", "agency_id"} {
+		for _, field := range []string{"gtfs_url", "vehicle_position_url"} {
 			if !strings.Contains(err.Error(), field) {
 				t.Fatalf("expected error to mention %q, got: %v", field, err)
 			}
@@ -190,7 +202,7 @@ func TestFilterValidServers(t *testing.T) {
 		invalidA.GtfsUrl = ""
 		invalidB := validServer()
 		invalidB.ID = 11
-		invalidB.AgencyID = ""
+		invalidB.VehiclePositionUrl = ""
 
 		// Interleave valid and invalid: valid, invalid, valid, invalid.
 		got := filterValidServers([]models.ObaServer{valid1, invalidA, valid2, invalidB})
@@ -102,6 +102,14 @@ func (s *BoundingBoxStore) Get(serverID int) (BoundingBox, bool) {
 	return bbox, ok
 }
 
+// Delete removes the bounding box associated with the given server ID.
+// It is used to evict servers that were removed from the configuration.
+func (s *BoundingBoxStore) Delete(serverID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.store, serverID)
+}
+
 // IsInBoundingBox checks whether the given lat/lon is within the
 // bounding box associated with the specified server ID.
 func (s *BoundingBoxStore) IsInBoundingBox(serverID int, lat, lon float64) bool {
@@ -0,0 +1,307 @@
+package gtfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/geo"
+	"watchdog.onebusaway.org/internal/models"
+	"watchdog.onebusaway.org/internal/report"
+	"watchdog.onebusaway.org/internal/utils"
+)
+
+// BundleCache keeps a copy of the last successfully downloaded GTFS static bundle of each server
+// on disk, so that a restarted watchdog has bundles to work with before (or without) reaching
+// the feed hosts.
+//
+// Each server's bundle is stored in the cache directory as `<server_id>.zip`, along with a
+// `<server_id>.json` metadata file describing it (see cachedBundleMetadata). Both files are written
+// to a temporary file first and renamed, so a crash never leaves a truncated bundle behind, and
+// the hash recorded in the metadata is checked when the bundle is loaded back.
+//
+// A nil *BundleCache is a disabled cache: every method is a no-op and Load finds nothing.
+type BundleCache struct {
+	dir string // Directory the bundles are stored in
+}
+
+// cachedBundleMetadata is the content of the metadata file stored next to a cached bundle.
+type cachedBundleMetadata struct {
+	ServerID     int               `json:"server_id"`
+	GtfsURL      string            `json:"gtfs_url"`      // URL the bundle was downloaded from
+	Bundle       models.BundleInfo `json:"bundle"`        // Description of the downloaded file
+	DownloadedAt time.Time         `json:"downloaded_at"` // Last time the bundle was downloaded or confirmed unchanged
+}
+
+// CachedBundle is a bundle loaded back from a BundleCache.
+type CachedBundle struct {
+	GtfsURL      string            // URL the bundle was downloaded from
+	Bundle       models.BundleInfo // Description of the downloaded file
+	DownloadedAt time.Time         // Last time the bundle was downloaded or confirmed unchanged
+	Data         []byte            // Content of the bundle file
+}
+
+// NewBundleCache creates a cache storing bundles in dir, creating the directory if needed.
+// An empty dir disables the cache and returns nil.
+func NewBundleCache(dir string) (*BundleCache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create GTFS bundle cache directory %s: %w", dir, err)
+	}
+	return &BundleCache{dir: dir}, nil
+}
+
+func (c *BundleCache) bundlePath(serverID int) string {
+	return filepath.Join(c.dir, strconv.Itoa(serverID)+".zip")
+}
+
+func (c *BundleCache) metadataPath(serverID int) string {
+	return filepath.Join(c.dir, strconv.Itoa(serverID)+".json")
+}
+
+// Save stores the content of a bundle downloaded from gtfsURL for a server, replacing the
+// bundle previously cached for it. The bundle is recorded as downloaded at downloadedAt.
+func (c *BundleCache) Save(serverID int, gtfsURL string, bundle models.BundleInfo, data []byte, downloadedAt time.Time) error {
+	if c == nil {
+		return nil
+	}
+	// The bundle is written before its metadata: an interrupted Save leaves a metadata file whose
+	// hash does not match the bundle, which Load rejects.
+	if err := writeFileAtomic(c.bundlePath(serverID), data); err != nil {
+		return fmt.Errorf("failed to cache GTFS bundle of server %d: %w", serverID, err)
+	}
+	return c.writeMetadata(cachedBundleMetadata{
+		ServerID:     serverID,
+		GtfsURL:      gtfsURL,
+		Bundle:       bundle,
+		DownloadedAt: downloadedAt.UTC(),
+	})
+}
+
+// Touch records that the bundle cached for a server was confirmed unchanged at downloadedAt, with
+// the given BundleInfo (which carries the latest validators), without rewriting the bundle itself.
+// It does nothing if no bundle is cached for the server, or if the cached one has another hash.
+func (c *BundleCache) Touch(serverID int, bundle models.BundleInfo, downloadedAt time.Time) error {
+	if c == nil {
+		return nil
+	}
+	metadata, err := c.readMetadata(serverID)
+	if err != nil || metadata == nil {
+		return err
+	}
+	if metadata.Bundle.SHA256 != bundle.SHA256 {
+		return nil
+	}
+	metadata.Bundle = bundle
+	metadata.DownloadedAt = downloadedAt.UTC()
+	return c.writeMetadata(*metadata)
+}
+
+// Load returns the bundle cached for a server, or nil if there is none.
+// It returns an error if the cached files cannot be read or the bundle does not match its metadata.
+func (c *BundleCache) Load(serverID int) (*CachedBundle, error) {
+	if c == nil {
+		return nil, nil
+	}
+	metadata, err := c.readMetadata(serverID)
+	if err != nil || metadata == nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(c.bundlePath(serverID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached GTFS bundle of server %d: %w", serverID, err)
+	}
+	hasher := newContentHasher()
+	hasher.Write(data)
+	if hasher.String() != metadata.Bundle.SHA256 {
+		return nil, fmt.Errorf("cached GTFS bundle of server %d does not match its metadata", serverID)
+	}
+	return &CachedBundle{
+		GtfsURL:      metadata.GtfsURL,
+		Bundle:       metadata.Bundle,
+		DownloadedAt: metadata.DownloadedAt,
+		Data:         data,
+	}, nil
+}
+
+// Delete removes the bundle cached for a server.
+// It is used to evict servers that were removed from the configuration, or whose GTFS URL changed.
+func (c *BundleCache) Delete(serverID int) error {
+	if c == nil {
+		return nil
+	}
+	// The metadata goes first, so that a bundle without metadata is never loaded.
+	err := os.Remove(c.metadataPath(serverID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = os.Remove(c.bundlePath(serverID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (c *BundleCache) readMetadata(serverID int) (*cachedBundleMetadata, error) {
+	// #nosec G304 -- the path is built from the configured cache directory and a server ID.
+	content, err := os.ReadFile(c.metadataPath(serverID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached GTFS bundle metadata of server %d: %w", serverID, err)
+	}
+	var metadata cachedBundleMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode cached GTFS bundle metadata of server %d: %w", serverID, err)
+	}
+	return &metadata, nil
+}
+
+func (c *BundleCache) writeMetadata(metadata cachedBundleMetadata) error {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.metadataPath(metadata.ServerID), content); err != nil {
+		return fmt.Errorf("failed to cache GTFS bundle metadata of server %d: %w", metadata.ServerID, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it to path.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// loadCachedBundles loads the bundles cached on disk for a list of OBA servers into the stores,
+// so that checks have a bundle to work with right after a restart, even when a feed host is down.
+// It is meant to be called once at startup, before the first downloadGTFSBundles.
+//
+// For each server with a cached bundle, the bundle is parsed and validated like a downloaded one
+// (see parseGTFSBundle), then stored with storeGTFSBundle. Its BundleInfo keeps the HTTP validators
+// and hash of the cached file, so the next download is conditional and an unchanged bundle is
+// not parsed again, and its CachedAt records when the cached copy was downloaded, until a download
+// confirms or replaces it (see refreshUnchangedBundle).
+//
+// Cached bundles are skipped when:
+//   - a bundle is already stored for the server;
+//   - the bundle was downloaded from another URL than the server's current GTFS URL
+//     (the stale entry is deleted);
+//   - the cached files cannot be read, do not match, or cannot be parsed (reported to Sentry
+//     as a warning; the entry is deleted so the next download replaces it).
+//
+// Bundles are loaded and parsed concurrently, within the parse slots of limits: a cached bundle is
+// read whole into memory, like a downloaded one read back from its spool file.
+func loadCachedBundles(ctx context.Context, servers []models.ObaServer, logger *slog.Logger, boundingBoxStore *geo.BoundingBoxStore, staticStore *StaticStore, limits *FeedLimits, cache *BundleCache) {
+	if cache == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		s := server
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, ok := staticStore.Get(s.ID); ok {
+				return
+			}
+
+			if err := limits.acquireParse(ctx); err != nil {
+				return
+			}
+			downloaded, ok := loadCachedBundle(s, logger, cache)
+			limits.releaseParse()
+			if !ok {
+				return
+			}
+
+			if err := storeGTFSBundle(downloaded, s.ID, staticStore, boundingBoxStore); err != nil {
+				reportCacheError(err, s)
+				logger.Error("Failed to store cached GTFS bundle", "server_id", s.ID, "error", err)
+				return
+			}
+			logger.Info("Loaded GTFS bundle from cache", "server_id", s.ID, "sha256", downloaded.Info.SHA256, "downloaded_at", downloaded.Info.CachedAt)
+		}()
+	}
+	wg.Wait()
+}
+
+// loadCachedBundle loads and parses the bundle cached for a server, with the BundleInfo it was cached
+// with. It returns false when the server has no usable cached bundle: a cached bundle that cannot be
+// loaded or parsed, or that was downloaded from another GTFS URL, is evicted.
+func loadCachedBundle(s models.ObaServer, logger *slog.Logger, cache *BundleCache) (downloadedBundle, bool) {
+	cached, err := cache.Load(s.ID)
+	if err != nil {
+		reportCacheError(err, s)
+		logger.Warn("Failed to load cached GTFS bundle", "server_id", s.ID, "error", err)
+		evictCachedBundle(cache, logger, s.ID)
+		return downloadedBundle{}, false
+	}
+	if cached == nil {
+		return downloadedBundle{}, false
+	}
+	if cached.GtfsURL != s.GtfsUrl {
+		logger.Info("Ignoring cached GTFS bundle of another GTFS URL", "server_id", s.ID, "cached_gtfs_url", cached.GtfsURL)
+		evictCachedBundle(cache, logger, s.ID)
+		return downloadedBundle{}, false
+	}
+
+	downloaded, err := parseGTFSBundle(cached.Data, cached.GtfsURL, s.ID)
+	if err != nil {
+		reportCacheError(err, s)
+		logger.Warn("Failed to parse cached GTFS bundle", "server_id", s.ID, "error", err)
+		evictCachedBundle(cache, logger, s.ID)
+		return downloadedBundle{}, false
+	}
+	downloaded.Info = cached.Bundle
+	downloaded.Info.CachedAt = cached.DownloadedAt
+	return downloaded, true
+}
+
+// evictCachedBundle deletes the bundle cached for a server, logging a failure to do so.
+func evictCachedBundle(cache *BundleCache, logger *slog.Logger, serverID int) {
+	if err := cache.Delete(serverID); err != nil {
+		logger.Warn("Failed to delete cached GTFS bundle", "server_id", serverID, "error", err)
+	}
+}
+
+// reportCacheError reports an error of the on-disk bundle cache to Sentry as a warning:
+// the bundle is downloaded again, so a cache failure never leaves a server without a bundle for long.
+func reportCacheError(err error, server models.ObaServer) {
+	report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+		Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+		ExtraContext: map[string]interface{}{
+			"gtfs_url": server.GtfsUrl,
+		},
+		Level: sentry.LevelWarning,
+	})
+}
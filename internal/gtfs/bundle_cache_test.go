@@ -0,0 +1,137 @@
+package gtfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"watchdog.onebusaway.org/internal/geo"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestBundleCache(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		cache, err := NewBundleCache("")
+		if err != nil || cache != nil {
+			t.Fatalf("expected an empty directory to disable the cache, got %v, %v", cache, err)
+		}
+		if err := cache.Save(1, "http://example.com/gtfs.zip", models.BundleInfo{}, []byte("zip"), time.Now()); err != nil {
+			t.Errorf("expected Save on a disabled cache to do nothing, got %v", err)
+		}
+		if cached, err := cache.Load(1); cached != nil || err != nil {
+			t.Errorf("expected a disabled cache to find nothing, got %v, %v", cached, err)
+		}
+	})
+
+	cache, err := NewBundleCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBundleCache failed: %v", err)
+	}
+
+	if cached, err := cache.Load(1); cached != nil || err != nil {
+		t.Fatalf("expected no cached bundle, got %v, %v", cached, err)
+	}
+
+	data := readFixture(t, "gtfs.zip")
+	sum := sha256.Sum256(data)
+	bundle := models.BundleInfo{ETag: `"v1"`, SHA256: hex.EncodeToString(sum[:]), Size: len(data)}
+	downloadedAt := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+	if err := cache.Save(1, "http://example.com/gtfs.zip", bundle, data, downloadedAt); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	cached, err := cache.Load(1)
+	if err != nil || cached == nil {
+		t.Fatalf("expected the saved bundle to be loaded, got %v, %v", cached, err)
+	}
+	if cached.GtfsURL != "http://example.com/gtfs.zip" || cached.Bundle.ETag != `"v1"` || !cached.DownloadedAt.Equal(downloadedAt) || len(cached.Data) != len(data) {
+		t.Errorf("unexpected cached bundle: %s, %+v, %s, %d bytes", cached.GtfsURL, cached.Bundle, cached.DownloadedAt, len(cached.Data))
+	}
+
+	confirmedAt := downloadedAt.Add(24 * time.Hour)
+	confirmed := bundle
+	confirmed.ETag = `"v2"`
+	if err := cache.Touch(1, confirmed, confirmedAt); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if cached, _ := cache.Load(1); cached == nil || !cached.DownloadedAt.Equal(confirmedAt) || cached.Bundle.ETag != `"v2"` {
+		t.Errorf("expected Touch to update the download time to %s and the ETag to \"v2\"", confirmedAt)
+	}
+
+	// A bundle that does not match its metadata is rejected.
+	if err := os.WriteFile(cache.bundlePath(1), []byte("truncated"), 0o600); err != nil {
+		t.Fatalf("failed to corrupt the cached bundle: %v", err)
+	}
+	if _, err := cache.Load(1); err == nil {
+		t.Error("expected an error for a bundle that does not match its metadata")
+	}
+
+	if err := cache.Delete(1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if cached, err := cache.Load(1); cached != nil || err != nil {
+		t.Errorf("expected no cached bundle after Delete, got %v, %v", cached, err)
+	}
+}
+
+func TestLoadCachedBundles(t *testing.T) {
+	mockServer := setupGtfsServer(t, "gtfs.zip")
+	defer mockServer.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cache, err := NewBundleCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewBundleCache failed: %v", err)
+	}
+	servers := []models.ObaServer{{ID: 1, GtfsUrl: mockServer.URL}}
+
+	// A first run downloads the bundle and caches it.
+	downloadGTFSBundles(context.Background(), servers, logger, geo.NewBoundingBoxStore(), NewStaticStore(), mockServer.Client(), NewFeedLimits(0, 0, 0, 0), nil, cache, 1)
+	if cached, err := cache.Load(1); cached == nil || err != nil {
+		t.Fatalf("expected the downloaded bundle to be cached, got %v, %v", cached, err)
+	}
+
+	// After a restart, the cached bundle is loaded without any download.
+	staticStore := NewStaticStore()
+	boundingBoxStore := geo.NewBoundingBoxStore()
+	loadCachedBundles(context.Background(), servers, logger, boundingBoxStore, staticStore, NewFeedLimits(0, 0, 0, 0), cache)
+	loaded, ok := staticStore.Get(1)
+	if !ok || loaded == nil {
+		t.Fatal("expected the cached bundle to be stored")
+	}
+	if loaded.Bundle.CachedAt.IsZero() || loaded.Bundle.SHA256 == "" {
+		t.Errorf("expected the stored bundle to be marked as cached, got %+v", loaded.Bundle)
+	}
+	if loaded.FeedInfo == nil || loaded.Validation == nil {
+		t.Error("expected the cached bundle to carry its feed info and validation report")
+	}
+	if _, ok := boundingBoxStore.Get(1); !ok {
+		t.Error("expected the bounding box of the cached bundle to be stored")
+	}
+
+	// A download finding the bundle unchanged confirms it.
+	downloadGTFSBundles(context.Background(), servers, logger, boundingBoxStore, staticStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0), nil, cache, 1)
+	confirmed, _ := staticStore.Get(1)
+	if !confirmed.Bundle.CachedAt.IsZero() {
+		t.Error("expected an unchanged download to confirm the cached bundle")
+	}
+	if len(confirmed.Stops) != len(loaded.Stops) {
+		t.Error("expected the confirmed bundle to keep its static data")
+	}
+
+	// A bundle cached for another GTFS URL is not loaded, and is dropped.
+	staticStore = NewStaticStore()
+	moved := []models.ObaServer{{ID: 1, GtfsUrl: "http://example.com/other.zip"}}
+	loadCachedBundles(context.Background(), moved, logger, geo.NewBoundingBoxStore(), staticStore, NewFeedLimits(0, 0, 0, 0), cache)
+	if _, ok := staticStore.Get(1); ok {
+		t.Error("expected a bundle cached for another GTFS URL not to be loaded")
+	}
+	if cached, _ := cache.Load(1); cached != nil {
+		t.Error("expected a bundle cached for another GTFS URL to be deleted")
+	}
+}
@@ -0,0 +1,83 @@
+package gtfs
+
+import (
+	"sync"
+
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// defaultChangelogSize is used when no positive changelog size is configured.
+const defaultChangelogSize = 20
+
+// BundleChangelog is a thread-safe in-memory log of the diffs between consecutive GTFS static
+// bundles of each server, indexed by server ID (see diffStaticData).
+//
+// A diff is recorded every time downloadGTFSBundles replaces a server's bundle with a changed one.
+// Only the most recent diffs of each server are kept, so the log never grows without bound.
+type BundleChangelog struct {
+	// Thresholds configures how diffs are computed and which changes are reported to Sentry.
+	Thresholds DiffThresholds
+
+	mu      sync.RWMutex
+	entries map[int][]models.BundleDiff // Diffs of each server, oldest first, indexed by server ID
+	size    int                         // Maximum number of diffs kept per server
+}
+
+// NewBundleChangelog creates an empty changelog keeping up to size diffs per server.
+// A non-positive size uses defaultChangelogSize.
+func NewBundleChangelog(size int, thresholds DiffThresholds) *BundleChangelog {
+	if size <= 0 {
+		size = defaultChangelogSize
+	}
+	return &BundleChangelog{
+		Thresholds: thresholds,
+		entries:    make(map[int][]models.BundleDiff),
+		size:       size,
+	}
+}
+
+// Record appends a diff to the log of a server, dropping its oldest diff once the log is full.
+func (c *BundleChangelog) Record(serverID int, diff models.BundleDiff) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := append(c.entries[serverID], diff)
+	if len(entries) > c.size {
+		entries = append([]models.BundleDiff(nil), entries[len(entries)-c.size:]...)
+	}
+	c.entries[serverID] = entries
+}
+
+// Get returns the diffs recorded for a server, most recent first.
+func (c *BundleChangelog) Get(serverID int) []models.BundleDiff {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := c.entries[serverID]
+	diffs := make([]models.BundleDiff, len(entries))
+	for i, diff := range entries {
+		diffs[len(entries)-1-i] = diff
+	}
+	return diffs
+}
+
+// Latest returns the most recent diff recorded for a server.
+//
+// Returns:
+//   - models.BundleDiff: The most recent diff, if any.
+//   - bool: True if a diff was recorded for the given server ID, false otherwise.
+func (c *BundleChangelog) Latest(serverID int) (models.BundleDiff, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entries := c.entries[serverID]
+	if len(entries) == 0 {
+		return models.BundleDiff{}, false
+	}
+	return entries[len(entries)-1], true
+}
+
+// Delete removes the diffs recorded for a server.
+// It is used to evict servers that were removed from the configuration.
+func (c *BundleChangelog) Delete(serverID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, serverID)
+}
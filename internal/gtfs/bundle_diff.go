@@ -0,0 +1,204 @@
+package gtfs
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"watchdog.onebusaway.org/internal/geo"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// Change thresholds a bundle diff can cross, as used in BundleDiff.ThresholdsExceeded.
+const (
+	ThresholdStopsRemoved    = "stops_removed"
+	ThresholdRoutesRemoved   = "routes_removed"
+	ThresholdAgenciesRemoved = "agencies_removed"
+)
+
+const (
+	// defaultStopMoveDistance is used when no positive stop move distance is configured.
+	defaultStopMoveDistance = 100
+	// defaultMaxStopsRemovedRatio is used when no positive stops removed ratio is configured.
+	defaultMaxStopsRemovedRatio = 0.10
+	// defaultMaxRoutesRemovedRatio is used when no positive routes removed ratio is configured.
+	defaultMaxRoutesRemovedRatio = 0.10
+	// maxDiffSamples bounds the number of stop IDs listed per kind of change in a BundleDiff.
+	maxDiffSamples = 50
+)
+
+// DiffThresholds configures how bundle diffs are computed and when a change is large enough
+// to be reported: a new bundle that drops a large part of the network usually is a bad export.
+type DiffThresholds struct {
+	StopMoveDistance      float64 // Stops that moved more than this many meters are counted as moved
+	MaxStopsRemovedRatio  float64 // Ratio of the previous stops that may be removed (0.1 is 10%)
+	MaxRoutesRemovedRatio float64 // Ratio of the previous route count that may disappear
+}
+
+// NewDiffThresholds creates the diff thresholds. Non-positive values fall back to
+// defaultStopMoveDistance, defaultMaxStopsRemovedRatio and defaultMaxRoutesRemovedRatio.
+func NewDiffThresholds(stopMoveDistance, maxStopsRemovedRatio, maxRoutesRemovedRatio float64) DiffThresholds {
+	if stopMoveDistance <= 0 {
+		stopMoveDistance = defaultStopMoveDistance
+	}
+	if maxStopsRemovedRatio <= 0 {
+		maxStopsRemovedRatio = defaultMaxStopsRemovedRatio
+	}
+	if maxRoutesRemovedRatio <= 0 {
+		maxRoutesRemovedRatio = defaultMaxRoutesRemovedRatio
+	}
+	return DiffThresholds{
+		StopMoveDistance:      stopMoveDistance,
+		MaxStopsRemovedRatio:  maxStopsRemovedRatio,
+		MaxRoutesRemovedRatio: maxRoutesRemovedRatio,
+	}
+}
+
+// diffStaticData compares the previous and new static data of a server and summarizes the changes:
+//   - Stops added, removed, or moved by more than thresholds.StopMoveDistance (see geo.HaversineDistance).
+//     Stops without coordinates in either bundle are never counted as moved.
+//   - Agencies added or removed, by agency ID.
+//   - The route count of both bundles.
+//   - The shift of the service date range (see serviceDateRange).
+//
+// ThresholdsExceeded lists the thresholds crossed: more than MaxStopsRemovedRatio of the previous
+// stops removed, more than MaxRoutesRemovedRatio of the previous route count gone, or any agency removed.
+func diffStaticData(previous, next *models.StaticData, thresholds DiffThresholds, now time.Time) models.BundleDiff {
+	diff := models.BundleDiff{
+		ComparedAt:      now,
+		PreviousSHA256:  previous.Bundle.SHA256,
+		SHA256:          next.Bundle.SHA256,
+		RoutesBefore:    len(previous.Routes),
+		RoutesAfter:     len(next.Routes),
+		AgenciesAdded:   []string{},
+		AgenciesRemoved: []string{},
+	}
+	if previous.FeedInfo != nil {
+		diff.PreviousFeedVersion = previous.FeedInfo.Version
+	}
+	if next.FeedInfo != nil {
+		diff.FeedVersion = next.FeedInfo.Version
+	}
+
+	diff.Stops = diffStops(previous, next, thresholds.StopMoveDistance)
+
+	previousAgencies := make(map[string]struct{}, len(previous.Agencies))
+	for _, agency := range previous.Agencies {
+		previousAgencies[agency.Id] = struct{}{}
+	}
+	nextAgencies := make(map[string]struct{}, len(next.Agencies))
+	for _, agency := range next.Agencies {
+		nextAgencies[agency.Id] = struct{}{}
+		if _, ok := previousAgencies[agency.Id]; !ok {
+			diff.AgenciesAdded = append(diff.AgenciesAdded, agency.Id)
+		}
+	}
+	for _, agency := range previous.Agencies {
+		if _, ok := nextAgencies[agency.Id]; !ok {
+			diff.AgenciesRemoved = append(diff.AgenciesRemoved, agency.Id)
+		}
+	}
+	sort.Strings(diff.AgenciesAdded)
+	sort.Strings(diff.AgenciesRemoved)
+
+	diff.PreviousServiceStart, diff.PreviousServiceEnd = serviceDateRange(previous)
+	diff.ServiceStart, diff.ServiceEnd = serviceDateRange(next)
+	diff.ServiceStartShiftDays = shiftDays(diff.PreviousServiceStart, diff.ServiceStart)
+	diff.ServiceEndShiftDays = shiftDays(diff.PreviousServiceEnd, diff.ServiceEnd)
+
+	diff.ThresholdsExceeded = []string{}
+	if diff.Stops.Before > 0 && float64(diff.Stops.Removed)/float64(diff.Stops.Before) > thresholds.MaxStopsRemovedRatio {
+		diff.ThresholdsExceeded = append(diff.ThresholdsExceeded, ThresholdStopsRemoved)
+	}
+	if diff.RoutesBefore > 0 && float64(diff.RoutesBefore-diff.RoutesAfter)/float64(diff.RoutesBefore) > thresholds.MaxRoutesRemovedRatio {
+		diff.ThresholdsExceeded = append(diff.ThresholdsExceeded, ThresholdRoutesRemoved)
+	}
+	if len(diff.AgenciesRemoved) > 0 {
+		diff.ThresholdsExceeded = append(diff.ThresholdsExceeded, ThresholdAgenciesRemoved)
+	}
+	return diff
+}
+
+// diffStops compares the stops of two bundles by stop ID. Sample ID lists are sorted and capped at maxDiffSamples.
+func diffStops(previous, next *models.StaticData, moveDistance float64) models.StopsDiff {
+	diff := models.StopsDiff{
+		Before:     len(previous.Stops),
+		After:      len(next.Stops),
+		AddedIDs:   []string{},
+		RemovedIDs: []string{},
+		MovedIDs:   []string{},
+	}
+
+	previousStops := make(map[string]int, len(previous.Stops))
+	for i, stop := range previous.Stops {
+		previousStops[stop.Id] = i
+	}
+	nextStops := make(map[string]struct{}, len(next.Stops))
+	for _, stop := range next.Stops {
+		nextStops[stop.Id] = struct{}{}
+		i, ok := previousStops[stop.Id]
+		if !ok {
+			diff.Added++
+			diff.AddedIDs = append(diff.AddedIDs, stop.Id)
+			continue
+		}
+		old := previous.Stops[i]
+		if old.Latitude == nil || old.Longitude == nil || stop.Latitude == nil || stop.Longitude == nil {
+			continue
+		}
+		if geo.HaversineDistance(*old.Latitude, *old.Longitude, *stop.Latitude, *stop.Longitude) > moveDistance {
+			diff.Moved++
+			diff.MovedIDs = append(diff.MovedIDs, stop.Id)
+		}
+	}
+	for _, stop := range previous.Stops {
+		if _, ok := nextStops[stop.Id]; !ok {
+			diff.Removed++
+			diff.RemovedIDs = append(diff.RemovedIDs, stop.Id)
+		}
+	}
+
+	diff.AddedIDs = sampleIDs(diff.AddedIDs)
+	diff.RemovedIDs = sampleIDs(diff.RemovedIDs)
+	diff.MovedIDs = sampleIDs(diff.MovedIDs)
+	return diff
+}
+
+// serviceDateRange returns the earliest service start date and the latest service end date of
+// the bundle, over calendar.txt and the dates added by calendar_dates.txt. Both are zero if the
+// bundle has no dated service.
+func serviceDateRange(staticData *models.StaticData) (start, end time.Time) {
+	for _, service := range staticData.Services {
+		dates := append([]time.Time{service.StartDate, service.EndDate}, service.AddedDates...)
+		for _, date := range dates {
+			if date.IsZero() {
+				continue
+			}
+			date = serviceDate(date)
+			if start.IsZero() || date.Before(start) {
+				start = date
+			}
+			if end.IsZero() || date.After(end) {
+				end = date
+			}
+		}
+	}
+	return start, end
+}
+
+// shiftDays returns the number of days from previous to next, or 0 if either date is zero.
+func shiftDays(previous, next time.Time) int {
+	if previous.IsZero() || next.IsZero() {
+		return 0
+	}
+	return int(math.Round(next.Sub(previous).Hours() / 24))
+}
+
+// sampleIDs sorts the IDs and keeps at most maxDiffSamples of them.
+func sampleIDs(ids []string) []string {
+	sort.Strings(ids)
+	if len(ids) > maxDiffSamples {
+		ids = ids[:maxDiffSamples]
+	}
+	return ids
+}
@@ -0,0 +1,135 @@
+package gtfs
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestDiffStaticData(t *testing.T) {
+	date := func(month time.Month, day int) time.Time { return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC) }
+	stop := func(id string, lat, lon float64) remoteGtfs.Stop {
+		return remoteGtfs.Stop{Id: id, Latitude: float64Ptr(lat), Longitude: float64Ptr(lon)}
+	}
+
+	previous := &models.StaticData{
+		Bundle:   models.BundleInfo{SHA256: "old"},
+		FeedInfo: &models.FeedInfo{Version: "v1"},
+		Agencies: []remoteGtfs.Agency{{Id: "A1"}, {Id: "A2"}},
+		Routes:   []remoteGtfs.Route{{Id: "R1"}, {Id: "R2"}, {Id: "R3"}, {Id: "R4"}},
+		Stops: []remoteGtfs.Stop{
+			stop("S1", 47.6000, -122.3000),
+			stop("S2", 47.6100, -122.3100),
+			stop("S3", 47.6200, -122.3200),
+			stop("S4", 47.6300, -122.3300),
+			{Id: "S5"}, // no coordinates
+		},
+		Services: []remoteGtfs.Service{{Id: "WK", StartDate: date(1, 1), EndDate: date(3, 31)}},
+	}
+	next := &models.StaticData{
+		Bundle:   models.BundleInfo{SHA256: "new"},
+		FeedInfo: &models.FeedInfo{Version: "v2"},
+		Agencies: []remoteGtfs.Agency{{Id: "A1"}, {Id: "A3"}},
+		Routes:   []remoteGtfs.Route{{Id: "R1"}, {Id: "R2"}, {Id: "R3"}},
+		Stops: []remoteGtfs.Stop{
+			stop("S1", 47.6000, -122.3000), // unchanged
+			stop("S2", 47.6105, -122.3100), // moved about 55 m
+			stop("S3", 47.6300, -122.3200), // moved about 1.1 km
+			stop("S6", 47.6400, -122.3400), // added
+			stop("S5", 47.6500, -122.3500), // previously without coordinates
+		},
+		Services: []remoteGtfs.Service{
+			{Id: "WK", StartDate: date(2, 1), EndDate: date(6, 30)},
+			{Id: "HOL", AddedDates: []time.Time{date(7, 4)}},
+		},
+	}
+
+	now := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	diff := diffStaticData(previous, next, NewDiffThresholds(100, 0.5, 0.1), now)
+
+	if diff.PreviousSHA256 != "old" || diff.SHA256 != "new" || diff.PreviousFeedVersion != "v1" || diff.FeedVersion != "v2" {
+		t.Errorf("unexpected bundle identification: %+v", diff)
+	}
+	if !diff.ComparedAt.Equal(now) {
+		t.Errorf("expected compared at %s, got %s", now, diff.ComparedAt)
+	}
+
+	stops := diff.Stops
+	if stops.Before != 5 || stops.After != 5 || stops.Added != 1 || stops.Removed != 1 || stops.Moved != 1 {
+		t.Errorf("unexpected stop changes: %+v", stops)
+	}
+	if len(stops.AddedIDs) != 1 || stops.AddedIDs[0] != "S6" {
+		t.Errorf("expected S6 to be added, got %v", stops.AddedIDs)
+	}
+	if len(stops.RemovedIDs) != 1 || stops.RemovedIDs[0] != "S4" {
+		t.Errorf("expected S4 to be removed, got %v", stops.RemovedIDs)
+	}
+	if len(stops.MovedIDs) != 1 || stops.MovedIDs[0] != "S3" {
+		t.Errorf("expected S3 to be moved, got %v", stops.MovedIDs)
+	}
+
+	if len(diff.AgenciesAdded) != 1 || diff.AgenciesAdded[0] != "A3" {
+		t.Errorf("expected A3 to be added, got %v", diff.AgenciesAdded)
+	}
+	if len(diff.AgenciesRemoved) != 1 || diff.AgenciesRemoved[0] != "A2" {
+		t.Errorf("expected A2 to be removed, got %v", diff.AgenciesRemoved)
+	}
+	if diff.RoutesBefore != 4 || diff.RoutesAfter != 3 {
+		t.Errorf("expected 4 routes before and 3 after, got %d and %d", diff.RoutesBefore, diff.RoutesAfter)
+	}
+
+	if diff.ServiceStartShiftDays != 31 {
+		t.Errorf("expected the service start to shift by 31 days, got %d", diff.ServiceStartShiftDays)
+	}
+	if diff.ServiceEndShiftDays != 95 {
+		t.Errorf("expected the service end to shift by 95 days, got %d", diff.ServiceEndShiftDays)
+	}
+
+	// 1 of 5 stops removed is below 50%; 1 of 4 routes gone is above 10%; an agency was removed.
+	expected := []string{ThresholdRoutesRemoved, ThresholdAgenciesRemoved}
+	if len(diff.ThresholdsExceeded) != len(expected) {
+		t.Fatalf("expected thresholds %v, got %v", expected, diff.ThresholdsExceeded)
+	}
+	for i := range expected {
+		if diff.ThresholdsExceeded[i] != expected[i] {
+			t.Errorf("expected thresholds %v, got %v", expected, diff.ThresholdsExceeded)
+		}
+	}
+
+	if diff := diffStaticData(previous, previous, NewDiffThresholds(0, 0, 0), now); len(diff.ThresholdsExceeded) != 0 || diff.Stops.Added+diff.Stops.Removed+diff.Stops.Moved != 0 {
+		t.Errorf("expected no changes between identical bundles, got %+v", diff)
+	}
+}
+
+func TestBundleChangelog(t *testing.T) {
+	changelog := NewBundleChangelog(2, NewDiffThresholds(0, 0, 0))
+
+	if _, ok := changelog.Latest(1); ok {
+		t.Fatal("expected no diff for an unknown server")
+	}
+
+	for _, sha := range []string{"a", "b", "c"} {
+		changelog.Record(1, models.BundleDiff{SHA256: sha})
+	}
+	changelog.Record(2, models.BundleDiff{SHA256: "z"})
+
+	diffs := changelog.Get(1)
+	if len(diffs) != 2 || diffs[0].SHA256 != "c" || diffs[1].SHA256 != "b" {
+		t.Errorf("expected the 2 most recent diffs, most recent first, got %+v", diffs)
+	}
+	if latest, ok := changelog.Latest(1); !ok || latest.SHA256 != "c" {
+		t.Errorf("expected latest diff c, got %+v", latest)
+	}
+
+	changelog.Delete(1)
+	if diffs := changelog.Get(1); len(diffs) != 0 {
+		t.Errorf("expected no diffs after delete, got %d", len(diffs))
+	}
+	if _, ok := changelog.Latest(2); !ok {
+		t.Error("expected the diffs of other servers to be kept")
+	}
+}
@@ -0,0 +1,105 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// bundleFile reads a CSV file of a GTFS bundle zip row by row.
+//
+// The GTFS library only returns the entities it could resolve, and silently drops the rest
+// (feed_info.txt is not parsed at all, trips referencing an unknown route are skipped, ...).
+// Checks that need to see the bundle as published read its files directly through bundleFile.
+// Rows are streamed, so that large files such as stop_times.txt are never fully held in memory.
+type bundleFile struct {
+	Name    string
+	reader  *csv.Reader
+	closer  io.Closer
+	columns map[string]int
+	row     []string
+	line    int
+	err     error
+}
+
+// openBundleFile opens the named file of the bundle, looking it up by base name so that bundles
+// zipped with a top-level directory are supported. It returns nil, without error, when the bundle
+// has no such file. The returned file must be closed.
+func openBundleFile(archive *zip.Reader, name string) (*bundleFile, error) {
+	var zipFile *zip.File
+	for _, file := range archive.File {
+		if path.Base(file.Name) == name {
+			zipFile = file
+			break
+		}
+	}
+	if zipFile == nil {
+		return nil, nil
+	}
+
+	reader, err := zipFile.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+	if err != nil && err != io.EOF {
+		reader.Close()
+		return nil, fmt.Errorf("failed to read %s header: %w", name, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		// The first column may carry a UTF-8 byte order mark.
+		columns[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+	return &bundleFile{Name: name, reader: csvReader, closer: reader, columns: columns, line: 1}, nil
+}
+
+// Next advances to the next row. It returns false at the end of the file or on error (see Err).
+func (f *bundleFile) Next() bool {
+	if f.err != nil {
+		return false
+	}
+	row, err := f.reader.Read()
+	if err == io.EOF {
+		return false
+	}
+	if err != nil {
+		f.err = fmt.Errorf("failed to read %s: %w", f.Name, err)
+		return false
+	}
+	f.row = row
+	// Counting records would be off after a quoted field spanning several lines.
+	f.line, _ = f.reader.FieldPos(0)
+	return true
+}
+
+// Get returns the trimmed value of a column in the current row, or "" if the file has no such column.
+func (f *bundleFile) Get(column string) string {
+	i, ok := f.columns[column]
+	if !ok || i >= len(f.row) {
+		return ""
+	}
+	return strings.TrimSpace(f.row[i])
+}
+
+// Line returns the line number of the current row in the file (the header is line 1).
+func (f *bundleFile) Line() int {
+	return f.line
+}
+
+// Err returns the first error encountered while reading rows.
+func (f *bundleFile) Err() error {
+	return f.err
+}
+
+// Close closes the file.
+func (f *bundleFile) Close() error {
+	return f.closer.Close()
+}
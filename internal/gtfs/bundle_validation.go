@@ -0,0 +1,340 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// Referential-integrity rules checked by validateBundle, as used in validation reports
+// and in the `rule` label of the bundle integrity metric.
+const (
+	RuleRouteUnknownAgency     = "route_unknown_agency"     // routes.txt agency_id not in agency.txt (or missing with several agencies)
+	RuleTripUnknownRoute       = "trip_unknown_route"       // trips.txt route_id not in routes.txt
+	RuleTripUnknownService     = "trip_unknown_service"     // trips.txt service_id not in calendar.txt nor calendar_dates.txt
+	RuleTripUnknownShape       = "trip_unknown_shape"       // trips.txt shape_id not in shapes.txt
+	RuleStopTimeUnknownTrip    = "stop_time_unknown_trip"   // stop_times.txt trip_id not in trips.txt
+	RuleStopTimeUnknownStop    = "stop_time_unknown_stop"   // stop_times.txt stop_id not in stops.txt
+	RuleStopInvalidCoordinates = "stop_invalid_coordinates" // stops.txt coordinates missing (when required), unparsable, out of range or (0, 0)
+	RuleStopUnknownParent      = "stop_unknown_parent"      // stops.txt parent_station not in stops.txt
+	RuleStopInvalidParent      = "stop_invalid_parent"      // stops.txt parent_station missing, forbidden or of the wrong location_type
+	RuleStopParentCycle        = "stop_parent_cycle"        // stops.txt parent_station chain that loops back on itself
+)
+
+// ValidationRules lists every rule checked by validateBundle.
+var ValidationRules = []string{
+	RuleRouteUnknownAgency,
+	RuleTripUnknownRoute,
+	RuleTripUnknownService,
+	RuleTripUnknownShape,
+	RuleStopTimeUnknownTrip,
+	RuleStopTimeUnknownStop,
+	RuleStopInvalidCoordinates,
+	RuleStopUnknownParent,
+	RuleStopInvalidParent,
+	RuleStopParentCycle,
+}
+
+// maxIssuesPerRule bounds the number of issue details kept per rule in a validation report.
+// Counts are always exact; a broken bundle can have millions of bad stop_times.txt rows.
+const maxIssuesPerRule = 20
+
+// GTFS location_type values of stops.txt.
+const (
+	locationTypeStop         = 0
+	locationTypeStation      = 1
+	locationTypeEntrance     = 2
+	locationTypeGenericNode  = 3
+	locationTypeBoardingArea = 4
+)
+
+// validationReport accumulates the errors of a bundle validation.
+type validationReport struct {
+	report  *models.ValidationReport
+	samples map[string]int
+}
+
+func newValidationReport(now time.Time) *validationReport {
+	counts := make(map[string]int, len(ValidationRules))
+	for _, rule := range ValidationRules {
+		counts[rule] = 0
+	}
+	return &validationReport{
+		report:  &models.ValidationReport{ValidatedAt: now, Counts: counts, Issues: []models.ValidationIssue{}},
+		samples: make(map[string]int, len(ValidationRules)),
+	}
+}
+
+// add records an error of the rule at the current row of file.
+func (v *validationReport) add(rule string, file *bundleFile, entityID, reference string) {
+	v.report.Counts[rule]++
+	if v.samples[rule] >= maxIssuesPerRule {
+		return
+	}
+	v.samples[rule]++
+	v.report.Issues = append(v.report.Issues, models.ValidationIssue{
+		Rule:      rule,
+		File:      file.Name,
+		Line:      file.Line(),
+		EntityID:  entityID,
+		Reference: reference,
+	})
+}
+
+// stopRow is the part of a stops.txt row needed to validate the stop hierarchy.
+type stopRow struct {
+	locationType int
+	parentID     string
+	line         int
+}
+
+// validateBundle checks the referential integrity of a GTFS static bundle.
+//
+// The GTFS library drops the entities whose references it cannot resolve (a trip referencing an
+// unknown route is simply not returned), so broken bundles look healthy once parsed and are only
+// noticed when OneBusAway misbehaves. validateBundle reads the files of the raw bundle zip instead
+// (see bundleFile), streaming them row by row, and counts the errors of every rule of ValidationRules.
+//
+// The stop hierarchy rules follow the GTFS specification, which is also what geo.getClusterID
+// relies on to cluster stops:
+//   - Stations (location_type 1) must not have a parent_station.
+//   - Stops (0) may only have a station as parent.
+//   - Entrances (2) and generic nodes (3) must have a station as parent.
+//   - Boarding areas (4) must have a stop (0) as parent.
+//   - Stops, stations and entrances must have coordinates.
+//
+// Missing optional files are skipped. Returns an error if the bundle is not a valid zip file or
+// one of its files cannot be read.
+func validateBundle(data []byte, now time.Time) (*models.ValidationReport, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GTFS bundle: %w", err)
+	}
+
+	v := newValidationReport(now)
+
+	agencyIDs := make(map[string]struct{})
+	agencyCount := 0
+	if err := forEachRow(archive, "agency.txt", func(file *bundleFile) {
+		agencyCount++
+		agencyIDs[file.Get("agency_id")] = struct{}{}
+	}); err != nil {
+		return nil, err
+	}
+
+	routeIDs := make(map[string]struct{})
+	if err := forEachRow(archive, "routes.txt", func(file *bundleFile) {
+		routeID := file.Get("route_id")
+		routeIDs[routeID] = struct{}{}
+		agencyID := file.Get("agency_id")
+		if agencyID == "" {
+			if agencyCount > 1 {
+				v.add(RuleRouteUnknownAgency, file, routeID, "")
+			}
+			return
+		}
+		if _, ok := agencyIDs[agencyID]; !ok {
+			v.add(RuleRouteUnknownAgency, file, routeID, agencyID)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	serviceIDs := make(map[string]struct{})
+	for _, name := range []string{"calendar.txt", "calendar_dates.txt"} {
+		if err := forEachRow(archive, name, func(file *bundleFile) {
+			serviceIDs[file.Get("service_id")] = struct{}{}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	shapeIDs := make(map[string]struct{})
+	if err := forEachRow(archive, "shapes.txt", func(file *bundleFile) {
+		shapeIDs[file.Get("shape_id")] = struct{}{}
+	}); err != nil {
+		return nil, err
+	}
+
+	tripIDs := make(map[string]struct{})
+	if err := forEachRow(archive, "trips.txt", func(file *bundleFile) {
+		tripID := file.Get("trip_id")
+		tripIDs[tripID] = struct{}{}
+		if routeID := file.Get("route_id"); !contains(routeIDs, routeID) {
+			v.add(RuleTripUnknownRoute, file, tripID, routeID)
+		}
+		if serviceID := file.Get("service_id"); !contains(serviceIDs, serviceID) {
+			v.add(RuleTripUnknownService, file, tripID, serviceID)
+		}
+		if shapeID := file.Get("shape_id"); shapeID != "" && !contains(shapeIDs, shapeID) {
+			v.add(RuleTripUnknownShape, file, tripID, shapeID)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	stops := make(map[string]stopRow)
+	if err := forEachRow(archive, "stops.txt", func(file *bundleFile) {
+		stopID := file.Get("stop_id")
+		locationType, _ := strconv.Atoi(file.Get("location_type"))
+		stops[stopID] = stopRow{locationType: locationType, parentID: file.Get("parent_station"), line: file.Line()}
+
+		coordinatesRequired := locationType == locationTypeStop || locationType == locationTypeStation || locationType == locationTypeEntrance
+		if !validCoordinates(file.Get("stop_lat"), file.Get("stop_lon"), coordinatesRequired) {
+			v.add(RuleStopInvalidCoordinates, file, stopID, "")
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if err := validateStopHierarchy(archive, stops, v); err != nil {
+		return nil, err
+	}
+
+	if err := forEachRow(archive, "stop_times.txt", func(file *bundleFile) {
+		tripID := file.Get("trip_id")
+		if !contains(tripIDs, tripID) {
+			v.add(RuleStopTimeUnknownTrip, file, tripID, tripID)
+		}
+		if stopID := file.Get("stop_id"); stopID != "" && !containsStop(stops, stopID) {
+			v.add(RuleStopTimeUnknownStop, file, tripID, stopID)
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	return v.report, nil
+}
+
+// validateStopHierarchy checks the parent_station of every stop: it must exist, have the
+// location_type required by the stop's own location_type, and must not lead to a cycle.
+func validateStopHierarchy(archive *zip.Reader, stops map[string]stopRow, v *validationReport) error {
+	// Issues are reported against stops.txt rows; the file is only used for its name and lines.
+	file := &bundleFile{Name: "stops.txt"}
+
+	stopIDs := stopIDsInFileOrder(stops)
+	for _, stopID := range stopIDs {
+		stop := stops[stopID]
+		file.line = stop.line
+		if stop.parentID == "" {
+			switch stop.locationType {
+			case locationTypeEntrance, locationTypeGenericNode, locationTypeBoardingArea:
+				v.add(RuleStopInvalidParent, file, stopID, "")
+			}
+			continue
+		}
+		parent, ok := stops[stop.parentID]
+		if !ok {
+			v.add(RuleStopUnknownParent, file, stopID, stop.parentID)
+			continue
+		}
+		valid := true
+		switch stop.locationType {
+		case locationTypeStation:
+			valid = false // stations are the root of the hierarchy
+		case locationTypeStop, locationTypeEntrance, locationTypeGenericNode:
+			valid = parent.locationType == locationTypeStation
+		case locationTypeBoardingArea:
+			valid = parent.locationType == locationTypeStop
+		}
+		if !valid {
+			v.add(RuleStopInvalidParent, file, stopID, stop.parentID)
+		}
+	}
+
+	// Walk the parent chain of every stop; a chain that reaches a stop already on the current
+	// path is a cycle. Every stop is visited once, whatever the depth of the hierarchy.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(stops))
+	for _, start := range stopIDs {
+		var path []string
+		id := start
+		for {
+			if state[id] == visited {
+				break
+			}
+			if state[id] == visiting {
+				// Every stop from the first occurrence of id on the path is on the cycle.
+				for i := len(path) - 1; i >= 0; i-- {
+					file.line = stops[path[i]].line
+					v.add(RuleStopParentCycle, file, path[i], stops[path[i]].parentID)
+					if path[i] == id {
+						break
+					}
+				}
+				break
+			}
+			state[id] = visiting
+			path = append(path, id)
+			parentID := stops[id].parentID
+			if parentID == "" || !containsStop(stops, parentID) {
+				break
+			}
+			id = parentID
+		}
+		for _, id := range path {
+			state[id] = visited
+		}
+	}
+	return nil
+}
+
+// forEachRow calls fn for every row of the named bundle file. Missing files are skipped.
+func forEachRow(archive *zip.Reader, name string, fn func(file *bundleFile)) error {
+	file, err := openBundleFile(archive, name)
+	if err != nil || file == nil {
+		return err
+	}
+	defer file.Close()
+	for file.Next() {
+		fn(file)
+	}
+	return file.Err()
+}
+
+// validCoordinates reports whether a stop's stop_lat and stop_lon are valid. Empty coordinates are
+// only valid when not required. The (0, 0) point is rejected, as it is the usual placeholder of a
+// stop whose location is unknown.
+func validCoordinates(rawLat, rawLon string, required bool) bool {
+	if rawLat == "" && rawLon == "" {
+		return !required
+	}
+	lat, latErr := strconv.ParseFloat(rawLat, 64)
+	lon, lonErr := strconv.ParseFloat(rawLon, 64)
+	if latErr != nil || lonErr != nil {
+		return false
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return false
+	}
+	return lat != 0 || lon != 0
+}
+
+// stopIDsInFileOrder returns the IDs of the stops in the order of their stops.txt rows,
+// so that the issues kept in a report do not depend on map iteration order.
+func stopIDsInFileOrder(stops map[string]stopRow) []string {
+	ids := make([]string, 0, len(stops))
+	for id := range stops {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return stops[ids[i]].line < stops[ids[j]].line })
+	return ids
+}
+
+func contains(set map[string]struct{}, id string) bool {
+	_, ok := set[id]
+	return ok
+}
+
+func containsStop(stops map[string]stopRow, id string) bool {
+	_, ok := stops[id]
+	return ok
+}
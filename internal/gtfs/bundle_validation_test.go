@@ -0,0 +1,144 @@
+package gtfs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateBundle(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		report, err := validateBundle(readFixture(t, "gtfs.zip"), time.Now())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if total := report.TotalErrors(); total != 0 {
+			t.Errorf("expected no integrity errors in the fixture, got %d: %+v", total, report.Issues)
+		}
+		if len(report.Counts) != len(ValidationRules) {
+			t.Errorf("expected a count for each of the %d rules, got %d", len(ValidationRules), len(report.Counts))
+		}
+	})
+
+	t.Run("broken references", func(t *testing.T) {
+		data := zipFiles(t, map[string]string{
+			"agency.txt": "agency_id,agency_name,agency_url,agency_timezone\n" +
+				"A1,Agency 1,https://a1.example.com,America/Los_Angeles\n" +
+				"A2,Agency 2,https://a2.example.com,America/Los_Angeles\n",
+			"routes.txt": "route_id,agency_id,route_short_name,route_type\n" +
+				"R1,A1,1,3\n" +
+				"R2,A9,2,3\n" + // unknown agency
+				"R3,,3,3\n", // no agency with several agencies
+			"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+				"WK,1,1,1,1,1,0,0,20250101,20251231\n",
+			"calendar_dates.txt": "service_id,date,exception_type\n" +
+				"HOL,20251225,1\n",
+			"shapes.txt": "shape_id,shape_pt_lat,shape_pt_lon,shape_pt_sequence\n" +
+				"S1,47.6,-122.3,1\n",
+			"trips.txt": "route_id,service_id,trip_id,shape_id\n" +
+				"R1,WK,T1,S1\n" +
+				"R1,HOL,T2,\n" +
+				"R9,WK,T3,S1\n" + // unknown route
+				"R1,XX,T4,S1\n" + // unknown service
+				"R1,WK,T5,S9\n", // unknown shape
+			"stops.txt": "stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+				"ST1,Station,47.6,-122.3,1,\n" +
+				"P1,Platform,47.6,-122.3,0,ST1\n" +
+				"P2,Platform,,,0,\n" + // missing coordinates
+				"P3,Platform,0,0,0,\n" + // null island
+				"P4,Platform,91,-122.3,0,\n" + // out of range
+				"P5,Platform,47.6,-122.3,0,ST9\n" + // unknown parent
+				"E1,Entrance,47.6,-122.3,2,\n" + // entrance without parent
+				"B1,Boarding area,,,4,ST1\n" + // boarding area whose parent is not a stop
+				"ST2,Station,47.6,-122.3,1,ST1\n" + // station with a parent
+				"N1,Node,,,3,N2\n" + // cycle N1 -> N2 -> N1, parents not stations
+				"N2,Node,,,3,N1\n",
+			"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+				"T1,08:00:00,08:00:00,P1,1\n" +
+				"T1,08:10:00,08:10:00,P9,2\n" + // unknown stop
+				"T9,08:00:00,08:00:00,P1,1\n", // unknown trip
+		})
+
+		report, err := validateBundle(data, time.Now())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := map[string]int{
+			RuleRouteUnknownAgency:     2,
+			RuleTripUnknownRoute:       1,
+			RuleTripUnknownService:     1,
+			RuleTripUnknownShape:       1,
+			RuleStopTimeUnknownTrip:    1,
+			RuleStopTimeUnknownStop:    1,
+			RuleStopInvalidCoordinates: 3,
+			RuleStopUnknownParent:      1,
+			RuleStopInvalidParent:      5, // E1, B1, ST2, N1, N2
+			RuleStopParentCycle:        2,
+		}
+		for rule, want := range expected {
+			if got := report.Counts[rule]; got != want {
+				t.Errorf("rule %s: expected %d errors, got %d", rule, want, got)
+			}
+		}
+
+		unknownStop := ""
+		for _, issue := range report.Issues {
+			if issue.Rule == RuleStopTimeUnknownStop {
+				unknownStop = fmt.Sprintf("%s:%d:%s:%s", issue.File, issue.Line, issue.EntityID, issue.Reference)
+			}
+		}
+		if unknownStop != "stop_times.txt:3:T1:P9" {
+			t.Errorf("expected the unknown stop issue to point at stop_times.txt line 3, got %q", unknownStop)
+		}
+	})
+
+	t.Run("line numbers after a multi-line field", func(t *testing.T) {
+		data := zipFiles(t, map[string]string{
+			"agency.txt": "agency_id,agency_name,agency_url,agency_timezone\n" +
+				"A1,Agency 1,https://a1.example.com,America/Los_Angeles\n",
+			"routes.txt": "route_id,agency_id,route_short_name,route_long_name,route_type\n" +
+				"R1,A1,1,\"Downtown\nvia Main St\",3\n" + // quoted field spanning lines 2 and 3
+				"\n" +
+				"R2,A9,2,Uptown,3\n", // unknown agency, on line 5
+		})
+
+		report, err := validateBundle(data, time.Now())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(report.Issues) != 1 || report.Issues[0].Line != 5 {
+			t.Errorf("expected a single issue on routes.txt line 5, got %+v", report.Issues)
+		}
+	})
+
+	t.Run("issue details are capped per rule", func(t *testing.T) {
+		var stopTimes strings.Builder
+		stopTimes.WriteString("trip_id,arrival_time,departure_time,stop_id,stop_sequence\n")
+		for i := 0; i < maxIssuesPerRule+10; i++ {
+			fmt.Fprintf(&stopTimes, "T%d,08:00:00,08:00:00,P1,1\n", i)
+		}
+		data := zipFiles(t, map[string]string{
+			"stops.txt":      "stop_id,stop_lat,stop_lon\nP1,47.6,-122.3\n",
+			"stop_times.txt": stopTimes.String(),
+		})
+
+		report, err := validateBundle(data, time.Now())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := report.Counts[RuleStopTimeUnknownTrip]; got != maxIssuesPerRule+10 {
+			t.Errorf("expected %d errors, got %d", maxIssuesPerRule+10, got)
+		}
+		if len(report.Issues) != maxIssuesPerRule {
+			t.Errorf("expected %d issue details, got %d", maxIssuesPerRule, len(report.Issues))
+		}
+	})
+
+	t.Run("invalid zip", func(t *testing.T) {
+		if _, err := validateBundle([]byte("not a zip"), time.Now()); err == nil {
+			t.Error("expected an error for an invalid zip file")
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package gtfs
+
+import (
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// feedHeaderField is the field number of the header in a GTFS-RT FeedMessage.
+const feedHeaderField = 1
+
+// parseFeedHeader returns the FeedHeader of a raw GTFS-RT FeedMessage, or nil if the payload has none.
+//
+// remoteGtfs.ParseRealtime only keeps the header timestamp. Instead of unmarshaling the whole
+// message a second time, the top-level fields are scanned and only the header is decoded:
+// producers write it first, so the scan usually stops at the first field.
+func parseFeedHeader(data []byte) *gtfsrt.FeedHeader {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+		if num == feedHeaderField && typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil
+			}
+			header := &gtfsrt.FeedHeader{}
+			// The version is a required field; a header without it is still worth reading.
+			if err := (proto.UnmarshalOptions{AllowPartial: true}).Unmarshal(value, header); err != nil {
+				return nil
+			}
+			return header
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+	}
+	return nil
+}
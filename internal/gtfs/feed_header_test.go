@@ -0,0 +1,31 @@
+package gtfs
+
+import (
+	"testing"
+
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseFeedHeader(t *testing.T) {
+	// The header is written after an entity, and lacks its required version.
+	data, err := proto.Marshal(&gtfsrt.FeedEntity{Id: proto.String("vehicle-1")})
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT entity: %v", err)
+	}
+	entity := append([]byte{2<<3 | 2, byte(len(data))}, data...)
+	header, err := proto.MarshalOptions{AllowPartial: true}.Marshal(&gtfsrt.FeedHeader{Timestamp: proto.Uint64(1700000000)})
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT header: %v", err)
+	}
+	message := append(entity, append([]byte{1<<3 | 2, byte(len(header))}, header...)...)
+
+	parsed := parseFeedHeader(message)
+	if parsed == nil || parsed.GetTimestamp() != 1700000000 || parsed.GetIncrementality() != gtfsrt.FeedHeader_FULL_DATASET {
+		t.Errorf("Expected the header to be parsed, got %v", parsed)
+	}
+
+	if parsed := parseFeedHeader([]byte("<html>Service Unavailable</html>")); parsed != nil {
+		t.Errorf("Expected no header in a non-protobuf payload, got %v", parsed)
+	}
+}
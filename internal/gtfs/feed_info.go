@@ -0,0 +1,141 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"time"
+
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// Sources a bundle's validity period can be derived from, in order of precedence.
+// They are used in logs and in the `source` label of the bundle expiration source metric.
+const (
+	ValiditySourceFeedInfo      = "feed_info"      // feed_end_date of feed_info.txt
+	ValiditySourceCalendar      = "calendar"       // calendar.txt end dates, extended by calendar_dates.txt additions
+	ValiditySourceCalendarDates = "calendar_dates" // calendar_dates.txt only, for bundles without calendar.txt
+)
+
+// BundleValidity is the period during which a GTFS static bundle provides service.
+type BundleValidity struct {
+	// Earliest is the first date at which part of the bundle stops providing service
+	// (the earliest service end date, capped at the feed end date).
+	Earliest time.Time
+	// Latest is the date after which the bundle provides no service at all.
+	Latest time.Time
+	// Source is the data the period was derived from (one of the ValiditySource constants).
+	Source string
+}
+
+// parseFeedInfo parses feed_info.txt from the raw bundle zip.
+//
+// The GTFS library does not parse feed_info.txt, so it is read directly from the archive.
+// It returns nil, without error, when the bundle has no feed_info.txt or the file has no data row.
+func parseFeedInfo(data []byte) (*models.FeedInfo, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GTFS bundle: %w", err)
+	}
+
+	file, err := openBundleFile(archive, "feed_info.txt")
+	if err != nil || file == nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if !file.Next() {
+		return nil, file.Err()
+	}
+
+	feedInfo := &models.FeedInfo{
+		PublisherName: file.Get("feed_publisher_name"),
+		PublisherURL:  file.Get("feed_publisher_url"),
+		Lang:          file.Get("feed_lang"),
+		Version:       file.Get("feed_version"),
+	}
+	if feedInfo.StartDate, err = parseServiceDate(file.Get("feed_start_date")); err != nil {
+		return nil, fmt.Errorf("invalid feed_start_date in feed_info.txt: %w", err)
+	}
+	if feedInfo.EndDate, err = parseServiceDate(file.Get("feed_end_date")); err != nil {
+		return nil, fmt.Errorf("invalid feed_end_date in feed_info.txt: %w", err)
+	}
+	return feedInfo, nil
+}
+
+// parseServiceDate parses a GTFS date (YYYYMMDD) as midnight UTC. An empty value yields the zero time.
+func parseServiceDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("20060102", value)
+}
+
+// getBundleValidity returns the validity period of a bundle from its most authoritative source:
+//   - feed_end_date of feed_info.txt, when set. The earliest service end date is still reported
+//     as Earliest when it comes first, since part of the service stops there.
+//   - Otherwise the service end dates of calendar.txt and calendar_dates.txt (see getServiceEndDates).
+//
+// Returns an error if neither source provides a date.
+func getBundleValidity(staticData *models.StaticData) (BundleValidity, error) {
+	if staticData == nil {
+		return BundleValidity{}, fmt.Errorf("static data is nil")
+	}
+
+	earliest, latest, source, serviceErr := getServiceEndDates(staticData)
+
+	if staticData.FeedInfo != nil && !staticData.FeedInfo.EndDate.IsZero() {
+		feedEnd := staticData.FeedInfo.EndDate
+		validity := BundleValidity{Earliest: feedEnd, Latest: feedEnd, Source: ValiditySourceFeedInfo}
+		if serviceErr == nil && earliest.Before(feedEnd) {
+			validity.Earliest = earliest
+		}
+		return validity, nil
+	}
+
+	if serviceErr != nil {
+		return BundleValidity{}, serviceErr
+	}
+	return BundleValidity{Earliest: earliest, Latest: latest, Source: source}, nil
+}
+
+// getServiceEndDates returns the earliest and latest service end dates of the bundle's services,
+// and the source they were derived from.
+//
+// The end date of a service is the later of its calendar.txt end_date and its last date added by
+// calendar_dates.txt, so that services defined only in calendar_dates.txt are accounted for.
+// Services with no date at all are ignored.
+func getServiceEndDates(staticData *models.StaticData) (earliest, latest time.Time, source string, err error) {
+	hasCalendar := false
+	found := false
+	for _, service := range staticData.Services {
+		end := service.EndDate
+		if !end.IsZero() {
+			hasCalendar = true
+		}
+		for _, date := range service.AddedDates {
+			if date.After(end) {
+				end = date
+			}
+		}
+		if end.IsZero() {
+			continue
+		}
+		if !found || end.Before(earliest) {
+			earliest = end
+		}
+		if !found || end.After(latest) {
+			latest = end
+		}
+		found = true
+	}
+
+	if !found {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("no services found in GTFS bundle")
+	}
+	source = ValiditySourceCalendarDates
+	if hasCalendar {
+		source = ValiditySourceCalendar
+	}
+	return earliest, latest, source, nil
+}
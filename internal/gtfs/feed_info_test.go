@@ -0,0 +1,182 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// zipFiles builds an in-memory zip archive from file names and contents.
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseFeedInfo(t *testing.T) {
+	t.Run("fixture", func(t *testing.T) {
+		feedInfo, err := parseFeedInfo(readFixture(t, "gtfs.zip"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if feedInfo == nil {
+			t.Fatal("expected feed info, got nil")
+		}
+		if feedInfo.PublisherName != "Sound Transit" {
+			t.Errorf("expected publisher %q, got %q", "Sound Transit", feedInfo.PublisherName)
+		}
+		if feedInfo.Version != "SC-Fall-2024.11" {
+			t.Errorf("expected version %q, got %q", "SC-Fall-2024.11", feedInfo.Version)
+		}
+		if expected := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC); !feedInfo.StartDate.Equal(expected) {
+			t.Errorf("expected start date %s, got %s", expected, feedInfo.StartDate)
+		}
+		if expected := time.Date(2025, 3, 28, 0, 0, 0, 0, time.UTC); !feedInfo.EndDate.Equal(expected) {
+			t.Errorf("expected end date %s, got %s", expected, feedInfo.EndDate)
+		}
+	})
+
+	t.Run("byte order mark and missing dates", func(t *testing.T) {
+		data := zipFiles(t, map[string]string{
+			"feed_info.txt": "\ufefffeed_publisher_name,feed_publisher_url,feed_lang,feed_version\nAgency,https://example.com,en,v2\n",
+		})
+		feedInfo, err := parseFeedInfo(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if feedInfo == nil || feedInfo.PublisherName != "Agency" || feedInfo.Version != "v2" {
+			t.Fatalf("unexpected feed info: %+v", feedInfo)
+		}
+		if !feedInfo.StartDate.IsZero() || !feedInfo.EndDate.IsZero() {
+			t.Errorf("expected zero dates, got %s and %s", feedInfo.StartDate, feedInfo.EndDate)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		feedInfo, err := parseFeedInfo(zipFiles(t, map[string]string{"agency.txt": "agency_id\n1\n"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if feedInfo != nil {
+			t.Errorf("expected nil feed info, got %+v", feedInfo)
+		}
+	})
+
+	t.Run("invalid date", func(t *testing.T) {
+		data := zipFiles(t, map[string]string{
+			"feed_info.txt": "feed_publisher_name,feed_end_date\nAgency,2025-03-28\n",
+		})
+		if _, err := parseFeedInfo(data); err == nil {
+			t.Error("expected an error for an invalid feed_end_date")
+		}
+	})
+}
+
+func TestGetBundleValidity(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2025, month, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name             string
+		staticData       *models.StaticData
+		expectedEarliest time.Time
+		expectedLatest   time.Time
+		expectedSource   string
+		expectError      bool
+	}{
+		{
+			name: "feed_info end date is authoritative",
+			staticData: &models.StaticData{
+				FeedInfo: &models.FeedInfo{EndDate: day(6, 30)},
+				Services: []remoteGtfs.Service{{Id: "a", EndDate: day(3, 1)}, {Id: "b", EndDate: day(12, 31)}},
+			},
+			expectedEarliest: day(3, 1),
+			expectedLatest:   day(6, 30),
+			expectedSource:   ValiditySourceFeedInfo,
+		},
+		{
+			name: "feed_info end date caps the earliest date",
+			staticData: &models.StaticData{
+				FeedInfo: &models.FeedInfo{EndDate: day(2, 1)},
+				Services: []remoteGtfs.Service{{Id: "a", EndDate: day(3, 1)}},
+			},
+			expectedEarliest: day(2, 1),
+			expectedLatest:   day(2, 1),
+			expectedSource:   ValiditySourceFeedInfo,
+		},
+		{
+			name: "feed_info without end date falls back to calendar",
+			staticData: &models.StaticData{
+				FeedInfo: &models.FeedInfo{Version: "v1"},
+				Services: []remoteGtfs.Service{
+					{Id: "a", EndDate: day(3, 1), AddedDates: []time.Time{day(4, 15)}},
+					{Id: "b", EndDate: day(5, 1)},
+				},
+			},
+			expectedEarliest: day(4, 15),
+			expectedLatest:   day(5, 1),
+			expectedSource:   ValiditySourceCalendar,
+		},
+		{
+			name: "calendar_dates only",
+			staticData: &models.StaticData{
+				Services: []remoteGtfs.Service{
+					{Id: "a", AddedDates: []time.Time{day(1, 10), day(1, 20)}},
+					{Id: "b", AddedDates: []time.Time{day(2, 10)}},
+				},
+			},
+			expectedEarliest: day(1, 20),
+			expectedLatest:   day(2, 10),
+			expectedSource:   ValiditySourceCalendarDates,
+		},
+		{
+			name:        "no dates",
+			staticData:  &models.StaticData{Services: []remoteGtfs.Service{{Id: "a"}}},
+			expectError: true,
+		},
+		{
+			name:        "nil static data",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validity, err := getBundleValidity(tt.staticData)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !validity.Earliest.Equal(tt.expectedEarliest) {
+				t.Errorf("expected earliest %s, got %s", tt.expectedEarliest, validity.Earliest)
+			}
+			if !validity.Latest.Equal(tt.expectedLatest) {
+				t.Errorf("expected latest %s, got %s", tt.expectedLatest, validity.Latest)
+			}
+			if validity.Source != tt.expectedSource {
+				t.Errorf("expected source %q, got %q", tt.expectedSource, validity.Source)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package gtfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+const (
+	// FeedStatic and FeedRealtime name the feed types, as used in errors and in the `feed` metric label.
+	FeedStatic   = "static"
+	FeedRealtime = "realtime"
+
+	// defaultMaxStaticBundleSize is used when no positive static bundle size limit is configured.
+	defaultMaxStaticBundleSize = 512 << 20
+	// defaultMaxRealtimeFeedSize is used when no positive GTFS-RT feed size limit is configured.
+	defaultMaxRealtimeFeedSize = 16 << 20
+	// defaultSpoolThreshold is used when no positive spool threshold is configured.
+	defaultSpoolThreshold = 32 << 20
+	// defaultBundleParseWorkers is used when no positive parse concurrency is configured.
+	defaultBundleParseWorkers = 2
+)
+
+// FeedTooLargeError is returned when a downloaded feed exceeds the size limit of its feed type.
+type FeedTooLargeError struct {
+	Feed  string // FeedStatic or FeedRealtime
+	URL   string
+	Limit int64 // Size limit in bytes
+}
+
+func (e *FeedTooLargeError) Error() string {
+	return fmt.Sprintf("GTFS %s feed at %s exceeds the size limit of %d bytes", e.Feed, e.URL, e.Limit)
+}
+
+// FeedLimits bounds the memory used to download and parse feeds.
+//
+// Without limits, every download is read fully into memory with io.ReadAll: several large agencies
+// refreshed at the same time cause memory spikes, and a misconfigured URL serving a huge file
+// could make the watchdog run out of memory. FeedLimits provides:
+//   - A maximum size per feed type. Larger downloads are aborted as soon as the limit is crossed
+//     (or right away when the Content-Length header announces it) with a FeedTooLargeError.
+//   - A spool threshold: static bundles larger than it are streamed to a temporary file instead of
+//     being buffered in memory while downloading, and only read back right before parsing.
+//   - A global semaphore bounding how many static bundles are parsed at the same time,
+//     since parsing needs the whole bundle in memory along with the parsed result.
+//
+// Spooling only spares memory while downloading: a spooled bundle is read back whole to be parsed.
+// Bundles are therefore only read back (or loaded from the cache) while holding a parse slot, so
+// that parse workers × MaxStaticBundleSize, plus the parsed results, bounds the memory they use.
+//
+// A single FeedLimits is shared by every download of the application (see NewGtfsService).
+type FeedLimits struct {
+	MaxStaticBundleSize int64 // Maximum size in bytes of a GTFS static bundle
+	MaxRealtimeFeedSize int64 // Maximum size in bytes of a GTFS-RT feed
+	SpoolThreshold      int64 // Static bundles larger than this many bytes are spooled to disk
+
+	// OnLimitExceeded, if set, is called every time a download is aborted for exceeding its limit.
+	// It lets the caller record a metric without this package depending on the metrics package.
+	OnLimitExceeded func(serverID int, feed string)
+
+	parseSlots chan struct{} // One token per bundle being parsed
+}
+
+// NewFeedLimits creates the feed limits. Sizes are in bytes.
+// Non-positive values fall back to defaultMaxStaticBundleSize, defaultMaxRealtimeFeedSize,
+// defaultSpoolThreshold and defaultBundleParseWorkers.
+func NewFeedLimits(maxStaticBundleSize, maxRealtimeFeedSize, spoolThreshold int64, parseWorkers int) *FeedLimits {
+	if maxStaticBundleSize <= 0 {
+		maxStaticBundleSize = defaultMaxStaticBundleSize
+	}
+	if maxRealtimeFeedSize <= 0 {
+		maxRealtimeFeedSize = defaultMaxRealtimeFeedSize
+	}
+	if spoolThreshold <= 0 {
+		spoolThreshold = defaultSpoolThreshold
+	}
+	if parseWorkers <= 0 {
+		parseWorkers = defaultBundleParseWorkers
+	}
+	return &FeedLimits{
+		MaxStaticBundleSize: maxStaticBundleSize,
+		MaxRealtimeFeedSize: maxRealtimeFeedSize,
+		SpoolThreshold:      spoolThreshold,
+		parseSlots:          make(chan struct{}, parseWorkers),
+	}
+}
+
+// acquireParse waits for a parse slot. It returns ctx.Err() if ctx is done first.
+func (l *FeedLimits) acquireParse(ctx context.Context) error {
+	select {
+	case l.parseSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseParse frees a parse slot taken by acquireParse.
+func (l *FeedLimits) releaseParse() {
+	<-l.parseSlots
+}
+
+// tooLarge builds the error of a download that exceeded its limit and notifies OnLimitExceeded.
+func (l *FeedLimits) tooLarge(serverID int, feed, url string, limit int64) error {
+	if l.OnLimitExceeded != nil {
+		l.OnLimitExceeded(serverID, feed)
+	}
+	return &FeedTooLargeError{Feed: feed, URL: url, Limit: limit}
+}
+
+// readRealtimeFeed reads a GTFS-RT response body, failing once it exceeds MaxRealtimeFeedSize.
+// contentLength is the announced body size, or -1 when unknown.
+func (l *FeedLimits) readRealtimeFeed(body io.Reader, contentLength int64, serverID int, url string) ([]byte, error) {
+	limit := l.MaxRealtimeFeedSize
+	if contentLength > limit {
+		return nil, l.tooLarge(serverID, FeedRealtime, url, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, l.tooLarge(serverID, FeedRealtime, url, limit)
+	}
+	return data, nil
+}
+
+// spooledBundle is a downloaded static bundle, held in memory or, past the spool threshold,
+// in a temporary file. Close must be called to remove the temporary file.
+type spooledBundle struct {
+	memory bytes.Buffer
+	file   *os.File // Set once the bundle is spooled to disk
+	size   int64
+	sha256 string // Hex-encoded SHA-256 hash of the bundle
+}
+
+// spoolStaticBundle streams a static bundle response body, hashing it on the way, and fails once
+// it exceeds MaxStaticBundleSize. Bundles larger than SpoolThreshold are written to a temporary file.
+// contentLength is the announced body size, or -1 when unknown.
+func (l *FeedLimits) spoolStaticBundle(body io.Reader, contentLength int64, serverID int, url string) (*spooledBundle, error) {
+	limit := l.MaxStaticBundleSize
+	if contentLength > limit {
+		return nil, l.tooLarge(serverID, FeedStatic, url, limit)
+	}
+
+	bundle := &spooledBundle{}
+	hasher := newContentHasher()
+	reader := io.TeeReader(io.LimitReader(body, limit+1), hasher)
+
+	// Buffer up to the spool threshold in memory; most bundles never go past it.
+	if _, err := io.Copy(&bundle.memory, io.LimitReader(reader, l.SpoolThreshold+1)); err != nil {
+		return nil, err
+	}
+	if int64(bundle.memory.Len()) > l.SpoolThreshold {
+		file, err := os.CreateTemp("", "watchdog-gtfs-bundle-*.zip")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary file for GTFS bundle: %w", err)
+		}
+		bundle.file = file
+		if _, err := bundle.memory.WriteTo(file); err != nil {
+			bundle.Close()
+			return nil, fmt.Errorf("failed to spool GTFS bundle to disk: %w", err)
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			bundle.Close()
+			return nil, fmt.Errorf("failed to spool GTFS bundle to disk: %w", err)
+		}
+		bundle.memory = bytes.Buffer{}
+		bundle.size, err = file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			bundle.Close()
+			return nil, err
+		}
+	} else {
+		bundle.size = int64(bundle.memory.Len())
+	}
+
+	if bundle.size > limit {
+		bundle.Close()
+		return nil, l.tooLarge(serverID, FeedStatic, url, limit)
+	}
+	bundle.sha256 = hasher.String()
+	return bundle, nil
+}
+
+// contentHasher computes the hash identifying the content of a feed or bundle: its SHA-256,
+// hex-encoded by String. It is fed through Write, so that large bundles are hashed as they stream.
+type contentHasher struct {
+	hash.Hash
+}
+
+func newContentHasher() contentHasher {
+	return contentHasher{Hash: sha256.New()}
+}
+
+// String returns the hex-encoded hash of everything written so far.
+func (h contentHasher) String() string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Bytes returns the content of the bundle, reading it back from disk if it was spooled.
+// The whole bundle, up to MaxStaticBundleSize, is then in memory: callers must hold a parse slot.
+func (b *spooledBundle) Bytes() ([]byte, error) {
+	if b.file == nil {
+		return b.memory.Bytes(), nil
+	}
+	data := make([]byte, b.size)
+	if _, err := b.file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read spooled GTFS bundle: %w", err)
+	}
+	return data, nil
+}
+
+// Close releases the bundle and removes its temporary file, if any.
+func (b *spooledBundle) Close() error {
+	b.memory = bytes.Buffer{}
+	if b.file == nil {
+		return nil
+	}
+	name := b.file.Name()
+	b.file.Close()
+	b.file = nil
+	return os.Remove(name)
+}
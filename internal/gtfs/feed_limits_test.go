@@ -0,0 +1,145 @@
+package gtfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpoolStaticBundle(t *testing.T) {
+	content := bytes.Repeat([]byte("gtfs"), 64) // 256 bytes
+	sum := sha256.Sum256(content)
+	expectedHash := hex.EncodeToString(sum[:])
+
+	t.Run("Small bundle stays in memory", func(t *testing.T) {
+		limits := NewFeedLimits(1024, 0, 512, 0)
+		bundle, err := limits.spoolStaticBundle(bytes.NewReader(content), -1, 1, "http://example.com/gtfs.zip")
+		if err != nil {
+			t.Fatalf("spoolStaticBundle failed: %v", err)
+		}
+		defer bundle.Close()
+		if bundle.file != nil {
+			t.Error("expected a bundle below the spool threshold to stay in memory")
+		}
+		assertSpooledBundle(t, bundle, content, expectedHash)
+	})
+
+	t.Run("Large bundle is spooled to disk", func(t *testing.T) {
+		limits := NewFeedLimits(1024, 0, 100, 0)
+		bundle, err := limits.spoolStaticBundle(bytes.NewReader(content), -1, 1, "http://example.com/gtfs.zip")
+		if err != nil {
+			t.Fatalf("spoolStaticBundle failed: %v", err)
+		}
+		if bundle.file == nil {
+			t.Fatal("expected a bundle above the spool threshold to be spooled to disk")
+		}
+		name := bundle.file.Name()
+		assertSpooledBundle(t, bundle, content, expectedHash)
+
+		if err := bundle.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("expected the temporary file %s to be removed, got %v", name, err)
+		}
+	})
+
+	for _, tc := range []struct {
+		name          string
+		contentLength int64
+		threshold     int64
+	}{
+		{name: "Announced size over the limit", contentLength: int64(len(content)), threshold: 512},
+		{name: "Streamed size over the limit in memory", contentLength: -1, threshold: 512},
+		{name: "Streamed size over the limit on disk", contentLength: -1, threshold: 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			limits := NewFeedLimits(200, 0, tc.threshold, 0)
+			var exceeded []string
+			limits.OnLimitExceeded = func(serverID int, feed string) {
+				exceeded = append(exceeded, feed)
+			}
+			_, err := limits.spoolStaticBundle(bytes.NewReader(content), tc.contentLength, 1, "http://example.com/gtfs.zip")
+			var tooLarge *FeedTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("expected a FeedTooLargeError, got %v", err)
+			}
+			if tooLarge.Feed != FeedStatic || tooLarge.Limit != 200 {
+				t.Errorf("unexpected error: %+v", tooLarge)
+			}
+			if len(exceeded) != 1 || exceeded[0] != FeedStatic {
+				t.Errorf("expected OnLimitExceeded to be called once for the static feed, got %v", exceeded)
+			}
+		})
+	}
+}
+
+func assertSpooledBundle(t *testing.T, bundle *spooledBundle, content []byte, expectedHash string) {
+	t.Helper()
+	if bundle.size != int64(len(content)) {
+		t.Errorf("expected size %d, got %d", len(content), bundle.size)
+	}
+	if bundle.sha256 != expectedHash {
+		t.Errorf("expected hash %s, got %s", expectedHash, bundle.sha256)
+	}
+	data, err := bundle.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("expected the bundle content to be preserved")
+	}
+}
+
+func TestReadRealtimeFeed(t *testing.T) {
+	limits := NewFeedLimits(0, 10, 0, 0)
+
+	data, err := limits.readRealtimeFeed(strings.NewReader("0123456789"), -1, 1, "http://example.com/rt")
+	if err != nil || string(data) != "0123456789" {
+		t.Fatalf("expected a feed at the limit to be read, got %q, %v", data, err)
+	}
+
+	var tooLarge *FeedTooLargeError
+	if _, err := limits.readRealtimeFeed(strings.NewReader("0123456789a"), -1, 1, "http://example.com/rt"); !errors.As(err, &tooLarge) || tooLarge.Feed != FeedRealtime {
+		t.Errorf("expected a FeedTooLargeError for the realtime feed, got %v", err)
+	}
+	if _, err := limits.readRealtimeFeed(strings.NewReader(""), 11, 1, "http://example.com/rt"); !errors.As(err, &tooLarge) {
+		t.Errorf("expected a FeedTooLargeError from the announced size, got %v", err)
+	}
+}
+
+func TestParseSlots(t *testing.T) {
+	limits := NewFeedLimits(0, 0, 0, 1)
+	if err := limits.acquireParse(context.Background()); err != nil {
+		t.Fatalf("acquireParse failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limits.acquireParse(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected acquireParse to give up once ctx is canceled, got %v", err)
+	}
+
+	limits.releaseParse()
+	if err := limits.acquireParse(context.Background()); err != nil {
+		t.Errorf("expected the released slot to be available, got %v", err)
+	}
+}
+
+func TestDownloadGTFSBundleTooLarge(t *testing.T) {
+	mockServer := setupGtfsServer(t, "gtfs.zip")
+	defer mockServer.Close()
+
+	limits := NewFeedLimits(1024, 0, 0, 0)
+	_, err := downloadGTFSBundle(context.Background(), http.DefaultClient, mockServer.URL, 1, 1, nil, limits, nil)
+	var tooLarge *FeedTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected a FeedTooLargeError, got %v", err)
+	}
+}
@@ -2,12 +2,13 @@ package gtfs
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,11 +24,17 @@ import (
 // downloadGTFSBundles fetches and processes GTFS static bundles concurrently for a list of OBA servers.
 //
 // For each server, it starts a dedicated goroutine that:
-//   1. Attempts to download and parse the GTFS static bundle from the server’s GTFS URL,
+//   1. Attempts to download the GTFS static bundle from the server’s GTFS URL,
 //      using exponential backoff with retries (up to maxRetries).
+//      When a bundle is already stored for the server, the download is conditional (see downloadGTFSBundle):
+//      an unchanged bundle is neither parsed nor stored again, and steps 2 to 5 are skipped.
+//      A downloaded bundle is also saved to the on-disk cache, and an unchanged bundle that was loaded
+//      from the cache is marked as confirmed by the feed host (see loadCachedBundles).
 //   2. Stores the parsed GTFS static data in the provided StaticStore, keyed by server ID.
 //   3. Computes a geographic bounding box from the stop locations in the static data.
 //   4. Stores the bounding box in the provided BoundingBoxStore.
+//   5. When the new bundle replaces a previous one, records the diff between both in the changelog
+//      (see diffStaticData), and reports a Sentry event if the diff crosses the changelog's thresholds.
 //
 // Concurrency:
 //   - A goroutine is launched for each server.
@@ -40,11 +47,15 @@ import (
 //   - logger: A structured logger for recording success/failure logs.
 //   - boundingBoxStore: A store for computed bounding boxes, one per server.
 //   - staticStore: A store for parsed GTFS static data, keyed by server ID.
+//   - client: The shared HTTP client used for the downloads.
+//   - limits: The size limits and parse semaphore shared by every download.
+//   - changelog: The log bundle diffs are recorded in; nil disables diffing.
+//   - cache: The on-disk cache downloaded bundles are saved to; nil disables caching.
 //   - maxRetries: The maximum number of retries (with exponential backoff) when downloading a bundle.
 //
 // This function does not return an error; failures are handled and reported individually per server.
 
-func downloadGTFSBundles(ctx context.Context, servers []models.ObaServer, logger *slog.Logger, boundingBoxStore *geo.BoundingBoxStore, staticStore *StaticStore, maxRetries int) {
+func downloadGTFSBundles(ctx context.Context, servers []models.ObaServer, logger *slog.Logger, boundingBoxStore *geo.BoundingBoxStore, staticStore *StaticStore, client *http.Client, limits *FeedLimits, changelog *BundleChangelog, cache *BundleCache, maxRetries int) {
 	var wg sync.WaitGroup
 	for _, server := range servers {
 		s := server
@@ -52,7 +63,16 @@ func downloadGTFSBundles(ctx context.Context, servers []models.ObaServer, logger
 		go func() {
 			defer wg.Done()
 
-			staticBundle, err := downloadGTFSBundle(ctx, s.GtfsUrl, s.ID, maxRetries)
+			// Only validators of a bundle that is still stored are reused, so that a bundle
+			// evicted from the StaticStore is always downloaded and parsed again.
+			var previous *models.BundleInfo
+			previousData, _ := staticStore.Get(s.ID)
+			if previousData != nil && previousData.Bundle.SHA256 != "" {
+				bundle := previousData.Bundle
+				previous = &bundle
+			}
+
+			downloaded, err := downloadGTFSBundle(ctx, client, s.GtfsUrl, s.ID, maxRetries, previous, limits, cache)
 			if err != nil {
 				report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
 					Tags: utils.MakeMap("server_id", fmt.Sprintf("%d", server.ID)),
@@ -64,9 +84,16 @@ func downloadGTFSBundles(ctx context.Context, servers []models.ObaServer, logger
 				logger.Error("Failed to download GTFS bundle", "server_id", s.ID, "error", err)
 				return
 			}
-			logger.Info("Successfully downloaded GTFS bundle", "server_id", s.ID)
+			if downloaded.Static == nil {
+				logger.Info("GTFS bundle unchanged, skipping parse", "server_id", s.ID, "sha256", downloaded.Info.SHA256)
+				if previousData != nil && (!previousData.Bundle.CachedAt.IsZero() || downloaded.Info != previousData.Bundle) {
+					refreshUnchangedBundle(s, previousData, downloaded.Info, staticStore, cache, logger)
+				}
+				return
+			}
+			logger.Info("Successfully downloaded GTFS bundle", "server_id", s.ID, "sha256", downloaded.Info.SHA256, "size_bytes", downloaded.Info.Size)
 
-			err = storeGTFSBundle(staticBundle, s.ID, staticStore, boundingBoxStore)
+			err = storeGTFSBundle(downloaded, s.ID, staticStore, boundingBoxStore)
 			if err != nil {
 				report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
 					Tags: utils.MakeMap("server_id", fmt.Sprintf("%d", s.ID)),
@@ -77,11 +104,81 @@ func downloadGTFSBundles(ctx context.Context, servers []models.ObaServer, logger
 				})
 				logger.Error("Failed to store GTFS bundle", "server_id", s.ID, "error", err)
 			}
+
+			if changelog != nil && previousData != nil {
+				if staticData, ok := staticStore.Get(s.ID); ok && staticData != nil {
+					recordBundleDiff(changelog, s, previousData, staticData, logger)
+				}
+			}
 		}()
 	}
 	wg.Wait()
 }
 
+// refreshUnchangedBundle records that a download found the stored bundle of a server unchanged,
+// with the given BundleInfo (the previous one, with the validators of the latest response).
+//
+// The stored bundle takes the new validators, so that the next download is conditional on them,
+// and is no longer reported as served from the cache if it was loaded from it. The cache records
+// both, so the cache age starts over and the validators are reused after the next restart.
+//
+// The stored StaticData is replaced by a copy rather than modified, since checks may be reading it.
+func refreshUnchangedBundle(server models.ObaServer, stored *models.StaticData, info models.BundleInfo, staticStore *StaticStore, cache *BundleCache, logger *slog.Logger) {
+	refreshed := *stored
+	refreshed.Bundle = info
+	refreshed.Bundle.CachedAt = time.Time{}
+	staticStore.Set(server.ID, &refreshed)
+	if err := cache.Touch(server.ID, refreshed.Bundle, time.Now()); err != nil {
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags:  utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+			Level: sentry.LevelWarning,
+		})
+		logger.Warn("Failed to update cached GTFS bundle", "server_id", server.ID, "error", err)
+	}
+}
+
+// recordBundleDiff records the diff between the previous and new static data of a server in the changelog.
+//
+// A diff crossing one of the changelog's thresholds (for example, more than 10% of the stops
+// removed) usually means a bad export rather than a real network change, so it is reported to
+// Sentry as a warning with the summary of the changes.
+func recordBundleDiff(changelog *BundleChangelog, server models.ObaServer, previous, next *models.StaticData, logger *slog.Logger) {
+	diff := diffStaticData(previous, next, changelog.Thresholds, time.Now().UTC())
+	changelog.Record(server.ID, diff)
+	logger.Info("GTFS bundle changed",
+		"server_id", server.ID,
+		"stops_added", diff.Stops.Added,
+		"stops_removed", diff.Stops.Removed,
+		"stops_moved", diff.Stops.Moved,
+		"routes_before", diff.RoutesBefore,
+		"routes_after", diff.RoutesAfter,
+		"agencies_added", len(diff.AgenciesAdded),
+		"agencies_removed", len(diff.AgenciesRemoved),
+	)
+
+	if len(diff.ThresholdsExceeded) == 0 {
+		return
+	}
+	err := fmt.Errorf("GTFS bundle of server %d changed beyond thresholds: %s", server.ID, strings.Join(diff.ThresholdsExceeded, ", "))
+	report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+		Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+		ExtraContext: map[string]interface{}{
+			"gtfs_url":            server.GtfsUrl,
+			"previous_sha256":     diff.PreviousSHA256,
+			"sha256":              diff.SHA256,
+			"stops_before":        diff.Stops.Before,
+			"stops_after":         diff.Stops.After,
+			"stops_removed":       diff.Stops.Removed,
+			"routes_before":       diff.RoutesBefore,
+			"routes_after":        diff.RoutesAfter,
+			"agencies_removed":    diff.AgenciesRemoved,
+			"thresholds_exceeded": diff.ThresholdsExceeded,
+		},
+		Level: sentry.LevelWarning,
+	})
+	logger.Warn("GTFS bundle changed beyond thresholds", "server_id", server.ID, "thresholds_exceeded", diff.ThresholdsExceeded)
+}
+
 // refreshGTFSBundles periodically refreshes GTFS static bundles for a list of OBA servers.
 //
 // It runs in a loop, triggered at the specified interval, and performs the following:
@@ -94,14 +191,19 @@ func downloadGTFSBundles(ctx context.Context, servers []models.ObaServer, logger
 //
 // Parameters:
 //   - ctx: Context used to cancel the refresh routine gracefully.
-//   - servers: List of OBA servers to fetch GTFS data from.
+//   - getServers: Returns the OBA servers to fetch GTFS data from. It is called on every cycle,
+//     so servers added to or removed from the configuration are picked up without a restart.
 //   - logger: Logger for structured logging of refresh activity.
 //   - interval: Time duration between each refresh cycle.
 //   - boundingBoxStore: Store to keep geographic bounding boxes per server.
 //   - staticStore: Store to keep parsed GTFS static data per server.
+//   - client: The shared HTTP client used for the downloads.
+//   - limits: The size limits and parse semaphore shared by every download.
+//   - changelog: The log bundle diffs are recorded in; nil disables diffing.
+//   - cache: The on-disk cache downloaded bundles are saved to; nil disables caching.
 //   - maxRetries: Maximum number of retries (with exponential backoff) for each server’s bundle download.
 
-func refreshGTFSBundles(ctx context.Context, servers []models.ObaServer, logger *slog.Logger, interval time.Duration, boundingBoxstore *geo.BoundingBoxStore, staticStore *StaticStore, maxRetries int) {
+func refreshGTFSBundles(ctx context.Context, getServers func() []models.ObaServer, logger *slog.Logger, interval time.Duration, boundingBoxstore *geo.BoundingBoxStore, staticStore *StaticStore, client *http.Client, limits *FeedLimits, changelog *BundleChangelog, cache *BundleCache, maxRetries int) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
@@ -111,35 +213,59 @@ func refreshGTFSBundles(ctx context.Context, servers []models.ObaServer, logger
 			return
 		case <-ticker.C:
 			logger.Info("Refreshing GTFS bundles")
-			downloadGTFSBundles(ctx, servers, logger, boundingBoxstore, staticStore, maxRetries)
+			downloadGTFSBundles(ctx, getServers(), logger, boundingBoxstore, staticStore, client, limits, changelog, cache, maxRetries)
 		}
 	}
 }
 
-// downloadAndStoreGTFSBundle fetches a GTFS static bundle from the provided URL,
-// parses it, and stores the resulting static data in the given StaticStore using
-// the serverID as the key. Requests are executed with exponential backoff to handle
-// transient network errors (e.g., timeouts, connection failures).
+// downloadedBundle is a GTFS static bundle returned by downloadGTFSBundle.
+type downloadedBundle struct {
+	Static     *remoteGtfs.Static       // Parsed bundle; nil when the bundle is unchanged
+	FeedInfo   *models.FeedInfo         // Parsed feed_info.txt; nil when the bundle has none
+	Validation *models.ValidationReport // Referential-integrity report; nil if the bundle could not be validated
+	Info       models.BundleInfo        // Description of the downloaded file
+}
+
+// downloadGTFSBundle fetches a GTFS static bundle from the provided URL and parses it.
+// Requests are executed with exponential backoff to handle transient network errors
+// (e.g., timeouts, connection failures).
 //
 // It performs the following steps:
 //   1. Makes an HTTP GET request (with exponential backoff) to download the GTFS bundle.
-//   2. Reads and parses the response body as GTFS static data.
-//   3. Stores the parsed data in the StaticStore.
+//      When previous is set, its ETag and Last-Modified validators are sent as
+//      If-None-Match and If-Modified-Since headers.
+//   2. Streams the response body, hashing it (SHA-256) and spooling it to a temporary file when it is
+//      larger than limits.SpoolThreshold. Bodies larger than limits.MaxStaticBundleSize fail with a
+//      FeedTooLargeError.
+//   3. Waits for one of the limited parse slots, then parses the bundle as GTFS static data,
+//      along with its feed_info.txt (which the GTFS library does not parse, see parseFeedInfo),
+//      and validates the referential integrity of the raw bundle (see validateBundle).
+//   4. Saves the parsed bundle to the on-disk cache, when one is given.
+//
+// Unchanged bundles:
+//
+//	A bundle is unchanged when the server answers 304 Not Modified, or when the downloaded file
+//	has the same hash as the previous one (many feed hosts do not support conditional requests,
+//	or re-publish identical files with a new modification time). In both cases the bundle is not
+//	parsed: the returned Static is nil, the returned Info is previous, and the error is nil.
 //
 // Parameters:
+//   - client: The HTTP client used for the download (the shared instrumented client in production).
 //   - url: The URL of the GTFS static bundle (usually a zip file).
-//   - serverID: The identifier used to store and retrieve the static data from the store.
-//   - staticStore: The in-memory store that holds GTFS static data indexed by server ID.
+//   - serverID: The identifier of the server the bundle belongs to, used for error reporting.
 //   - maxRetries: The maximum number of retry attempts allowed during exponential backoff
 //                 before giving up on reaching the server
+//   - previous: The BundleInfo of the currently stored bundle, or nil to always download and parse.
+//   - limits: The size limits and parse semaphore shared by every download.
+//   - cache: The on-disk cache the bundle is saved to; nil disables caching.
 //
 // Returns:
-//   - gtfs static data
+//   - the downloaded bundle: parsed gtfs static data (nil if the bundle is unchanged),
+//     feed info, validation report, and the BundleInfo describing the downloaded file
 //   - error: Describes what went wrong, or nil if the operation was successful.
 
-func downloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetries int) (*remoteGtfs.Static, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
+func downloadGTFSBundle(ctx context.Context, client *http.Client, url string, serverID int, maxRetries int, previous *models.BundleInfo, limits *FeedLimits, cache *BundleCache) (downloadedBundle, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		err = fmt.Errorf("failed to create request for %s: %w", url, err)
 		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
@@ -148,7 +274,16 @@ func downloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetrie
 				"url": url,
 			},
 		})
-		return nil, err
+		return downloadedBundle{}, err
+	}
+
+	if previous != nil {
+		if previous.ETag != "" {
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.LastModified)
+		}
 	}
 
 	resp, err := config.DoWithBackoff(ctx, client, req, maxRetries)
@@ -161,10 +296,14 @@ func downloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetrie
 				"url": url,
 			},
 		})
-		return nil, err
+		return downloadedBundle{}, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && previous != nil {
+		return downloadedBundle{Info: *previous}, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("unexpected response status %d when downloading GTFS bundle from %s", resp.StatusCode, url)
 		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
@@ -174,16 +313,82 @@ func downloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetrie
 				"status": resp.Status,
 			},
 		})
-		return nil, err
+		return downloadedBundle{}, err
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	spooled, err := limits.spoolStaticBundle(resp.Body, resp.ContentLength, serverID, url)
+	if err != nil {
+		var tooLarge *FeedTooLargeError
+		if !errors.As(err, &tooLarge) {
+			err = fmt.Errorf("failed to read GTFS bundle response body from %s: %w", url, err)
+		}
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: utils.MakeMap("server_id", strconv.Itoa(serverID)),
+			ExtraContext: map[string]interface{}{
+				"url": url,
+			},
+		})
+		return downloadedBundle{}, err
+	}
+	defer spooled.Close()
+
+	bundle := models.BundleInfo{
+		ETag:          resp.Header.Get("ETag"),
+		LastModified:  resp.Header.Get("Last-Modified"),
+		SHA256:        spooled.sha256,
+		Size:          int(spooled.size),
+		LastChangedAt: time.Now().UTC(),
+	}
+	if lastModified, err := http.ParseTime(bundle.LastModified); err == nil {
+		bundle.LastModifiedAt = lastModified.UTC()
+	}
+
+	// A bundle re-published unchanged keeps its previous parse, but the validators of the new
+	// response replace the previous ones, or the next request would never get a 304.
+	if previous != nil && previous.SHA256 == bundle.SHA256 {
+		unchanged := *previous
+		unchanged.ETag = bundle.ETag
+		unchanged.LastModified = bundle.LastModified
+		unchanged.LastModifiedAt = bundle.LastModifiedAt
+		return downloadedBundle{Info: unchanged}, nil
+	}
+
+	// The whole bundle and its parsed result are in memory while parsing,
+	// so only a bounded number of bundles are parsed at the same time.
+	if err := limits.acquireParse(ctx); err != nil {
+		return downloadedBundle{}, fmt.Errorf("gave up waiting to parse GTFS bundle from %s: %w", url, err)
+	}
+	defer limits.releaseParse()
+
+	data, err := spooled.Bytes()
 	if err != nil {
-		err = fmt.Errorf("failed to read GTFS bundle response body from %s: %w", url, err)
 		report.ReportError(err)
-		return nil, err
+		return downloadedBundle{}, err
+	}
+
+	downloaded, err := parseGTFSBundle(data, url, serverID)
+	if err != nil {
+		return downloadedBundle{}, err
+	}
+	downloaded.Info = bundle
+
+	// A bundle that could not be cached is still used; only the next restart misses it.
+	if err := cache.Save(serverID, url, bundle, data, time.Now()); err != nil {
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags:  utils.MakeMap("server_id", strconv.Itoa(serverID)),
+			Level: sentry.LevelWarning,
+		})
 	}
+	return downloaded, nil
+}
 
+// parseGTFSBundle parses the content of a GTFS static bundle downloaded from url (or cached from it):
+// the GTFS static data, its feed_info.txt, and the referential-integrity report of the raw bundle.
+// The returned bundle has no Info.
+//
+// Only a bundle that cannot be parsed as GTFS static data is an error; a malformed feed_info.txt
+// or a failed validation is reported to Sentry as a warning and leaves the corresponding field nil.
+func parseGTFSBundle(data []byte, url string, serverID int) (downloadedBundle, error) {
 	staticBundle, err := remoteGtfs.ParseStatic(data, remoteGtfs.ParseStaticOptions{})
 	if err != nil {
 		err = fmt.Errorf("failed to parse GTFS static data from %s: %w", url, err)
@@ -193,23 +398,41 @@ func downloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetrie
 				"url": url,
 			},
 		})
-		return nil, err
+		return downloadedBundle{}, err
+	}
+
+	// A malformed feed_info.txt does not make the bundle unusable; expiration then falls back to the calendars.
+	feedInfo, err := parseFeedInfo(data)
+	if err != nil {
+		report.ReportErrorWithSentryOptions(fmt.Errorf("failed to parse feed_info.txt from %s: %w", url, err), report.SentryReportOptions{
+			Tags:  utils.MakeMap("server_id", strconv.Itoa(serverID)),
+			Level: sentry.LevelWarning,
+		})
 	}
-	return staticBundle, nil
 
+	// The parsed bundle silently drops broken references, so they are looked for in the raw file.
+	validation, err := validateBundle(data, time.Now().UTC())
+	if err != nil {
+		report.ReportErrorWithSentryOptions(fmt.Errorf("failed to validate GTFS bundle from %s: %w", url, err), report.SentryReportOptions{
+			Tags:  utils.MakeMap("server_id", strconv.Itoa(serverID)),
+			Level: sentry.LevelWarning,
+		})
+	}
+	return downloadedBundle{Static: staticBundle, FeedInfo: feedInfo, Validation: validation}, nil
 }
 
 // storeGTFSBundle stores a parsed GTFS static bundle in memory and computes its bounding box.
 //
 // The function performs the following:
 //   1. Wraps the GTFS static bundle into a StaticData object, keeping only the relevant parts
-//      needed by the application to avoid storing the full bundle in memory.
+//      needed by the application to avoid storing the full bundle in memory, along with its
+//      feed info, validation report and the description of the downloaded file.
 //   2. Stores the StaticData in the StaticStore, keyed by serverID.
 //   3. Computes the bounding box from the stops in the GTFS data.
 //   4. Stores the bounding box in the BoundingBoxStore, also keyed by serverID.
 //
 // Parameters:
-//   - staticBundle: The parsed GTFS static bundle containing routes, stops, and other transit data.
+//   - downloaded: The downloaded bundle; its Static bundle contains routes, stops, and other transit data.
 //   - serverID: The identifier used to store and retrieve data for a specific server.
 //   - staticStore: The in-memory store holding GTFS static data indexed by server ID.
 //   - boundingBoxStore: The in-memory store holding computed bounding boxes for GTFS data.
@@ -217,13 +440,16 @@ func downloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetrie
 // Returns:
 //   - error: If computing the bounding box fails, an error is returned. Otherwise, nil.
 
-func storeGTFSBundle(staticBundle *remoteGtfs.Static, serverID int, staticStore *StaticStore, boundingBoxStore *geo.BoundingBoxStore) error {
+func storeGTFSBundle(downloaded downloadedBundle, serverID int, staticStore *StaticStore, boundingBoxStore *geo.BoundingBoxStore) error {
 	// StaticData is a wrapper around the GTFS static bundle
 	// that includes only the parts we use in the application.
 	// So we do not keep the whole GTFS static bundle in memory,
 	// but only the parts we need.
-	staticData := models.NewStaticData(staticBundle)
-	staticBundle = nil // drop reference, GC can collect earlier
+	staticData := models.NewStaticData(downloaded.Static)
+	staticData.FeedInfo = downloaded.FeedInfo
+	staticData.Validation = downloaded.Validation
+	staticData.Bundle = downloaded.Info
+	downloaded.Static = nil // drop reference, GC can collect earlier
 	staticStore.Set(serverID, staticData)
 	// compute bounding box for each downloaded GTFS bundle
 	bbox, err := geo.ComputeBoundingBox(staticData.Stops)
@@ -264,28 +490,73 @@ func getStopLocationsByIDs(serverID int, stopIDs []string, staticStore *StaticSt
 
 // fetchAndStoreGTFSRTFeed fetches the GTFS-Realtime (GTFS-RT) vehicle position feed
 // from the specified server, parses the response, and stores it safely in the
-// provided RealtimeStore.
+// provided RealtimeStore under the server's ID.
+//
+// See fetchAndStoreRealtimeFeed for the stored snapshot and the error handling.
+
+func fetchAndStoreGTFSRTFeed(ctx context.Context, server models.ObaServer, realtimeStore *RealtimeStore, client *http.Client, limits *FeedLimits) error {
+	return fetchAndStoreRealtimeFeed(ctx, server, FeedVehiclePositions, server.VehiclePositionUrl, realtimeStore, client, limits)
+}
+
+// fetchAndStoreTripUpdatesFeed fetches the GTFS-RT TripUpdates feed of the specified server
+// (its `trip_update_url`), parses the response, and stores it in the provided tripUpdatesStore
+// under the server's ID. It is the feed that drives OBA arrival predictions.
+//
+// The same authentication header as the vehicle position feed is sent.
+// See fetchAndStoreRealtimeFeed for the stored snapshot and the error handling.
+
+func fetchAndStoreTripUpdatesFeed(ctx context.Context, server models.ObaServer, tripUpdatesStore *RealtimeStore, client *http.Client, limits *FeedLimits) error {
+	return fetchAndStoreRealtimeFeed(ctx, server, FeedTripUpdates, server.TripUpdateUrl, tripUpdatesStore, client, limits)
+}
+
+// fetchAndStoreAlertsFeed fetches the GTFS-RT Service Alerts feed of the specified server
+// (its optional `alerts_url`), parses the response, and stores it in the provided alertsStore
+// under the server's ID.
+//
+// The same authentication header as the vehicle position feed is sent.
+// See fetchAndStoreRealtimeFeed for the stored snapshot and the error handling.
+
+func fetchAndStoreAlertsFeed(ctx context.Context, server models.ObaServer, alertsStore *RealtimeStore, client *http.Client, limits *FeedLimits) error {
+	return fetchAndStoreRealtimeFeed(ctx, server, FeedAlerts, server.AlertsUrl, alertsStore, client, limits)
+}
+
+// fetchAndStoreRealtimeFeed fetches the GTFS-RT feed at feedURL for the specified server,
+// parses the response, and stores it safely in the provided RealtimeStore under the server's ID.
+// feed names the feed: FeedVehiclePositions, FeedTripUpdates or FeedAlerts.
+//
+// Alongside the parsed data, the stored snapshot records the fetch time, the
+// FeedHeader timestamp, the payload size and the source URL, so that consumers
+// can detect stale data and correlate metrics with the feed that produced them.
+// It also records the `gtfs_realtime_version` and incrementality of the FeedHeader,
+// and a hash of the payload: comparing it with the previous snapshot of the server
+// tells how many consecutive fetches returned identical bytes (see RealtimeSnapshot.UnchangedFetches),
+// which exposes a frozen producer even when its feed still parses. Finally, it records the
+// vehicle IDs and trips claimed more than once by its vehicle positions (see RealtimeSnapshot.Integrity).
+//
+// The request is bound to ctx, so it is aborted when the collection run's deadline
+// passes or the application shuts down.
+//
+// Only a valid feed replaces the stored snapshot. Every failure leaves the previous snapshot in
+// place and returns a RealtimeFetchError classifying it: the feed could not be reached (DNS, timeout,
+// TLS), answered with an error status or a document instead of protobuf (error and login pages),
+// answered with an empty body, a payload that does not parse, or a feed without any entity (except
+// for the Service Alerts feed), or exceeded limits.MaxRealtimeFeedSize.
+// The error is not reported to Sentry here: the check running the fetch reports it.
 //
 // The realtimeStore is designed to be thread-safe, and this function ensures
 // that the parsed data is written using the store’s locking mechanisms,
 // making it safe for concurrent access across goroutines.
 
-func fetchAndStoreGTFSRTFeed(server models.ObaServer, realtimeStore *RealtimeStore, client *http.Client) error {
-	parsedURL, err := url.Parse(server.VehiclePositionUrl)
+func fetchAndStoreRealtimeFeed(ctx context.Context, server models.ObaServer, feed string, feedURL string, realtimeStore *RealtimeStore, client *http.Client, limits *FeedLimits) error {
+	parsedURL, err := url.Parse(feedURL)
 	if err != nil {
-		err = fmt.Errorf("failed to parse GTFS-RT URL: %v", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-			ExtraContext: map[string]interface{}{
-				"vehicle_position_url": server.VehiclePositionUrl,
-			},
-		})
+		err = newRealtimeFetchError(feed, FetchFailureOther, "failed to parse GTFS-RT URL: %v", err)
 		return err
 	}
 
-	req, err := http.NewRequest("GET", parsedURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsedURL.String(), nil)
 	if err != nil {
-		report.ReportError(err)
+		err = newRealtimeFetchError(feed, FetchFailureOther, "failed to create GTFS-RT request: %v", err)
 		return err
 	}
 
@@ -295,60 +566,82 @@ func fetchAndStoreGTFSRTFeed(server models.ObaServer, realtimeStore *RealtimeSto
 
 	resp, err := client.Do(req)
 	if err != nil {
-		err = fmt.Errorf("failed to fetch GTFS-RT feed: %v", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-			ExtraContext: map[string]interface{}{
-				"vehicle_position_url": server.VehiclePositionUrl,
-			},
-		})
+		err = newRealtimeFetchError(feed, classifyTransportError(err), "failed to fetch GTFS-RT feed: %v", err)
 		return err
 	}
 	defer resp.Body.Close()
 
-	data, err := io.ReadAll(resp.Body)
+	if reason := classifyStatus(resp.StatusCode); reason != "" {
+		err = newRealtimeFetchError(feed, reason, "GTFS-RT feed responded with status %s", resp.Status)
+		return err
+	}
+	if contentType := resp.Header.Get("Content-Type"); isDocumentContentType(contentType) {
+		err = newRealtimeFetchError(feed, FetchFailureContentType, "GTFS-RT feed responded with content type %q instead of protobuf", contentType)
+		return err
+	}
+
+	data, err := limits.readRealtimeFeed(resp.Body, resp.ContentLength, server.ID, parsedURL.String())
 	if err != nil {
-		report.ReportError(err)
+		reason := classifyTransportError(err)
+		var tooLarge *FeedTooLargeError
+		if errors.As(err, &tooLarge) {
+			reason = FetchFailureTooLarge
+		}
+		err = &RealtimeFetchError{Feed: feed, Reason: reason, Err: err}
+		return err
+	}
+	if len(data) == 0 {
+		err = newRealtimeFetchError(feed, FetchFailureEmptyBody, "GTFS-RT feed responded with an empty body")
 		return err
 	}
 
-	gtfsRT, err := remoteGtfs.ParseRealtime(data, &remoteGtfs.ParseRealtimeOptions{})
+	recorder := &vehicleRecorder{}
+	gtfsRT, err := remoteGtfs.ParseRealtime(data, &remoteGtfs.ParseRealtimeOptions{Extension: recorder})
 	if err != nil {
-		report.ReportError(err)
+		err = &RealtimeFetchError{Feed: feed, Reason: FetchFailureParse, Err: err}
 		return err
 	}
 	realtimeData := models.NewRealtimeData(gtfsRT)
+	feedTimestamp := gtfsRT.CreatedAt.UTC()
 	gtfsRT = nil // drop reference, GC can collect earlier
-	realtimeStore.Set(realtimeData)
+	if requiresEntities(feed) && len(realtimeData.Vehicles)+len(realtimeData.TripUpdates)+len(realtimeData.Alerts) == 0 {
+		err = newRealtimeFetchError(feed, FetchFailureZeroEntities, "GTFS-RT feed has no entity")
+		return err
+	}
+
+	hasher := newContentHasher()
+	hasher.Write(data)
+	snapshot := &RealtimeSnapshot{
+		Data:          realtimeData,
+		FetchedAt:     time.Now().UTC(),
+		FeedTimestamp: feedTimestamp,
+		PayloadSize:   len(data),
+		SourceURL:     parsedURL.String(),
+		ContentHash:   hasher.String(),
+		Integrity:     newRealtimeIntegrityReport(recorder.vehicles),
+	}
+	if header := parseFeedHeader(data); header != nil {
+		snapshot.RealtimeVersion = header.GetGtfsRealtimeVersion()
+		snapshot.Incrementality = header.GetIncrementality().String()
+	}
+	previous, _ := realtimeStore.Get(server.ID)
+	snapshot.followPrevious(previous)
+	realtimeStore.Set(server.ID, snapshot)
 	return nil
 }
 
 // getEarliestAndLatestServiceDates returns the earliest and latest service end dates
-// from the GTFS static data's calendar entries.
-//
-// This is used as a workaround because the GTFS library does not currently support
-// parsing `feed_info.txt`, which usually provides feed start/end dates.
+// of the GTFS static data, ignoring feed_info.txt.
 //
-// Instead, this function infers expiration information by scanning all `calendar.txt`
-// entries (i.e., service periods), and returns the minimum and maximum `EndDate` values.
+// The end date of a service is the later of its `calendar.txt` end date and its last date added
+// by `calendar_dates.txt`, so that bundles defining their service only in `calendar_dates.txt`
+// are supported. To get the authoritative validity period of a bundle, use getBundleValidity.
 //
-// Returns an error if no services are found in the bundle.
+// Returns an error if no dated services are found in the bundle.
 func getEarliestAndLatestServiceDates(staticData *models.StaticData) (earliestEndDate, latestEndDate time.Time, err error) {
 	if staticData == nil {
 		return time.Time{}, time.Time{}, fmt.Errorf("static data is nil")
 	}
-	if len(staticData.Services) == 0 {
-		return time.Time{}, time.Time{}, fmt.Errorf("no services found in GTFS bundle")
-	}
-	earliestEndDate = staticData.Services[0].EndDate
-	latestEndDate = staticData.Services[0].EndDate
-	for _, service := range staticData.Services {
-		if service.EndDate.Before(earliestEndDate) {
-			earliestEndDate = service.EndDate
-		}
-		if service.EndDate.After(latestEndDate) {
-			latestEndDate = service.EndDate
-		}
-	}
-	return earliestEndDate, latestEndDate, nil
+	earliestEndDate, latestEndDate, _, err = getServiceEndDates(staticData)
+	return earliestEndDate, latestEndDate, err
 }
@@ -5,12 +5,19 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"google.golang.org/protobuf/proto"
 	"watchdog.onebusaway.org/internal/geo"
 	"watchdog.onebusaway.org/internal/models"
 )
@@ -24,7 +31,7 @@ func TestDownloadGTFSBundles(t *testing.T) {
 	boundingBoxStore := geo.NewBoundingBoxStore()
 	staticStore := NewStaticStore()
 	ctx := context.Background()
-	downloadGTFSBundles(ctx, servers, logger, boundingBoxStore, staticStore, 1)
+	downloadGTFSBundles(ctx, servers, logger, boundingBoxStore, staticStore, http.DefaultClient, NewFeedLimits(0, 0, 0, 0), nil, nil, 1)
 
 }
 
@@ -37,7 +44,7 @@ func TestRefreshGTFSBundles(t *testing.T) {
 	staticStore := NewStaticStore()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go refreshGTFSBundles(ctx, servers, logger, 10*time.Millisecond, boundingBoxStore, staticStore, 1)
+	go refreshGTFSBundles(ctx, func() []models.ObaServer { return servers }, logger, 10*time.Millisecond, boundingBoxStore, staticStore, http.DefaultClient, NewFeedLimits(0, 0, 0, 0), nil, nil, 1)
 
 	time.Sleep(15 * time.Millisecond)
 
@@ -49,7 +56,8 @@ func TestDownloadGTFSBundle(t *testing.T) {
 	serverID := 1
 	ctx := context.Background()
 	t.Run("Success Response", func(t *testing.T) {
-		staticBundle, err := downloadGTFSBundle(ctx, mockServer.URL, serverID, 1)
+		downloaded, err := downloadGTFSBundle(ctx, http.DefaultClient, mockServer.URL, serverID, 1, nil, NewFeedLimits(0, 0, 0, 0), nil)
+		staticBundle := downloaded.Static
 		if err != nil {
 			t.Fatalf("DownloadGTFSBundle failed: %v", err)
 		}
@@ -100,7 +108,7 @@ func TestDownloadGTFSBundle(t *testing.T) {
 
 	t.Run("Invalid URL", func(t *testing.T) {
 		invalidURL := "http://invalid-url"
-		_, err := downloadGTFSBundle(ctx, invalidURL, 2, 1)
+		_, err := downloadGTFSBundle(ctx, http.DefaultClient, invalidURL, 2, 1, nil, NewFeedLimits(0, 0, 0, 0), nil)
 		if err == nil {
 			t.Errorf("Expected error for invalid URL, got none")
 		}
@@ -108,6 +116,183 @@ func TestDownloadGTFSBundle(t *testing.T) {
 
 }
 
+func TestDownloadGTFSBundleConditional(t *testing.T) {
+	data := readFixture(t, "gtfs.zip")
+	const etag = `"v1"`
+	lastModified := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+
+	var requests atomic.Int32
+	var conditional atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if conditional.Load() && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		// Writing to ResponseWriter in tests, error can be safely ignored.
+		// #nosec G104
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	downloaded, err := downloadGTFSBundle(ctx, server.Client(), server.URL, 1, 1, nil, NewFeedLimits(0, 0, 0, 0), nil)
+	staticBundle, bundle := downloaded.Static, downloaded.Info
+	if err != nil {
+		t.Fatalf("downloadGTFSBundle failed: %v", err)
+	}
+	if staticBundle == nil {
+		t.Fatal("expected the first download to be parsed")
+	}
+	if bundle.ETag != etag || !bundle.LastModifiedAt.Equal(lastModified) || bundle.Size != len(data) || bundle.SHA256 == "" || bundle.LastChangedAt.IsZero() {
+		t.Fatalf("unexpected bundle info: %+v", bundle)
+	}
+
+	t.Run("Same hash is not parsed", func(t *testing.T) {
+		// The server ignores the validators, so the bundle is downloaded again but has the same hash.
+		downloaded, err := downloadGTFSBundle(ctx, server.Client(), server.URL, 1, 1, &bundle, NewFeedLimits(0, 0, 0, 0), nil)
+		staticBundle, got := downloaded.Static, downloaded.Info
+		if err != nil {
+			t.Fatalf("downloadGTFSBundle failed: %v", err)
+		}
+		if staticBundle != nil {
+			t.Error("expected an unchanged bundle not to be parsed")
+		}
+		if got != bundle {
+			t.Errorf("expected the previous bundle info to be returned, got %+v", got)
+		}
+	})
+
+	t.Run("Same hash takes the new validators", func(t *testing.T) {
+		previous := bundle
+		previous.ETag = `"v0"`
+		previous.LastModified = ""
+		previous.LastModifiedAt = time.Time{}
+		downloaded, err := downloadGTFSBundle(ctx, server.Client(), server.URL, 1, 1, &previous, NewFeedLimits(0, 0, 0, 0), nil)
+		if err != nil {
+			t.Fatalf("downloadGTFSBundle failed: %v", err)
+		}
+		got := downloaded.Info
+		if downloaded.Static != nil {
+			t.Error("expected an unchanged bundle not to be parsed")
+		}
+		if got.ETag != etag || !got.LastModifiedAt.Equal(lastModified) || !got.LastChangedAt.Equal(previous.LastChangedAt) {
+			t.Errorf("expected the new validators with the previous change time, got %+v", got)
+		}
+	})
+
+	t.Run("Not modified", func(t *testing.T) {
+		conditional.Store(true)
+		before := requests.Load()
+		downloaded, err := downloadGTFSBundle(ctx, server.Client(), server.URL, 1, 1, &bundle, NewFeedLimits(0, 0, 0, 0), nil)
+		staticBundle, got := downloaded.Static, downloaded.Info
+		if err != nil {
+			t.Fatalf("downloadGTFSBundle failed: %v", err)
+		}
+		if staticBundle != nil || got != bundle {
+			t.Errorf("expected a 304 response to keep the previous bundle, got %+v", got)
+		}
+		if requests.Load() != before+1 {
+			t.Errorf("expected exactly one request, got %d", requests.Load()-before)
+		}
+	})
+
+	t.Run("Changed hash is parsed", func(t *testing.T) {
+		previous := bundle
+		previous.ETag = ""
+		previous.SHA256 = "outdated"
+		downloaded, err := downloadGTFSBundle(ctx, server.Client(), server.URL, 1, 1, &previous, NewFeedLimits(0, 0, 0, 0), nil)
+		staticBundle, got := downloaded.Static, downloaded.Info
+		if err != nil {
+			t.Fatalf("downloadGTFSBundle failed: %v", err)
+		}
+		if staticBundle == nil {
+			t.Fatal("expected a changed bundle to be parsed")
+		}
+		if got.SHA256 != bundle.SHA256 {
+			t.Errorf("expected hash %s, got %s", bundle.SHA256, got.SHA256)
+		}
+	})
+}
+
+func TestDownloadGTFSBundlesSkipsUnchangedBundle(t *testing.T) {
+	mockServer := setupGtfsServer(t, "gtfs.zip")
+	defer mockServer.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	boundingBoxStore := geo.NewBoundingBoxStore()
+	staticStore := NewStaticStore()
+	servers := []models.ObaServer{{ID: 1, GtfsUrl: mockServer.URL}}
+	ctx := context.Background()
+
+	downloadGTFSBundles(ctx, servers, logger, boundingBoxStore, staticStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0), nil, nil, 1)
+	first, ok := staticStore.Get(1)
+	if !ok || first == nil {
+		t.Fatal("expected the bundle to be stored")
+	}
+	if first.Bundle.SHA256 == "" {
+		t.Fatal("expected the stored bundle to carry its hash")
+	}
+	if first.FeedInfo == nil || first.FeedInfo.Version != "SC-Fall-2024.11" {
+		t.Errorf("expected the stored bundle to carry its feed_info.txt, got %+v", first.FeedInfo)
+	}
+	if first.Validation == nil {
+		t.Error("expected the stored bundle to carry its validation report")
+	}
+	if len(first.Trips) == 0 || first.Trips[0].StopTimeCount == 0 || len(first.Shapes) == 0 {
+		t.Errorf("expected the stored bundle to summarize its trips and shapes, got %d trips and %d shapes", len(first.Trips), len(first.Shapes))
+	}
+
+	downloadGTFSBundles(ctx, servers, logger, boundingBoxStore, staticStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0), nil, nil, 1)
+	second, _ := staticStore.Get(1)
+	if second != first {
+		t.Error("expected an unchanged bundle not to replace the stored static data")
+	}
+}
+
+func TestDownloadGTFSBundlesRecordsBundleDiff(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(readFixture(t, "gtfs.zip"))
+	}))
+	defer mockServer.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	boundingBoxStore := geo.NewBoundingBoxStore()
+	staticStore := NewStaticStore()
+	changelog := NewBundleChangelog(0, NewDiffThresholds(0, 0, 0))
+	servers := []models.ObaServer{{ID: 1, GtfsUrl: mockServer.URL}}
+
+	// No diff is recorded for the first bundle of a server.
+	downloadGTFSBundles(context.Background(), servers, logger, boundingBoxStore, staticStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0), changelog, nil, 1)
+	if _, ok := changelog.Latest(1); ok {
+		t.Fatal("expected no diff for the first bundle")
+	}
+
+	// Pretend the stored bundle had an agency the new one drops.
+	stored, _ := staticStore.Get(1)
+	previous := *stored
+	previous.Bundle.SHA256 = "previous"
+	previous.Agencies = append(append([]remoteGtfs.Agency(nil), stored.Agencies...), remoteGtfs.Agency{Id: "removed-agency"})
+	staticStore.Set(1, &previous)
+
+	downloadGTFSBundles(context.Background(), servers, logger, boundingBoxStore, staticStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0), changelog, nil, 1)
+	diff, ok := changelog.Latest(1)
+	if !ok {
+		t.Fatal("expected a diff to be recorded when the bundle changed")
+	}
+	if diff.PreviousSHA256 != "previous" || diff.SHA256 == "" {
+		t.Errorf("unexpected bundle hashes in diff: %q -> %q", diff.PreviousSHA256, diff.SHA256)
+	}
+	if len(diff.AgenciesRemoved) != 1 || diff.AgenciesRemoved[0] != "removed-agency" {
+		t.Errorf("expected removed-agency to be removed, got %v", diff.AgenciesRemoved)
+	}
+	if len(diff.ThresholdsExceeded) != 1 || diff.ThresholdsExceeded[0] != ThresholdAgenciesRemoved {
+		t.Errorf("expected the agencies_removed threshold to be exceeded, got %v", diff.ThresholdsExceeded)
+	}
+}
+
 func TestAgencyParsing(t *testing.T) {
 	data := readFixture(t, "gtfs.zip")
 	staticBundle, err := remoteGtfs.ParseStatic(data, remoteGtfs.ParseStaticOptions{})
@@ -217,6 +402,41 @@ func TestStopsParsing(t *testing.T) {
 	}
 }
 
+func TestStaticDataIndexes(t *testing.T) {
+	data := readFixture(t, "gtfs.zip")
+	staticBundle, err := remoteGtfs.ParseStatic(data, remoteGtfs.ParseStaticOptions{})
+	if err != nil {
+		t.Fatal("failed to parse gtfs static data")
+	}
+	staticData := models.NewStaticData(staticBundle)
+
+	if len(staticData.RoutesByID) != len(staticData.Routes) {
+		t.Fatalf("expected %d indexed routes, got %d", len(staticData.Routes), len(staticData.RoutesByID))
+	}
+	for i, route := range staticData.Routes {
+		if staticData.RoutesByID[route.Id] != &staticData.Routes[i] {
+			t.Errorf("route %s is not indexed", route.Id)
+		}
+	}
+
+	if len(staticData.TripsByID) != len(staticBundle.Trips) {
+		t.Fatalf("expected %d indexed trips, got %d", len(staticBundle.Trips), len(staticData.TripsByID))
+	}
+	for _, trip := range staticBundle.Trips {
+		summary, ok := staticData.Trip(trip.ID)
+		if !ok {
+			t.Errorf("trip %s is not indexed", trip.ID)
+			continue
+		}
+		if trip.Service != nil && summary.ServiceID != trip.Service.Id {
+			t.Errorf("trip %s: expected service %s, got %s", trip.ID, trip.Service.Id, summary.ServiceID)
+		}
+	}
+	if _, ok := staticData.Trip("no-such-trip"); ok {
+		t.Error("expected an unknown trip not to be found")
+	}
+}
+
 func TestGetEarliestAndLatestServiceDates(t *testing.T) {
 	server := models.ObaServer{ID: 1, Name: "test"}
 	data := readFixture(t, "gtfs.zip")
@@ -294,13 +514,14 @@ func TestFetchAndStoreGTFSRTFeed(t *testing.T) {
 		client := &http.Client{
 			Timeout: 5 * time.Second,
 		}
-		realtimeStore := NewRealtimeStore()
-		err := fetchAndStoreGTFSRTFeed(server, realtimeStore, client)
+		realtimeStore := NewRealtimeStore(time.Minute)
+		err := fetchAndStoreGTFSRTFeed(context.Background(), server, realtimeStore, client, NewFeedLimits(0, 0, 0, 0))
 		if err != nil {
 			t.Fatalf("Expected no error, got: %v", err)
 		}
-		if realtimeStore.Get() == nil {
-			t.Fatalf("Expected realtimeStore to contain parsed GTFS-RT data, but it is nil")
+		snapshot, ok := realtimeStore.Get(server.ID)
+		if !ok || snapshot == nil {
+			t.Fatalf("Expected realtimeStore to contain a GTFS-RT snapshot for server %d, but it is missing", server.ID)
 		}
 
 		data := readFixture(t, "gtfs_rt_feed_vehicles.pb")
@@ -309,11 +530,24 @@ func TestFetchAndStoreGTFSRTFeed(t *testing.T) {
 			t.Fatalf("Failed to parse GTFS-RT data: %v", err)
 		}
 		expectedRtData := models.NewRealtimeData(gtfsRT)
-		realtimeData := realtimeStore.Get()
+		realtimeData := snapshot.Data
 		if realtimeData == nil {
 			t.Fatal("realtimeData is nil; expected non-nil GTFS-RT data")
 		}
 
+		if snapshot.PayloadSize != len(data) {
+			t.Errorf("Expected payload size %d, got %d", len(data), snapshot.PayloadSize)
+		}
+		if snapshot.SourceURL != mockServer.URL {
+			t.Errorf("Expected source URL %q, got %q", mockServer.URL, snapshot.SourceURL)
+		}
+		if !snapshot.FeedTimestamp.Equal(gtfsRT.CreatedAt) {
+			t.Errorf("Expected feed timestamp %v, got %v", gtfsRT.CreatedAt, snapshot.FeedTimestamp)
+		}
+		if snapshot.FetchedAt.IsZero() {
+			t.Error("Expected fetch time to be recorded, got zero time")
+		}
+
 		if len(expectedRtData.Vehicles) == 0 {
 			t.Fatalf("Make sure that data contains at least one vehicle in the GTFS-RT feed in testdata/gtfs_rt_feed_vehicles.pb")
 		}
@@ -354,9 +588,9 @@ func TestFetchAndStoreGTFSRTFeed(t *testing.T) {
 		client := &http.Client{
 			Timeout: 5 * time.Second,
 		}
-		realtimeStore := NewRealtimeStore()
+		realtimeStore := NewRealtimeStore(time.Minute)
 
-		err := fetchAndStoreGTFSRTFeed(server, realtimeStore, client)
+		err := fetchAndStoreGTFSRTFeed(context.Background(), server, realtimeStore, client, NewFeedLimits(0, 0, 0, 0))
 		if err == nil {
 			t.Error("Expected error due to invalid URL, got nil")
 		}
@@ -373,10 +607,357 @@ func TestFetchAndStoreGTFSRTFeed(t *testing.T) {
 		client := &http.Client{
 			Timeout: 5 * time.Second,
 		}
-		realtimeStore := NewRealtimeStore()
-		err := fetchAndStoreGTFSRTFeed(server, realtimeStore, client)
+		realtimeStore := NewRealtimeStore(time.Minute)
+		err := fetchAndStoreGTFSRTFeed(context.Background(), server, realtimeStore, client, NewFeedLimits(0, 0, 0, 0))
 		if err == nil {
 			t.Error("Expected error when accessing closed server, got nil")
 		}
 	})
 }
+
+func TestFetchAndStoreTripUpdatesFeed(t *testing.T) {
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Timestamp:           proto.Uint64(1700000000),
+		},
+		Entity: []*gtfsrt.FeedEntity{
+			{
+				Id: proto.String("update-1"),
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip:  &gtfsrt.TripDescriptor{TripId: proto.String("trip-1")},
+					Delay: proto.Int32(120),
+				},
+			},
+			{
+				Id: proto.String("update-2"),
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
+						TripId:               proto.String("trip-2"),
+						ScheduleRelationship: gtfsrt.TripDescriptor_CANCELED.Enum(),
+					},
+				},
+			},
+			{
+				// A vehicle position referencing a trip is not a trip update.
+				Id: proto.String("vehicle-1"),
+				Vehicle: &gtfsrt.VehiclePosition{
+					Trip:    &gtfsrt.TripDescriptor{TripId: proto.String("trip-3")},
+					Vehicle: &gtfsrt.VehicleDescriptor{Id: proto.String("vehicle-1")},
+				},
+			},
+		},
+	}
+	data, err := proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test-Header") != "test-value" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// Writing to ResponseWriter in tests, error can be safely ignored.
+		// #nosec G104
+		w.Write(data)
+	}))
+	defer mockServer.Close()
+
+	server := models.ObaServer{
+		ID:             1,
+		TripUpdateUrl:  mockServer.URL,
+		GtfsRtApiKey:   "X-Test-Header",
+		GtfsRtApiValue: "test-value",
+	}
+	tripUpdatesStore := NewRealtimeStore(time.Minute)
+	if err := fetchAndStoreTripUpdatesFeed(context.Background(), server, tripUpdatesStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	snapshot, ok := tripUpdatesStore.Get(server.ID)
+	if !ok || snapshot == nil {
+		t.Fatal("Expected the trip updates snapshot to be stored")
+	}
+	if snapshot.SourceURL != mockServer.URL {
+		t.Errorf("Expected source URL %q, got %q", mockServer.URL, snapshot.SourceURL)
+	}
+	tripUpdates := snapshot.Data.TripUpdates
+	if len(tripUpdates) != 2 {
+		t.Fatalf("Expected 2 trip updates, got %d", len(tripUpdates))
+	}
+	if tripUpdates[0].ID.ID != "trip-1" || tripUpdates[0].Delay == nil || *tripUpdates[0].Delay != 2*time.Minute {
+		t.Errorf("Unexpected first trip update: %+v", tripUpdates[0])
+	}
+	if tripUpdates[1].ID.ScheduleRelationship != gtfsrt.TripDescriptor_CANCELED {
+		t.Errorf("Expected the second trip update to be canceled, got %v", tripUpdates[1].ID.ScheduleRelationship)
+	}
+}
+
+func TestFetchAndStoreAlertsFeed(t *testing.T) {
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			{
+				Id: proto.String("alert-1"),
+				Alert: &gtfsrt.Alert{
+					ActivePeriod:   []*gtfsrt.TimeRange{{End: proto.Uint64(1700000000)}},
+					InformedEntity: []*gtfsrt.EntitySelector{{StopId: proto.String("stop-1")}},
+				},
+			},
+		},
+	}
+	data, err := proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Writing to ResponseWriter in tests, error can be safely ignored.
+		// #nosec G104
+		w.Write(data)
+	}))
+	defer mockServer.Close()
+
+	server := models.ObaServer{ID: 1, AlertsUrl: mockServer.URL}
+	alertsStore := NewRealtimeStore(time.Minute)
+	if err := fetchAndStoreAlertsFeed(context.Background(), server, alertsStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	snapshot, ok := alertsStore.Get(server.ID)
+	if !ok || snapshot == nil {
+		t.Fatal("Expected the alerts snapshot to be stored")
+	}
+	alerts := snapshot.Data.Alerts
+	if len(alerts) != 1 || alerts[0].ID != "alert-1" {
+		t.Fatalf("Expected the alert to be parsed, got %+v", alerts)
+	}
+	if len(alerts[0].InformedEntities) != 1 || alerts[0].InformedEntities[0].StopID == nil || *alerts[0].InformedEntities[0].StopID != "stop-1" {
+		t.Errorf("Expected the informed stop to be parsed, got %+v", alerts[0].InformedEntities)
+	}
+}
+
+func TestFetchAndStoreRealtimeFeedTracksChanges(t *testing.T) {
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
+			GtfsRealtimeVersion: proto.String("2.0"),
+			Incrementality:      gtfsrt.FeedHeader_DIFFERENTIAL.Enum(),
+			Timestamp:           proto.Uint64(1700000000),
+		},
+		Entity: []*gtfsrt.FeedEntity{
+			{
+				Id:      proto.String("vehicle-1"),
+				Vehicle: &gtfsrt.VehiclePosition{Vehicle: &gtfsrt.VehicleDescriptor{Id: proto.String("vehicle-1")}},
+			},
+		},
+	}
+	data, err := proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+	var payload atomic.Value
+	payload.Store(data)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Writing to ResponseWriter in tests, error can be safely ignored.
+		// #nosec G104
+		w.Write(payload.Load().([]byte))
+	}))
+	defer mockServer.Close()
+
+	server := models.ObaServer{ID: 1, VehiclePositionUrl: mockServer.URL}
+	realtimeStore := NewRealtimeStore(time.Minute)
+	fetch := func() *RealtimeSnapshot {
+		t.Helper()
+		if err := fetchAndStoreGTFSRTFeed(context.Background(), server, realtimeStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		snapshot, _ := realtimeStore.Get(server.ID)
+		return snapshot
+	}
+
+	first := fetch()
+	if first.RealtimeVersion != "2.0" || first.Incrementality != "DIFFERENTIAL" {
+		t.Errorf("Expected the header metadata to be recorded, got version %q and incrementality %q", first.RealtimeVersion, first.Incrementality)
+	}
+	if first.ContentHash == "" || first.UnchangedFetches != 0 || !first.ContentChangedAt.Equal(first.FetchedAt) {
+		t.Errorf("Expected the first fetch to start a change streak, got %+v", first)
+	}
+
+	second := fetch()
+	if second.UnchangedFetches != 1 || !second.ContentChangedAt.Equal(first.FetchedAt) {
+		t.Errorf("Expected an identical payload to be counted as unchanged, got %d unchanged fetches since %v", second.UnchangedFetches, second.ContentChangedAt)
+	}
+
+	feed.Header.Timestamp = proto.Uint64(1700000030)
+	data, err = proto.Marshal(feed)
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+	payload.Store(data)
+	third := fetch()
+	if third.UnchangedFetches != 0 || third.ContentHash == second.ContentHash || !third.ContentChangedAt.Equal(third.FetchedAt) {
+		t.Errorf("Expected a new payload to reset the change streak, got %+v", third)
+	}
+}
+
+func TestFetchAndStoreRealtimeFeedClassifiesFailures(t *testing.T) {
+	valid, err := proto.Marshal(&gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			{
+				Id:      proto.String("vehicle-1"),
+				Vehicle: &gtfsrt.VehiclePosition{Vehicle: &gtfsrt.VehicleDescriptor{Id: proto.String("vehicle-1")}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+	empty, err := proto.Marshal(&gtfsrt.FeedMessage{Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")}})
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        []byte
+		feed        string
+		reason      string
+	}{
+		{name: "Unauthorized", status: http.StatusUnauthorized, body: []byte("Unauthorized"), feed: FeedVehiclePositions, reason: FetchFailureHTTP4xx},
+		{name: "Unavailable", status: http.StatusServiceUnavailable, contentType: "text/html", body: []byte("<html>Down</html>"), feed: FeedVehiclePositions, reason: FetchFailureHTTP5xx},
+		{name: "Error page", status: http.StatusOK, contentType: "text/html; charset=utf-8", body: []byte("<html>Login</html>"), feed: FeedVehiclePositions, reason: FetchFailureContentType},
+		{name: "Empty body", status: http.StatusOK, feed: FeedVehiclePositions, reason: FetchFailureEmptyBody},
+		{name: "Not protobuf", status: http.StatusOK, contentType: "application/octet-stream", body: []byte{0xff, 0xff, 0xff}, feed: FeedVehiclePositions, reason: FetchFailureParse},
+		{name: "Zero entities", status: http.StatusOK, body: empty, feed: FeedTripUpdates, reason: FetchFailureZeroEntities},
+		{name: "Empty alerts", status: http.StatusOK, body: empty, feed: FeedAlerts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				// Writing to ResponseWriter in tests, error can be safely ignored.
+				// #nosec G104
+				w.Write(tt.body)
+			}))
+			defer mockServer.Close()
+
+			server := models.ObaServer{ID: 1}
+			realtimeStore := NewRealtimeStore(time.Minute)
+			good := &RealtimeSnapshot{Data: &models.RealtimeData{}}
+			realtimeStore.Set(server.ID, good)
+
+			err := fetchAndStoreRealtimeFeed(context.Background(), server, tt.feed, mockServer.URL, realtimeStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0))
+			snapshot, _ := realtimeStore.Get(server.ID)
+			if tt.reason == "" {
+				if err != nil || snapshot == good {
+					t.Errorf("Expected the feed to be stored, got error %v", err)
+				}
+				return
+			}
+			if got := RealtimeFetchFailureReason(err); got != tt.reason {
+				t.Errorf("Expected reason %q, got %q (error: %v)", tt.reason, got, err)
+			}
+			if snapshot != good {
+				t.Error("Expected the previous snapshot to be kept")
+			}
+		})
+	}
+
+	t.Run("TLS", func(t *testing.T) {
+		mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Writing to ResponseWriter in tests, error can be safely ignored.
+			// #nosec G104
+			w.Write(valid)
+		}))
+		defer mockServer.Close()
+
+		// The default client does not trust the certificate of the test server.
+		err := fetchAndStoreRealtimeFeed(context.Background(), models.ObaServer{ID: 1}, FeedVehiclePositions, mockServer.URL, NewRealtimeStore(time.Minute), &http.Client{}, NewFeedLimits(0, 0, 0, 0))
+		if got := RealtimeFetchFailureReason(err); got != FetchFailureTLS {
+			t.Errorf("Expected reason %q, got %q (error: %v)", FetchFailureTLS, got, err)
+		}
+	})
+}
+
+// tlsHandshakeTimeoutError mimics the unexported error net/http returns when a TLS handshake times out.
+type tlsHandshakeTimeoutError struct{}
+
+func (tlsHandshakeTimeoutError) Timeout() bool   { return true }
+func (tlsHandshakeTimeoutError) Temporary() bool { return true }
+func (tlsHandshakeTimeoutError) Error() string   { return "net/http: TLS handshake timeout" }
+
+func TestClassifyTransportError(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{&url.Error{Op: "Get", URL: "http://feed.invalid", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "feed.invalid"}}}, FetchFailureDNS},
+		{&url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}}, FetchFailureConnectTimeout},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: tlsHandshakeTimeoutError{}}, FetchFailureConnectTimeout},
+		{&url.Error{Op: "Get", URL: "http://example.com", Err: context.DeadlineExceeded}, FetchFailureTimeout},
+		{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, FetchFailureTimeout},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, FetchFailureOther},
+	}
+	for _, tt := range tests {
+		if got := classifyTransportError(tt.err); got != tt.reason {
+			t.Errorf("Expected reason %q for %v, got %q", tt.reason, tt.err, got)
+		}
+	}
+}
+
+func TestFetchAndStoreGTFSRTFeedRecordsIntegrity(t *testing.T) {
+	vehicle := func(entityID, vehicleID, tripID string) *gtfsrt.FeedEntity {
+		position := &gtfsrt.VehiclePosition{Vehicle: &gtfsrt.VehicleDescriptor{Id: proto.String(vehicleID)}}
+		if tripID != "" {
+			position.Trip = &gtfsrt.TripDescriptor{TripId: proto.String(tripID), StartDate: proto.String("20250310")}
+		}
+		return &gtfsrt.FeedEntity{Id: proto.String(entityID), Vehicle: position}
+	}
+	data, err := proto.Marshal(&gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			vehicle("1", "bus-1", "trip-1"),
+			vehicle("2", "bus-1", "trip-2"),
+			vehicle("3", "bus-2", "trip-3"),
+			vehicle("4", "bus-3", "trip-3"),
+			vehicle("5", "bus-4", ""),
+			vehicle("6", "bus-5", "trip-4"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal GTFS-RT feed: %v", err)
+	}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Writing to ResponseWriter in tests, error can be safely ignored.
+		// #nosec G104
+		w.Write(data)
+	}))
+	defer mockServer.Close()
+
+	server := models.ObaServer{ID: 1, VehiclePositionUrl: mockServer.URL}
+	realtimeStore := NewRealtimeStore(time.Minute)
+	if err := fetchAndStoreGTFSRTFeed(context.Background(), server, realtimeStore, mockServer.Client(), NewFeedLimits(0, 0, 0, 0)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	snapshot, _ := realtimeStore.Get(server.ID)
+	if snapshot.Integrity == nil {
+		t.Fatal("Expected an integrity report to be stored with the snapshot")
+	}
+
+	duplicates := snapshot.Integrity.DuplicateVehicles
+	if len(duplicates) != 1 || duplicates[0].VehicleID != "bus-1" || duplicates[0].Count != 2 {
+		t.Errorf("Expected bus-1 to be reported twice, got %+v", duplicates)
+	}
+	shared := snapshot.Integrity.SharedTrips
+	if len(shared) != 1 || shared[0].TripID != "trip-3" || shared[0].StartDate != "20250310" ||
+		len(shared[0].VehicleIDs) != 2 || shared[0].VehicleIDs[0] != "bus-2" || shared[0].VehicleIDs[1] != "bus-3" {
+		t.Errorf("Expected trip-3 to be shared by bus-2 and bus-3, got %+v", shared)
+	}
+}
@@ -2,6 +2,7 @@ package gtfs
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -13,24 +14,54 @@ import (
 
 type GtfsService struct {
 	StaticStore      *StaticStore
-	RealtimeStore    *RealtimeStore
+	RealtimeStore    *RealtimeStore // GTFS-RT vehicle positions of each server
+	TripUpdatesStore *RealtimeStore // GTFS-RT trip updates of each server
+	AlertsStore      *RealtimeStore // GTFS-RT service alerts of each server
 	BoundingBoxStore *geo.BoundingBoxStore
 	Logger           *slog.Logger
 	Client           *http.Client
+	Limits           *FeedLimits      // Size limits and parse semaphore shared by every feed download
+	Changelog        *BundleChangelog // Diffs between consecutive bundles of each server
+	Cache            *BundleCache     // On-disk copies of the downloaded bundles; nil when disabled
+
+	// OnRealtimeFetch, if set, is called after every GTFS-RT fetch with the feed name and, for a failed
+	// fetch, its reason (see RealtimeFetchFailureReason); the reason is empty for a successful fetch.
+	// It lets the caller record metrics without this package depending on the metrics package.
+	OnRealtimeFetch func(serverID int, feed string, reason string)
 }
 
-func NewGtfsService(staticStore *StaticStore, realtimeStore *RealtimeStore, boundingBoxStore *geo.BoundingBoxStore, logger *slog.Logger, client *http.Client) *GtfsService {
+// NewGtfsService creates the GTFS service. A nil limits uses the default FeedLimits,
+// a nil changelog a changelog with the default size and thresholds, and a nil cache disables the
+// on-disk bundle cache.
+func NewGtfsService(staticStore *StaticStore, realtimeStore *RealtimeStore, tripUpdatesStore *RealtimeStore, alertsStore *RealtimeStore, boundingBoxStore *geo.BoundingBoxStore, logger *slog.Logger, client *http.Client, limits *FeedLimits, changelog *BundleChangelog, cache *BundleCache) *GtfsService {
+	if limits == nil {
+		limits = NewFeedLimits(0, 0, 0, 0)
+	}
+	if changelog == nil {
+		changelog = NewBundleChangelog(0, NewDiffThresholds(0, 0, 0))
+	}
 	return &GtfsService{
 		StaticStore:      staticStore,
 		RealtimeStore:    realtimeStore,
+		TripUpdatesStore: tripUpdatesStore,
+		AlertsStore:      alertsStore,
 		BoundingBoxStore: boundingBoxStore,
 		Logger:           logger,
 		Client:           client,
+		Limits:           limits,
+		Changelog:        changelog,
+		Cache:            cache,
 	}
 }
 
 func (gs *GtfsService) DownloadGTFSBundles(ctx context.Context, servers []models.ObaServer, maxRetries int) {
-	downloadGTFSBundles(ctx, servers, gs.Logger, gs.BoundingBoxStore, gs.StaticStore, maxRetries)
+	downloadGTFSBundles(ctx, servers, gs.Logger, gs.BoundingBoxStore, gs.StaticStore, gs.Client, gs.Limits, gs.Changelog, gs.Cache, maxRetries)
+}
+
+// LoadCachedBundles loads the bundles cached on disk for the servers into the stores (see loadCachedBundles).
+// It is meant to be called at startup, before DownloadGTFSBundles.
+func (gs *GtfsService) LoadCachedBundles(ctx context.Context, servers []models.ObaServer) {
+	loadCachedBundles(ctx, servers, gs.Logger, gs.BoundingBoxStore, gs.StaticStore, gs.Limits, gs.Cache)
 }
 
 // This service method downloads a GTFS static bundle from the provided URL,
@@ -39,20 +70,49 @@ func (gs *GtfsService) DownloadGTFSBundles(ctx context.Context, servers []models
 // but this public method can be used to download a single GTFS bundle.
 // It parses the GTFS data and stores it in the StaticStore using the serverID as the key.
 // It returns an error if the download or parsing fails.
+// The download is unconditional: the bundle is always downloaded and parsed.
 func (gs *GtfsService) DownloadGTFSBundle(ctx context.Context, url string, serverID int, maxRetires int) (*remoteGtfs.Static, error) {
-	return downloadGTFSBundle(ctx, url, serverID, maxRetires)
+	downloaded, err := downloadGTFSBundle(ctx, gs.Client, url, serverID, maxRetires, nil, gs.Limits, nil)
+	return downloaded.Static, err
 }
 
 func (gs *GtfsService) StoreGTFSBundle(staticBundle *remoteGtfs.Static, serverID int) error {
-	return storeGTFSBundle(staticBundle, serverID, gs.StaticStore, gs.BoundingBoxStore)
+	return storeGTFSBundle(downloadedBundle{Static: staticBundle}, serverID, gs.StaticStore, gs.BoundingBoxStore)
+}
+
+func (gs *GtfsService) RefreshGTFSBundles(ctx context.Context, getServers func() []models.ObaServer, interval time.Duration, maxRetries int) {
+	refreshGTFSBundles(ctx, getServers, gs.Logger, interval, gs.BoundingBoxStore, gs.StaticStore, gs.Client, gs.Limits, gs.Changelog, gs.Cache, maxRetries)
+}
+
+func (gs *GtfsService) FetchAndStoreGTFSRTFeed(ctx context.Context, server models.ObaServer) error {
+	err := fetchAndStoreGTFSRTFeed(ctx, server, gs.RealtimeStore, gs.Client, gs.Limits)
+	gs.recordRealtimeFetch(server.ID, FeedVehiclePositions, err)
+	return err
 }
 
-func (gs *GtfsService) RefreshGTFSBundles(ctx context.Context, servers []models.ObaServer, interval time.Duration, maxRetries int) {
-	refreshGTFSBundles(ctx, servers, gs.Logger, interval, gs.BoundingBoxStore, gs.StaticStore, maxRetries)
+func (gs *GtfsService) FetchAndStoreTripUpdatesFeed(ctx context.Context, server models.ObaServer) error {
+	err := fetchAndStoreTripUpdatesFeed(ctx, server, gs.TripUpdatesStore, gs.Client, gs.Limits)
+	gs.recordRealtimeFetch(server.ID, FeedTripUpdates, err)
+	return err
 }
 
-func (gs *GtfsService) FetchAndStoreGTFSRTFeed(server models.ObaServer) error {
-	return fetchAndStoreGTFSRTFeed(server, gs.RealtimeStore, gs.Client)
+func (gs *GtfsService) FetchAndStoreAlertsFeed(ctx context.Context, server models.ObaServer) error {
+	err := fetchAndStoreAlertsFeed(ctx, server, gs.AlertsStore, gs.Client, gs.Limits)
+	gs.recordRealtimeFetch(server.ID, FeedAlerts, err)
+	return err
+}
+
+// recordRealtimeFetch notifies OnRealtimeFetch of the outcome of a GTFS-RT fetch.
+// A fetch aborted because the application is shutting down says nothing about the feed and is ignored.
+func (gs *GtfsService) recordRealtimeFetch(serverID int, feed string, err error) {
+	if gs.OnRealtimeFetch == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	reason := ""
+	if err != nil {
+		reason = RealtimeFetchFailureReason(err)
+	}
+	gs.OnRealtimeFetch(serverID, feed, reason)
 }
 
 // exported helper functions
@@ -64,6 +124,31 @@ func GetEarliestAndLatestServiceDates(staticData *models.StaticData) (earliest,
 	return earliestTime, latestTime, nil
 }
 
+// GetBundleValidity returns the validity period of a bundle from its most authoritative source.
+func GetBundleValidity(staticData *models.StaticData) (BundleValidity, error) {
+	return getBundleValidity(staticData)
+}
+
+// ExpandServiceCalendar returns the number of active services on each of the next days service dates.
+func ExpandServiceCalendar(staticData *models.StaticData, now time.Time, days int) []ServiceDay {
+	return expandServiceCalendar(staticData, now, days)
+}
+
+// StopsInService returns the IDs of the stops scheduled to have service at now or within the next `within`.
+func StopsInService(staticData *models.StaticData, now time.Time, within time.Duration) map[string]bool {
+	return stopsInService(staticData, now, within)
+}
+
+// CurrentServiceDate returns the service date of now in the timezone of the bundle's agencies, as midnight UTC.
+func CurrentServiceDate(staticData *models.StaticData, now time.Time) time.Time {
+	return currentServiceDate(staticData, now)
+}
+
+// ActiveServices returns the IDs of the services providing service on a service date (midnight UTC).
+func ActiveServices(staticData *models.StaticData, date time.Time) map[string]bool {
+	return activeServices(staticData, date)
+}
+
 func GetStopLocationsByIDs(serverID int, stopIDs []string, staticStore *StaticStore) (map[string]remoteGtfs.Stop, error) {
 	return getStopLocationsByIDs(serverID, stopIDs, staticStore)
 }
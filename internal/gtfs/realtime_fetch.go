@@ -0,0 +1,146 @@
+package gtfs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Names of the GTFS-RT feeds of a server, as used in the `feed` metric label of fetch outcomes.
+const (
+	FeedVehiclePositions = "vehicle_positions"
+	FeedTripUpdates      = "trip_updates"
+	FeedAlerts           = "alerts"
+)
+
+// Reasons a GTFS-RT fetch fails, as reported by RealtimeFetchError and used in the `reason` metric label.
+const (
+	FetchFailureDNS            = "dns"             // The feed host name could not be resolved
+	FetchFailureConnectTimeout = "connect_timeout" // Connecting to the feed host, or the TLS handshake with it, timed out
+	FetchFailureTimeout        = "timeout"         // The fetch timed out once connected: waiting for the response or reading the body, or the collection run's deadline passed
+	FetchFailureTLS            = "tls"             // The TLS handshake failed (certificate expired, unknown authority, wrong host name...)
+	FetchFailureHTTP4xx        = "http_4xx"        // The feed answered with a 4xx status (bad API key, wrong URL...)
+	FetchFailureHTTP5xx        = "http_5xx"        // The feed answered with a 5xx status
+	FetchFailureContentType    = "content_type"    // The feed answered with an HTML, JSON or XML document instead of protobuf
+	FetchFailureEmptyBody      = "empty_body"      // The feed answered with an empty body
+	FetchFailureParse          = "parse_error"     // The body is not a valid GTFS-RT protobuf message
+	FetchFailureZeroEntities   = "zero_entities"   // The feed parsed but carries no entity
+	FetchFailureTooLarge       = "too_large"       // The feed exceeded FeedLimits.MaxRealtimeFeedSize
+	FetchFailureOther          = "other"           // Any other failure (invalid URL, connection refused, unexpected status...)
+)
+
+// RealtimeFetchError is returned when a GTFS-RT feed could not be fetched, or was fetched but is
+// not a usable feed. The previous snapshot of the feed is left in place.
+type RealtimeFetchError struct {
+	Feed   string // FeedVehiclePositions, FeedTripUpdates or FeedAlerts
+	Reason string // One of the FetchFailure* reasons
+	Err    error
+}
+
+func (e *RealtimeFetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RealtimeFetchError) Unwrap() error {
+	return e.Err
+}
+
+// RealtimeFetchFailureReason returns the reason of a failed GTFS-RT fetch, or FetchFailureOther
+// when err is not a RealtimeFetchError.
+func RealtimeFetchFailureReason(err error) string {
+	var fetchErr *RealtimeFetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Reason
+	}
+	return FetchFailureOther
+}
+
+// classifyTransportError returns the reason of an error returned by http.Client.Do or while reading
+// the response body.
+func classifyTransportError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FetchFailureDNS
+	}
+
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return FetchFailureTLS
+	}
+
+	var opErr *net.OpError
+	if (errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout()) || isTLSHandshakeTimeout(err) {
+		return FetchFailureConnectTimeout
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return FetchFailureTimeout
+	}
+	return FetchFailureOther
+}
+
+// isTLSHandshakeTimeout reports whether err is the timeout of http.Transport.TLSHandshakeTimeout.
+// net/http does not export the type of that error, so it is recognized by its message.
+func isTLSHandshakeTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() && strings.HasSuffix(err.Error(), "TLS handshake timeout")
+}
+
+// classifyStatus returns the reason of a response with an unexpected status code,
+// or an empty string for 200 OK.
+func classifyStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusOK:
+		return ""
+	case statusCode >= 400 && statusCode < 500:
+		return FetchFailureHTTP4xx
+	case statusCode >= 500 && statusCode < 600:
+		return FetchFailureHTTP5xx
+	default:
+		return FetchFailureOther
+	}
+}
+
+// isDocumentContentType reports whether a Content-Type header announces a document (HTML, JSON or
+// XML) rather than a protobuf payload. Such bodies are error or login pages served with a 200 status.
+//
+// Producers label protobuf feeds inconsistently (application/x-protobuf, application/octet-stream,
+// text/plain, or nothing at all), so only document types are rejected.
+func isDocumentContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "application/json", "text/json", "application/xml", "text/xml":
+		return true
+	}
+	return false
+}
+
+// requiresEntities reports whether a feed without any entity is a failure. A Service Alerts feed is
+// routinely empty when nothing is disrupted; vehicle positions and trip updates feeds never should be.
+func requiresEntities(feed string) bool {
+	return feed != FeedAlerts
+}
+
+// newRealtimeFetchError builds the RealtimeFetchError of a failed fetch.
+func newRealtimeFetchError(feed, reason string, format string, args ...any) error {
+	return &RealtimeFetchError{Feed: feed, Reason: reason, Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,90 @@
+package gtfs
+
+import (
+	"sort"
+
+	"github.com/OneBusAway/go-gtfs/extensions"
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// vehicleRef is the vehicle and trip descriptor of a single VehiclePosition entity.
+type vehicleRef struct {
+	vehicleID string
+	tripID    string
+	startDate string
+}
+
+// vehicleRecorder is a go-gtfs parse extension recording the descriptors of every VehiclePosition
+// entity of a feed, as found in the message.
+//
+// remoteGtfs.ParseRealtime merges the vehicle positions sharing a vehicle ID and keeps a single
+// vehicle per trip, so duplicates are gone from the parsed feed; the extension sees each entity
+// before that happens.
+type vehicleRecorder struct {
+	extensions.NoExtensionImpl
+	vehicles []vehicleRef
+}
+
+func (r *vehicleRecorder) UpdateVehicle(vehicle *gtfsrt.VehiclePosition) {
+	r.vehicles = append(r.vehicles, vehicleRef{
+		vehicleID: vehicle.GetVehicle().GetId(),
+		tripID:    vehicle.GetTrip().GetTripId(),
+		startDate: vehicle.GetTrip().GetStartDate(),
+	})
+}
+
+// newRealtimeIntegrityReport finds the vehicle IDs reported by several vehicle positions, and the
+// trips (trip ID and start date) claimed by several distinct vehicles. Vehicle positions without a
+// vehicle ID are ignored, and so are vehicles without a trip ID when looking for shared trips.
+func newRealtimeIntegrityReport(vehicles []vehicleRef) *models.RealtimeIntegrityReport {
+	type tripKey struct{ tripID, startDate string }
+	vehicleCounts := make(map[string]int)
+	tripVehicles := make(map[tripKey]map[string]bool)
+	for _, vehicle := range vehicles {
+		if vehicle.vehicleID == "" {
+			continue
+		}
+		vehicleCounts[vehicle.vehicleID]++
+		if vehicle.tripID == "" {
+			continue
+		}
+		key := tripKey{vehicle.tripID, vehicle.startDate}
+		if tripVehicles[key] == nil {
+			tripVehicles[key] = make(map[string]bool)
+		}
+		tripVehicles[key][vehicle.vehicleID] = true
+	}
+
+	report := &models.RealtimeIntegrityReport{
+		DuplicateVehicles: []models.DuplicateVehicle{},
+		SharedTrips:       []models.SharedTrip{},
+	}
+	for vehicleID, count := range vehicleCounts {
+		if count > 1 {
+			report.DuplicateVehicles = append(report.DuplicateVehicles, models.DuplicateVehicle{VehicleID: vehicleID, Count: count})
+		}
+	}
+	for key, vehicleIDs := range tripVehicles {
+		if len(vehicleIDs) < 2 {
+			continue
+		}
+		shared := models.SharedTrip{TripID: key.tripID, StartDate: key.startDate}
+		for vehicleID := range vehicleIDs {
+			shared.VehicleIDs = append(shared.VehicleIDs, vehicleID)
+		}
+		sort.Strings(shared.VehicleIDs)
+		report.SharedTrips = append(report.SharedTrips, shared)
+	}
+
+	sort.Slice(report.DuplicateVehicles, func(i, j int) bool {
+		return report.DuplicateVehicles[i].VehicleID < report.DuplicateVehicles[j].VehicleID
+	})
+	sort.Slice(report.SharedTrips, func(i, j int) bool {
+		if report.SharedTrips[i].TripID != report.SharedTrips[j].TripID {
+			return report.SharedTrips[i].TripID < report.SharedTrips[j].TripID
+		}
+		return report.SharedTrips[i].StartDate < report.SharedTrips[j].StartDate
+	})
+	return report
+}
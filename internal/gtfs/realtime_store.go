@@ -1,49 +1,146 @@
 package gtfs
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"watchdog.onebusaway.org/internal/models"
 )
 
-// RealtimeStore is used to store GTFS-RT data
-// fetched once by a designated function. This avoids making multiple API calls for the same data
-// and allows other components to reuse the parsed result safely across goroutines.
+// RealtimeSnapshot is a parsed GTFS-RT feed together with the metadata
+// recorded at the moment it was fetched.
 //
-// It provides a thread-safe way to store and retrieve parsed GTFS-RT data.
-// It ensures that multiple goroutines can safely read the same data after it is set once.
+// Keeping the metadata next to the data lets consumers decide whether a
+// snapshot is still usable (e.g., reject snapshots older than a few fetch cycles)
+// and lets operators correlate metrics with the exact feed that produced them.
+type RealtimeSnapshot struct {
+	// Data is the parsed GTFS-RT feed content.
+	Data *models.RealtimeData
+	// FetchedAt is the UTC time at which the watchdog received the feed.
+	FetchedAt time.Time
+	// FeedTimestamp is the FeedHeader timestamp reported by the producer.
+	// It is the zero time if the feed did not set one.
+	FeedTimestamp time.Time
+	// PayloadSize is the size in bytes of the raw protobuf payload.
+	PayloadSize int
+	// SourceURL is the URL the feed was fetched from.
+	SourceURL string
+	// RealtimeVersion is the `gtfs_realtime_version` of the FeedHeader, empty if the header is missing.
+	RealtimeVersion string
+	// Incrementality is the incrementality of the FeedHeader (FULL_DATASET or DIFFERENTIAL).
+	Incrementality string
+	// ContentHash is the hex-encoded SHA-256 hash of the raw protobuf payload.
+	ContentHash string
+	// UnchangedFetches is the number of consecutive fetches, this one included, that returned the
+	// same payload as the previous fetch. It is 0 when the payload changed.
+	UnchangedFetches int
+	// ContentChangedAt is the fetch time of the first fetch that returned this payload.
+	ContentChangedAt time.Time
+	// Integrity lists the duplicate vehicle IDs and the trips shared by several vehicles of the
+	// feed's vehicle positions, found before parsing merges them.
+	Integrity *models.RealtimeIntegrityReport
+}
+
+// Age returns how long ago the snapshot was fetched, relative to now.
+func (s *RealtimeSnapshot) Age(now time.Time) time.Duration {
+	return now.Sub(s.FetchedAt)
+}
+
+// followPrevious carries the change tracking of the previous snapshot of the same feed over to s:
+// when both payloads have the same content hash, the unchanged streak goes on and the content
+// change time is kept; otherwise s starts a new streak at its own fetch time.
+func (s *RealtimeSnapshot) followPrevious(previous *RealtimeSnapshot) {
+	if previous != nil && previous.ContentHash != "" && previous.ContentHash == s.ContentHash {
+		s.UnchangedFetches = previous.UnchangedFetches + 1
+		s.ContentChangedAt = previous.ContentChangedAt
+		return
+	}
+	s.UnchangedFetches = 0
+	s.ContentChangedAt = s.FetchedAt
+}
+
+// RealtimeStore is a thread-safe in-memory store for GTFS-RT snapshots,
+// indexed by server ID. Each server's feed is fetched once per collection cycle
+// by a designated function, and the parsed result is reused by every check
+// for that server. This avoids making multiple API calls for the same data
+// and keeps one server's feed from being read by another server's checks.
 type RealtimeStore struct {
-	mu   sync.RWMutex
-	data *models.RealtimeData
+	mu     sync.RWMutex
+	data   map[int]*RealtimeSnapshot // GTFS-RT snapshot of each server, indexed by server ID
+	maxAge time.Duration             // Snapshots older than this are reported as missing by GetFresh
 }
 
 // NewRealtimeStore creates and returns a new empty RealtimeStore instance.
 //
+// Parameters:
+//   - maxAge: The maximum age of a snapshot returned by GetFresh.
+//     A value of zero or less disables the staleness check.
+//
 // Usage:
 //
-//	store := gtfs.NewRealtimeStore()
-func NewRealtimeStore() *RealtimeStore {
-	return &RealtimeStore{}
+//	store := gtfs.NewRealtimeStore(90 * time.Second)
+func NewRealtimeStore(maxAge time.Duration) *RealtimeStore {
+	return &RealtimeStore{
+		data:   make(map[int]*RealtimeSnapshot),
+		maxAge: maxAge,
+	}
 }
 
-// Set stores the latest parsed GTFS-RT data in a thread-safe way.
-// It is typically called once by the function responsible for fetching the feed.
+// Set stores the latest GTFS-RT snapshot for the specified server ID in a thread-safe way.
+// It is typically called once per cycle by the function responsible for fetching the feed.
 //
 // Parameters:
-//   - newData: The parsed GTFS-RT feed to store.
-func (s *RealtimeStore) Set(newData *models.RealtimeData) {
+//   - serverID: The unique identifier for the OBA server.
+//   - snapshot: The parsed GTFS-RT feed and its fetch metadata.
+func (s *RealtimeStore) Set(serverID int, snapshot *RealtimeSnapshot) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data = newData
+	s.data[serverID] = snapshot
 }
 
-// Get retrieves the most recently stored GTFS-RT data in a thread-safe way.
-// It can be safely called by multiple consumers concurrently.
+// Get retrieves the most recently stored GTFS-RT snapshot for the specified server ID,
+// regardless of its age. It can be safely called by multiple consumers concurrently.
 //
 // Returns:
-//   - A pointer to the parsed GTFS-RT feed, or nil if not set.
-func (s *RealtimeStore) Get() *models.RealtimeData {
+//   - *RealtimeSnapshot: The stored snapshot, if present.
+//   - bool: True if a snapshot exists for the given server ID, false otherwise.
+func (s *RealtimeStore) Get(serverID int) (*RealtimeSnapshot, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.data
+	snapshot, exists := s.data[serverID]
+	return snapshot, exists
+}
+
+// GetFresh retrieves the GTFS-RT snapshot for the specified server ID only if it
+// was fetched within the store's maximum age of now.
+//
+// A stale snapshot is treated the same as a missing one, so that checks never
+// silently report metrics computed from an old feed.
+//
+// Returns:
+//   - *RealtimeSnapshot: The stored snapshot, if present and fresh.
+//   - error: Describes why no usable snapshot is available, or nil.
+func (s *RealtimeStore) GetFresh(serverID int, now time.Time) (*RealtimeSnapshot, error) {
+	snapshot, ok := s.Get(serverID)
+	if !ok || snapshot == nil || snapshot.Data == nil {
+		return nil, fmt.Errorf("no GTFS-RT data available for server %d", serverID)
+	}
+	if s.maxAge > 0 {
+		if age := snapshot.Age(now); age > s.maxAge {
+			return nil, fmt.Errorf("GTFS-RT data for server %d is stale: fetched %s ago (max age %s)", serverID, age.Round(time.Second), s.maxAge)
+		}
+	}
+	return snapshot, nil
+}
+
+// Delete removes the GTFS-RT snapshot stored for the specified server ID.
+// It is used to evict servers that were removed from the configuration.
+//
+// Parameters:
+//   - serverID: The unique identifier for the OBA server.
+func (s *RealtimeStore) Delete(serverID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, serverID)
 }
@@ -0,0 +1,158 @@
+package gtfs
+
+import (
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// ServiceDay is the number of services active on a service date.
+type ServiceDay struct {
+	Date           time.Time // Service date, as midnight UTC
+	ActiveServices int       // Number of service IDs providing service on Date
+}
+
+// expandServiceCalendar expands calendar.txt and calendar_dates.txt over days service dates,
+// starting with the service date of now in the timezone of the bundle's agencies.
+//
+// A service is active on a date when either:
+//   - the date is within its calendar.txt StartDate and EndDate, runs on that day of the week,
+//     and is not removed by calendar_dates.txt (exception_type 2), or
+//   - the date is added by calendar_dates.txt (exception_type 1).
+//
+// Service dates are compared as calendar dates (year, month, day), whatever the location
+// the GTFS library parsed them in.
+func expandServiceCalendar(staticData *models.StaticData, now time.Time, days int) []ServiceDay {
+	if staticData == nil || days <= 0 {
+		return nil
+	}
+
+	today := currentServiceDate(staticData, now)
+	serviceDays := make([]ServiceDay, days)
+	for i := range serviceDays {
+		serviceDays[i].Date = today.AddDate(0, 0, i)
+	}
+	for _, service := range staticData.Services {
+		for i := range serviceDays {
+			if serviceActiveOn(service, serviceDays[i].Date) {
+				serviceDays[i].ActiveServices++
+			}
+		}
+	}
+	return serviceDays
+}
+
+// stopsInService returns the IDs of the stops scheduled to have service at now or within the next
+// `within`: stops at which a service active on the service date of now calls in that window
+// (see models.StopServiceSpan). Trips of the previous service date running past midnight (stop
+// times beyond 24:00:00) are taken into account.
+//
+// Times are measured from midnight in the timezone of the bundle's agencies.
+func stopsInService(staticData *models.StaticData, now time.Time, within time.Duration) map[string]bool {
+	inService := make(map[string]bool)
+	if staticData == nil {
+		return inService
+	}
+
+	local := now.In(agencyLocation(staticData.Agencies))
+	today := serviceDate(local)
+	sinceMidnight := local.Sub(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location()))
+
+	activeToday := activeServices(staticData, today)
+	activeYesterday := activeServices(staticData, today.AddDate(0, 0, -1))
+
+	for stopID, spans := range staticData.StopServices {
+		for _, span := range spans {
+			if (activeToday[span.ServiceID] && spanCalls(span, sinceMidnight, within)) ||
+				(activeYesterday[span.ServiceID] && spanCalls(span, sinceMidnight+24*time.Hour, within)) {
+				inService[stopID] = true
+				break
+			}
+		}
+	}
+	return inService
+}
+
+// currentServiceDate returns the service date of now in the timezone of the bundle's agencies, as midnight UTC.
+func currentServiceDate(staticData *models.StaticData, now time.Time) time.Time {
+	if staticData == nil {
+		return serviceDate(now)
+	}
+	return serviceDate(now.In(agencyLocation(staticData.Agencies)))
+}
+
+// activeServices returns the IDs of the services providing service on the given service date (midnight UTC).
+func activeServices(staticData *models.StaticData, date time.Time) map[string]bool {
+	active := make(map[string]bool)
+	if staticData == nil {
+		return active
+	}
+	for _, service := range staticData.Services {
+		if serviceActiveOn(service, date) {
+			active[service.Id] = true
+		}
+	}
+	return active
+}
+
+// spanCalls reports whether the span has a call between at and at+within.
+func spanCalls(span models.StopServiceSpan, at, within time.Duration) bool {
+	return span.First <= at+within && span.Last >= at
+}
+
+// serviceActiveOn reports whether the service provides service on the given service date (midnight UTC).
+func serviceActiveOn(service remoteGtfs.Service, date time.Time) bool {
+	for _, added := range service.AddedDates {
+		if serviceDate(added).Equal(date) {
+			return true
+		}
+	}
+	for _, removed := range service.RemovedDates {
+		if serviceDate(removed).Equal(date) {
+			return false
+		}
+	}
+	if service.StartDate.IsZero() || service.EndDate.IsZero() {
+		return false
+	}
+	if date.Before(serviceDate(service.StartDate)) || date.After(serviceDate(service.EndDate)) {
+		return false
+	}
+
+	switch date.Weekday() {
+	case time.Monday:
+		return service.Monday
+	case time.Tuesday:
+		return service.Tuesday
+	case time.Wednesday:
+		return service.Wednesday
+	case time.Thursday:
+		return service.Thursday
+	case time.Friday:
+		return service.Friday
+	case time.Saturday:
+		return service.Saturday
+	default:
+		return service.Sunday
+	}
+}
+
+// serviceDate returns the calendar date of t, as midnight UTC.
+func serviceDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// agencyLocation returns the timezone of the first agency with a valid agency_timezone,
+// or UTC if there is none. GTFS requires every agency of a bundle to share the same timezone.
+func agencyLocation(agencies []remoteGtfs.Agency) *time.Location {
+	for _, agency := range agencies {
+		if agency.Timezone == "" {
+			continue
+		}
+		if location, err := time.LoadLocation(agency.Timezone); err == nil {
+			return location
+		}
+	}
+	return time.UTC
+}
@@ -0,0 +1,152 @@
+package gtfs
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestExpandServiceCalendar(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+	localDate := func(month time.Month, day int) time.Time { return time.Date(2025, month, day, 0, 0, 0, 0, loc) }
+	utcDate := func(month time.Month, day int) time.Time { return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC) }
+
+	staticData := &models.StaticData{
+		Agencies: []remoteGtfs.Agency{{Id: "1", Timezone: "America/Los_Angeles"}},
+		Services: []remoteGtfs.Service{
+			{
+				Id:     "weekday",
+				Monday: true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true,
+				StartDate:    localDate(1, 1),
+				EndDate:      localDate(1, 31),
+				RemovedDates: []time.Time{localDate(1, 8)},
+			},
+			{
+				Id:         "special",
+				AddedDates: []time.Time{localDate(1, 11)},
+			},
+		},
+	}
+
+	// 2025-01-06 03:00 UTC is still Sunday 2025-01-05 in Los Angeles.
+	now := time.Date(2025, 1, 6, 3, 0, 0, 0, time.UTC)
+	days := expandServiceCalendar(staticData, now, 8)
+	if len(days) != 8 {
+		t.Fatalf("expected 8 days, got %d", len(days))
+	}
+
+	expected := []struct {
+		date   time.Time
+		active int
+	}{
+		{utcDate(1, 5), 0},  // Sunday
+		{utcDate(1, 6), 1},  // Monday
+		{utcDate(1, 7), 1},  // Tuesday
+		{utcDate(1, 8), 0},  // Wednesday, removed
+		{utcDate(1, 9), 1},  // Thursday
+		{utcDate(1, 10), 1}, // Friday
+		{utcDate(1, 11), 1}, // Saturday, added
+		{utcDate(1, 12), 0}, // Sunday
+	}
+	for i, want := range expected {
+		if !days[i].Date.Equal(want.date) {
+			t.Errorf("day %d: expected date %s, got %s", i, want.date.Format("2006-01-02"), days[i].Date.Format("2006-01-02"))
+		}
+		if days[i].ActiveServices != want.active {
+			t.Errorf("day %d (%s): expected %d active services, got %d", i, want.date.Format("2006-01-02"), want.active, days[i].ActiveServices)
+		}
+	}
+
+	if days := expandServiceCalendar(staticData, now, 0); days != nil {
+		t.Errorf("expected no days for an empty window, got %d", len(days))
+	}
+	if days := expandServiceCalendar(nil, now, 7); days != nil {
+		t.Errorf("expected no days for nil static data, got %d", len(days))
+	}
+}
+
+func TestExpandServiceCalendarFixture(t *testing.T) {
+	data := readFixture(t, "gtfs.zip")
+	staticBundle, err := remoteGtfs.ParseStatic(data, remoteGtfs.ParseStaticOptions{})
+	if err != nil {
+		t.Fatal("failed to parse gtfs static data")
+	}
+	staticData := models.NewStaticData(staticBundle)
+
+	// The fixture provides service every day in early 2025, and none after its last end date.
+	inService := expandServiceCalendar(staticData, time.Date(2025, 1, 13, 20, 0, 0, 0, time.UTC), 7)
+	for _, day := range inService {
+		if day.ActiveServices == 0 {
+			t.Errorf("expected active services on %s", day.Date.Format("2006-01-02"))
+		}
+	}
+	expired := expandServiceCalendar(staticData, time.Date(2025, 6, 1, 20, 0, 0, 0, time.UTC), 7)
+	for _, day := range expired {
+		if day.ActiveServices != 0 {
+			t.Errorf("expected no active services on %s, got %d", day.Date.Format("2006-01-02"), day.ActiveServices)
+		}
+	}
+
+	// Stops are in service on a weekday afternoon, and none is once the bundle expired.
+	if stops := stopsInService(staticData, time.Date(2025, 1, 13, 20, 0, 0, 0, time.UTC), 30*time.Minute); len(stops) == 0 {
+		t.Error("expected stops in service on a weekday afternoon")
+	}
+	if stops := stopsInService(staticData, time.Date(2025, 6, 1, 20, 0, 0, 0, time.UTC), 30*time.Minute); len(stops) != 0 {
+		t.Errorf("expected no stop in service after the last end date, got %d", len(stops))
+	}
+}
+
+func TestStopsInService(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+	localDate := func(day int) time.Time { return time.Date(2025, 1, day, 0, 0, 0, 0, loc) }
+
+	staticData := &models.StaticData{
+		Agencies: []remoteGtfs.Agency{{Id: "1", Timezone: "America/Los_Angeles"}},
+		Services: []remoteGtfs.Service{
+			{Id: "weekday", Monday: true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true, StartDate: localDate(1), EndDate: localDate(31)},
+			{Id: "sunday", Sunday: true, StartDate: localDate(1), EndDate: localDate(31)},
+		},
+		StopServices: map[string][]models.StopServiceSpan{
+			"morning":  {{ServiceID: "weekday", First: 6 * time.Hour, Last: 10 * time.Hour}},
+			"evening":  {{ServiceID: "weekday", First: 17 * time.Hour, Last: 20 * time.Hour}},
+			"owl":      {{ServiceID: "sunday", First: 23 * time.Hour, Last: 25 * time.Hour}}, // past midnight
+			"weekends": {{ServiceID: "sunday", First: 6 * time.Hour, Last: 22 * time.Hour}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected []string
+	}{
+		{"Monday morning", time.Date(2025, 1, 6, 8, 0, 0, 0, loc), []string{"morning"}},
+		{"Shortly before the evening service", time.Date(2025, 1, 6, 16, 40, 0, 0, loc), []string{"evening"}},
+		{"After midnight, on Sunday's service", time.Date(2025, 1, 6, 0, 30, 0, 0, loc), []string{"owl"}},
+		{"Sunday afternoon", time.Date(2025, 1, 5, 15, 0, 0, 0, loc), []string{"weekends"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stopsInService(staticData, tt.now, 30*time.Minute)
+			if len(got) != len(tt.expected) {
+				t.Errorf("expected %v in service, got %v", tt.expected, got)
+			}
+			for _, stopID := range tt.expected {
+				if !got[stopID] {
+					t.Errorf("expected %s in service, got %v", stopID, got)
+				}
+			}
+		})
+	}
+
+	if got := stopsInService(nil, time.Now(), time.Hour); len(got) != 0 {
+		t.Errorf("expected no stop in service for nil static data, got %v", got)
+	}
+}
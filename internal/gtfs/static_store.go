@@ -54,3 +54,15 @@ func (s *StaticStore) Get(serverID int) (*models.StaticData, bool) {
 	data, exists := s.data[serverID]
 	return data, exists
 }
+
+// Delete removes the GTFS static data stored for the specified server ID.
+// It is used to evict servers that were removed from the configuration.
+// This method is thread-safe and uses a write lock.
+//
+// Parameters:
+//   - serverID: The unique identifier for the OBA server.
+func (s *StaticStore) Delete(serverID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, serverID)
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"net/http"
 	"testing"
+	"time"
 
 	"watchdog.onebusaway.org/internal/geo"
 	"watchdog.onebusaway.org/internal/gtfs"
@@ -22,11 +23,11 @@ func TestDownloadGTFSBundles(t *testing.T) {
 	}
 
 	staticStore := gtfs.NewStaticStore()
-	realtimeStore := gtfs.NewRealtimeStore()
+	realtimeStore := gtfs.NewRealtimeStore(time.Minute)
 	boundingBoxStore := geo.NewBoundingBoxStore()
 	logger := slog.Default()
 	client := &http.Client{}
-	gtfsService := gtfs.NewGtfsService(staticStore,realtimeStore,boundingBoxStore,logger,client)
+	gtfsService := gtfs.NewGtfsService(staticStore,realtimeStore,gtfs.NewRealtimeStore(time.Minute),gtfs.NewRealtimeStore(time.Minute),boundingBoxStore,logger,client,nil,nil,nil)
 	ctx := context.Background()
 	for _, server := range integrationServers {
 		srv := server
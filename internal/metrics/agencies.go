@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// resolveAgencyIDs returns the agencies hosted by a server, the way per-agency checks see them.
+//
+// The agencies configured for the server (`agency_id` and `agency_ids`, see
+// models.ObaServer.ConfiguredAgencyIDs) always win. When none is configured, they are discovered:
+//  1. from the agencies of the server's GTFS static bundle, when it is downloaded;
+//  2. otherwise from the server's `agencies-with-coverage` endpoint.
+//
+// Returns an error if no agency is configured and none could be discovered.
+func resolveAgencyIDs(ctx context.Context, server models.ObaServer, staticStore *gtfs.StaticStore) ([]string, error) {
+	var staticData *models.StaticData
+	if staticStore != nil {
+		staticData, _ = staticStore.Get(server.ID)
+	}
+	if ids := staticAgencyIDs(server, staticData); len(ids) > 0 {
+		return ids, nil
+	}
+
+	coverage, err := fetchAgenciesWithCoverage(ctx, server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover the agencies of server %d: %w", server.ID, err)
+	}
+	var ids []string
+	if coverage != nil {
+		for _, agency := range coverage.List {
+			ids = append(ids, agency.AgencyID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no agency configured or discovered for server %d", server.ID)
+	}
+	return ids, nil
+}
+
+// staticAgencyIDs returns the agencies configured for a server or, when none is configured,
+// the agencies of its GTFS static bundle. staticData may be nil.
+// Unlike resolveAgencyIDs, it never calls the server.
+func staticAgencyIDs(server models.ObaServer, staticData *models.StaticData) []string {
+	if ids := server.ConfiguredAgencyIDs(); len(ids) > 0 {
+		return ids
+	}
+	if staticData == nil {
+		return nil
+	}
+	ids := make([]string, 0, len(staticData.Agencies))
+	for _, agency := range staticData.Agencies {
+		ids = append(ids, agency.Id)
+	}
+	return ids
+}
+
+// obaAPIMetricsSlugID returns the `slug_id` label of the metrics of the OBA metrics API for a server.
+// The metrics API covers every agency of the server, so the label is made of all of its agencies
+// (see staticAgencyIDs) joined by commas or, when none is known yet, of the server ID.
+func obaAPIMetricsSlugID(server models.ObaServer, staticStore *gtfs.StaticStore) string {
+	var staticData *models.StaticData
+	if staticStore != nil {
+		staticData, _ = staticStore.Get(server.ID)
+	}
+	if ids := staticAgencyIDs(server, staticData); len(ids) > 0 {
+		return strings.Join(ids, ",")
+	}
+	return strconv.Itoa(server.ID)
+}
+
+// stopAgencyID returns the agency OBA prefixes the stop IDs of a server with: its first configured
+// agency or, when none is configured, the first agency of its GTFS static bundle. GTFS stops have no
+// agency, and the OBA bundle builder assigns them the default agency of the feed.
+// It returns an empty string if the server has no known agency.
+func stopAgencyID(server models.ObaServer, staticData *models.StaticData) string {
+	if ids := staticAgencyIDs(server, staticData); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// vehicleAgencies attributes GTFS-RT vehicles to the agencies of a server, through the agency of
+// their route in the GTFS static bundle.
+type vehicleAgencies struct {
+	staticData *models.StaticData // Bundle the routes of trips and agencies of routes are looked up in; may be nil
+	fallback   string             // Agency of every vehicle of a single-agency server; empty otherwise
+}
+
+// newVehicleAgencies builds the attribution of vehicles to the given agencies.
+//
+// A server with a single agency gets every vehicle, whatever its route, so that single-agency
+// servers compare the whole feed as before. Otherwise vehicles are attributed through the static
+// bundle; staticData may be nil, in which case every vehicle is left unattributed.
+func newVehicleAgencies(staticData *models.StaticData, agencyIDs []string) *vehicleAgencies {
+	va := &vehicleAgencies{}
+	if len(agencyIDs) == 1 {
+		va.fallback = agencyIDs[0]
+		return va
+	}
+	va.staticData = staticData
+	return va
+}
+
+// agencyOf returns the agency of a vehicle, or an empty string if it cannot be attributed.
+//
+// The route of the vehicle is its trip descriptor's route_id or, when the feed omits it, the
+// route of its trip in the static bundle.
+func (va *vehicleAgencies) agencyOf(vehicle remoteGtfs.Vehicle) string {
+	if vehicle.Trip != nil && va.staticData != nil {
+		routeID := vehicle.Trip.ID.RouteID
+		if routeID == "" {
+			if trip, ok := va.staticData.Trip(vehicle.Trip.ID.ID); ok {
+				routeID = trip.RouteID
+			}
+		}
+		if route, ok := va.staticData.RoutesByID[routeID]; ok && route.Agency != nil {
+			return route.Agency.Id
+		}
+	}
+	return va.fallback
+}
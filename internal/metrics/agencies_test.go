@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestResolveAgencyIDs(t *testing.T) {
+	ts := setupObaServer(t, `{"code":200,"currentTime":1234567890000,"text":"OK","version":2,"data":{"list":[{"agencyId":"api-1"},{"agencyId":"api-2"}]}}`, http.StatusOK)
+	defer ts.Close()
+
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(1, &models.StaticData{Agencies: []remoteGtfs.Agency{{Id: "bundle-1"}, {Id: "bundle-2"}}})
+
+	tests := []struct {
+		name     string
+		server   models.ObaServer
+		expected []string
+	}{
+		{"Configured agencies win", models.ObaServer{ID: 1, AgencyID: "1", AgencyIDs: []string{"40"}, ObaBaseURL: ts.URL}, []string{"1", "40"}},
+		{"Discovered from the static bundle", models.ObaServer{ID: 1, ObaBaseURL: ts.URL}, []string{"bundle-1", "bundle-2"}},
+		{"Discovered from agencies-with-coverage", models.ObaServer{ID: 2, ObaBaseURL: ts.URL}, []string{"api-1", "api-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAgencyIDs(context.Background(), tt.server, staticStore)
+			if err != nil {
+				t.Fatalf("resolveAgencyIDs failed: %v", err)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("Nothing to discover", func(t *testing.T) {
+		empty := setupObaServer(t, `{"code":200,"currentTime":1234567890000,"text":"OK","version":2,"data":{"list":[]}}`, http.StatusOK)
+		defer empty.Close()
+		if _, err := resolveAgencyIDs(context.Background(), models.ObaServer{ID: 2, ObaBaseURL: empty.URL}, staticStore); err == nil {
+			t.Error("expected an error when no agency is configured or discovered")
+		}
+	})
+}
+
+func TestObaAPIMetricsSlugID(t *testing.T) {
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(1, &models.StaticData{Agencies: []remoteGtfs.Agency{{Id: "bundle-1"}, {Id: "bundle-2"}}})
+
+	tests := []struct {
+		name     string
+		server   models.ObaServer
+		expected string
+	}{
+		{"Configured agency", models.ObaServer{ID: 1, AgencyID: "1"}, "1"},
+		{"Configured agencies", models.ObaServer{ID: 1, AgencyID: "1", AgencyIDs: []string{"40"}}, "1,40"},
+		{"No agency_id, agencies of the static bundle", models.ObaServer{ID: 1}, "bundle-1,bundle-2"},
+		{"No agency_id and no static bundle", models.ObaServer{ID: 2}, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := obaAPIMetricsSlugID(tt.server, staticStore); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCountVehiclePositionsByAgency(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 993, "", "www.example.com", "", "", "")
+	defer Series.DeleteServer(server.ID)
+
+	metro := &remoteGtfs.Agency{Id: "metro"}
+	tram := &remoteGtfs.Agency{Id: "tram"}
+	staticData := &models.StaticData{
+		Routes: []remoteGtfs.Route{{Id: "route-1", Agency: metro}, {Id: "route-2", Agency: tram}},
+		Trips:  []models.TripSummary{{ID: "trip-2", RouteID: "route-2"}},
+	}
+	staticData.BuildIndexes()
+	realtimeData := &models.RealtimeData{Vehicles: []remoteGtfs.Vehicle{
+		{Trip: &remoteGtfs.Trip{ID: remoteGtfs.TripID{ID: "trip-1", RouteID: "route-1"}}},
+		{Trip: &remoteGtfs.Trip{ID: remoteGtfs.TripID{ID: "trip-2"}}}, // route taken from the static bundle
+		{Trip: &remoteGtfs.Trip{ID: remoteGtfs.TripID{ID: "unknown-trip"}}},
+		{}, // no trip
+	}}
+
+	counts := countVehiclePositionsByAgency(server, realtimeData, staticData, []string{"metro", "tram", "ferry"})
+	if counts["metro"] != 1 || counts["tram"] != 1 || counts["ferry"] != 0 {
+		t.Errorf("unexpected counts by agency: %v", counts)
+	}
+	if got := testutil.ToFloat64(RealtimeVehiclePositionsByAgency.WithLabelValues("ferry", "993")); got != 0 {
+		t.Errorf("expected an agency without vehicles to export 0, got %v", got)
+	}
+	if got := testutil.ToFloat64(UnattributedVehiclePositions.WithLabelValues("993")); got != 2 {
+		t.Errorf("expected 2 unattributed vehicles, got %v", got)
+	}
+
+	// A single agency gets every vehicle, whatever its route.
+	counts = countVehiclePositionsByAgency(server, realtimeData, staticData, []string{"metro"})
+	if counts["metro"] != 4 {
+		t.Errorf("expected the single agency to get every vehicle, got %v", counts)
+	}
+	if got := testutil.ToFloat64(UnattributedVehiclePositions.WithLabelValues("993")); got != 0 {
+		t.Errorf("expected no unattributed vehicles for a single agency, got %v", got)
+	}
+}
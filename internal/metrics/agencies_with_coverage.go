@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
 	onebusaway "github.com/OneBusAway/go-sdk"
 	"github.com/OneBusAway/go-sdk/option"
+	"github.com/OneBusAway/go-sdk/shared"
 	"github.com/getsentry/sentry-go"
+	"watchdog.onebusaway.org/internal/geo"
 	"watchdog.onebusaway.org/internal/gtfs"
 	"watchdog.onebusaway.org/internal/models"
 	"watchdog.onebusaway.org/internal/report"
@@ -49,29 +53,22 @@ func checkAgenciesWithCoverage(staticStore *gtfs.StaticStore, server models.ObaS
 		return 0, err
 	}
 
-	AgenciesInStaticGtfs.WithLabelValues(
+	Series.Gauge(AgenciesInStaticGtfs, server.ID,
 		strconv.Itoa(server.ID),
 	).Set(float64(len(staticData.Agencies)))
 
 	return len(staticData.Agencies), nil
 }
 
-// getAgenciesWithCoverage calls the OBA `agencies-with-coverage` API endpoint
-// for the given server and returns the number of agencies in the real-time feed.
-// The count is also reported to the AgenciesWithCoverage Prometheus metric.
-//
-// This function is used to collect live data for comparison against the GTFS static bundle.
-//
-// Returns the number of real-time agencies on success.
-// Returns an error if the API call fails or the response is invalid.
-func getAgenciesWithCoverage(server models.ObaServer) (int, error) {
+// fetchAgenciesWithCoverage calls the OBA `agencies-with-coverage` API endpoint for the given server
+// and returns its data: the agencies it lists with their coverage area, and the references holding
+// their names and timezones. It returns nil if the response is empty. Errors are reported to Sentry.
+func fetchAgenciesWithCoverage(ctx context.Context, server models.ObaServer) (*onebusaway.AgenciesWithCoverageListResponseData, error) {
 	client := onebusaway.NewClient(
 		option.WithAPIKey(server.ObaApiKey),
 		option.WithBaseURL(server.ObaBaseURL),
 	)
 
-	ctx := context.Background()
-
 	response, err := client.AgenciesWithCoverage.List(ctx)
 
 	if err != nil {
@@ -81,43 +78,191 @@ func getAgenciesWithCoverage(server models.ObaServer) (int, error) {
 				"oba_base_url": server.ObaBaseURL,
 			},
 		})
-		return 0, err
+		return nil, err
 	}
 
 	if response == nil {
-		return 0, nil
+		return nil, nil
 	}
+	return &response.Data, nil
+}
 
-	AgenciesInCoverageEndpoint.WithLabelValues(
-		strconv.Itoa(server.ID),
-	).Set(float64(len(response.Data.List)))
+// agencyCoverageMargin is how far, in degrees (about 1 km), the coverage area of an agency may extend
+// beyond the bounding box of the GTFS static bundle. OBA computes the coverage area from the stops of
+// the agency, like the bounding box, so the margin only absorbs rounding.
+const agencyCoverageMargin = 0.01
 
-	return len(response.Data.List), nil
+// agencyMismatch is an attribute of an agency whose value differs between the GTFS static bundle and
+// the `agencies-with-coverage` endpoint.
+type agencyMismatch struct {
+	agencyID  string
+	attribute string // "name" or "timezone"
+	static    string // Value in the static bundle
+	coverage  string // Value in the agencies-with-coverage references
 }
 
-// checkAgenciesWithCoverageMatch compares the number of agencies in the GTFS static bundle
-// with the number of agencies returned by the real-time `agencies-with-coverage` API for the given server.
-// It sets the AgenciesCoverageMatch Prometheus metric to 1 if the counts match, or 0 if they differ.
+// agencyReconciliation is the outcome of comparing, agency by agency, the GTFS static bundle of a
+// server with its `agencies-with-coverage` endpoint.
+type agencyReconciliation struct {
+	staticIDs   []string         // Agencies of the static bundle, in bundle order
+	coverageIDs []string         // Agencies of the endpoint, in response order
+	missing     map[string]bool  // Agencies of the static bundle the endpoint does not list
+	extra       map[string]bool  // Agencies the endpoint lists that are not in the static bundle
+	compared    []string         // Agencies listed by both, with a reference to compare attributes with
+	mismatches  []agencyMismatch // Attributes differing between both, for the compared agencies
+	inBounds    map[string]bool  // Whether the coverage area of each listed agency is within the bounding box
+}
+
+// matches reports whether both sources describe the same agencies: same IDs, names and timezones.
+func (r agencyReconciliation) matches() bool {
+	return len(r.missing) == 0 && len(r.extra) == 0 && len(r.mismatches) == 0
+}
+
+// reconcileAgencies compares the agencies of a GTFS static bundle with the data of an
+// `agencies-with-coverage` response, which may be nil.
+//
+// Agencies are matched by ID. For those listed by both, the name and timezone of the bundle are
+// compared with the agency references of the response; an agency without a reference is not compared.
+//
+// When bbox is not nil, the coverage area of each listed agency (a rectangle centered on its lat/lon,
+// of its lat/lon spans) must fit within the bounding box of the bundle, give or take
+// agencyCoverageMargin. A coverage area outside it means OBA places the agency elsewhere than the
+// bundle, typically because it was loaded from another bundle, or has no stops (an area at 0,0).
+func reconcileAgencies(staticAgencies []remoteGtfs.Agency, coverage *onebusaway.AgenciesWithCoverageListResponseData, bbox *geo.BoundingBox) agencyReconciliation {
+	r := agencyReconciliation{
+		missing:  make(map[string]bool),
+		extra:    make(map[string]bool),
+		inBounds: make(map[string]bool),
+	}
+
+	var listed []onebusaway.AgenciesWithCoverageListResponseDataList
+	references := make(map[string]shared.ReferencesAgency)
+	if coverage != nil {
+		listed = coverage.List
+		for _, reference := range coverage.References.Agencies {
+			references[reference.ID] = reference
+		}
+	}
+
+	staticByID := make(map[string]remoteGtfs.Agency, len(staticAgencies))
+	for _, agency := range staticAgencies {
+		staticByID[agency.Id] = agency
+		r.staticIDs = append(r.staticIDs, agency.Id)
+	}
+
+	listedIDs := make(map[string]bool, len(listed))
+	for _, agency := range listed {
+		listedIDs[agency.AgencyID] = true
+		r.coverageIDs = append(r.coverageIDs, agency.AgencyID)
+
+		staticAgency, ok := staticByID[agency.AgencyID]
+		if !ok {
+			r.extra[agency.AgencyID] = true
+		} else if reference, ok := references[agency.AgencyID]; ok {
+			r.compared = append(r.compared, agency.AgencyID)
+			if strings.TrimSpace(staticAgency.Name) != strings.TrimSpace(reference.Name) {
+				r.mismatches = append(r.mismatches, agencyMismatch{agency.AgencyID, "name", staticAgency.Name, reference.Name})
+			}
+			if staticAgency.Timezone != reference.Timezone {
+				r.mismatches = append(r.mismatches, agencyMismatch{agency.AgencyID, "timezone", staticAgency.Timezone, reference.Timezone})
+			}
+		}
+
+		if bbox != nil {
+			r.inBounds[agency.AgencyID] = agency.Lat-agency.LatSpan/2 >= bbox.MinLat-agencyCoverageMargin &&
+				agency.Lat+agency.LatSpan/2 <= bbox.MaxLat+agencyCoverageMargin &&
+				agency.Lon-agency.LonSpan/2 >= bbox.MinLon-agencyCoverageMargin &&
+				agency.Lon+agency.LonSpan/2 <= bbox.MaxLon+agencyCoverageMargin
+		}
+	}
+
+	for _, id := range r.staticIDs {
+		if !listedIDs[id] {
+			r.missing[id] = true
+		}
+	}
+	return r
+}
+
+// checkAgenciesWithCoverageMatch reconciles the agencies of the GTFS static bundle with the agencies
+// returned by the real-time `agencies-with-coverage` API for the given server (see reconcileAgencies).
+//
+// It sets the AgenciesMatch Prometheus metric to 1 only if both list the same agency IDs with the
+// same names and timezones, or 0 otherwise. The details are exported per agency:
+//   - AgencyMissingFromCoverage, for each agency of the static bundle (1 if the endpoint omits it);
+//   - AgencyExtraInCoverage, for each agency of the endpoint (1 if the static bundle lacks it);
+//   - AgencyAttributeMismatch, for the name and timezone of each agency both describe;
+//   - AgencyCoverageInBounds, for each agency of the endpoint, when the bundle has a bounding box.
 //
 // Returns an error if reading the static bundle or calling the API fails.
-func checkAgenciesWithCoverageMatch(staticStore *gtfs.StaticStore, logger *slog.Logger, server models.ObaServer) error {
-	staticGtfsAgenciesCount, err := checkAgenciesWithCoverage(staticStore, server)
-	if err != nil {
+func checkAgenciesWithCoverageMatch(ctx context.Context, staticStore *gtfs.StaticStore, boundingBoxStore *geo.BoundingBoxStore, logger *slog.Logger, server models.ObaServer) error {
+	if _, err := checkAgenciesWithCoverage(staticStore, server); err != nil {
 		return err
 	}
+	staticData, _ := staticStore.Get(server.ID)
 
-	coverageAgenciesCount, err := getAgenciesWithCoverage(server)
-
+	coverage, err := fetchAgenciesWithCoverage(ctx, server)
 	if err != nil {
 		return fmt.Errorf("error getting remote agencies with coverage data: %w", err)
 	}
 
+	var bbox *geo.BoundingBox
+	if boundingBoxStore != nil {
+		if box, ok := boundingBoxStore.Get(server.ID); ok {
+			bbox = &box
+		}
+	}
+
+	r := reconcileAgencies(staticData.Agencies, coverage, bbox)
+	serverID := strconv.Itoa(server.ID)
+
+	Series.Gauge(AgenciesInCoverageEndpoint, server.ID, serverID).Set(float64(len(r.coverageIDs)))
+
+	for _, id := range r.staticIDs {
+		Series.Gauge(AgencyMissingFromCoverage, server.ID, id, serverID).Set(boolToFloat(r.missing[id]))
+		if r.missing[id] {
+			logger.Warn("Agency of the static GTFS bundle missing from agencies-with-coverage", "server_id", server.ID, "agency_id", id)
+		}
+	}
+	for _, id := range r.coverageIDs {
+		Series.Gauge(AgencyExtraInCoverage, server.ID, id, serverID).Set(boolToFloat(r.extra[id]))
+		if r.extra[id] {
+			logger.Warn("Agency of agencies-with-coverage missing from the static GTFS bundle", "server_id", server.ID, "agency_id", id)
+		}
+		if inBounds, ok := r.inBounds[id]; ok {
+			Series.Gauge(AgencyCoverageInBounds, server.ID, id, serverID).Set(boolToFloat(inBounds))
+			if !inBounds {
+				logger.Warn("Agency coverage area outside the bounding box of the static GTFS bundle", "server_id", server.ID, "agency_id", id)
+			}
+		}
+	}
+
+	mismatched := make(map[[2]string]bool, len(r.mismatches))
+	for _, m := range r.mismatches {
+		mismatched[[2]string{m.agencyID, m.attribute}] = true
+		logger.Warn("Agency attribute differs between the static GTFS bundle and agencies-with-coverage",
+			"server_id", server.ID, "agency_id", m.agencyID, "attribute", m.attribute, "static", m.static, "coverage", m.coverage)
+	}
+	for _, id := range r.compared {
+		for _, attribute := range []string{"name", "timezone"} {
+			Series.Gauge(AgencyAttributeMismatch, server.ID, id, attribute, serverID).Set(boolToFloat(mismatched[[2]string{id, attribute}]))
+		}
+	}
+
 	matchValue := 0
-	if coverageAgenciesCount == staticGtfsAgenciesCount {
+	if r.matches() {
 		matchValue = 1
 	}
 
-	AgenciesMatch.WithLabelValues(strconv.Itoa(server.ID)).Set(float64(matchValue))
+	Series.Gauge(AgenciesMatch, server.ID, serverID).Set(float64(matchValue))
 
 	return nil
 }
+
+// boolToFloat returns 1 for true and 0 for false, the values of boolean gauges.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,12 +1,19 @@
 package metrics
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"testing"
 
 	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	onebusaway "github.com/OneBusAway/go-sdk"
+	"github.com/OneBusAway/go-sdk/shared"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/geo"
 	"watchdog.onebusaway.org/internal/gtfs"
 	"watchdog.onebusaway.org/internal/models"
 )
@@ -17,7 +24,7 @@ func TestCheckAgenciesWithCoverage(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
-		ts := setupObaServer(t, `{"code":200,"currentTime":1234567890000,"text":"OK","version":2,"data":{"list":[{"agencyId":"1"}]}}`, http.StatusOK)
+		ts := setupObaServer(t, `{"code":200,"currentTime":1234567890000,"text":"OK","version":2,"data":{"list":[{"agencyId":"40"}],"references":{"agencies":[{"id":"40","name":"Sound Transit","timezone":"America/Los_Angeles"}]}}}`, http.StatusOK)
 		defer ts.Close()
 
 		testServer := createTestServer(ts.URL, "Test Server", 999, "test-key", "http://example.com", "test-api-value", "test-api-key", "1")
@@ -31,7 +38,7 @@ func TestCheckAgenciesWithCoverage(t *testing.T) {
 		staticStore := gtfs.NewStaticStore()
 		staticStore.Set(testServer.ID, staticData)
 
-		err = checkAgenciesWithCoverageMatch(staticStore, logger, testServer)
+		err = checkAgenciesWithCoverageMatch(context.Background(), staticStore, nil, logger, testServer)
 		if err != nil {
 			t.Fatalf("CheckAgenciesWithCoverageMatch failed: %v", err)
 		}
@@ -45,66 +52,89 @@ func TestCheckAgenciesWithCoverage(t *testing.T) {
 			t.Errorf("Expected agency match metric to be 1, got %v", agencyMatchMetric)
 		}
 	})
-}
 
-// OBASdk tests
-func TestGetAgenciesWithCoverage(t *testing.T) {
-	t.Run("NilResponse", func(t *testing.T) {
-		ts := setupObaServer(t, `{}`, http.StatusOK)
+	t.Run("Swapped agency", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		// Same number of agencies, but not the same agency.
+		ts := setupObaServer(t, `{"code":200,"currentTime":1234567890000,"text":"OK","version":2,"data":{"list":[{"agencyId":"1"}]}}`, http.StatusOK)
 		defer ts.Close()
 
-		server := models.ObaServer{
-			Name:       "Test Server",
-			ID:         999,
-			ObaBaseURL: ts.URL,
-			ObaApiKey:  "test-key",
-		}
+		testServer := createTestServer(ts.URL, "Test Server", 992, "test-key", "http://example.com", "test-api-value", "test-api-key", "1")
+		defer Series.DeleteServer(testServer.ID)
 
-		count, err := getAgenciesWithCoverage(server)
-		if err != nil {
-			t.Fatalf("Expected no error, got %v", err)
-		}
+		staticStore := gtfs.NewStaticStore()
+		staticStore.Set(testServer.ID, &models.StaticData{Agencies: []remoteGtfs.Agency{{Id: "40"}}})
 
-		if count != 0 {
-			t.Fatalf("Expected count to be 0, got %d", count)
+		if err := checkAgenciesWithCoverageMatch(context.Background(), staticStore, nil, logger, testServer); err != nil {
+			t.Fatalf("CheckAgenciesWithCoverageMatch failed: %v", err)
 		}
-	})
 
-	t.Run("SuccessfulResponse", func(t *testing.T) {
-		ts := setupObaServer(t, `{"data": {"list": [{"agencyId": "1"}, {"agencyId": "2"}]}}`, http.StatusOK)
-		defer ts.Close()
-
-		server := models.ObaServer{
-			Name:       "Test Server",
-			ID:         999,
-			ObaBaseURL: ts.URL,
-			ObaApiKey:  "test-key",
+		if got := testutil.ToFloat64(AgenciesMatch.WithLabelValues("992")); got != 0 {
+			t.Errorf("Expected agency match metric to be 0, got %v", got)
 		}
-
-		count, err := getAgenciesWithCoverage(server)
-		if err != nil {
-			t.Fatalf("Expected no error, got %v", err)
+		if got := testutil.ToFloat64(AgencyMissingFromCoverage.WithLabelValues("40", "992")); got != 1 {
+			t.Errorf("Expected agency 40 to be reported missing, got %v", got)
 		}
-
-		if count != 2 {
-			t.Fatalf("Expected count to be 2, got %d", count)
+		if got := testutil.ToFloat64(AgencyExtraInCoverage.WithLabelValues("1", "992")); got != 1 {
+			t.Errorf("Expected agency 1 to be reported extra, got %v", got)
 		}
 	})
+}
 
-	t.Run("ErrorResponse", func(t *testing.T) {
-		ts := setupObaServer(t, `{"error": "Internal Server Error"}`, http.StatusInternalServerError)
-		defer ts.Close()
-
-		server := models.ObaServer{
-			Name:       "Test Server",
-			ID:         999,
-			ObaBaseURL: ts.URL,
-			ObaApiKey:  "test-key",
+func TestReconcileAgencies(t *testing.T) {
+	staticAgencies := []remoteGtfs.Agency{
+		{Id: "metro", Name: "Metro Transit", Timezone: "America/Los_Angeles"},
+		{Id: "tram", Name: "City Tram", Timezone: "America/Los_Angeles"},
+		{Id: "ferry", Name: "Ferries", Timezone: "America/Los_Angeles"},
+	}
+	coverage := &onebusaway.AgenciesWithCoverageListResponseData{
+		List: []onebusaway.AgenciesWithCoverageListResponseDataList{
+			{AgencyID: "metro", Lat: 47.6, LatSpan: 0.2, Lon: -122.3, LonSpan: 0.2},
+			{AgencyID: "tram", Lat: 47.6, LatSpan: 0.1, Lon: -122.3, LonSpan: 0.1},
+			{AgencyID: "bus"}, // no stops: coverage area at 0,0
+		},
+		References: shared.References{Agencies: []shared.ReferencesAgency{
+			{ID: "metro", Name: "Metro Transit", Timezone: "America/Los_Angeles"},
+			{ID: "tram", Name: "Tramways", Timezone: "America/New_York"},
+		}},
+	}
+	bbox := &geo.BoundingBox{MinLat: 47.5, MaxLat: 47.7, MinLon: -122.4, MaxLon: -122.2}
+
+	r := reconcileAgencies(staticAgencies, coverage, bbox)
+
+	if r.matches() {
+		t.Error("expected the agencies not to match")
+	}
+	if len(r.missing) != 1 || !r.missing["ferry"] {
+		t.Errorf("expected ferry to be missing, got %v", r.missing)
+	}
+	if len(r.extra) != 1 || !r.extra["bus"] {
+		t.Errorf("expected bus to be extra, got %v", r.extra)
+	}
+	if !slices.Equal(r.compared, []string{"metro", "tram"}) {
+		t.Errorf("expected metro and tram to be compared, got %v", r.compared)
+	}
+	if len(r.mismatches) != 2 || r.mismatches[0].attribute != "name" || r.mismatches[1].attribute != "timezone" {
+		t.Errorf("expected the name and timezone of tram to differ, got %+v", r.mismatches)
+	}
+	if !r.inBounds["metro"] || !r.inBounds["tram"] || r.inBounds["bus"] {
+		t.Errorf("expected only bus to be out of bounds, got %v", r.inBounds)
+	}
+
+	t.Run("Without bounding box", func(t *testing.T) {
+		r := reconcileAgencies(staticAgencies[:2], coverage, nil)
+		if len(r.inBounds) != 0 {
+			t.Errorf("expected no coverage area check without a bounding box, got %v", r.inBounds)
 		}
+	})
 
-		_, err := getAgenciesWithCoverage(server)
-		if err == nil {
-			t.Fatal("Expected an error but got nil")
+	t.Run("Same agencies", func(t *testing.T) {
+		r := reconcileAgencies(staticAgencies[:1], &onebusaway.AgenciesWithCoverageListResponseData{
+			List: coverage.List[:1],
+		}, bbox)
+		if !r.matches() {
+			t.Errorf("expected the agencies to match, got %+v", r)
 		}
 	})
 }
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"strconv"
+
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// reportBundleDiff exports the most recent diff between two consecutive GTFS static bundles of
+// a server, as recorded in the changelog when the bundle was replaced (see gtfs.diffStaticData):
+//   - BundleDiffStops: stops added, removed and moved.
+//   - BundleDiffAgencies: agencies added and removed.
+//   - BundleDiffRouteCountChange: the route count of the new bundle minus the previous one.
+//   - BundleDiffServiceShift: the shift in days of the service start and end dates.
+//   - BundleDiffThresholdsExceeded: the number of change thresholds crossed.
+//   - BundleDiffTimestamp: when the diff was computed.
+//
+// The full history is served by the bundle changelog endpoint. Servers whose bundle was never
+// replaced export nothing.
+func reportBundleDiff(changelog *gtfs.BundleChangelog, server models.ObaServer) {
+	diff, ok := changelog.Latest(server.ID)
+	if !ok {
+		return
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	Series.Gauge(BundleDiffStops, server.ID, serverID, "added").Set(float64(diff.Stops.Added))
+	Series.Gauge(BundleDiffStops, server.ID, serverID, "removed").Set(float64(diff.Stops.Removed))
+	Series.Gauge(BundleDiffStops, server.ID, serverID, "moved").Set(float64(diff.Stops.Moved))
+	Series.Gauge(BundleDiffAgencies, server.ID, serverID, "added").Set(float64(len(diff.AgenciesAdded)))
+	Series.Gauge(BundleDiffAgencies, server.ID, serverID, "removed").Set(float64(len(diff.AgenciesRemoved)))
+	Series.Gauge(BundleDiffRouteCountChange, server.ID, serverID).Set(float64(diff.RoutesAfter - diff.RoutesBefore))
+	Series.Gauge(BundleDiffServiceShift, server.ID, serverID, "start").Set(float64(diff.ServiceStartShiftDays))
+	Series.Gauge(BundleDiffServiceShift, server.ID, serverID, "end").Set(float64(diff.ServiceEndShiftDays))
+	Series.Gauge(BundleDiffThresholdsExceeded, server.ID, serverID).Set(float64(len(diff.ThresholdsExceeded)))
+	Series.Gauge(BundleDiffTimestamp, server.ID, serverID).Set(float64(diff.ComparedAt.Unix()))
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestReportBundleDiff(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 994, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	changelog := gtfs.NewBundleChangelog(0, gtfs.NewDiffThresholds(0, 0, 0))
+	defer Series.DeleteServer(server.ID)
+
+	// Servers whose bundle was never replaced export nothing.
+	reportBundleDiff(changelog, server)
+	if got := testutil.CollectAndCount(BundleDiffTimestamp, "gtfs_bundle_diff_timestamp_seconds"); got != 0 {
+		t.Fatalf("expected no diff series, got %d", got)
+	}
+
+	comparedAt := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	changelog.Record(server.ID, models.BundleDiff{
+		ComparedAt:            comparedAt,
+		Stops:                 models.StopsDiff{Added: 4, Removed: 12, Moved: 2},
+		AgenciesAdded:         []string{},
+		AgenciesRemoved:       []string{"A2"},
+		RoutesBefore:          10,
+		RoutesAfter:           8,
+		ServiceStartShiftDays: 30,
+		ServiceEndShiftDays:   -7,
+		ThresholdsExceeded:    []string{gtfs.ThresholdStopsRemoved, gtfs.ThresholdAgenciesRemoved},
+	})
+	reportBundleDiff(changelog, server)
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"stops added", testutil.ToFloat64(BundleDiffStops.WithLabelValues("994", "added")), 4},
+		{"stops removed", testutil.ToFloat64(BundleDiffStops.WithLabelValues("994", "removed")), 12},
+		{"stops moved", testutil.ToFloat64(BundleDiffStops.WithLabelValues("994", "moved")), 2},
+		{"agencies added", testutil.ToFloat64(BundleDiffAgencies.WithLabelValues("994", "added")), 0},
+		{"agencies removed", testutil.ToFloat64(BundleDiffAgencies.WithLabelValues("994", "removed")), 1},
+		{"route count change", testutil.ToFloat64(BundleDiffRouteCountChange.WithLabelValues("994")), -2},
+		{"service start shift", testutil.ToFloat64(BundleDiffServiceShift.WithLabelValues("994", "start")), 30},
+		{"service end shift", testutil.ToFloat64(BundleDiffServiceShift.WithLabelValues("994", "end")), -7},
+		{"thresholds exceeded", testutil.ToFloat64(BundleDiffThresholdsExceeded.WithLabelValues("994")), 2},
+		{"timestamp", testutil.ToFloat64(BundleDiffTimestamp.WithLabelValues("994")), float64(comparedAt.Unix())},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	onebusaway "github.com/OneBusAway/go-sdk"
+	"github.com/OneBusAway/go-sdk/option"
+	"watchdog.onebusaway.org/internal/geo"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// DefaultBundleDriftSampleSize is the number of stops, and of routes, looked up on each run of
+// the bundle drift check when no positive sample size is configured.
+const DefaultBundleDriftSampleSize = 10
+
+// bundleDriftMaxDistance is how far (in meters) OBA may place a stop from its position in the
+// GTFS static bundle before the stop is counted as moved.
+const bundleDriftMaxDistance = 50.0
+
+// Reasons a sampled entity is counted as drifted, as exported in the `reason` label of BundleDriftEntities.
+const (
+	driftMissing = "missing" // OBA does not know the entity
+	driftMoved   = "moved"   // OBA places the stop more than bundleDriftMaxDistance away
+	driftRenamed = "renamed" // OBA names the entity differently
+)
+
+// checkBundleDrift detects whether the OBA server serves the GTFS static bundle the watchdog
+// downloaded from its `gtfs_url`, or an older (or otherwise different) one.
+//
+// A new GTFS is routinely published without the OBA bundle builder ever running, and nothing else
+// notices: the server keeps answering from its old bundle. This check samples up to sampleSize stops
+// and sampleSize routes of the watchdog's static bundle, looks each of them up through the OBA REST
+// API (`stop` and `route` endpoints), and counts those that drifted:
+//   - stops that OBA does not know, places more than bundleDriftMaxDistance meters away, or names differently;
+//   - routes that OBA does not know, or whose short or long name differs.
+//
+// OBA identifies entities as `<agency_id>_<id>`. Routes are prefixed with the agency of the route;
+// stops, which have no agency in GTFS, with the first agency of the server (see stopAgencyID).
+//
+// It exports:
+//   - BundleDriftRatio: the fraction of sampled entities that drifted (0 when nothing could be sampled).
+//   - BundleDriftSampled: the number of entities looked up successfully, by entity type.
+//   - BundleDriftEntities: the number of drifted entities, by entity type and reason.
+//
+// Lookups failing for another reason than an unknown entity (network errors, 5xx responses) are
+// left out of the ratio. The bundle metadata exposed by the server's `config` endpoint is reported
+// too (see reportObaBundleConfig).
+//
+// A non-positive sampleSize uses DefaultBundleDriftSampleSize.
+//
+// Returns the drift ratio, or an error if no static data is stored for the server, or if the
+// bundle has entities to sample but every lookup failed.
+func checkBundleDrift(ctx context.Context, staticStore *gtfs.StaticStore, logger *slog.Logger, server models.ObaServer, sampleSize int) (float64, error) {
+	if sampleSize <= 0 {
+		sampleSize = DefaultBundleDriftSampleSize
+	}
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return 0, fmt.Errorf("there is no bundle for server %v", server.ID)
+	}
+
+	client := onebusaway.NewClient(
+		option.WithAPIKey(server.ObaApiKey),
+		option.WithBaseURL(server.ObaBaseURL),
+	)
+
+	reportObaBundleConfig(ctx, client, logger, server)
+
+	stopAgency := stopAgencyID(server, staticData)
+
+	counts := map[string]map[string]int{
+		"stop":  {driftMissing: 0, driftMoved: 0, driftRenamed: 0},
+		"route": {driftMissing: 0, driftRenamed: 0},
+	}
+	sampled := map[string]int{"stop": 0, "route": 0}
+	var lookupErrs []error
+
+	for _, stop := range sampleStops(staticData.Stops, sampleSize) {
+		reason, err := stopDrift(ctx, client, obaEntityID(stopAgency, stop.Id), stop)
+		if err != nil {
+			lookupErrs = append(lookupErrs, err)
+			continue
+		}
+		sampled["stop"]++
+		if reason != "" {
+			counts["stop"][reason]++
+			logger.Debug("GTFS stop drifted on the OBA server", "server_id", server.ID, "stop_id", stop.Id, "reason", reason)
+		}
+	}
+
+	for _, route := range sampleRoutes(staticData.Routes, sampleSize) {
+		agencyID := stopAgency
+		if route.Agency != nil && route.Agency.Id != "" {
+			agencyID = route.Agency.Id
+		}
+		reason, err := routeDrift(ctx, client, obaEntityID(agencyID, route.Id), route)
+		if err != nil {
+			lookupErrs = append(lookupErrs, err)
+			continue
+		}
+		sampled["route"]++
+		if reason != "" {
+			counts["route"][reason]++
+			logger.Debug("GTFS route drifted on the OBA server", "server_id", server.ID, "route_id", route.Id, "reason", reason)
+		}
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	total, drifted := 0, 0
+	for entity, reasons := range counts {
+		Series.Gauge(BundleDriftSampled, server.ID, serverID, entity).Set(float64(sampled[entity]))
+		total += sampled[entity]
+		for reason, count := range reasons {
+			Series.Gauge(BundleDriftEntities, server.ID, serverID, entity, reason).Set(float64(count))
+			drifted += count
+		}
+	}
+
+	if total == 0 && len(lookupErrs) > 0 {
+		return 0, fmt.Errorf("failed to look up any sampled GTFS entity on server %d: %w", server.ID, errors.Join(lookupErrs...))
+	}
+
+	ratio := 0.0
+	if total > 0 {
+		ratio = float64(drifted) / float64(total)
+	}
+	Series.Gauge(BundleDriftRatio, server.ID, serverID).Set(ratio)
+
+	if len(lookupErrs) > 0 {
+		logger.Warn("Some GTFS entities could not be looked up on the OBA server", "server_id", server.ID, "failed", len(lookupErrs), "error", lookupErrs[0])
+	}
+	return ratio, nil
+}
+
+// stopDrift looks up a stop of the static bundle on the OBA server and returns why it drifted,
+// or an empty string if OBA serves it as the bundle describes it.
+func stopDrift(ctx context.Context, client *onebusaway.Client, obaID string, stop remoteGtfs.Stop) (string, error) {
+	response, err := client.Stop.Get(ctx, obaID)
+	if isNotFound(err) || (err == nil && (response == nil || response.Code == http.StatusNotFound)) {
+		return driftMissing, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up stop %s: %w", obaID, err)
+	}
+
+	entry := response.Data.Entry
+	if geo.HaversineDistance(*stop.Latitude, *stop.Longitude, entry.Lat, entry.Lon) > bundleDriftMaxDistance {
+		return driftMoved, nil
+	}
+	if strings.TrimSpace(stop.Name) != strings.TrimSpace(entry.Name) {
+		return driftRenamed, nil
+	}
+	return "", nil
+}
+
+// routeDrift looks up a route of the static bundle on the OBA server and returns why it drifted,
+// or an empty string if OBA serves it as the bundle describes it.
+func routeDrift(ctx context.Context, client *onebusaway.Client, obaID string, route remoteGtfs.Route) (string, error) {
+	response, err := client.Route.Get(ctx, obaID)
+	if isNotFound(err) || (err == nil && (response == nil || response.Code == http.StatusNotFound)) {
+		return driftMissing, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up route %s: %w", obaID, err)
+	}
+
+	entry := response.Data.Entry
+	if strings.TrimSpace(route.ShortName) != strings.TrimSpace(entry.ShortName) ||
+		strings.TrimSpace(route.LongName) != strings.TrimSpace(entry.LongName) {
+		return driftRenamed, nil
+	}
+	return "", nil
+}
+
+// reportObaBundleConfig reports the bundle metadata exposed by the `config` endpoint of the OBA
+// server: the ID and name of the bundle it loaded (ObaBundleConfigInfo) and the service dates it
+// covers (ObaBundleServiceDateFrom and ObaBundleServiceDateTo).
+//
+// Older servers do not expose this endpoint, so a failure is only logged.
+func reportObaBundleConfig(ctx context.Context, client *onebusaway.Client, logger *slog.Logger, server models.ObaServer) {
+	response, err := client.Config.Get(ctx)
+	if err != nil || response == nil {
+		logger.Debug("OBA server exposes no bundle configuration", "server_id", server.ID, "error", err)
+		return
+	}
+
+	entry := response.Data.Entry
+	serverID := strconv.Itoa(server.ID)
+	Series.ExclusiveGauge(ObaBundleConfigInfo, server.ID, serverID, entry.ID, entry.Name).Set(1)
+
+	// Service dates are Unix timestamps in milliseconds.
+	if from, err := strconv.ParseInt(entry.ServiceDateFrom, 10, 64); err == nil {
+		Series.Gauge(ObaBundleServiceDateFrom, server.ID, serverID).Set(float64(from / 1000))
+	}
+	if to, err := strconv.ParseInt(entry.ServiceDateTo, 10, 64); err == nil {
+		Series.Gauge(ObaBundleServiceDateTo, server.ID, serverID).Set(float64(to / 1000))
+	}
+}
+
+// isNotFound reports whether err is an OBA API error for an unknown entity.
+func isNotFound(err error) bool {
+	var apiErr *onebusaway.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// obaEntityID returns the OBA ID of a GTFS entity of the given agency.
+func obaEntityID(agencyID, id string) string {
+	if agencyID == "" {
+		return id
+	}
+	return agencyID + "_" + id
+}
+
+// sampleStops returns up to n random boardable stops (see boardableStops).
+func sampleStops(stops []remoteGtfs.Stop, n int) []remoteGtfs.Stop {
+	return sample(boardableStops(stops), n)
+}
+
+// boardableStops returns the stops that riders board at (stops and platforms, with coordinates).
+// Stations, entrances and other nodes are left out: OBA does not always serve them as stops.
+func boardableStops(stops []remoteGtfs.Stop) []remoteGtfs.Stop {
+	var boardable []remoteGtfs.Stop
+	for _, stop := range stops {
+		if (stop.Type == remoteGtfs.StopType_Stop || stop.Type == remoteGtfs.StopType_Platform) &&
+			stop.Latitude != nil && stop.Longitude != nil {
+			boardable = append(boardable, stop)
+		}
+	}
+	return boardable
+}
+
+// sampleRoutes returns up to n random routes.
+func sampleRoutes(routes []remoteGtfs.Route, n int) []remoteGtfs.Route {
+	return sample(routes, n)
+}
+
+// sample returns up to n random elements of items, without repetition.
+func sample[T any](items []T, n int) []T {
+	if n >= len(items) {
+		return items
+	}
+	picked := make([]T, 0, n)
+	for _, i := range rand.Perm(len(items))[:n] {
+		picked = append(picked, items[i])
+	}
+	return picked
+}
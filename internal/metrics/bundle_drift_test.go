@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestCheckBundleDrift(t *testing.T) {
+	responses := map[string]string{
+		"/api/where/config.json":                 `{"code":200,"data":{"entry":{"id":"bundle-1","name":"2025-01","serviceDateFrom":"1735689600000","serviceDateTo":"1743465600000"}}}`,
+		"/api/where/stop/40_stop-ok.json":        `{"code":200,"data":{"entry":{"id":"40_stop-ok","lat":47.6,"lon":-122.3,"name":"Main St"}}}`,
+		"/api/where/stop/40_stop-moved.json":     `{"code":200,"data":{"entry":{"id":"40_stop-moved","lat":47.61,"lon":-122.3,"name":"Pine St"}}}`,
+		"/api/where/route/metro_route-ok.json":   `{"code":200,"data":{"entry":{"id":"metro_route-ok","shortName":"1","longName":"Downtown"}}}`,
+		"/api/where/route/40_route-renamed.json": `{"code":200,"data":{"entry":{"id":"40_route-renamed","shortName":"2","longName":"Old Name"}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			response = `{"code":404,"text":"resource not found"}`
+		}
+		// #nosec G104
+		w.Write([]byte(response))
+	}))
+	defer ts.Close()
+
+	server := createTestServer(ts.URL, "Test Server", 991, "test-key", "http://example.com", "", "", "40")
+	defer Series.DeleteServer(server.ID)
+
+	lat, lon := 47.6, -122.3
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(server.ID, &models.StaticData{
+		Stops: []remoteGtfs.Stop{
+			{Id: "stop-ok", Name: "Main St", Latitude: &lat, Longitude: &lon},
+			{Id: "stop-moved", Name: "Pine St", Latitude: &lat, Longitude: &lon},
+			{Id: "stop-missing", Name: "New St", Latitude: &lat, Longitude: &lon},
+			{Id: "station", Name: "Station", Type: remoteGtfs.StopType_Station, Latitude: &lat, Longitude: &lon},
+		},
+		Routes: []remoteGtfs.Route{
+			{Id: "route-ok", Agency: &remoteGtfs.Agency{Id: "metro"}, ShortName: "1", LongName: "Downtown"},
+			{Id: "route-renamed", ShortName: "2", LongName: "New Name"},
+		},
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ratio, err := checkBundleDrift(context.Background(), staticStore, logger, server, 10)
+	if err != nil {
+		t.Fatalf("checkBundleDrift failed: %v", err)
+	}
+
+	// 3 of the 5 sampled entities drifted; the station is not sampled.
+	if ratio != 0.6 {
+		t.Errorf("expected a drift ratio of 0.6, got %v", ratio)
+	}
+	if got := testutil.ToFloat64(BundleDriftSampled.WithLabelValues("991", "stop")); got != 3 {
+		t.Errorf("expected 3 sampled stops, got %v", got)
+	}
+	for _, tc := range []struct {
+		entity, reason string
+		expected       float64
+	}{
+		{"stop", driftMissing, 1},
+		{"stop", driftMoved, 1},
+		{"stop", driftRenamed, 0},
+		{"route", driftMissing, 0},
+		{"route", driftRenamed, 1},
+	} {
+		if got := testutil.ToFloat64(BundleDriftEntities.WithLabelValues("991", tc.entity, tc.reason)); got != tc.expected {
+			t.Errorf("expected %v %s drifted as %s, got %v", tc.expected, tc.entity, tc.reason, got)
+		}
+	}
+
+	if got := testutil.ToFloat64(ObaBundleConfigInfo.WithLabelValues("991", "bundle-1", "2025-01")); got != 1 {
+		t.Errorf("expected the bundle of the config endpoint to be reported, got %v", got)
+	}
+	if got := testutil.ToFloat64(ObaBundleServiceDateFrom.WithLabelValues("991")); got != 1735689600 {
+		t.Errorf("expected the service start date in seconds, got %v", got)
+	}
+
+	t.Run("No bundle", func(t *testing.T) {
+		if _, err := checkBundleDrift(context.Background(), gtfs.NewStaticStore(), logger, server, 10); err == nil {
+			t.Error("expected an error without a static bundle")
+		}
+	})
+}
+
+func TestSample(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	if got := sample(items, 10); len(got) != 5 {
+		t.Errorf("expected every item when the sample is larger, got %v", got)
+	}
+	got := sample(items, 3)
+	seen := make(map[int]bool)
+	for _, item := range got {
+		seen[item] = true
+	}
+	if len(got) != 3 || len(seen) != 3 {
+		t.Errorf("expected 3 distinct items, got %v", got)
+	}
+}
@@ -13,11 +13,13 @@ import (
 )
 
 // checkBundleExpiration calculates the number of days remaining until the earliest and latest
-// service end dates in the GTFS static bundle associated with a given server.
+// expiration dates of the GTFS static bundle associated with a given server.
 //
 // It retrieves the static GTFS data from the provided StaticStore using the server ID,
-// and then computes the number of days remaining until both the earliest and latest service
-// end dates based on the provided current time.
+// and then computes the number of days remaining until both dates based on the provided current time.
+// The dates come from the most authoritative source available (see gtfs.GetBundleValidity):
+// feed_end_date of feed_info.txt, otherwise the service end dates of calendar.txt and calendar_dates.txt.
+// The source used is exported as the label of BundleExpirationSource.
 //
 // Parameters:
 //   - staticStore: a pointer to StaticStore that holds GTFS data for multiple servers.
@@ -27,8 +29,9 @@ import (
 // Returns:
 //   - int: days until the earliest service end date.
 //   - int: days until the latest service end date.
+//   - string: the source the dates were derived from (one of the gtfs.ValiditySource constants).
 //   - error: any error encountered during processing.
-func checkBundleExpiration(staticStore *gtfs.StaticStore, currentTime time.Time, server models.ObaServer) (int, int, error) {
+func checkBundleExpiration(staticStore *gtfs.StaticStore, currentTime time.Time, server models.ObaServer) (int, int, string, error) {
 	currentTime = currentTime.UTC()
 	staticData, ok := staticStore.Get(server.ID)
 	if !ok {
@@ -37,7 +40,7 @@ func checkBundleExpiration(staticStore *gtfs.StaticStore, currentTime time.Time,
 			Tags:  utils.MakeMap("server_id", strconv.Itoa(server.ID)),
 			Level: sentry.LevelWarning,
 		})
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 	if staticData == nil {
 		err := fmt.Errorf("static data is nil for server %v", server.ID)
@@ -45,23 +48,24 @@ func checkBundleExpiration(staticStore *gtfs.StaticStore, currentTime time.Time,
 			Tags:  utils.MakeMap("server_id", strconv.Itoa(server.ID)),
 			Level: sentry.LevelWarning,
 		})
-		return 0, 0, err
+		return 0, 0, "", err
 	}
-	earliestEndDate, latestEndDate, err := gtfs.GetEarliestAndLatestServiceDates(staticData)
-
+	validity, err := gtfs.GetBundleValidity(staticData)
 	if err != nil {
 		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
 			Tags:  utils.MakeMap("server_id", strconv.Itoa(server.ID)),
 			Level: sentry.LevelWarning,
 		})
-		return 0, 0, err
+		return 0, 0, "", err
 	}
 
-	daysUntilEarliestExpiration := int(earliestEndDate.Sub(currentTime).Hours() / 24)
-	daysUntilLatestExpiration := int(latestEndDate.Sub(currentTime).Hours() / 24)
+	daysUntilEarliestExpiration := int(validity.Earliest.Sub(currentTime).Hours() / 24)
+	daysUntilLatestExpiration := int(validity.Latest.Sub(currentTime).Hours() / 24)
+
+	Series.Gauge(BundleEarliestExpirationGauge, server.ID, strconv.Itoa(server.ID)).Set(float64(daysUntilEarliestExpiration))
+	Series.Gauge(BundleLatestExpirationGauge, server.ID, strconv.Itoa(server.ID)).Set(float64(daysUntilLatestExpiration))
 
-	BundleEarliestExpirationGauge.WithLabelValues(strconv.Itoa(server.ID)).Set(float64(daysUntilEarliestExpiration))
-	BundleLatestExpirationGauge.WithLabelValues(strconv.Itoa(server.ID)).Set(float64(daysUntilLatestExpiration))
+	Series.ExclusiveGauge(BundleExpirationSource, server.ID, strconv.Itoa(server.ID), validity.Source).Set(1)
 
-	return daysUntilEarliestExpiration, daysUntilLatestExpiration, nil
+	return daysUntilEarliestExpiration, daysUntilLatestExpiration, validity.Source, nil
 }
@@ -22,7 +22,7 @@ func TestCheckBundleExpiration(t *testing.T) {
 	staticStore.Set(testServer.ID, staticData)
 	fixedTime := time.Date(2025, 1, 12, 20, 16, 38, 0, time.UTC)
 
-	earliest, latest, err := checkBundleExpiration(staticStore, fixedTime, testServer)
+	earliest, latest, source, err := checkBundleExpiration(staticStore, fixedTime, testServer)
 	if err != nil {
 		t.Fatalf("CheckBundleExpiration failed: %v", err)
 	}
@@ -31,6 +31,9 @@ func TestCheckBundleExpiration(t *testing.T) {
 	expectedEarliest := int(time.Date(2024, 11, 22, 0, 0, 0, 0, time.UTC).Sub(fixedTime).Hours() / 24)
 	expectedLatest := int(time.Date(2025, 3, 28, 0, 0, 0, 0, time.UTC).Sub(fixedTime).Hours() / 24)
 
+	if source != gtfs.ValiditySourceCalendar {
+		t.Errorf("Expected expiration source to be %q, got %q", gtfs.ValiditySourceCalendar, source)
+	}
 	if earliest != expectedEarliest {
 		t.Errorf("Expected earliest expiration days to be %d, got %d", expectedEarliest, earliest)
 	}
@@ -54,3 +57,34 @@ func TestCheckBundleExpiration(t *testing.T) {
 		t.Errorf("Expected latest expiration metric to be %v, got %v", expectedLatest, latestMetric)
 	}
 }
+
+func TestCheckBundleExpirationUsesFeedInfo(t *testing.T) {
+	testServer := createTestServer("www.example.com", "Test Server", 997, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	defer Series.DeleteServer(testServer.ID)
+
+	fixedTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(testServer.ID, &models.StaticData{
+		FeedInfo: &models.FeedInfo{Version: "v1", EndDate: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+		Services: []remoteGtfs.Service{{Id: "weekday", EndDate: time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)}},
+	})
+
+	earliest, latest, source, err := checkBundleExpiration(staticStore, fixedTime, testServer)
+	if err != nil {
+		t.Fatalf("CheckBundleExpiration failed: %v", err)
+	}
+	if source != gtfs.ValiditySourceFeedInfo {
+		t.Errorf("Expected expiration source to be %q, got %q", gtfs.ValiditySourceFeedInfo, source)
+	}
+	if earliest != 30 || latest != 30 {
+		t.Errorf("Expected 30 days until expiration, got %d (earliest) and %d (latest)", earliest, latest)
+	}
+
+	sourceMetric, err := getMetricValue(BundleExpirationSource, map[string]string{"server_id": "997", "source": gtfs.ValiditySourceFeedInfo})
+	if err != nil {
+		t.Errorf("Failed to get expiration source metric value: %v", err)
+	}
+	if sourceMetric != 1 {
+		t.Errorf("Expected expiration source metric to be 1, got %v", sourceMetric)
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// reportBundleInfo exports the description of the GTFS static bundle currently stored for a server:
+// its SHA-256 hash (as the label of BundleInfo), its size, its Last-Modified time and the last time
+// its content was seen changing.
+//
+// Bundles are only swapped in the StaticStore when their content changed (see gtfs.downloadGTFSBundles),
+// so BundleLastChanged tells how long a feed has gone without a new bundle, while BundleLastModified
+// tells what the feed host claims.
+//
+// BundleCacheAge tells how old a bundle loaded from the on-disk cache at startup is (see gtfs.BundleCache),
+// as long as no download confirmed or replaced it; it is 0 for a bundle downloaded by this process.
+//
+// The publisher and version of feed_info.txt are exported as the labels of BundleFeedInfo,
+// when the bundle has a feed_info.txt.
+//
+// Bundles that were not produced by a download (and thus carry no hash) export nothing else.
+// BundleLastModified is only exported when the feed host sent a valid Last-Modified header.
+//
+// Returns an error if no static data is stored for the server.
+func reportBundleInfo(staticStore *gtfs.StaticStore, server models.ObaServer) error {
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return fmt.Errorf("there is no bundle for server %v", server.ID)
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	if feedInfo := staticData.FeedInfo; feedInfo != nil {
+		Series.ExclusiveGauge(BundleFeedInfo, server.ID, serverID, feedInfo.PublisherName, feedInfo.Version).Set(1)
+	}
+
+	bundle := staticData.Bundle
+	if bundle.SHA256 == "" {
+		return nil
+	}
+
+	Series.ExclusiveGauge(BundleInfo, server.ID, serverID, bundle.SHA256).Set(1)
+	Series.Gauge(BundleSizeBytes, server.ID, serverID).Set(float64(bundle.Size))
+	Series.Gauge(BundleLastChanged, server.ID, serverID).Set(float64(bundle.LastChangedAt.Unix()))
+	cacheAge := 0.0
+	if !bundle.CachedAt.IsZero() {
+		cacheAge = time.Since(bundle.CachedAt).Seconds()
+	}
+	Series.Gauge(BundleCacheAge, server.ID, serverID).Set(cacheAge)
+	if !bundle.LastModifiedAt.IsZero() {
+		Series.Gauge(BundleLastModified, server.ID, serverID).Set(float64(bundle.LastModifiedAt.Unix()))
+	}
+	return nil
+}
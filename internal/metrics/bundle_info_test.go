@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestReportBundleInfo(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 998, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	staticStore := gtfs.NewStaticStore()
+	defer Series.DeleteServer(server.ID)
+
+	if err := reportBundleInfo(staticStore, server); err == nil {
+		t.Fatal("expected an error when no bundle is stored")
+	}
+
+	changedAt := time.Date(2025, 1, 12, 0, 0, 0, 0, time.UTC)
+	modifiedAt := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	staticStore.Set(server.ID, &models.StaticData{FeedInfo: &models.FeedInfo{PublisherName: "Agency", Version: "v1"}, Bundle: models.BundleInfo{
+		SHA256:         "aaa",
+		Size:           1024,
+		LastModifiedAt: modifiedAt,
+		LastChangedAt:  changedAt,
+	}})
+	if err := reportBundleInfo(staticStore, server); err != nil {
+		t.Fatalf("reportBundleInfo failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(BundleSizeBytes.WithLabelValues("998")); got != 1024 {
+		t.Errorf("expected size 1024, got %v", got)
+	}
+	if got := testutil.ToFloat64(BundleLastChanged.WithLabelValues("998")); got != float64(changedAt.Unix()) {
+		t.Errorf("expected last changed %d, got %v", changedAt.Unix(), got)
+	}
+	if got := testutil.ToFloat64(BundleLastModified.WithLabelValues("998")); got != float64(modifiedAt.Unix()) {
+		t.Errorf("expected last modified %d, got %v", modifiedAt.Unix(), got)
+	}
+	if got := testutil.ToFloat64(BundleInfo.WithLabelValues("998", "aaa")); got != 1 {
+		t.Errorf("expected bundle info for hash aaa to be 1, got %v", got)
+	}
+	if got := testutil.ToFloat64(BundleFeedInfo.WithLabelValues("998", "Agency", "v1")); got != 1 {
+		t.Errorf("expected feed info for version v1 to be 1, got %v", got)
+	}
+
+	// A new bundle replaces the info series of the previous hash.
+	staticStore.Set(server.ID, &models.StaticData{FeedInfo: &models.FeedInfo{PublisherName: "Agency", Version: "v2"}, Bundle: models.BundleInfo{SHA256: "bbb", LastChangedAt: changedAt}})
+	if err := reportBundleInfo(staticStore, server); err != nil {
+		t.Fatalf("reportBundleInfo failed: %v", err)
+	}
+	if BundleInfo.DeleteLabelValues("998", "aaa") {
+		t.Error("expected the info series of the previous hash to be deleted")
+	}
+	if got := testutil.ToFloat64(BundleInfo.WithLabelValues("998", "bbb")); got != 1 {
+		t.Errorf("expected bundle info for hash bbb to be 1, got %v", got)
+	}
+	if BundleFeedInfo.DeleteLabelValues("998", "Agency", "v1") {
+		t.Error("expected the feed info series of the previous version to be deleted")
+	}
+	if got := testutil.ToFloat64(BundleCacheAge.WithLabelValues("998")); got != 0 {
+		t.Errorf("expected a cache age of 0 for a downloaded bundle, got %v", got)
+	}
+
+	// A bundle loaded from the on-disk cache reports how long ago it was downloaded.
+	staticStore.Set(server.ID, &models.StaticData{Bundle: models.BundleInfo{SHA256: "bbb", LastChangedAt: changedAt, CachedAt: time.Now().Add(-2 * time.Hour)}})
+	if err := reportBundleInfo(staticStore, server); err != nil {
+		t.Fatalf("reportBundleInfo failed: %v", err)
+	}
+	if got := testutil.ToFloat64(BundleCacheAge.WithLabelValues("998")); got < 7200 || got > 7260 {
+		t.Errorf("expected a cache age of about 7200 seconds, got %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// reportBundleIntegrity exports the referential-integrity errors of the GTFS static bundle
+// currently stored for a server, as BundleIntegrityErrors labeled by rule.
+//
+// Bundles are validated once, when they are downloaded (see gtfs.validateBundle); this only
+// exports the stored report, and every rule of gtfs.ValidationRules is exported, including the
+// ones without errors, so that alerts can tell a clean bundle from a missing series.
+// Bundles that were not produced by a download (and thus carry no report) export nothing.
+//
+// Returns the total number of errors, or an error if no static data is stored for the server.
+func reportBundleIntegrity(staticStore *gtfs.StaticStore, server models.ObaServer) (int, error) {
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return 0, fmt.Errorf("there is no bundle for server %v", server.ID)
+	}
+	validation := staticData.Validation
+	if validation == nil {
+		return 0, nil
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	for _, rule := range gtfs.ValidationRules {
+		Series.Gauge(BundleIntegrityErrors, server.ID, serverID, rule).Set(float64(validation.Counts[rule]))
+	}
+	return validation.TotalErrors(), nil
+}
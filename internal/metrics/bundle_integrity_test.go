@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestReportBundleIntegrity(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 995, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	staticStore := gtfs.NewStaticStore()
+	defer Series.DeleteServer(server.ID)
+
+	if _, err := reportBundleIntegrity(staticStore, server); err == nil {
+		t.Fatal("expected an error when no bundle is stored")
+	}
+
+	// Bundles without a validation report export nothing.
+	staticStore.Set(server.ID, &models.StaticData{})
+	if total, err := reportBundleIntegrity(staticStore, server); err != nil || total != 0 {
+		t.Fatalf("expected no errors for a bundle without report, got %d (err: %v)", total, err)
+	}
+	if got := testutil.CollectAndCount(BundleIntegrityErrors, "gtfs_bundle_integrity_errors"); got != 0 {
+		t.Errorf("expected no integrity series, got %d", got)
+	}
+
+	staticStore.Set(server.ID, &models.StaticData{Validation: &models.ValidationReport{
+		Counts: map[string]int{gtfs.RuleTripUnknownRoute: 3, gtfs.RuleStopParentCycle: 2},
+	}})
+	total, err := reportBundleIntegrity(staticStore, server)
+	if err != nil {
+		t.Fatalf("reportBundleIntegrity failed: %v", err)
+	}
+	if total != 5 {
+		t.Errorf("expected 5 errors, got %d", total)
+	}
+	if got := testutil.ToFloat64(BundleIntegrityErrors.WithLabelValues("995", gtfs.RuleTripUnknownRoute)); got != 3 {
+		t.Errorf("expected 3 trip_unknown_route errors, got %v", got)
+	}
+	if got := testutil.ToFloat64(BundleIntegrityErrors.WithLabelValues("995", gtfs.RuleStopUnknownParent)); got != 0 {
+		t.Errorf("expected rules without errors to be exported as 0, got %v", got)
+	}
+	if got := testutil.CollectAndCount(BundleIntegrityErrors, "gtfs_bundle_integrity_errors"); got != len(gtfs.ValidationRules) {
+		t.Errorf("expected one series per rule, got %d", got)
+	}
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// RecordFeedSizeLimitExceeded counts a GTFS download aborted for exceeding the size limit of its feed type.
+// It is set as gtfs.FeedLimits.OnLimitExceeded.
+func RecordFeedSizeLimitExceeded(serverID int, feed string) {
+	Series.Counter(FeedSizeLimitExceeded, serverID, strconv.Itoa(serverID), feed).Inc()
+}
+
+// RecordRealtimeFetch records the outcome of a GTFS-RT fetch: a failed fetch is counted by reason,
+// and a successful one (empty reason) sets the last success time of the feed.
+// It is set as gtfs.GtfsService.OnRealtimeFetch.
+func RecordRealtimeFetch(serverID int, feed string, reason string) {
+	if reason != "" {
+		Series.Counter(RealtimeFetchFailures, serverID, strconv.Itoa(serverID), feed, reason).Inc()
+		return
+	}
+	Series.Gauge(RealtimeLastSuccess, serverID, strconv.Itoa(serverID), feed).Set(float64(time.Now().Unix()))
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+)
+
+func TestRecordRealtimeFetch(t *testing.T) {
+	defer Series.DeleteServer(988)
+
+	RecordRealtimeFetch(988, gtfs.FeedVehiclePositions, gtfs.FetchFailureHTTP5xx)
+	RecordRealtimeFetch(988, gtfs.FeedVehiclePositions, gtfs.FetchFailureHTTP5xx)
+	if got := testutil.ToFloat64(RealtimeFetchFailures.WithLabelValues("988", gtfs.FeedVehiclePositions, gtfs.FetchFailureHTTP5xx)); got != 2 {
+		t.Errorf("expected 2 failures, got %v", got)
+	}
+
+	before := time.Now().Unix()
+	RecordRealtimeFetch(988, gtfs.FeedTripUpdates, "")
+	if got := testutil.ToFloat64(RealtimeLastSuccess.WithLabelValues("988", gtfs.FeedTripUpdates)); got < float64(before) {
+		t.Errorf("expected the last success time to be set, got %v", got)
+	}
+}
@@ -26,6 +26,108 @@ var (
 		Name: "gtfs_bundle_days_until_latest_expiration",
 		Help: "Number of days until the latest GTFS bundle expiration",
 	}, []string{"server_id"})
+
+	BundleExpirationSource = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_expiration_source",
+		Help: "Always 1, labeled with the data the GTFS bundle expiration was derived from (feed_info, calendar or calendar_dates)",
+	}, []string{"server_id", "source"})
+
+	ServiceGapDays = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_service_gap_days",
+		Help: "Number of days without any active service within the look-ahead window of the GTFS bundle",
+	}, []string{"server_id"})
+
+	ServiceGapFirstDate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_service_gap_first_date_timestamp_seconds",
+		Help: "First date without any active service within the look-ahead window, as a Unix timestamp (0 if none)",
+	}, []string{"server_id"})
+
+	ActiveServicesByDay = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_active_services",
+		Help: "Number of active service IDs on each upcoming day of the look-ahead window, by days ahead of today",
+	}, []string{"server_id", "days_ahead"})
+)
+
+var (
+	BundleInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_info",
+		Help: "Always 1, labeled with the SHA-256 hash of the current GTFS static bundle",
+	}, []string{"server_id", "sha256"})
+
+	BundleIntegrityErrors = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_integrity_errors",
+		Help: "Number of referential-integrity errors in the current GTFS static bundle, by rule",
+	}, []string{"server_id", "rule"})
+
+	BundleDiffStops = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_diff_stops",
+		Help: "Number of stops added, removed or moved by the latest GTFS bundle change",
+	}, []string{"server_id", "change"})
+
+	BundleDiffAgencies = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_diff_agencies",
+		Help: "Number of agencies added or removed by the latest GTFS bundle change",
+	}, []string{"server_id", "change"})
+
+	BundleDiffRouteCountChange = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_diff_route_count_change",
+		Help: "Route count of the new GTFS bundle minus the route count of the previous one, at the latest change",
+	}, []string{"server_id"})
+
+	BundleDiffServiceShift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_diff_service_shift_days",
+		Help: "Shift in days of the service start or end date at the latest GTFS bundle change (positive is later)",
+	}, []string{"server_id", "bound"})
+
+	BundleDiffThresholdsExceeded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_diff_thresholds_exceeded",
+		Help: "Number of change thresholds crossed by the latest GTFS bundle change",
+	}, []string{"server_id"})
+
+	BundleDiffTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_diff_timestamp_seconds",
+		Help: "Unix timestamp of the latest GTFS bundle change",
+	}, []string{"server_id"})
+
+	BundleFeedInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_feed_info",
+		Help: "Always 1, labeled with the publisher and version of the current GTFS static bundle, from feed_info.txt",
+	}, []string{"server_id", "publisher", "version"})
+
+	BundleSizeBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_size_bytes",
+		Help: "Size in bytes of the current GTFS static bundle file",
+	}, []string{"server_id"})
+
+	BundleLastModified = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_last_modified_timestamp_seconds",
+		Help: "Unix timestamp of the Last-Modified header of the current GTFS static bundle",
+	}, []string{"server_id"})
+
+	BundleLastChanged = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_last_changed_timestamp_seconds",
+		Help: "Unix timestamp at which the content of the GTFS static bundle was last seen changing",
+	}, []string{"server_id"})
+
+	BundleCacheAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_bundle_cache_age_seconds",
+		Help: "Age of the GTFS static bundle served from the on-disk cache since it was downloaded, 0 once a download confirmed or replaced it",
+	}, []string{"server_id"})
+
+	FeedSizeLimitExceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gtfs_feed_size_limit_exceeded_total",
+		Help: "Number of GTFS downloads aborted because the feed exceeded its size limit, by feed type (static, realtime)",
+	}, []string{"server_id", "feed"})
+
+	RealtimeFetchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gtfs_rt_fetch_failures_total",
+		Help: "Number of failed GTFS-RT fetches, by feed (vehicle_positions, trip_updates, alerts) and reason (dns, connect_timeout, timeout, tls, http_4xx, http_5xx, content_type, empty_body, parse_error, zero_entities, too_large, other)",
+	}, []string{"server_id", "feed", "reason"})
+
+	RealtimeLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful fetch of each GTFS-RT feed (vehicle_positions, trip_updates, alerts)",
+	}, []string{"server_id", "feed"})
 )
 
 var (
@@ -41,7 +143,122 @@ var (
 
 	AgenciesMatch = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "oba_agencies_match",
-		Help: "Whether the number of agencies in the static GTFS file matches the agencies-with-coverage endpoint (1 = match, 0 = no match)",
+		Help: "Whether the agencies of the static GTFS file match the agencies-with-coverage endpoint by ID, name and timezone (1 = match, 0 = no match)",
+	}, []string{"server_id"})
+
+	AgencyMissingFromCoverage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_agency_missing_from_coverage",
+		Help: "Whether each agency of the static GTFS file is missing from the agencies-with-coverage endpoint (1 = missing, 0 = listed)",
+	}, []string{"agency_id", "server_id"})
+
+	AgencyExtraInCoverage = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_agency_extra_in_coverage",
+		Help: "Whether each agency of the agencies-with-coverage endpoint is absent from the static GTFS file (1 = absent, 0 = present)",
+	}, []string{"agency_id", "server_id"})
+
+	AgencyAttributeMismatch = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_agency_attribute_mismatch",
+		Help: "Whether the name or timezone of each agency differs between the static GTFS file and the agencies-with-coverage endpoint (1 = differs, 0 = same)",
+	}, []string{"agency_id", "attribute", "server_id"})
+
+	AgencyCoverageInBounds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_agency_coverage_area_in_bounds",
+		Help: "Whether the coverage area of each agency of the agencies-with-coverage endpoint fits within the bounding box of the static GTFS file (1 = within, 0 = outside)",
+	}, []string{"agency_id", "server_id"})
+)
+
+var (
+	RoutesInStaticGtfs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_routes_in_static_gtfs",
+		Help: "Number of routes of each agency in the static GTFS file",
+	}, []string{"agency_id", "server_id"})
+
+	RoutesInAPI = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_routes_in_api",
+		Help: "Number of routes of each agency in the routes-for-agency API response",
+	}, []string{"agency_id", "server_id"})
+
+	RoutesMissing = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_routes_missing",
+		Help: "Number of routes of each agency in the static GTFS file that the routes-for-agency API does not list",
+	}, []string{"agency_id", "server_id"})
+
+	RoutesExtra = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_routes_extra",
+		Help: "Number of routes the routes-for-agency API lists for each agency that are not in the static GTFS file",
+	}, []string{"agency_id", "server_id"})
+
+	RoutesMismatched = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_routes_mismatched",
+		Help: "Number of routes of each agency whose attribute (short_name, type) differs between the static GTFS file and the routes-for-agency API",
+	}, []string{"agency_id", "attribute", "server_id"})
+
+	RouteDiscrepancyInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_route_discrepancy_info",
+		Help: "Presence marker (always 1) for routes that differ between the static GTFS file and the routes-for-agency API, labeled with the discrepancy (missing, extra, short_name, type)",
+	}, []string{"agency_id", "route_id", "discrepancy", "server_id"})
+)
+
+var (
+	BundleDriftRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_bundle_drift_ratio",
+		Help: "Fraction of the GTFS static bundle's sampled stops and routes that the OBA server does not know or describes differently",
+	}, []string{"server_id"})
+
+	BundleDriftSampled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_bundle_drift_sampled",
+		Help: "Number of GTFS static bundle entities looked up on the OBA server by the latest bundle drift check, by entity type (stop, route)",
+	}, []string{"server_id", "entity"})
+
+	BundleDriftEntities = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_bundle_drift_entities",
+		Help: "Number of sampled GTFS static bundle entities that drifted on the OBA server, by entity type and reason (missing, moved, renamed)",
+	}, []string{"server_id", "entity", "reason"})
+
+	ObaBundleConfigInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_bundle_config_info",
+		Help: "Always 1, labeled with the ID and name of the bundle loaded by the OBA server, from its config endpoint",
+	}, []string{"server_id", "bundle_id", "bundle_name"})
+
+	ObaBundleServiceDateFrom = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_bundle_service_date_from_timestamp_seconds",
+		Help: "Unix timestamp of the first service date of the bundle loaded by the OBA server, from its config endpoint",
+	}, []string{"server_id"})
+
+	ObaBundleServiceDateTo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_bundle_service_date_to_timestamp_seconds",
+		Help: "Unix timestamp of the last service date of the bundle loaded by the OBA server, from its config endpoint",
+	}, []string{"server_id"})
+)
+
+var (
+	ArrivalsProbeDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "oba_arrivals_probe_duration_seconds",
+			Help:    "Duration of the arrivals-and-departures-for-stop calls of the stop arrivals probe (in seconds)",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"server_id"},
+	)
+
+	ArrivalsProbeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "oba_arrivals_probe_requests_total",
+		Help: "Total number of arrivals-and-departures-for-stop calls of the stop arrivals probe, by result (error, no_arrivals, scheduled, predicted)",
+	}, []string{"server_id", "result"})
+
+	ArrivalsProbeErrorRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_arrivals_probe_error_ratio",
+		Help: "Share of the stop arrivals probe calls of the latest run that failed",
+	}, []string{"server_id"})
+
+	ArrivalsProbeArrivalsRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_arrivals_probe_arrivals_ratio",
+		Help: "Share of the successful stop arrivals probe calls of the latest run that returned at least one arrival",
+	}, []string{"server_id"})
+
+	ArrivalsProbePredictionsRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "oba_arrivals_probe_predictions_ratio",
+		Help: "Share of the successful stop arrivals probe calls of the latest run that returned at least one real-time prediction",
 	}, []string{"server_id"})
 )
 
@@ -51,6 +268,51 @@ var (
 		Help: "Number of realtime vehicle positions in the GTFS-RT feed",
 	}, []string{"gtfs_rt_url", "server_id"})
 
+	RealtimeVehiclePositionsByAgency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "realtime_vehicle_positions_count_by_agency",
+		Help: "Number of realtime vehicle positions of each agency in the GTFS-RT feed, attributed through the agency of their route",
+	}, []string{"agency_id", "server_id"})
+
+	UnattributedVehiclePositions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "realtime_vehicle_positions_unattributed",
+		Help: "Number of realtime vehicle positions in the GTFS-RT feed that could not be attributed to one of the server's agencies",
+	}, []string{"server_id"})
+
+	RealtimeFeedInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_feed_info",
+		Help: "GTFS-RT vehicle positions feed header metadata (always 1): the gtfs_realtime_version and incrementality of the latest snapshot",
+	}, []string{"server_id", "gtfs_realtime_version", "incrementality"})
+
+	RealtimeFeedAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_feed_age_seconds",
+		Help: "Seconds elapsed since the FeedHeader timestamp of the latest GTFS-RT vehicle positions snapshot",
+	}, []string{"server_id"})
+
+	RealtimeFeedUnchangedFetches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_feed_unchanged_fetches",
+		Help: "Number of consecutive GTFS-RT vehicle positions fetches that returned the same payload as the previous fetch",
+	}, []string{"server_id"})
+
+	RealtimeFeedFrozen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_feed_frozen",
+		Help: "Whether the GTFS-RT vehicle positions feed is frozen: its header timestamp or its content has not changed for longer than the frozen threshold (1 = frozen, 0 = live)",
+	}, []string{"server_id"})
+
+	DuplicateVehicleIDs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_duplicate_vehicle_ids",
+		Help: "Number of vehicle IDs reported by more than one vehicle position of the GTFS-RT feed",
+	}, []string{"server_id"})
+
+	SharedTrips = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_shared_trips",
+		Help: "Number of trips (trip ID and start date) claimed by more than one vehicle of the GTFS-RT feed",
+	}, []string{"server_id"})
+
+	VehicleTripMismatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_vehicle_trip_mismatches",
+		Help: "Number of GTFS-RT vehicles whose trip cannot be matched to the static bundle, by reason (no_trip, unknown_trip, unknown_route, inactive_service)",
+	}, []string{"server_id", "reason"})
+
 	VehicleCountAPI = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "vehicle_count_api",
 		Help: "Number of vehicles in the API response",
@@ -68,9 +330,19 @@ var (
 
 	VehicleReportCount = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "vehicle_report_total",
-		Help: "Total number of GTFS-RT updates received from each vehicle",
+		Help: "Total number of new GTFS-RT reports received from each vehicle; reports repeating the previous timestamp or without a timestamp are not counted",
+	}, []string{"vehicle_id", "server_id"})
+
+	VehicleUpdatePeriod = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "vehicle_update_period_seconds",
+		Help: "Estimated time in seconds between two new GTFS-RT reports of each vehicle (moving average of the observed intervals)",
 	}, []string{"vehicle_id", "server_id"})
 
+	VehicleReportsByTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_vehicle_reports",
+		Help: "Number of vehicle reports in the latest GTFS-RT snapshot, by timestamp class compared with the previous report of the vehicle (new, repeated, backwards, future, untimestamped)",
+	}, []string{"server_id", "class"})
+
 	VehicleSpeedGauge = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "gtfs_rt_vehicle_computed_speed",
@@ -204,6 +476,54 @@ var (
 	)
 )
 
+var (
+	TripUpdatesCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_trip_updates",
+		Help: "Number of trip updates in the GTFS-RT TripUpdates feed",
+	}, []string{"server_id"})
+
+	TripUpdateDelay = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gtfs_rt_trip_update_delay_seconds",
+			Help:    "Delay (in seconds, negative when early) predicted by each trip update, observed once per fetch",
+			Buckets: []float64{-600, -300, -120, -60, 0, 60, 120, 300, 600, 900, 1800, 3600},
+		},
+		[]string{"server_id"},
+	)
+
+	TripUpdatesUnknownTrips = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_trip_updates_unknown_trips",
+		Help: "Number of scheduled trip updates whose trip ID is not in the GTFS static bundle",
+	}, []string{"server_id"})
+
+	TripUpdatesCanceled = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_trip_updates_canceled",
+		Help: "Number of trip updates with a CANCELED schedule relationship",
+	}, []string{"server_id"})
+
+	TripUpdatesAdded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_trip_updates_added",
+		Help: "Number of trip updates with an ADDED schedule relationship",
+	}, []string{"server_id"})
+)
+
+var (
+	ServiceAlertsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_alerts_active",
+		Help: "Number of service alerts active now",
+	}, []string{"server_id"})
+
+	ServiceAlertsExpired = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_alerts_expired",
+		Help: "Number of service alerts still published although every active period has ended",
+	}, []string{"server_id"})
+
+	ServiceAlertsOrphaned = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gtfs_rt_alerts_orphaned",
+		Help: "Number of service alerts informing a route, stop or trip ID missing from the GTFS static bundle, by entity type",
+	}, []string{"server_id", "entity"})
+)
+
 var (
 	OutgoingLatency = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -214,3 +534,71 @@ var (
 		[]string{"url", "method", "status_code"},
 	)
 )
+
+// Metrics collection scheduler metrics
+var (
+	CollectionCycleDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "watchdog_collection_cycle_duration_seconds",
+			Help:    "Time from a collection tick until every server dispatched on that tick finished collecting (in seconds)",
+			Buckets: []float64{0.5, 1, 2.5, 5, 10, 15, 20, 30, 45, 60, 90, 120},
+		},
+	)
+
+	ServerCollectionDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "watchdog_server_collection_duration_seconds",
+			Help:    "Time spent collecting metrics for a single server (in seconds)",
+			Buckets: []float64{0.5, 1, 2.5, 5, 10, 15, 20, 30, 45, 60, 90, 120},
+		},
+		[]string{"server_id"},
+	)
+
+	CollectionCycleOverruns = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "watchdog_collection_cycle_overruns_total",
+			Help: "Total number of collection cycles that took longer than the fetch interval",
+		},
+	)
+
+	CollectionSkippedTicks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "watchdog_collection_skipped_ticks_total",
+			Help: "Total number of collection ticks skipped for a server because its previous run was still in progress",
+		},
+		[]string{"server_id"},
+	)
+
+	CollectionPanics = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "watchdog_collection_panics_total",
+			Help: "Total number of panics recovered while collecting metrics for a server",
+		},
+		[]string{"server_id"},
+	)
+
+	CheckResults = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "watchdog_check_results_total",
+			Help: "Total number of check runs per server, check and outcome (passed, failed, skipped)",
+		},
+		[]string{"server_id", "check", "status"},
+	)
+)
+
+// Series lifecycle metrics
+var (
+	TrackedSeries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "watchdog_tracked_series",
+			Help: "Number of per-server metric series currently tracked (and exported) by the watchdog",
+		},
+	)
+
+	ExpiredSeries = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "watchdog_expired_series_total",
+			Help: "Total number of metric series deleted because they were not refreshed within their TTL",
+		},
+	)
+)
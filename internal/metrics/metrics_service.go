@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"time"
@@ -13,16 +14,20 @@ import (
 type MetricsService struct {
 	StaticStore      *gtfs.StaticStore
 	RealtimeStore    *gtfs.RealtimeStore
+	TripUpdatesStore *gtfs.RealtimeStore
+	AlertsStore      *gtfs.RealtimeStore
 	BoundingBoxStore *geo.BoundingBoxStore
 	VehicleLastSeen  *VehicleLastSeen
 	Logger           *slog.Logger
 	Client           *http.Client
 }
 
-func NewMetricsService(static *gtfs.StaticStore, realtime *gtfs.RealtimeStore, bbox *geo.BoundingBoxStore, vehicleLastSeen *VehicleLastSeen, logger *slog.Logger, client *http.Client) *MetricsService {
+func NewMetricsService(static *gtfs.StaticStore, realtime *gtfs.RealtimeStore, tripUpdates *gtfs.RealtimeStore, alerts *gtfs.RealtimeStore, bbox *geo.BoundingBoxStore, vehicleLastSeen *VehicleLastSeen, logger *slog.Logger, client *http.Client) *MetricsService {
 	return &MetricsService{
 		StaticStore:      static,
 		RealtimeStore:    realtime,
+		TripUpdatesStore: tripUpdates,
+		AlertsStore:      alerts,
 		BoundingBoxStore: bbox,
 		VehicleLastSeen:  vehicleLastSeen,
 		Logger:           logger,
@@ -30,32 +35,84 @@ func NewMetricsService(static *gtfs.StaticStore, realtime *gtfs.RealtimeStore, b
 	}
 }
 
-func (ms *MetricsService) CheckVehicleCountMatch(server models.ObaServer) error {
-	return checkVehicleCountMatch(server, ms.RealtimeStore)
+func (ms *MetricsService) CheckVehicleCountMatch(ctx context.Context, server models.ObaServer) error {
+	return checkVehicleCountMatch(ctx, server, ms.RealtimeStore, ms.StaticStore)
 }
 
-func (ms *MetricsService) CheckAgenciesWithCoverageMatch(server models.ObaServer) error {
-	if err := checkAgenciesWithCoverageMatch(ms.StaticStore, ms.Logger, server); err != nil {
+func (ms *MetricsService) CheckAgenciesWithCoverageMatch(ctx context.Context, server models.ObaServer) error {
+	if err := checkAgenciesWithCoverageMatch(ctx, ms.StaticStore, ms.BoundingBoxStore, ms.Logger, server); err != nil {
 		return err
 	}
 	return nil
 
 }
 
-func (ms *MetricsService) CheckBundleExpiration(currentTime time.Time, server models.ObaServer) (int, int, error) {
+func (ms *MetricsService) CheckRouteConsistency(ctx context.Context, server models.ObaServer) error {
+	return checkRouteConsistency(ctx, ms.StaticStore, server)
+}
+
+func (ms *MetricsService) ProbeStopArrivals(ctx context.Context, server models.ObaServer, sampleSize int) error {
+	return probeStopArrivals(ctx, ms.StaticStore, ms.Logger, server, time.Now(), sampleSize)
+}
+
+func (ms *MetricsService) CheckBundleDrift(ctx context.Context, server models.ObaServer, sampleSize int) (float64, error) {
+	return checkBundleDrift(ctx, ms.StaticStore, ms.Logger, server, sampleSize)
+}
+
+func (ms *MetricsService) CheckBundleExpiration(currentTime time.Time, server models.ObaServer) (int, int, string, error) {
 	return checkBundleExpiration(ms.StaticStore, currentTime, server)
 }
 
-func (ms *MetricsService) ServerPing(server models.ObaServer) bool {
-	return serverPing(server)
+func (ms *MetricsService) ReportBundleInfo(server models.ObaServer) error {
+	return reportBundleInfo(ms.StaticStore, server)
+}
+
+func (ms *MetricsService) ServerPing(ctx context.Context, server models.ObaServer) bool {
+	return serverPing(ctx, server)
+}
+
+func (ms *MetricsService) FetchObaAPIMetrics(ctx context.Context, slugID string, serverID int, serverBaseUrl string, apiKey string) error {
+	return fetchObaAPIMetrics(ctx, slugID, serverID, serverBaseUrl, apiKey, ms.Client, ms.StaticStore)
+}
+
+func (ms *MetricsService) ObaAPIMetricsSlugID(server models.ObaServer) string {
+	return obaAPIMetricsSlugID(server, ms.StaticStore)
+}
+
+func (ms *MetricsService) TrackTripUpdates(server models.ObaServer) error {
+	return trackTripUpdates(server, ms.TripUpdatesStore, ms.StaticStore)
+}
+
+func (ms *MetricsService) ReportBundleIntegrity(server models.ObaServer) (int, error) {
+	return reportBundleIntegrity(ms.StaticStore, server)
+}
+
+func (ms *MetricsService) ReportBundleDiff(server models.ObaServer, changelog *gtfs.BundleChangelog) {
+	reportBundleDiff(changelog, server)
+}
+
+func (ms *MetricsService) CheckServiceGaps(server models.ObaServer, lookaheadDays int) (int, error) {
+	return checkServiceGaps(ms.StaticStore, time.Now().UTC(), server, lookaheadDays)
 }
 
-func (ms *MetricsService) FetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKey string) error {
-	return fetchObaAPIMetrics(slugID, serverID, serverBaseUrl, apiKey, ms.Client, ms.StaticStore)
+func (ms *MetricsService) TrackServiceAlerts(server models.ObaServer) error {
+	return trackServiceAlerts(server, ms.AlertsStore, ms.StaticStore, time.Now().UTC())
 }
 
 func (ms *MetricsService) TrackVehicleTelemetry(server models.ObaServer) error {
-	return trackVehicleTelemetry(server, ms.VehicleLastSeen, ms.RealtimeStore)
+	return trackVehicleTelemetry(server, ms.VehicleLastSeen, ms.RealtimeStore, ms.StaticStore, time.Now().UTC())
+}
+
+func (ms *MetricsService) TrackRealtimeFreshness(server models.ObaServer, frozenThreshold time.Duration) (bool, error) {
+	return trackRealtimeFreshness(server, ms.RealtimeStore, time.Now().UTC(), frozenThreshold)
+}
+
+func (ms *MetricsService) ReportRealtimeIntegrity(server models.ObaServer) (*models.RealtimeIntegrityReport, error) {
+	return reportRealtimeIntegrity(server, ms.RealtimeStore, time.Now().UTC())
+}
+
+func (ms *MetricsService) TrackVehicleTrips(server models.ObaServer) (map[string]int, error) {
+	return trackVehicleTrips(server, ms.RealtimeStore, ms.StaticStore, time.Now().UTC())
 }
 
 func (ms *MetricsService) TrackInvalidVehiclesAndStoppedOutOfBounds(server models.ObaServer) error {
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -47,6 +48,7 @@ type OBAMetrics struct {
 //   - Locations of unmatched stops (if available)
 //
 // Parameters:
+//   - ctx: the context of the collection run; canceling it aborts the request.
 //   - slugID: a string identifier used for metric labels.
 //   - serverID: the numeric ID of the OBA server.
 //   - serverBaseUrl: the base URL of the OBA server (e.g., https://example.org).
@@ -56,7 +58,7 @@ type OBAMetrics struct {
 // Returns:
 //   - error: any error encountered during request, decoding, or Prometheus reporting.
 
-func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKey string, client *http.Client, staticStore *gtfs.StaticStore) error {
+func fetchObaAPIMetrics(ctx context.Context, slugID string, serverID int, serverBaseUrl string, apiKey string, client *http.Client, staticStore *gtfs.StaticStore) error {
 	if client == nil {
 		client = &http.Client{
 			Timeout: 10 * time.Second,
@@ -67,7 +69,19 @@ func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKe
 
 	fmt.Printf("Fetching metrics from %s\n", url)
 
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to create metrics request for %s: %v", url, err)
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: utils.MakeMap("slug_id", slugID),
+			ExtraContext: map[string]interface{}{
+				"url": url,
+			},
+		})
+		return err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		err = fmt.Errorf("failed to fetch metrics from %s: %v", url, err)
 		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
@@ -112,23 +126,23 @@ func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKe
 		return err
 	}
 
-	ObaApiStatus.WithLabelValues(slugID, url).Set(1)
+	Series.Gauge(ObaApiStatus, serverID, slugID, url).Set(1)
 
 	entry := metrics.Data.Entry
 
-	ObaAgenciesWithCoverage.WithLabelValues(slugID).Set(float64(entry.AgenciesWithCoverageCount))
+	Series.Gauge(ObaAgenciesWithCoverage, serverID, slugID).Set(float64(entry.AgenciesWithCoverageCount))
 
 	for _, agencyID := range entry.AgencyIDs {
 		if count, ok := entry.RealtimeRecordsTotal[agencyID]; ok {
-			ObaRealtimeRecords.WithLabelValues(slugID, agencyID).Set(float64(count))
+			Series.Gauge(ObaRealtimeRecords, serverID, slugID, agencyID).Set(float64(count))
 		}
 
 		if count, ok := entry.RealtimeTripCountsMatched[agencyID]; ok {
-			ObaRealtimeTripsMatched.WithLabelValues(slugID, agencyID).Set(float64(count))
+			Series.Gauge(ObaRealtimeTripsMatched, serverID, slugID, agencyID).Set(float64(count))
 		}
 
 		if count, ok := entry.RealtimeTripCountsUnmatched[agencyID]; ok {
-			ObaRealtimeTripsUnmatched.WithLabelValues(slugID, agencyID).Set(float64(count))
+			Series.Gauge(ObaRealtimeTripsUnmatched, serverID, slugID, agencyID).Set(float64(count))
 		}
 
 		matched := entry.RealtimeTripCountsMatched[agencyID]
@@ -136,19 +150,19 @@ func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKe
 		total := matched + unmatched
 		if total > 0 {
 			ratio := float64(matched) / float64(total)
-			TripMatchRatio.WithLabelValues(slugID, agencyID).Set(ratio)
+			Series.Gauge(TripMatchRatio, serverID, slugID, agencyID).Set(ratio)
 		}
 
 		if count, ok := entry.ScheduledTripsCount[agencyID]; ok {
-			ObaScheduledTrips.WithLabelValues(slugID, agencyID).Set(float64(count))
+			Series.Gauge(ObaScheduledTrips, serverID, slugID, agencyID).Set(float64(count))
 		}
 
 		if count, ok := entry.StopIDsMatchedCount[agencyID]; ok {
-			ObaStopsMatched.WithLabelValues(slugID, agencyID).Set(float64(count))
+			Series.Gauge(ObaStopsMatched, serverID, slugID, agencyID).Set(float64(count))
 		}
 
 		if count, ok := entry.StopIDsUnmatchedCount[agencyID]; ok {
-			ObaStopsUnmatched.WithLabelValues(slugID, agencyID).Set(float64(count))
+			Series.Gauge(ObaStopsUnmatched, serverID, slugID, agencyID).Set(float64(count))
 		}
 
 		stopMatched := entry.StopIDsMatchedCount[agencyID]
@@ -156,11 +170,11 @@ func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKe
 		stopTotal := stopMatched + stopUnmatched
 		if stopTotal > 0 {
 			stopRatio := float64(stopMatched) / float64(stopTotal)
-			StopMatchRatio.WithLabelValues(slugID, agencyID).Set(stopRatio)
+			Series.Gauge(StopMatchRatio, serverID, slugID, agencyID).Set(stopRatio)
 		}
 
 		if seconds, ok := entry.TimeSinceLastRealtimeUpdate[agencyID]; ok {
-			ObaTimeSinceUpdate.WithLabelValues(slugID, agencyID).Set(float64(seconds))
+			Series.Gauge(ObaTimeSinceUpdate, serverID, slugID, agencyID).Set(float64(seconds))
 		}
 
 		unmatchedStopIDs := entry.StopIDsUnmatched[agencyID]
@@ -178,7 +192,7 @@ func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKe
 				if stop.Latitude == nil || stop.Longitude == nil {
 					continue
 				}
-				ObaUnmatchedStopInfo.WithLabelValues(
+				Series.Gauge(ObaUnmatchedStopInfo, serverID,
 					slugID,
 					agencyID,
 					stopID,
@@ -187,7 +201,7 @@ func fetchObaAPIMetrics(slugID string, serverID int, serverBaseUrl string, apiKe
 					fmt.Sprintf("%.6f", *stop.Longitude),
 				).Set(1)
 			}
-			reportUnmatchedStopClusters(slugID, agencyID, stopInfoMap)
+			reportUnmatchedStopClusters(serverID, slugID, agencyID, stopInfoMap)
 		}
 	}
 	return nil
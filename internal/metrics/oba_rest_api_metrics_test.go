@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	remoteGtfs "github.com/OneBusAway/go-gtfs"
 	"gopkg.in/dnaeon/go-vcr.v4/pkg/recorder"
 	"net/http"
@@ -70,7 +71,7 @@ func TestFetchObaAPIMetrics_WithVCR(t *testing.T) {
 				}
 			}
 			staticStore.Set(tt.serverID, staticData)
-			err := fetchObaAPIMetrics(tt.slugID, tt.serverID, tt.serverURL, tt.apiKey, client, staticStore)
+			err := fetchObaAPIMetrics(context.Background(), tt.slugID, tt.serverID, tt.serverURL, tt.apiKey, client, staticStore)
 
 			if tt.wantErr {
 				if err == nil {
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// DefaultRealtimeFrozenThreshold is how long the GTFS-RT feed may go without change before it is
+// flagged as frozen when no positive threshold is configured.
+const DefaultRealtimeFrozenThreshold = 5 * time.Minute
+
+// trackRealtimeFreshness tells a live GTFS-RT vehicle positions feed from a frozen one.
+//
+// A producer that stopped updating often keeps serving its last feed: it still parses, vehicles
+// are still counted, and nothing else looks wrong. Two signals of the latest snapshot stored for
+// the server expose it:
+//   - the FeedHeader timestamp, which stops advancing;
+//   - the payload, which stays byte for byte identical across fetches (see gtfs.RealtimeSnapshot.UnchangedFetches).
+//
+// It exports:
+//   - RealtimeFeedInfo: the `gtfs_realtime_version` and incrementality of the feed header.
+//   - RealtimeFeedAge: the time elapsed since the header timestamp (not exported when the feed sets none).
+//   - RealtimeFeedUnchangedFetches: the number of consecutive fetches that returned identical bytes.
+//   - RealtimeFeedFrozen: 1 when either signal has stalled for longer than frozenThreshold, 0 otherwise.
+//
+// A non-positive frozenThreshold uses DefaultRealtimeFrozenThreshold.
+//
+// Returns whether the feed is frozen, or an error if no snapshot is stored for the server.
+func trackRealtimeFreshness(server models.ObaServer, realtimeStore *gtfs.RealtimeStore, now time.Time, frozenThreshold time.Duration) (bool, error) {
+	if frozenThreshold <= 0 {
+		frozenThreshold = DefaultRealtimeFrozenThreshold
+	}
+	snapshot, ok := realtimeStore.Get(server.ID)
+	if !ok || snapshot == nil {
+		return false, fmt.Errorf("no GTFS-RT data available for server %d", server.ID)
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	Series.ExclusiveGauge(RealtimeFeedInfo, server.ID, serverID, snapshot.RealtimeVersion, snapshot.Incrementality).Set(1)
+	Series.Gauge(RealtimeFeedUnchangedFetches, server.ID, serverID).Set(float64(snapshot.UnchangedFetches))
+
+	frozen := now.Sub(snapshot.ContentChangedAt) > frozenThreshold
+	if !snapshot.FeedTimestamp.IsZero() {
+		age := now.Sub(snapshot.FeedTimestamp)
+		Series.Gauge(RealtimeFeedAge, server.ID, serverID).Set(age.Seconds())
+		frozen = frozen || age > frozenThreshold
+	}
+	Series.Gauge(RealtimeFeedFrozen, server.ID, serverID).Set(boolToFloat(frozen))
+	return frozen, nil
+}
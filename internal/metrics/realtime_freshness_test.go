@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestTrackRealtimeFreshness(t *testing.T) {
+	server := createTestServer("http://example.com", "Test Server", 988, "test-key", "http://example.com", "", "", "")
+	defer Series.DeleteServer(server.ID)
+
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC)
+	realtimeStore := gtfs.NewRealtimeStore(time.Minute)
+
+	tests := []struct {
+		name     string
+		snapshot *gtfs.RealtimeSnapshot
+		frozen   bool
+	}{
+		{
+			name: "Live feed",
+			snapshot: &gtfs.RealtimeSnapshot{
+				FeedTimestamp:    now.Add(-30 * time.Second),
+				UnchangedFetches: 1,
+				ContentChangedAt: now.Add(-time.Minute),
+			},
+		},
+		{
+			name: "Header timestamp stalled",
+			snapshot: &gtfs.RealtimeSnapshot{
+				FeedTimestamp:    now.Add(-10 * time.Minute),
+				ContentChangedAt: now,
+			},
+			frozen: true,
+		},
+		{
+			name: "Content stalled without header timestamp",
+			snapshot: &gtfs.RealtimeSnapshot{
+				UnchangedFetches: 12,
+				ContentChangedAt: now.Add(-6 * time.Minute),
+			},
+			frozen: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.snapshot.Data = &models.RealtimeData{}
+			tt.snapshot.RealtimeVersion = "2.0"
+			tt.snapshot.Incrementality = "FULL_DATASET"
+			realtimeStore.Set(server.ID, tt.snapshot)
+
+			frozen, err := trackRealtimeFreshness(server, realtimeStore, now, 5*time.Minute)
+			if err != nil {
+				t.Fatalf("trackRealtimeFreshness failed: %v", err)
+			}
+			if frozen != tt.frozen {
+				t.Errorf("expected frozen %v, got %v", tt.frozen, frozen)
+			}
+			if got := testutil.ToFloat64(RealtimeFeedFrozen.WithLabelValues("988")); got != boolToFloat(tt.frozen) {
+				t.Errorf("expected frozen flag %v, got %v", boolToFloat(tt.frozen), got)
+			}
+			if got := testutil.ToFloat64(RealtimeFeedUnchangedFetches.WithLabelValues("988")); got != float64(tt.snapshot.UnchangedFetches) {
+				t.Errorf("expected %d unchanged fetches, got %v", tt.snapshot.UnchangedFetches, got)
+			}
+			if got := testutil.ToFloat64(RealtimeFeedInfo.WithLabelValues("988", "2.0", "FULL_DATASET")); got != 1 {
+				t.Errorf("expected the feed info to be exported, got %v", got)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(RealtimeFeedAge.WithLabelValues("988")); got != 600 {
+		t.Errorf("expected the age of the last feed with a header timestamp, got %v", got)
+	}
+
+	t.Run("No snapshot", func(t *testing.T) {
+		if _, err := trackRealtimeFreshness(server, gtfs.NewRealtimeStore(time.Minute), now, 0); err == nil {
+			t.Error("expected an error without a GTFS-RT snapshot")
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// reportRealtimeIntegrity exports the integrity of the latest fresh GTFS-RT vehicle positions
+// snapshot of the server (see gtfs.RealtimeSnapshot.Integrity):
+//   - DuplicateVehicleIDs: the number of vehicle IDs reported by more than one vehicle position.
+//     OBA keeps a single one of them, so the vehicle jumps between the reported positions.
+//   - SharedTrips: the number of trips (trip ID and start date) claimed by more than one vehicle.
+//     OBA attaches a single vehicle to a trip, so the predictions of the trip follow either vehicle.
+//
+// The offending IDs are served by the `/v1/servers/:id/realtime/integrity` endpoint.
+//
+// Returns the integrity report, or an error if no fresh snapshot is stored for the server.
+func reportRealtimeIntegrity(server models.ObaServer, realtimeStore *gtfs.RealtimeStore, now time.Time) (*models.RealtimeIntegrityReport, error) {
+	snapshot, err := realtimeStore.GetFresh(server.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Integrity == nil {
+		return nil, fmt.Errorf("no GTFS-RT integrity report available for server %d", server.ID)
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	Series.Gauge(DuplicateVehicleIDs, server.ID, serverID).Set(float64(len(snapshot.Integrity.DuplicateVehicles)))
+	Series.Gauge(SharedTrips, server.ID, serverID).Set(float64(len(snapshot.Integrity.SharedTrips)))
+	return snapshot.Integrity, nil
+}
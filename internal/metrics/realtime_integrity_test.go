@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestReportRealtimeIntegrity(t *testing.T) {
+	server := createTestServer("http://example.com", "Test Server", 986, "test-key", "http://example.com", "", "", "")
+	defer Series.DeleteServer(server.ID)
+
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC)
+	realtimeStore := gtfs.NewRealtimeStore(time.Minute)
+	realtimeStore.Set(server.ID, &gtfs.RealtimeSnapshot{
+		Data:      &models.RealtimeData{},
+		FetchedAt: now.Add(-10 * time.Second),
+		Integrity: &models.RealtimeIntegrityReport{
+			DuplicateVehicles: []models.DuplicateVehicle{{VehicleID: "bus-1", Count: 2}, {VehicleID: "bus-2", Count: 3}},
+			SharedTrips:       []models.SharedTrip{{TripID: "trip-1", StartDate: "20250310", VehicleIDs: []string{"bus-3", "bus-4"}}},
+		},
+	})
+
+	report, err := reportRealtimeIntegrity(server, realtimeStore, now)
+	if err != nil {
+		t.Fatalf("reportRealtimeIntegrity failed: %v", err)
+	}
+	if len(report.DuplicateVehicles) != 2 || len(report.SharedTrips) != 1 {
+		t.Errorf("expected the stored report, got %+v", report)
+	}
+	if got := testutil.ToFloat64(DuplicateVehicleIDs.WithLabelValues("986")); got != 2 {
+		t.Errorf("expected 2 duplicate vehicle IDs, got %v", got)
+	}
+	if got := testutil.ToFloat64(SharedTrips.WithLabelValues("986")); got != 1 {
+		t.Errorf("expected 1 shared trip, got %v", got)
+	}
+
+	t.Run("Stale snapshot", func(t *testing.T) {
+		if _, err := reportRealtimeIntegrity(server, realtimeStore, now.Add(5*time.Minute)); err == nil {
+			t.Error("expected an error for a stale GTFS-RT snapshot")
+		}
+	})
+
+	t.Run("No integrity report", func(t *testing.T) {
+		realtimeStore.Set(server.ID, &gtfs.RealtimeSnapshot{Data: &models.RealtimeData{}, FetchedAt: now})
+		if _, err := reportRealtimeIntegrity(server, realtimeStore, now); err == nil {
+			t.Error("expected an error without an integrity report")
+		}
+	})
+}
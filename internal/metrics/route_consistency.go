@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	onebusaway "github.com/OneBusAway/go-sdk"
+	"github.com/OneBusAway/go-sdk/option"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+	"watchdog.onebusaway.org/internal/report"
+	"watchdog.onebusaway.org/internal/utils"
+)
+
+// maxRouteDiscrepancySeries caps the number of RouteDiscrepancyInfo series exported per agency and
+// server, so that an agency whose whole network is missing does not export one series per route.
+// The counts (RoutesMissing, RoutesExtra and RoutesMismatched) are never capped.
+const maxRouteDiscrepancySeries = 50
+
+// Discrepancies of a route between the GTFS static bundle and the OBA API, as exported in the
+// `discrepancy` label of RouteDiscrepancyInfo. Mismatches are also the `attribute` label of RoutesMismatched.
+const (
+	routeMissing   = "missing"    // In routes.txt, not in the API
+	routeExtra     = "extra"      // In the API, not in routes.txt
+	routeShortName = "short_name" // route_short_name differs
+	routeType      = "type"       // route_type differs
+)
+
+// routeDiscrepancy is a route that differs between the GTFS static bundle and the OBA API.
+type routeDiscrepancy struct {
+	routeID     string // GTFS route ID, without the OBA agency prefix
+	discrepancy string // routeMissing, routeExtra, routeShortName or routeType
+}
+
+// compareRoutes compares the routes of an agency in the GTFS static bundle with the routes the
+// OBA API lists for it, and returns the discrepancies sorted by route ID.
+//
+// API route IDs are prefixed with their agency (`<agency_id>_<route_id>`); the prefix is removed
+// before matching them with the bundle. For routes present in both, the short name and the route
+// type are compared.
+func compareRoutes(staticRoutes []remoteGtfs.Route, apiRoutes []onebusaway.RoutesForAgencyListResponseDataList, agencyID string) []routeDiscrepancy {
+	apiByID := make(map[string]onebusaway.RoutesForAgencyListResponseDataList, len(apiRoutes))
+	for _, route := range apiRoutes {
+		prefix := route.AgencyID
+		if prefix == "" {
+			prefix = agencyID
+		}
+		apiByID[strings.TrimPrefix(route.ID, prefix+"_")] = route
+	}
+
+	var discrepancies []routeDiscrepancy
+	staticIDs := make(map[string]bool, len(staticRoutes))
+	for _, route := range staticRoutes {
+		staticIDs[route.Id] = true
+		apiRoute, ok := apiByID[route.Id]
+		if !ok {
+			discrepancies = append(discrepancies, routeDiscrepancy{route.Id, routeMissing})
+			continue
+		}
+		if strings.TrimSpace(route.ShortName) != strings.TrimSpace(apiRoute.ShortName) {
+			discrepancies = append(discrepancies, routeDiscrepancy{route.Id, routeShortName})
+		}
+		if int64(route.Type) != apiRoute.Type {
+			discrepancies = append(discrepancies, routeDiscrepancy{route.Id, routeType})
+		}
+	}
+	for id := range apiByID {
+		if !staticIDs[id] {
+			discrepancies = append(discrepancies, routeDiscrepancy{id, routeExtra})
+		}
+	}
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		if discrepancies[i].routeID != discrepancies[j].routeID {
+			return discrepancies[i].routeID < discrepancies[j].routeID
+		}
+		return discrepancies[i].discrepancy < discrepancies[j].discrepancy
+	})
+	return discrepancies
+}
+
+// staticRoutesByAgency splits the routes of the GTFS static bundle by agency, keeping only the given agencies.
+// A server with a single agency gets every route, like it gets every vehicle (see newVehicleAgencies).
+func staticRoutesByAgency(routes []remoteGtfs.Route, agencyIDs []string) map[string][]remoteGtfs.Route {
+	byAgency := make(map[string][]remoteGtfs.Route, len(agencyIDs))
+	for _, agencyID := range agencyIDs {
+		byAgency[agencyID] = nil
+	}
+	for _, route := range routes {
+		agencyID := ""
+		if len(agencyIDs) == 1 {
+			agencyID = agencyIDs[0]
+		} else if route.Agency != nil {
+			agencyID = route.Agency.Id
+		}
+		if _, ok := byAgency[agencyID]; ok {
+			byAgency[agencyID] = append(byAgency[agencyID], route)
+		}
+	}
+	return byAgency
+}
+
+// routesForAgencyAPI calls the OBA `routes-for-agency` API endpoint and returns the routes of the agency.
+// Errors are reported to Sentry.
+func routesForAgencyAPI(ctx context.Context, server models.ObaServer, agencyID string) ([]onebusaway.RoutesForAgencyListResponseDataList, error) {
+	client := onebusaway.NewClient(
+		option.WithAPIKey(server.ObaApiKey),
+		option.WithBaseURL(server.ObaBaseURL),
+	)
+
+	response, err := client.RoutesForAgency.List(ctx, agencyID)
+	if err != nil {
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: map[string]string{
+				"server_id": strconv.Itoa(server.ID),
+				"agency_id": agencyID,
+			},
+		})
+		return nil, err
+	}
+
+	if response == nil {
+		return nil, nil
+	}
+	return response.Data.List, nil
+}
+
+// checkRouteConsistency compares, for every agency of the given server, the routes of the GTFS
+// static bundle (routes.txt) with the routes listed by the OBA `routes-for-agency` API.
+//
+// The agencies are the configured ones or, when none is configured, the discovered ones
+// (see resolveAgencyIDs). For each agency, it exports:
+//   - RoutesInStaticGtfs and RoutesInAPI: the number of routes on each side.
+//   - RoutesMissing: routes of the bundle the API does not list.
+//   - RoutesExtra: routes the API lists that are not in the bundle.
+//   - RoutesMismatched: routes listed by both whose short name or type differs, by attribute.
+//   - RouteDiscrepancyInfo: a presence marker for each differing route, labeled with its ID and
+//     discrepancy, capped at maxRouteDiscrepancySeries series (the first route IDs in order).
+//     Markers of routes that no longer differ expire after EntitySeriesTTL, which must therefore
+//     exceed the interval the check runs at.
+//
+// Returns an error if no static data is stored for the server, the agencies cannot be resolved, or
+// the API call of any agency fails. The agencies whose API call succeeded are still compared.
+func checkRouteConsistency(ctx context.Context, staticStore *gtfs.StaticStore, server models.ObaServer) error {
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return fmt.Errorf("there is no bundle for server %v", server.ID)
+	}
+
+	agencyIDs, err := resolveAgencyIDs(ctx, server, staticStore)
+	if err != nil {
+		return err
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	staticRoutes := staticRoutesByAgency(staticData.Routes, agencyIDs)
+
+	var errs []error
+	for _, agencyID := range agencyIDs {
+		apiRoutes, err := routesForAgencyAPI(ctx, server, agencyID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("agency %s: %w", agencyID, err))
+			continue
+		}
+
+		discrepancies := compareRoutes(staticRoutes[agencyID], apiRoutes, agencyID)
+		counts := map[string]int{routeMissing: 0, routeExtra: 0, routeShortName: 0, routeType: 0}
+		for i, d := range discrepancies {
+			counts[d.discrepancy]++
+			if i < maxRouteDiscrepancySeries {
+				Series.Gauge(RouteDiscrepancyInfo, server.ID, agencyID, d.routeID, d.discrepancy, serverID).Set(1)
+			}
+		}
+
+		Series.Gauge(RoutesInStaticGtfs, server.ID, agencyID, serverID).Set(float64(len(staticRoutes[agencyID])))
+		Series.Gauge(RoutesInAPI, server.ID, agencyID, serverID).Set(float64(len(apiRoutes)))
+		Series.Gauge(RoutesMissing, server.ID, agencyID, serverID).Set(float64(counts[routeMissing]))
+		Series.Gauge(RoutesExtra, server.ID, agencyID, serverID).Set(float64(counts[routeExtra]))
+		for _, attribute := range []string{routeShortName, routeType} {
+			Series.Gauge(RoutesMismatched, server.ID, agencyID, attribute, serverID).Set(float64(counts[attribute]))
+		}
+	}
+
+	if len(errs) > 0 {
+		err := fmt.Errorf("failed to list routes from API: %w", errors.Join(errs...))
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: utils.MakeMap("server_id", serverID),
+		})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	onebusaway "github.com/OneBusAway/go-sdk"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestCompareRoutes(t *testing.T) {
+	staticRoutes := []remoteGtfs.Route{
+		{Id: "1", ShortName: "1", Type: remoteGtfs.RouteType(3)},
+		{Id: "2", ShortName: "2", Type: remoteGtfs.RouteType(3)},
+		{Id: "3", ShortName: "3", Type: remoteGtfs.RouteType(3)},
+	}
+	apiRoutes := []onebusaway.RoutesForAgencyListResponseDataList{
+		{ID: "40_1", AgencyID: "40", ShortName: "1", Type: 3},
+		{ID: "40_2", AgencyID: "40", ShortName: "2X", Type: 0},
+		{ID: "40_4", AgencyID: "40", ShortName: "4", Type: 3},
+	}
+
+	got := compareRoutes(staticRoutes, apiRoutes, "40")
+	expected := []routeDiscrepancy{
+		{"2", routeShortName},
+		{"2", routeType},
+		{"3", routeMissing},
+		{"4", routeExtra},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestStaticRoutesByAgency(t *testing.T) {
+	routes := []remoteGtfs.Route{
+		{Id: "1", Agency: &remoteGtfs.Agency{Id: "metro"}},
+		{Id: "2", Agency: &remoteGtfs.Agency{Id: "tram"}},
+		{Id: "3"},
+	}
+
+	byAgency := staticRoutesByAgency(routes, []string{"metro", "ferry"})
+	if len(byAgency["metro"]) != 1 || len(byAgency["ferry"]) != 0 || len(byAgency) != 2 {
+		t.Errorf("expected only the routes of the given agencies, got %v", byAgency)
+	}
+
+	byAgency = staticRoutesByAgency(routes, []string{"metro"})
+	if len(byAgency["metro"]) != 3 {
+		t.Errorf("expected a single agency to get every route, got %v", byAgency)
+	}
+}
+
+func TestCheckRouteConsistency(t *testing.T) {
+	var list []string
+	for i := 0; i < maxRouteDiscrepancySeries+10; i++ {
+		list = append(list, fmt.Sprintf(`{"id":"40_extra-%03d","agencyId":"40","shortName":"X","type":3}`, i))
+	}
+	list = append(list, `{"id":"40_1","agencyId":"40","shortName":"1","type":3}`)
+	ts := setupObaServer(t, `{"code":200,"currentTime":1234567890000,"text":"OK","version":2,"data":{"list":[`+strings.Join(list, ",")+`]}}`, http.StatusOK)
+	defer ts.Close()
+
+	server := createTestServer(ts.URL, "Test Server", 990, "test-key", "http://example.com", "", "", "40")
+	defer Series.DeleteServer(server.ID)
+
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(server.ID, &models.StaticData{Routes: []remoteGtfs.Route{
+		{Id: "1", ShortName: "1", Type: remoteGtfs.RouteType(3)},
+		{Id: "2", ShortName: "2", Type: remoteGtfs.RouteType(3)},
+	}})
+
+	if err := checkRouteConsistency(context.Background(), staticStore, server); err != nil {
+		t.Fatalf("checkRouteConsistency failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(RoutesMissing.WithLabelValues("40", "990")); got != 1 {
+		t.Errorf("expected 1 missing route, got %v", got)
+	}
+	if got := testutil.ToFloat64(RoutesExtra.WithLabelValues("40", "990")); got != float64(maxRouteDiscrepancySeries+10) {
+		t.Errorf("expected every extra route to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(RoutesMismatched.WithLabelValues("40", routeShortName, "990")); got != 0 {
+		t.Errorf("expected no mismatched route, got %v", got)
+	}
+	if got := testutil.ToFloat64(RouteDiscrepancyInfo.WithLabelValues("40", "2", routeMissing, "990")); got != 1 {
+		t.Errorf("expected the missing route to be exported, got %v", got)
+	}
+	if got := testutil.CollectAndCount(RouteDiscrepancyInfo); got != maxRouteDiscrepancySeries {
+		t.Errorf("expected the route discrepancy series to be capped at %d, got %d", maxRouteDiscrepancySeries, got)
+	}
+
+	t.Run("No bundle", func(t *testing.T) {
+		if err := checkRouteConsistency(context.Background(), gtfs.NewStaticStore(), server); err == nil {
+			t.Error("expected an error without a static bundle")
+		}
+	})
+}
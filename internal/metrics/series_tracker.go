@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EntitySeriesTTL is how long a series labeled by a short-lived entity (vehicle, stop, cluster, agency)
+// keeps being exported after it was last written. Such entities routinely disappear (a vehicle leaves
+// service, a stop becomes matched), and nothing else would ever remove their series.
+const EntitySeriesTTL = 10 * time.Minute
+
+// SeriesVec is implemented by every Prometheus metric vector (GaugeVec, CounterVec, HistogramVec).
+type SeriesVec interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// seriesKey identifies a single exported series: a metric vector and one set of label values.
+type seriesKey struct {
+	vec    SeriesVec
+	labels string
+}
+
+// trackedSeries records which server a series belongs to and when it was last written.
+type trackedSeries struct {
+	labelValues []string
+	serverID    int
+	lastWrite   time.Time
+}
+
+// SeriesTracker manages the lifecycle of per-server Prometheus series.
+//
+// Prometheus vectors keep exporting every label set ever written until it is explicitly deleted,
+// so a vehicle that left service or a server dropped from the configuration would otherwise keep
+// exporting its last value forever, making dashboards lie and cardinality grow without bound.
+//
+// Every write of a per-server series goes through the tracker (see Gauge, Counter and Observer),
+// which records the label values, the owning server and the time of the write. Then:
+//   - Sweep deletes the series of vectors that have a TTL and were not written within that TTL.
+//   - DeleteServer deletes every series written for a server, whatever its TTL.
+//
+// Vectors without a TTL (the default) hold server-level state, such as the API status, and are only
+// deleted when their server is removed. Vectors labeled by short-lived entities are given a TTL.
+//
+// All methods are safe for concurrent use.
+type SeriesTracker struct {
+	mu     sync.Mutex
+	ttls   map[SeriesVec]time.Duration
+	series map[seriesKey]*trackedSeries
+}
+
+// NewSeriesTracker creates and returns a new empty SeriesTracker.
+func NewSeriesTracker() *SeriesTracker {
+	return &SeriesTracker{
+		ttls:   make(map[SeriesVec]time.Duration),
+		series: make(map[seriesKey]*trackedSeries),
+	}
+}
+
+// Series is the tracker used for every per-server metric defined in this package.
+var Series = newDefaultSeriesTracker()
+
+// newDefaultSeriesTracker creates the package tracker and assigns EntitySeriesTTL to the vectors
+// labeled by vehicles, stops, clusters and agencies.
+func newDefaultSeriesTracker() *SeriesTracker {
+	tracker := NewSeriesTracker()
+	for _, vec := range []SeriesVec{
+		VehicleReportInterval,
+		VehicleReportCount,
+		VehicleUpdatePeriod,
+		VehicleSpeedGauge,
+		VehicleSpeedDiscrepancyRatioGauge,
+		ObaUnmatchedStopInfo,
+		UnmatchedStopClusterCount,
+		ObaRealtimeRecords,
+		ObaRealtimeTripsMatched,
+		ObaRealtimeTripsUnmatched,
+		ObaScheduledTrips,
+		ObaStopsMatched,
+		ObaStopsUnmatched,
+		TripMatchRatio,
+		StopMatchRatio,
+		ObaTimeSinceUpdate,
+		AgencyMissingFromCoverage,
+		AgencyExtraInCoverage,
+		AgencyAttributeMismatch,
+		AgencyCoverageInBounds,
+		RoutesInStaticGtfs,
+		RoutesInAPI,
+		RoutesMissing,
+		RoutesExtra,
+		RoutesMismatched,
+		RouteDiscrepancyInfo,
+	} {
+		tracker.SetTTL(vec, EntitySeriesTTL)
+	}
+	return tracker
+}
+
+// SetTTL sets how long the series of the given vector are kept after their last write.
+// A TTL of zero or less keeps them until their server is deleted.
+func (t *SeriesTracker) SetTTL(vec SeriesVec, ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ttls[vec] = ttl
+}
+
+// Gauge records a write of the series and returns the gauge for the given label values.
+//
+// Usage:
+//
+//	metrics.Series.Gauge(VehicleReportInterval, server.ID, vehicleID, strconv.Itoa(server.ID)).Set(interval)
+func (t *SeriesTracker) Gauge(vec *prometheus.GaugeVec, serverID int, labelValues ...string) prometheus.Gauge {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.touch(vec, serverID, labelValues)
+	return vec.WithLabelValues(labelValues...)
+}
+
+// ExclusiveGauge is like Gauge, but first deletes every other series of the vector written for
+// the same server. It is meant for info-style metrics whose labels carry a value (such as a hash),
+// so that a server only ever exports the series of its current value.
+func (t *SeriesTracker) ExclusiveGauge(vec *prometheus.GaugeVec, serverID int, labelValues ...string) prometheus.Gauge {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	labels := strings.Join(labelValues, "\xff")
+	for key, series := range t.series {
+		if key.vec != SeriesVec(vec) || series.serverID != serverID || key.labels == labels {
+			continue
+		}
+		vec.DeleteLabelValues(series.labelValues...)
+		delete(t.series, key)
+	}
+	t.touch(vec, serverID, labelValues)
+	TrackedSeries.Set(float64(len(t.series)))
+	return vec.WithLabelValues(labelValues...)
+}
+
+// Counter records a write of the series and returns the counter for the given label values.
+func (t *SeriesTracker) Counter(vec *prometheus.CounterVec, serverID int, labelValues ...string) prometheus.Counter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.touch(vec, serverID, labelValues)
+	return vec.WithLabelValues(labelValues...)
+}
+
+// Observer records a write of the series and returns the histogram observer for the given label values.
+func (t *SeriesTracker) Observer(vec *prometheus.HistogramVec, serverID int, labelValues ...string) prometheus.Observer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.touch(vec, serverID, labelValues)
+	return vec.WithLabelValues(labelValues...)
+}
+
+// touch records a write of the series. The caller must hold t.mu.
+//
+// The series itself is created by the caller while still holding the lock, so that a concurrent
+// Sweep or DeleteServer never deletes a series between its registration and its creation.
+func (t *SeriesTracker) touch(vec SeriesVec, serverID int, labelValues []string) {
+	key := seriesKey{vec: vec, labels: strings.Join(labelValues, "\xff")}
+	if series, ok := t.series[key]; ok {
+		series.lastWrite = time.Now()
+		return
+	}
+	t.series[key] = &trackedSeries{
+		labelValues: append([]string(nil), labelValues...),
+		serverID:    serverID,
+		lastWrite:   time.Now(),
+	}
+	TrackedSeries.Set(float64(len(t.series)))
+}
+
+// Sweep deletes every series whose vector has a TTL and that was not written within that TTL of now.
+// It returns the number of deleted series.
+func (t *SeriesTracker) Sweep(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deleted := 0
+	for key, series := range t.series {
+		ttl := t.ttls[key.vec]
+		if ttl <= 0 || now.Sub(series.lastWrite) <= ttl {
+			continue
+		}
+		key.vec.DeleteLabelValues(series.labelValues...)
+		delete(t.series, key)
+		deleted++
+	}
+	ExpiredSeries.Add(float64(deleted))
+	TrackedSeries.Set(float64(len(t.series)))
+	return deleted
+}
+
+// DeleteServer deletes every series written for the given server and returns how many were deleted.
+// It is used when a server is removed from the configuration.
+func (t *SeriesTracker) DeleteServer(serverID int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deleted := 0
+	for key, series := range t.series {
+		if series.serverID != serverID {
+			continue
+		}
+		key.vec.DeleteLabelValues(series.labelValues...)
+		delete(t.series, key)
+		deleted++
+	}
+	TrackedSeries.Set(float64(len(t.series)))
+	return deleted
+}
+
+// Len returns the number of tracked series.
+func (t *SeriesTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.series)
+}
+
+// SweepRoutine runs a background process that periodically deletes expired series.
+//
+// ctx: Context for canceling the routine.
+// interval: Interval at which expired series are swept.
+func (t *SeriesTracker) SweepRoutine(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.Sweep(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSeriesTracker(t *testing.T) {
+	newVecs := func() (*prometheus.GaugeVec, *prometheus.GaugeVec) {
+		status := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_status"}, []string{"server_id"})
+		vehicles := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_vehicle"}, []string{"vehicle_id", "server_id"})
+		return status, vehicles
+	}
+
+	t.Run("Sweep deletes series not refreshed within their TTL", func(t *testing.T) {
+		status, vehicles := newVecs()
+		tracker := NewSeriesTracker()
+		tracker.SetTTL(vehicles, time.Minute)
+
+		tracker.Gauge(status, 1, "1").Set(1)
+		tracker.Gauge(vehicles, 1, "bus-1", "1").Set(30)
+		tracker.Gauge(vehicles, 1, "bus-2", "1").Set(45)
+
+		if deleted := tracker.Sweep(time.Now()); deleted != 0 {
+			t.Fatalf("expected no series to expire yet, got %d", deleted)
+		}
+
+		if deleted := tracker.Sweep(time.Now().Add(2 * time.Minute)); deleted != 2 {
+			t.Errorf("expected 2 expired vehicle series, got %d", deleted)
+		}
+		if count := testutil.CollectAndCount(vehicles); count != 0 {
+			t.Errorf("expected vehicle series to be deleted, got %d", count)
+		}
+		if count := testutil.CollectAndCount(status); count != 1 {
+			t.Errorf("expected series without TTL to be kept, got %d", count)
+		}
+	})
+
+	t.Run("Refreshed series are kept", func(t *testing.T) {
+		_, vehicles := newVecs()
+		tracker := NewSeriesTracker()
+		tracker.SetTTL(vehicles, 50*time.Millisecond)
+
+		tracker.Gauge(vehicles, 1, "bus-1", "1").Set(30)
+		time.Sleep(60 * time.Millisecond)
+		tracker.Gauge(vehicles, 1, "bus-1", "1").Set(35)
+
+		if deleted := tracker.Sweep(time.Now()); deleted != 0 {
+			t.Errorf("expected refreshed series to be kept, got %d deleted", deleted)
+		}
+	})
+
+	t.Run("DeleteServer deletes every series of the server", func(t *testing.T) {
+		status, vehicles := newVecs()
+		tracker := NewSeriesTracker()
+		tracker.SetTTL(vehicles, time.Minute)
+
+		tracker.Gauge(status, 1, "1").Set(1)
+		tracker.Gauge(vehicles, 1, "bus-1", "1").Set(30)
+		tracker.Gauge(status, 2, "2").Set(1)
+
+		if deleted := tracker.DeleteServer(1); deleted != 2 {
+			t.Errorf("expected 2 deleted series, got %d", deleted)
+		}
+		if count := testutil.CollectAndCount(status); count != 1 {
+			t.Errorf("expected only the other server's series to remain, got %d", count)
+		}
+		if tracker.Len() != 1 {
+			t.Errorf("expected 1 tracked series, got %d", tracker.Len())
+		}
+	})
+}
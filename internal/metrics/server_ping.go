@@ -20,17 +20,17 @@ import (
 // Errors (such as failed requests or invalid responses) are reported to Sentry with server context.
 //
 // Parameters:
+//   - ctx: the context of the collection run; canceling it aborts the request.
 //   - server: a models.ObaServer object containing the base URL, API key, and server ID.
 //
 // Returns:
 //   - None (side effects include reporting to Prometheus and Sentry).
-func serverPing(server models.ObaServer) bool {
+func serverPing(ctx context.Context, server models.ObaServer) bool {
 	client := onebusaway.NewClient(
 		option.WithAPIKey(server.ObaApiKey),
 		option.WithBaseURL(server.ObaBaseURL),
 	)
 
-	ctx := context.Background()
 	response, err := client.CurrentTime.Get(ctx)
 
 	if err != nil {
@@ -42,7 +42,7 @@ func serverPing(server models.ObaServer) bool {
 			},
 		})
 		// Update status metric
-		ObaApiStatus.WithLabelValues(
+		Series.Gauge(ObaApiStatus, server.ID,
 			strconv.Itoa(server.ID),
 			server.ObaBaseURL,
 		).Set(0)
@@ -51,13 +51,13 @@ func serverPing(server models.ObaServer) bool {
 
 	// Check response validity
 	if response.Data.Entry.ReadableTime != "" {
-		ObaApiStatus.WithLabelValues(
+		Series.Gauge(ObaApiStatus, server.ID,
 			strconv.Itoa(server.ID),
 			server.ObaBaseURL,
 		).Set(1)
 		return true
 	}
-	ObaApiStatus.WithLabelValues(
+	Series.Gauge(ObaApiStatus, server.ID,
 		strconv.Itoa(server.ID),
 		server.ObaBaseURL,
 	).Set(0)
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+	"watchdog.onebusaway.org/internal/report"
+	"watchdog.onebusaway.org/internal/utils"
+)
+
+// Informed entity types, as used in the `entity` label of ServiceAlertsOrphaned.
+const (
+	alertEntityRoute = "route"
+	alertEntityStop  = "stop"
+	alertEntityTrip  = "trip"
+)
+
+// serviceAlertStats summarizes the alerts of a GTFS-RT Service Alerts feed.
+type serviceAlertStats struct {
+	active   int
+	expired  int
+	orphaned map[string]int // Alerts with at least one missing reference, by informed entity type
+}
+
+// trackServiceAlerts exports the state of the GTFS-RT Service Alerts feed of a server.
+//
+// Stale and orphaned alerts are a frequent rider complaint: an alert about a detour that ended
+// last week, or about a stop that no longer exists, erodes trust in every other alert.
+// For the latest fresh snapshot (see RealtimeStore.GetFresh), it exports:
+//   - ServiceAlertsActive: alerts active at now. An alert without active periods is always active.
+//   - ServiceAlertsExpired: alerts still published although every one of their active periods has ended.
+//   - ServiceAlertsOrphaned: alerts informing a route, stop or trip ID that does not exist in the
+//     server's GTFS static bundle, by entity type. An alert is counted once per entity type,
+//     however many of its references are missing.
+//
+// Returns an error if the alerts snapshot or the static bundle of the server is missing.
+func trackServiceAlerts(server models.ObaServer, alertsStore *gtfs.RealtimeStore, staticStore *gtfs.StaticStore, now time.Time) error {
+	if alertsStore == nil {
+		return fmt.Errorf("alertsStore is nil for server %d", server.ID)
+	}
+	snapshot, err := alertsStore.GetFresh(server.ID, now)
+	if err != nil {
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+			ExtraContext: map[string]interface{}{
+				"alerts_url": server.AlertsUrl,
+			},
+		})
+		return err
+	}
+
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return fmt.Errorf("no GTFS static data found for server ID %d", server.ID)
+	}
+
+	stats := summarizeServiceAlerts(snapshot.Data.Alerts, staticData, now)
+
+	serverID := strconv.Itoa(server.ID)
+	Series.Gauge(ServiceAlertsActive, server.ID, serverID).Set(float64(stats.active))
+	Series.Gauge(ServiceAlertsExpired, server.ID, serverID).Set(float64(stats.expired))
+	for _, entity := range []string{alertEntityRoute, alertEntityStop, alertEntityTrip} {
+		Series.Gauge(ServiceAlertsOrphaned, server.ID, serverID, entity).Set(float64(stats.orphaned[entity]))
+	}
+	return nil
+}
+
+// summarizeServiceAlerts counts the active, expired and orphaned alerts at now.
+func summarizeServiceAlerts(alerts []remoteGtfs.Alert, staticData *models.StaticData, now time.Time) serviceAlertStats {
+	stopIDs := make(map[string]struct{}, len(staticData.Stops))
+	for _, stop := range staticData.Stops {
+		stopIDs[stop.Id] = struct{}{}
+	}
+
+	stats := serviceAlertStats{orphaned: make(map[string]int)}
+	for _, alert := range alerts {
+		if alertActiveAt(alert, now) {
+			stats.active++
+		} else if alertExpiredAt(alert, now) {
+			stats.expired++
+		}
+
+		for entity := range orphanedAlertEntities(alert, staticData, stopIDs) {
+			stats.orphaned[entity]++
+		}
+	}
+	return stats
+}
+
+// alertActiveAt reports whether the alert is active at now.
+// Per the GTFS-RT specification, an alert without active periods is always active.
+func alertActiveAt(alert remoteGtfs.Alert, now time.Time) bool {
+	if len(alert.ActivePeriods) == 0 {
+		return true
+	}
+	for _, period := range alert.ActivePeriods {
+		started := period.StartsAt == nil || !now.Before(*period.StartsAt)
+		ended := period.EndsAt != nil && !now.Before(*period.EndsAt)
+		if started && !ended {
+			return true
+		}
+	}
+	return false
+}
+
+// alertExpiredAt reports whether every active period of the alert has ended at now.
+// An alert without active periods, or with an open-ended period, never expires.
+func alertExpiredAt(alert remoteGtfs.Alert, now time.Time) bool {
+	if len(alert.ActivePeriods) == 0 {
+		return false
+	}
+	for _, period := range alert.ActivePeriods {
+		if period.EndsAt == nil || now.Before(*period.EndsAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// orphanedAlertEntities returns the entity types for which the alert references an ID
+// missing from the static bundle. stopIDs holds the stop IDs of the bundle.
+func orphanedAlertEntities(alert remoteGtfs.Alert, staticData *models.StaticData, stopIDs map[string]struct{}) map[string]struct{} {
+	orphaned := make(map[string]struct{})
+	for _, entity := range alert.InformedEntities {
+		if entity.RouteID != nil && *entity.RouteID != "" {
+			if _, exists := staticData.RoutesByID[*entity.RouteID]; !exists {
+				orphaned[alertEntityRoute] = struct{}{}
+			}
+		}
+		if entity.StopID != nil && *entity.StopID != "" {
+			if _, exists := stopIDs[*entity.StopID]; !exists {
+				orphaned[alertEntityStop] = struct{}{}
+			}
+		}
+		if entity.TripID != nil {
+			if entity.TripID.ID != "" {
+				if _, exists := staticData.Trip(entity.TripID.ID); !exists {
+					orphaned[alertEntityTrip] = struct{}{}
+				}
+			}
+			if entity.TripID.RouteID != "" {
+				if _, exists := staticData.RoutesByID[entity.TripID.RouteID]; !exists {
+					orphaned[alertEntityRoute] = struct{}{}
+				}
+			}
+		}
+	}
+	return orphaned
+}
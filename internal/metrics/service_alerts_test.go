@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestSummarizeServiceAlerts(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	staticData := &models.StaticData{
+		Routes: []remoteGtfs.Route{{Id: "route-1"}},
+		Stops:  []remoteGtfs.Stop{{Id: "stop-1"}},
+		Trips:  []models.TripSummary{{ID: "trip-1", RouteID: "route-1"}},
+	}
+	staticData.BuildIndexes()
+	alerts := []remoteGtfs.Alert{
+		{ID: "no-period", InformedEntities: []remoteGtfs.AlertInformedEntity{{RouteID: stringPtr("route-1")}}},
+		{ID: "current", ActivePeriods: []remoteGtfs.AlertActivePeriod{{StartsAt: timePtr(now.Add(-time.Hour)), EndsAt: timePtr(now.Add(time.Hour))}}},
+		{ID: "future", ActivePeriods: []remoteGtfs.AlertActivePeriod{{StartsAt: timePtr(now.Add(time.Hour))}}},
+		{ID: "expired", ActivePeriods: []remoteGtfs.AlertActivePeriod{
+			{EndsAt: timePtr(now.Add(-48 * time.Hour))},
+			{StartsAt: timePtr(now.Add(-24 * time.Hour)), EndsAt: timePtr(now.Add(-time.Hour))},
+		}},
+		{ID: "orphaned", InformedEntities: []remoteGtfs.AlertInformedEntity{
+			{RouteID: stringPtr("missing-route")},
+			{StopID: stringPtr("missing-stop-1")},
+			{StopID: stringPtr("missing-stop-2")},
+			{TripID: &remoteGtfs.TripID{ID: "missing-trip", RouteID: "route-1"}},
+		}},
+		{ID: "orphaned-trip-route", InformedEntities: []remoteGtfs.AlertInformedEntity{
+			{TripID: &remoteGtfs.TripID{ID: "trip-1", RouteID: "missing-route"}},
+			{StopID: stringPtr("stop-1")},
+		}},
+	}
+
+	stats := summarizeServiceAlerts(alerts, staticData, now)
+
+	if stats.active != 4 {
+		t.Errorf("expected 4 active alerts, got %d", stats.active)
+	}
+	if stats.expired != 1 {
+		t.Errorf("expected 1 expired alert, got %d", stats.expired)
+	}
+	expectedOrphaned := map[string]int{alertEntityRoute: 2, alertEntityStop: 1, alertEntityTrip: 1}
+	for entity, expected := range expectedOrphaned {
+		if stats.orphaned[entity] != expected {
+			t.Errorf("expected %d alerts with an orphaned %s, got %d", expected, entity, stats.orphaned[entity])
+		}
+	}
+}
+
+func TestTrackServiceAlerts(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 996, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	defer Series.DeleteServer(server.ID)
+
+	now := time.Now().UTC()
+	staticStore := gtfs.NewStaticStore()
+	alertsStore := gtfs.NewRealtimeStore(time.Minute)
+
+	if err := trackServiceAlerts(server, alertsStore, staticStore, now); err == nil {
+		t.Fatal("expected an error when no alerts snapshot is stored")
+	}
+
+	alertsStore.Set(server.ID, &gtfs.RealtimeSnapshot{
+		Data: &models.RealtimeData{Alerts: []remoteGtfs.Alert{
+			{ID: "active", InformedEntities: []remoteGtfs.AlertInformedEntity{{StopID: stringPtr("missing-stop")}}},
+			{ID: "expired", ActivePeriods: []remoteGtfs.AlertActivePeriod{{EndsAt: timePtr(now.Add(-time.Hour))}}},
+		}},
+		FetchedAt: now,
+	})
+	staticStore.Set(server.ID, &models.StaticData{})
+	if err := trackServiceAlerts(server, alertsStore, staticStore, now); err != nil {
+		t.Fatalf("trackServiceAlerts failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(ServiceAlertsActive.WithLabelValues("996")); got != 1 {
+		t.Errorf("expected 1 active alert, got %v", got)
+	}
+	if got := testutil.ToFloat64(ServiceAlertsExpired.WithLabelValues("996")); got != 1 {
+		t.Errorf("expected 1 expired alert, got %v", got)
+	}
+	if got := testutil.ToFloat64(ServiceAlertsOrphaned.WithLabelValues("996", alertEntityStop)); got != 1 {
+		t.Errorf("expected 1 alert with an orphaned stop, got %v", got)
+	}
+	if got := testutil.ToFloat64(ServiceAlertsOrphaned.WithLabelValues("996", alertEntityRoute)); got != 0 {
+		t.Errorf("expected no alert with an orphaned route, got %v", got)
+	}
+}
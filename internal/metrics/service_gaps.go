@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// DefaultServiceGapLookaheadDays is the look-ahead window used when no positive window is configured.
+const DefaultServiceGapLookaheadDays = 14
+
+// checkServiceGaps detects upcoming days without any active service ("service cliffs")
+// in the GTFS static bundle of a server.
+//
+// The days-until-expiration gauges (see checkBundleExpiration) do not catch a bundle that runs
+// until next year but has no active service on some date next week, for example after a botched
+// holiday removal in calendar_dates.txt. This check expands calendar.txt and calendar_dates.txt
+// over the next lookaheadDays service dates (see gtfs.ExpandServiceCalendar) and exports:
+//   - ServiceGapDays: the number of days in the window without any active service.
+//   - ServiceGapFirstDate: the first of these days, as a Unix timestamp (midnight UTC of the
+//     service date), or 0 when there is none.
+//   - ActiveServicesByDay: the number of active service IDs on each day, labeled by the number
+//     of days ahead of today (0 is today).
+//
+// A non-positive lookaheadDays uses DefaultServiceGapLookaheadDays.
+//
+// Returns the number of days without service, or an error if no static data is stored for the server.
+func checkServiceGaps(staticStore *gtfs.StaticStore, now time.Time, server models.ObaServer, lookaheadDays int) (int, error) {
+	if lookaheadDays <= 0 {
+		lookaheadDays = DefaultServiceGapLookaheadDays
+	}
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return 0, fmt.Errorf("there is no bundle for server %v", server.ID)
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	gapDays := 0
+	var firstGap time.Time
+	for i, day := range gtfs.ExpandServiceCalendar(staticData, now, lookaheadDays) {
+		Series.Gauge(ActiveServicesByDay, server.ID, serverID, strconv.Itoa(i)).Set(float64(day.ActiveServices))
+		if day.ActiveServices > 0 {
+			continue
+		}
+		if gapDays == 0 {
+			firstGap = day.Date
+		}
+		gapDays++
+	}
+
+	Series.Gauge(ServiceGapDays, server.ID, serverID).Set(float64(gapDays))
+	if firstGap.IsZero() {
+		Series.Gauge(ServiceGapFirstDate, server.ID, serverID).Set(0)
+	} else {
+		Series.Gauge(ServiceGapFirstDate, server.ID, serverID).Set(float64(firstGap.Unix()))
+	}
+	return gapDays, nil
+}
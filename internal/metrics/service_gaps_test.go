@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestCheckServiceGaps(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 996, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	staticStore := gtfs.NewStaticStore()
+	defer Series.DeleteServer(server.ID)
+
+	if _, err := checkServiceGaps(staticStore, time.Now(), server, 7); err == nil {
+		t.Fatal("expected an error when no bundle is stored")
+	}
+
+	// Daily service through 2025-01-31, with a botched removal of 2025-01-08.
+	staticStore.Set(server.ID, &models.StaticData{
+		Services: []remoteGtfs.Service{{
+			Id:     "daily",
+			Monday: true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true, Saturday: true, Sunday: true,
+			StartDate:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:      time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+			RemovedDates: []time.Time{time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)},
+		}},
+	})
+
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC)
+	gapDays, err := checkServiceGaps(staticStore, now, server, 7)
+	if err != nil {
+		t.Fatalf("checkServiceGaps failed: %v", err)
+	}
+	if gapDays != 1 {
+		t.Errorf("expected 1 day without service, got %d", gapDays)
+	}
+	if got := testutil.ToFloat64(ServiceGapDays.WithLabelValues("996")); got != 1 {
+		t.Errorf("expected gap days metric to be 1, got %v", got)
+	}
+	firstGap := time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC)
+	if got := testutil.ToFloat64(ServiceGapFirstDate.WithLabelValues("996")); got != float64(firstGap.Unix()) {
+		t.Errorf("expected first gap date %d, got %v", firstGap.Unix(), got)
+	}
+	if got := testutil.ToFloat64(ActiveServicesByDay.WithLabelValues("996", "0")); got != 1 {
+		t.Errorf("expected 1 active service today, got %v", got)
+	}
+	if got := testutil.ToFloat64(ActiveServicesByDay.WithLabelValues("996", "2")); got != 0 {
+		t.Errorf("expected no active service 2 days ahead, got %v", got)
+	}
+
+	// The window ends before the gap.
+	if gapDays, err := checkServiceGaps(staticStore, now, server, 2); err != nil || gapDays != 0 {
+		t.Fatalf("expected no gap within 2 days, got %d (err: %v)", gapDays, err)
+	}
+	if got := testutil.ToFloat64(ServiceGapFirstDate.WithLabelValues("996")); got != 0 {
+		t.Errorf("expected first gap date to be reset to 0, got %v", got)
+	}
+}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	onebusaway "github.com/OneBusAway/go-sdk"
+	"github.com/OneBusAway/go-sdk/option"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// DefaultArrivalsSampleSize is the number of stops probed on each run of the stop arrivals check
+// when no positive sample size is configured.
+const DefaultArrivalsSampleSize = 5
+
+// arrivalsServiceWindow is how far ahead a stop must be scheduled to have service to count as in
+// service. It matches the default window of `arrivals-and-departures-for-stop` (35 minutes after now).
+const arrivalsServiceWindow = 35 * time.Minute
+
+// arrivalsInServiceShare is the share of the sample drawn from the stops in service; the rest is
+// drawn from the other stops, so that stops the schedule says are idle are still probed now and then.
+const arrivalsInServiceShare = 0.75
+
+// Results of a probe, as exported in the `result` label of ArrivalsProbeRequests.
+const (
+	arrivalsError     = "error"       // The request failed
+	arrivalsNone      = "no_arrivals" // The response lists no arrival
+	arrivalsScheduled = "scheduled"   // The response lists arrivals, none with a real-time prediction
+	arrivalsPredicted = "predicted"   // At least one arrival has a real-time prediction
+)
+
+// probeStopArrivals measures what riders see, rather than whether the server answers: it calls the
+// OBA `arrivals-and-departures-for-stop` endpoint for a random sample of the server's stops and
+// records the outcome of each call.
+//
+// On each run, up to sampleSize boardable stops (see boardableStops) are drawn at random, three
+// quarters of them among the stops scheduled to have service within arrivalsServiceWindow (see
+// gtfs.StopsInService), so that a healthy server is expected to return arrivals for most of them.
+// Drawing a new sample on every run rotates the probes over the whole network.
+//
+// It exports:
+//   - ArrivalsProbeDuration: the latency of each call, failed or not.
+//   - ArrivalsProbeRequests: the number of calls by result (error, no_arrivals, scheduled, predicted).
+//   - ArrivalsProbeErrorRatio: the share of the calls of the run that failed.
+//   - ArrivalsProbeArrivalsRatio and ArrivalsProbePredictionsRatio: among the successful calls of
+//     the run, the share with at least one arrival, and with at least one real-time prediction.
+//
+// Stop IDs are prefixed with the server's stop agency (see stopAgencyID).
+// A non-positive sampleSize uses DefaultArrivalsSampleSize.
+//
+// Returns an error if no static data is stored for the server, or if every call of the run failed.
+func probeStopArrivals(ctx context.Context, staticStore *gtfs.StaticStore, logger *slog.Logger, server models.ObaServer, now time.Time, sampleSize int) error {
+	if sampleSize <= 0 {
+		sampleSize = DefaultArrivalsSampleSize
+	}
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return fmt.Errorf("there is no bundle for server %v", server.ID)
+	}
+
+	client := onebusaway.NewClient(
+		option.WithAPIKey(server.ObaApiKey),
+		option.WithBaseURL(server.ObaBaseURL),
+	)
+
+	serverID := strconv.Itoa(server.ID)
+	agencyID := stopAgencyID(server, staticData)
+	results := map[string]int{arrivalsError: 0, arrivalsNone: 0, arrivalsScheduled: 0, arrivalsPredicted: 0}
+	var errs []error
+
+	stops := sampleArrivalStops(staticData, now, sampleSize)
+	for _, stop := range stops {
+		start := time.Now()
+		result, err := probeStop(ctx, client, obaEntityID(agencyID, stop.Id))
+		Series.Observer(ArrivalsProbeDuration, server.ID, serverID).Observe(time.Since(start).Seconds())
+		Series.Counter(ArrivalsProbeRequests, server.ID, serverID, result).Inc()
+		results[result]++
+		if err != nil {
+			errs = append(errs, err)
+			logger.Debug("Stop arrivals probe failed", "server_id", server.ID, "stop_id", stop.Id, "error", err)
+		}
+	}
+
+	successful := len(stops) - results[arrivalsError]
+	errorRatio, arrivalsRatio, predictionsRatio := 0.0, 0.0, 0.0
+	if len(stops) > 0 {
+		errorRatio = float64(results[arrivalsError]) / float64(len(stops))
+	}
+	if successful > 0 {
+		arrivalsRatio = float64(results[arrivalsScheduled]+results[arrivalsPredicted]) / float64(successful)
+		predictionsRatio = float64(results[arrivalsPredicted]) / float64(successful)
+	}
+	Series.Gauge(ArrivalsProbeErrorRatio, server.ID, serverID).Set(errorRatio)
+	Series.Gauge(ArrivalsProbeArrivalsRatio, server.ID, serverID).Set(arrivalsRatio)
+	Series.Gauge(ArrivalsProbePredictionsRatio, server.ID, serverID).Set(predictionsRatio)
+
+	if len(stops) > 0 && successful == 0 {
+		return fmt.Errorf("every stop arrivals probe failed for server %d: %w", server.ID, errors.Join(errs...))
+	}
+	return nil
+}
+
+// probeStop calls `arrivals-and-departures-for-stop` for a stop and classifies the response.
+func probeStop(ctx context.Context, client *onebusaway.Client, obaStopID string) (string, error) {
+	response, err := client.ArrivalAndDeparture.List(ctx, obaStopID, onebusaway.ArrivalAndDepartureListParams{})
+	if err != nil {
+		return arrivalsError, fmt.Errorf("failed to get arrivals of stop %s: %w", obaStopID, err)
+	}
+	if response == nil || len(response.Data.Entry.ArrivalsAndDepartures) == 0 {
+		return arrivalsNone, nil
+	}
+	for _, arrival := range response.Data.Entry.ArrivalsAndDepartures {
+		if arrival.Predicted || arrival.PredictedArrivalTime > 0 || arrival.PredictedDepartureTime > 0 {
+			return arrivalsPredicted, nil
+		}
+	}
+	return arrivalsScheduled, nil
+}
+
+// sampleArrivalStops draws up to n random boardable stops, arrivalsInServiceShare of them (rounded
+// up) among the stops in service at now, and the rest among the other stops. When there are not
+// enough stops on one side, the sample is completed from the other.
+func sampleArrivalStops(staticData *models.StaticData, now time.Time, n int) []remoteGtfs.Stop {
+	inService := gtfs.StopsInService(staticData, now, arrivalsServiceWindow)
+	var active, idle []remoteGtfs.Stop
+	for _, stop := range boardableStops(staticData.Stops) {
+		if inService[stop.Id] {
+			active = append(active, stop)
+		} else {
+			idle = append(idle, stop)
+		}
+	}
+
+	activeCount := int(math.Ceil(float64(n) * arrivalsInServiceShare))
+	if activeCount > len(active) {
+		activeCount = len(active)
+	}
+	idleCount := n - activeCount
+	if idleCount > len(idle) {
+		idleCount = len(idle)
+		activeCount = min(n-idleCount, len(active))
+	}
+	return append(sample(active, activeCount), sample(idle, idleCount)...)
+}
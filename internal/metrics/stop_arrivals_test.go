@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// newArrivalsStaticData returns a bundle whose "busy-*" stops have service all day on every day,
+// and whose "idle-*" stops have none.
+func newArrivalsStaticData(busy, idle []string) *models.StaticData {
+	lat, lon := 47.6, -122.3
+	staticData := &models.StaticData{
+		Agencies: []remoteGtfs.Agency{{Id: "40", Timezone: "America/Los_Angeles"}},
+		Services: []remoteGtfs.Service{{
+			Id:     "daily",
+			Monday: true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true, Saturday: true, Sunday: true,
+			StartDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+		}},
+		StopServices: make(map[string][]models.StopServiceSpan),
+	}
+	for _, id := range busy {
+		staticData.Stops = append(staticData.Stops, remoteGtfs.Stop{Id: id, Latitude: &lat, Longitude: &lon})
+		staticData.StopServices[id] = []models.StopServiceSpan{{ServiceID: "daily", First: 0, Last: 24 * time.Hour}}
+	}
+	for _, id := range idle {
+		staticData.Stops = append(staticData.Stops, remoteGtfs.Stop{Id: id, Latitude: &lat, Longitude: &lon})
+	}
+	return staticData
+}
+
+func TestSampleArrivalStops(t *testing.T) {
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC)
+	staticData := newArrivalsStaticData(
+		[]string{"busy-1", "busy-2", "busy-3", "busy-4", "busy-5"},
+		[]string{"idle-1", "idle-2", "idle-3", "idle-4", "idle-5"},
+	)
+
+	stops := sampleArrivalStops(staticData, now, 4)
+	busy := 0
+	for _, stop := range stops {
+		if stop.Id[:4] == "busy" {
+			busy++
+		}
+	}
+	if len(stops) != 4 || busy != 3 {
+		t.Errorf("expected 3 stops in service out of 4, got %d out of %d", busy, len(stops))
+	}
+
+	// Without enough stops in service, the sample is completed with idle stops.
+	staticData = newArrivalsStaticData([]string{"busy-1"}, []string{"idle-1", "idle-2", "idle-3", "idle-4", "idle-5"})
+	if stops := sampleArrivalStops(staticData, now, 4); len(stops) != 4 {
+		t.Errorf("expected the sample to be completed, got %d stops", len(stops))
+	}
+}
+
+func TestProbeStopArrivals(t *testing.T) {
+	responses := map[string]string{
+		"/api/where/arrivals-and-departures-for-stop/40_busy-1.json": `{"code":200,"data":{"entry":{"arrivalsAndDepartures":[{"predicted":true,"predictedArrivalTime":1741636800000}]}}}`,
+		"/api/where/arrivals-and-departures-for-stop/40_busy-2.json": `{"code":200,"data":{"entry":{"arrivalsAndDepartures":[{"predicted":false}]}}}`,
+		"/api/where/arrivals-and-departures-for-stop/40_idle-1.json": `{"code":200,"data":{"entry":{"arrivalsAndDepartures":[]}}}`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			response = `{"code":404,"text":"resource not found"}`
+		}
+		// #nosec G104
+		w.Write([]byte(response))
+	}))
+	defer ts.Close()
+
+	server := createTestServer(ts.URL, "Test Server", 989, "test-key", "http://example.com", "", "", "")
+	defer Series.DeleteServer(server.ID)
+
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(server.ID, newArrivalsStaticData([]string{"busy-1", "busy-2", "busy-3"}, []string{"idle-1"}))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC)
+	if err := probeStopArrivals(context.Background(), staticStore, logger, server, now, 4); err != nil {
+		t.Fatalf("probeStopArrivals failed: %v", err)
+	}
+
+	// busy-3 is unknown to the server, and the 3 other stops answer.
+	if got := testutil.ToFloat64(ArrivalsProbeErrorRatio.WithLabelValues("989")); got != 0.25 {
+		t.Errorf("expected an error ratio of 0.25, got %v", got)
+	}
+	if got := testutil.ToFloat64(ArrivalsProbeArrivalsRatio.WithLabelValues("989")); got < 0.66 || got > 0.67 {
+		t.Errorf("expected 2 of 3 responses with arrivals, got %v", got)
+	}
+	if got := testutil.ToFloat64(ArrivalsProbePredictionsRatio.WithLabelValues("989")); got < 0.33 || got > 0.34 {
+		t.Errorf("expected 1 of 3 responses with predictions, got %v", got)
+	}
+	for result, expected := range map[string]float64{arrivalsError: 1, arrivalsNone: 1, arrivalsScheduled: 1, arrivalsPredicted: 1} {
+		if got := testutil.ToFloat64(ArrivalsProbeRequests.WithLabelValues("989", result)); got != expected {
+			t.Errorf("expected %v %s probes, got %v", expected, result, got)
+		}
+	}
+
+	t.Run("No bundle", func(t *testing.T) {
+		if err := probeStopArrivals(context.Background(), gtfs.NewStaticStore(), logger, server, now, 4); err == nil {
+			t.Error("expected an error without a static bundle")
+		}
+	})
+}
@@ -16,10 +16,11 @@ import (
 // - UnmatchedStopClusterCount: labeled by slug ID, agency ID, cluster ID, and cluster type ("station" or "s2").
 //
 // Parameters:
+// - serverID: the ID of the OBA server the stops belong to, used to track the reported series
 // - slugID: a unique identifier for the server or deployment instance
 // - agencyID: the GTFS agency identifier
 // - unmatchedStops: a map of stop IDs to GTFS stop objects not matched to gtfs static data
-func reportUnmatchedStopClusters(slugID, agencyID string, unmatchedStops map[string]remoteGtfs.Stop) {
+func reportUnmatchedStopClusters(serverID int, slugID, agencyID string, unmatchedStops map[string]remoteGtfs.Stop) {
 	clusterCount := make(map[string]int)
 	clusterType := make(map[string]string) // station or s2
 
@@ -34,6 +35,6 @@ func reportUnmatchedStopClusters(slugID, agencyID string, unmatchedStops map[str
 
 	// Report each cluster to Prometheus
 	for id, count := range clusterCount {
-		UnmatchedStopClusterCount.WithLabelValues(slugID, agencyID, id, clusterType[id]).Set(float64(count))
+		Series.Gauge(UnmatchedStopClusterCount, serverID, slugID, agencyID, id, clusterType[id]).Set(float64(count))
 	}
 }
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+	"watchdog.onebusaway.org/internal/report"
+	"watchdog.onebusaway.org/internal/utils"
+)
+
+// tripUpdateStats summarizes the trip updates of a GTFS-RT TripUpdates feed.
+type tripUpdateStats struct {
+	total        int
+	canceled     int
+	added        int
+	unknownTrips int             // Scheduled trip updates whose trip ID is not in the static bundle
+	delays       []time.Duration // One delay per trip update that predicts one
+}
+
+// trackTripUpdates exports the state of the GTFS-RT TripUpdates feed of a server.
+//
+// The TripUpdates feed drives OBA arrival predictions, so problems in it are directly visible to riders.
+// For the latest fresh snapshot (see RealtimeStore.GetFresh), it exports:
+//   - TripUpdatesCount: the number of trip updates.
+//   - TripUpdateDelay: the delay predicted by each trip update (see tripUpdateDelay), observed once
+//     per fetch, so the histogram describes the distribution of delays over time.
+//   - TripUpdatesUnknownTrips: scheduled trip updates whose trip ID does not exist in the server's
+//     GTFS static bundle. OBA cannot match such updates to a trip, so their predictions are lost.
+//     ADDED trips are not counted, since they are by definition absent from the static bundle.
+//   - TripUpdatesCanceled and TripUpdatesAdded: trip updates with a CANCELED or ADDED schedule relationship.
+//
+// Returns an error if the TripUpdates snapshot or the static bundle of the server is missing.
+func trackTripUpdates(server models.ObaServer, tripUpdatesStore *gtfs.RealtimeStore, staticStore *gtfs.StaticStore) error {
+	if tripUpdatesStore == nil {
+		return fmt.Errorf("tripUpdatesStore is nil for server %d", server.ID)
+	}
+	snapshot, err := tripUpdatesStore.GetFresh(server.ID, time.Now().UTC())
+	if err != nil {
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+			ExtraContext: map[string]interface{}{
+				"trip_update_url": server.TripUpdateUrl,
+			},
+		})
+		return err
+	}
+
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return fmt.Errorf("no GTFS static data found for server ID %d", server.ID)
+	}
+
+	stats := summarizeTripUpdates(snapshot.Data.TripUpdates, staticData)
+
+	serverID := strconv.Itoa(server.ID)
+	Series.Gauge(TripUpdatesCount, server.ID, serverID).Set(float64(stats.total))
+	Series.Gauge(TripUpdatesUnknownTrips, server.ID, serverID).Set(float64(stats.unknownTrips))
+	Series.Gauge(TripUpdatesCanceled, server.ID, serverID).Set(float64(stats.canceled))
+	Series.Gauge(TripUpdatesAdded, server.ID, serverID).Set(float64(stats.added))
+	delayObserver := Series.Observer(TripUpdateDelay, server.ID, serverID)
+	for _, delay := range stats.delays {
+		delayObserver.Observe(delay.Seconds())
+	}
+	return nil
+}
+
+// summarizeTripUpdates counts the trip updates by schedule relationship, the scheduled ones
+// whose trip ID is not in the static bundle, and collects their delays.
+func summarizeTripUpdates(tripUpdates []remoteGtfs.Trip, staticData *models.StaticData) tripUpdateStats {
+	stats := tripUpdateStats{total: len(tripUpdates)}
+	for _, trip := range tripUpdates {
+		switch trip.ID.ScheduleRelationship {
+		case gtfsrt.TripDescriptor_CANCELED:
+			stats.canceled++
+		case gtfsrt.TripDescriptor_ADDED:
+			stats.added++
+		}
+
+		if trip.ID.ScheduleRelationship != gtfsrt.TripDescriptor_ADDED && trip.ID.ID != "" {
+			if _, exists := staticData.Trip(trip.ID.ID); !exists {
+				stats.unknownTrips++
+			}
+		}
+
+		if delay, ok := tripUpdateDelay(trip); ok {
+			stats.delays = append(stats.delays, delay)
+		}
+	}
+	return stats
+}
+
+// tripUpdateDelay returns the delay predicted by a trip update: the trip-level delay when set,
+// otherwise the arrival (or departure) delay of its first stop time update that has one,
+// i.e. the prediction for the next stop. Canceled trips have no meaningful delay.
+func tripUpdateDelay(trip remoteGtfs.Trip) (time.Duration, bool) {
+	if trip.ID.ScheduleRelationship == gtfsrt.TripDescriptor_CANCELED {
+		return 0, false
+	}
+	if trip.Delay != nil {
+		return *trip.Delay, true
+	}
+	for _, update := range trip.StopTimeUpdates {
+		if update.Arrival != nil && update.Arrival.Delay != nil {
+			return *update.Arrival.Delay, true
+		}
+		if update.Departure != nil && update.Departure.Delay != nil {
+			return *update.Departure.Delay, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestSummarizeTripUpdates(t *testing.T) {
+	staticData := &models.StaticData{Trips: []models.TripSummary{
+		{ID: "trip-1", RouteID: "route-1"}, {ID: "trip-2", RouteID: "route-1"}, {ID: "trip-3", RouteID: "route-2"},
+	}}
+	staticData.BuildIndexes()
+	tripUpdates := []remoteGtfs.Trip{
+		{ID: remoteGtfs.TripID{ID: "trip-1"}, Delay: durationPtr(2 * time.Minute)},
+		{ID: remoteGtfs.TripID{ID: "trip-2"}, StopTimeUpdates: []remoteGtfs.StopTimeUpdate{
+			{Arrival: &remoteGtfs.StopTimeEvent{}},
+			{Departure: &remoteGtfs.StopTimeEvent{Delay: durationPtr(-30 * time.Second)}},
+		}},
+		{ID: remoteGtfs.TripID{ID: "trip-3", ScheduleRelationship: gtfsrt.TripDescriptor_CANCELED}, Delay: durationPtr(time.Hour)},
+		{ID: remoteGtfs.TripID{ID: "unknown-trip"}},
+		{ID: remoteGtfs.TripID{ID: "added-trip", ScheduleRelationship: gtfsrt.TripDescriptor_ADDED}, Delay: durationPtr(0)},
+	}
+
+	stats := summarizeTripUpdates(tripUpdates, staticData)
+
+	if stats.total != 5 {
+		t.Errorf("expected 5 trip updates, got %d", stats.total)
+	}
+	if stats.canceled != 1 || stats.added != 1 {
+		t.Errorf("expected 1 canceled and 1 added trip update, got %d and %d", stats.canceled, stats.added)
+	}
+	if stats.unknownTrips != 1 {
+		t.Errorf("expected 1 unknown trip (ADDED trips excluded), got %d", stats.unknownTrips)
+	}
+	expectedDelays := []time.Duration{2 * time.Minute, -30 * time.Second, 0}
+	if len(stats.delays) != len(expectedDelays) {
+		t.Fatalf("expected delays %v, got %v", expectedDelays, stats.delays)
+	}
+	for i, delay := range expectedDelays {
+		if stats.delays[i] != delay {
+			t.Errorf("expected delay %v at index %d, got %v", delay, i, stats.delays[i])
+		}
+	}
+}
+
+func TestTrackTripUpdates(t *testing.T) {
+	server := createTestServer("www.example.com", "Test Server", 997, "", "www.example.com", "test-api-value", "test-api-key", "1")
+	defer Series.DeleteServer(server.ID)
+
+	staticStore := gtfs.NewStaticStore()
+	tripUpdatesStore := gtfs.NewRealtimeStore(time.Minute)
+
+	if err := trackTripUpdates(server, tripUpdatesStore, staticStore); err == nil {
+		t.Fatal("expected an error when no trip updates snapshot is stored")
+	}
+
+	tripUpdatesStore.Set(server.ID, &gtfs.RealtimeSnapshot{
+		Data: &models.RealtimeData{TripUpdates: []remoteGtfs.Trip{
+			{ID: remoteGtfs.TripID{ID: "trip-1"}, Delay: durationPtr(time.Minute)},
+			{ID: remoteGtfs.TripID{ID: "unknown-trip"}},
+		}},
+		FetchedAt: time.Now().UTC(),
+	})
+	if err := trackTripUpdates(server, tripUpdatesStore, staticStore); err == nil {
+		t.Fatal("expected an error when no static bundle is stored")
+	}
+
+	staticData := &models.StaticData{Trips: []models.TripSummary{{ID: "trip-1", RouteID: "route-1"}}}
+	staticData.BuildIndexes()
+	staticStore.Set(server.ID, staticData)
+	if err := trackTripUpdates(server, tripUpdatesStore, staticStore); err != nil {
+		t.Fatalf("trackTripUpdates failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(TripUpdatesCount.WithLabelValues("997")); got != 2 {
+		t.Errorf("expected 2 trip updates, got %v", got)
+	}
+	if got := testutil.ToFloat64(TripUpdatesUnknownTrips.WithLabelValues("997")); got != 1 {
+		t.Errorf("expected 1 unknown trip, got %v", got)
+	}
+	if got := testutil.CollectAndCount(TripUpdateDelay, "gtfs_rt_trip_update_delay_seconds"); got < 1 {
+		t.Errorf("expected the delay histogram to be exported, got %d series", got)
+	}
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
@@ -16,6 +17,39 @@ import (
 	"watchdog.onebusaway.org/internal/utils"
 )
 
+// getRealtimeData returns the GTFS-RT data fetched for the given server.
+//
+// Only a snapshot that belongs to this server and is still fresh (see RealtimeStore.GetFresh)
+// is returned. A missing or stale snapshot is reported to Sentry and returned as an error,
+// so that checks never compute metrics from another server's feed or from an old one.
+//
+// Parameters:
+//   - server: the ObaServer whose GTFS-RT data is requested.
+//   - realtimeStore: a pointer to the RealtimeStore holding GTFS-RT snapshots.
+//
+// Returns:
+//   - *models.RealtimeData: the parsed GTFS-RT feed for the server.
+//   - error: if the realtimeStore is nil, or the snapshot is missing or stale.
+func getRealtimeData(server models.ObaServer, realtimeStore *gtfs.RealtimeStore) (*models.RealtimeData, error) {
+	var err error
+	if realtimeStore == nil {
+		err = fmt.Errorf("realtimeStore is nil for server %d", server.ID)
+	} else {
+		var snapshot *gtfs.RealtimeSnapshot
+		snapshot, err = realtimeStore.GetFresh(server.ID, time.Now().UTC())
+		if err == nil {
+			return snapshot.Data, nil
+		}
+	}
+	report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+		Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+		ExtraContext: map[string]interface{}{
+			"vehicle_position_url": server.VehiclePositionUrl,
+		},
+	})
+	return nil, err
+}
+
 // countVehiclePositions returns the number of vehicles present in the GTFS-RT feed
 // for a given server, as stored in the provided RealtimeStore.
 //
@@ -28,67 +62,89 @@ import (
 //
 // Returns:
 //   - int: the number of vehicle positions found in the GTFS-RT feed.
-//   - error: if the realtimeStore is nil or the data is missing.
+//   - error: if the realtimeStore is nil or the data is missing or stale.
 
 func countVehiclePositions(server models.ObaServer, realtimeStore *gtfs.RealtimeStore) (int, error) {
-	if realtimeStore == nil {
-		err := fmt.Errorf("realtimeStore is nil for server %d", server.ID)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-			ExtraContext: map[string]interface{}{
-				"vehicle_position_url": server.VehiclePositionUrl,
-			},
-		})
-		return 0, err
-	}
-	realtimeData := realtimeStore.Get()
-	if realtimeData == nil {
-		err := fmt.Errorf("no GTFS-RT data available for server %d", server.ID)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-			ExtraContext: map[string]interface{}{
-				"vehicle_position_url": server.VehiclePositionUrl,
-			},
-		})
+	realtimeData, err := getRealtimeData(server, realtimeStore)
+	if err != nil {
 		return 0, err
 	}
+	return reportVehiclePositionCount(server, realtimeData), nil
+}
+
+// reportVehiclePositionCount reports the number of vehicles of a GTFS-RT feed
+// to the RealtimeVehiclePositions Prometheus metric, and returns it.
+func reportVehiclePositionCount(server models.ObaServer, realtimeData *models.RealtimeData) int {
 	count := len(realtimeData.Vehicles)
 
-	RealtimeVehiclePositions.WithLabelValues(
+	Series.Gauge(RealtimeVehiclePositions, server.ID,
 		server.VehiclePositionUrl,
 		strconv.Itoa(server.ID),
 	).Set(float64(count))
 
-	return count, nil
+	return count
 }
 
-// vehiclesForAgencyAPI calls the OneBusAway VehiclesForAgency API for the given server,
+// countVehiclePositionsByAgency splits the vehicles of a GTFS-RT feed by agency (see vehicleAgencies),
+// and reports the count of every agency to the RealtimeVehiclePositionsByAgency Prometheus metric,
+// and the number of vehicles that could not be attributed to UnattributedVehiclePositions.
+//
+// Every agency of agencyIDs gets a count, even when none of its vehicles is in the feed.
+// Vehicles of agencies that are not in agencyIDs are counted as unattributed.
+//
+// Returns the number of vehicles of each agency, indexed by agency ID.
+func countVehiclePositionsByAgency(server models.ObaServer, realtimeData *models.RealtimeData, staticData *models.StaticData, agencyIDs []string) map[string]int {
+	counts := make(map[string]int, len(agencyIDs))
+	for _, agencyID := range agencyIDs {
+		counts[agencyID] = 0
+	}
+
+	attribution := newVehicleAgencies(staticData, agencyIDs)
+	unattributed := 0
+	for _, vehicle := range realtimeData.Vehicles {
+		agencyID := attribution.agencyOf(vehicle)
+		if _, ok := counts[agencyID]; !ok {
+			unattributed++
+			continue
+		}
+		counts[agencyID]++
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	for agencyID, count := range counts {
+		Series.Gauge(RealtimeVehiclePositionsByAgency, server.ID, agencyID, serverID).Set(float64(count))
+	}
+	Series.Gauge(UnattributedVehiclePositions, server.ID, serverID).Set(float64(unattributed))
+	return counts
+}
+
+// vehiclesForAgencyAPI calls the OneBusAway VehiclesForAgency API for one agency of the given server,
 // retrieves the list of vehicles, and reports the count to the VehicleCountAPI Prometheus metric.
 //
 // This function fetches live vehicle data from the OBA API using the agency ID.
 //
 // Parameters:
-//   - server: the ObaServer containing API credentials and agency information.
+//   - ctx: the context of the collection run; canceling it aborts the request.
+//   - server: the ObaServer containing API credentials.
+//   - agencyID: the agency whose vehicles are listed.
 //
 // Returns:
 //   - int: the number of vehicles returned by the API.
 //   - error: if the API call fails or returns an invalid response.
-func vehiclesForAgencyAPI(server models.ObaServer) (int, error) {
+func vehiclesForAgencyAPI(ctx context.Context, server models.ObaServer, agencyID string) (int, error) {
 
 	client := onebusaway.NewClient(
 		option.WithAPIKey(server.ObaApiKey),
 		option.WithBaseURL(server.ObaBaseURL),
 	)
 
-	ctx := context.Background()
-
-	response, err := client.VehiclesForAgency.List(ctx, server.AgencyID, onebusaway.VehiclesForAgencyListParams{})
+	response, err := client.VehiclesForAgency.List(ctx, agencyID, onebusaway.VehiclesForAgencyListParams{})
 
 	if err != nil {
 		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
 			Tags: map[string]string{
 				"server_id": strconv.Itoa(server.ID),
-				"agency_id": server.AgencyID,
+				"agency_id": agencyID,
 			},
 		})
 		return 0, err
@@ -98,25 +154,33 @@ func vehiclesForAgencyAPI(server models.ObaServer) (int, error) {
 		return 0, nil
 	}
 
-	VehicleCountAPI.WithLabelValues(server.AgencyID, strconv.Itoa(server.ID)).Set(float64(len(response.Data.List)))
+	Series.Gauge(VehicleCountAPI, server.ID, agencyID, strconv.Itoa(server.ID)).Set(float64(len(response.Data.List)))
 
 	return len(response.Data.List), nil
 }
 
-// checkVehicleCountMatch compares the number of vehicles in the GTFS-RT feed with
-// the number reported by the VehiclesForAgency API for the given server.
+// checkVehicleCountMatch compares, for every agency of the given server, the number of vehicles
+// of the agency in the GTFS-RT feed with the number reported by the VehiclesForAgency API.
+//
+// The agencies are the configured ones or, when none is configured, the discovered ones
+// (see resolveAgencyIDs). GTFS-RT vehicles are split by agency through the agency of their route
+// in the GTFS static bundle (see countVehiclePositionsByAgency); a server with a single agency
+// gets every vehicle of the feed, even without a static bundle.
 //
-// It sets the VehicleCountMatch Prometheus metric to 1 if the counts match, or 0 otherwise.
+// It sets the VehicleCountMatch Prometheus metric of each agency to 1 if the counts match, or 0 otherwise.
 // Used to detect inconsistencies between real-time GTFS-RT data and the OBA API.
 //
 // Parameters:
+//   - ctx: the context of the collection run; canceling it aborts the API requests.
 //   - server: the ObaServer for which the comparison is made.
 //   - realtimeStore: a pointer to the RealtimeStore holding GTFS-RT data.
+//   - staticStore: a pointer to the StaticStore holding the GTFS static bundles; may be nil.
 //
 // Returns:
-//   - error: if counting vehicles from either source fails.
-func checkVehicleCountMatch(server models.ObaServer, realtimeStore *gtfs.RealtimeStore) error {
-	gtfsRtVehicleCount, err := countVehiclePositions(server, realtimeStore)
+//   - error: if counting vehicles from the GTFS-RT feed fails, the agencies cannot be resolved,
+//     or the API call of any agency fails. The agencies whose API call succeeded are still compared.
+func checkVehicleCountMatch(ctx context.Context, server models.ObaServer, realtimeStore *gtfs.RealtimeStore, staticStore *gtfs.StaticStore) error {
+	realtimeData, err := getRealtimeData(server, realtimeStore)
 	if err != nil {
 		err := fmt.Errorf("failed to count vehicle positions from GTFS-RT: %v", err)
 		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
@@ -124,23 +188,42 @@ func checkVehicleCountMatch(server models.ObaServer, realtimeStore *gtfs.Realtim
 		})
 		return err
 	}
+	reportVehiclePositionCount(server, realtimeData)
 
-	apiVehicleCount, err := vehiclesForAgencyAPI(server)
+	agencyIDs, err := resolveAgencyIDs(ctx, server, staticStore)
 	if err != nil {
-		err := fmt.Errorf("failed to count vehicle positions from API: %v", err)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-		})
 		return err
 	}
 
-	match := 0
-	if gtfsRtVehicleCount == apiVehicleCount {
-		match = 1
+	var staticData *models.StaticData
+	if staticStore != nil {
+		staticData, _ = staticStore.Get(server.ID)
 	}
+	gtfsRtVehicleCounts := countVehiclePositionsByAgency(server, realtimeData, staticData, agencyIDs)
+
+	var errs []error
+	for _, agencyID := range agencyIDs {
+		apiVehicleCount, err := vehiclesForAgencyAPI(ctx, server, agencyID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("agency %s: %w", agencyID, err))
+			continue
+		}
 
-	VehicleCountMatch.WithLabelValues(server.AgencyID, strconv.Itoa(server.ID)).Set(float64(match))
+		match := 0
+		if gtfsRtVehicleCounts[agencyID] == apiVehicleCount {
+			match = 1
+		}
 
+		Series.Gauge(VehicleCountMatch, server.ID, agencyID, strconv.Itoa(server.ID)).Set(float64(match))
+	}
+
+	if len(errs) > 0 {
+		err := fmt.Errorf("failed to count vehicle positions from API: %w", errors.Join(errs...))
+		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
+			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
+		})
+		return err
+	}
 	return nil
 }
 
@@ -149,45 +232,61 @@ func checkVehicleCountMatch(server models.ObaServer, realtimeStore *gtfs.Realtim
 // This function performs the following tasks:
 //  1. Fetches and parses the GTFS-RT vehicle positions feed for the given OBA server.
 //  2. For each valid vehicle entry:
-//     - Tracks the number of GTFS-RT updates received (`vehicle_report_total`).
-//     - Measures the interval since the last report (`vehicle_position_report_interval_seconds`).
+//     - Classifies the report by comparing its timestamp with the previous report of the vehicle
+//     (see classifyVehicleReport): new, repeated, going backwards, or in the future. A report
+//     without a timestamp is classified untimestamped.
+//     - Tracks the number of new GTFS-RT reports received (`vehicle_report_total`); a repeated
+//     timestamp means the vehicle did not update since the previous fetch, so it is not counted.
+//     - Estimates the update period of the vehicle from the intervals between its new reports
+//     (`vehicle_update_period_seconds`). It cannot measure periods shorter than the fetch interval.
+//     - Measures the interval since the last accepted report (`vehicle_position_report_interval_seconds`).
 //     - Computes the vehicle speed based on current and previous coordinates and timestamps.
 //     - Reports the computed speed to Prometheus (`gtfs_rt_vehicle_computed_speed`).
 //     - Compares the computed speed with the reported speed (if available) and reports the relative discrepancy
 //     (`gtfs_rt_vehicle_speed_discrepancy_ratio`).
+//  3. Exports the number of reports of each class (`gtfs_rt_vehicle_reports`).
+//
+// Reports going backwards or into the future are anomalies of the producer: they are counted, but
+// they neither update the last seen data of the vehicle nor feed the speed computation.
+// A report without a timestamp is taken as received at now, and still updates the last seen data
+// and speed of the vehicle. It cannot tell whether the vehicle updated since the previous fetch,
+// though, so it is neither counted as a new report nor used to estimate the update period.
 //
 // All metrics are labeled by `vehicle_id`, `server_id`, and `agency_id` to support detailed monitoring and alerting.
+// The agency of a vehicle is the agency of its route in the GTFS static bundle (see vehicleAgencies);
+// it is empty for a vehicle that cannot be attributed on a server hosting several agencies.
 //
 // The function maintains a local in-memory store (`vehicleLastSeen`) to cache the last known location and timestamp
 // for each vehicle per server.
 //
 // Parameters:
 //   - server: the `ObaServer` instance representing the target OBA server.
+//   - staticStore: the StaticStore used to attribute vehicles to agencies; may be nil.
+//   - now: the time the reports are compared with.
 //
 // Returns:
-//   - An error if the feed cannot be fetched or parsed, otherwise nil.
-func trackVehicleTelemetry(server models.ObaServer, vehicleLastSeen *VehicleLastSeen, realtimeStore *gtfs.RealtimeStore) error {
+//   - An error if the server's GTFS-RT snapshot is missing or stale, otherwise nil.
+func trackVehicleTelemetry(server models.ObaServer, vehicleLastSeen *VehicleLastSeen, realtimeStore *gtfs.RealtimeStore, staticStore *gtfs.StaticStore, now time.Time) error {
 	serverID := server.ID
-	agencyID := server.AgencyID
-	now := time.Now().UTC()
 
-	realtimeData := realtimeStore.Get()
-	if realtimeData == nil {
-		err := fmt.Errorf("no GTFS-RT data available for server %d", serverID)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-			ExtraContext: map[string]interface{}{
-				"vehicle_position_url": server.VehiclePositionUrl,
-			},
-		})
+	realtimeData, err := getRealtimeData(server, realtimeStore)
+	if err != nil {
 		return err
 	}
 
+	classes := map[string]int{vehicleReportNew: 0, vehicleReportRepeated: 0, vehicleReportBackwards: 0, vehicleReportFuture: 0, vehicleReportUntimestamped: 0}
 	if len(realtimeData.Vehicles) == 0 {
-		TrackedVehiclesGauge.WithLabelValues(strconv.Itoa(serverID)).Set(0)
+		reportVehicleReportClasses(serverID, classes)
+		Series.Gauge(TrackedVehiclesGauge, serverID, strconv.Itoa(serverID)).Set(0)
 		return nil
 	}
 
+	var staticData *models.StaticData
+	if staticStore != nil {
+		staticData, _ = staticStore.Get(serverID)
+	}
+	attribution := newVehicleAgencies(staticData, staticAgencyIDs(server, staticData))
+
 	for _, vehicle := range realtimeData.Vehicles {
 		if vehicle.ID == nil || vehicle.ID.ID == "" {
 			continue
@@ -200,45 +299,68 @@ func trackVehicleTelemetry(server models.ObaServer, vehicleLastSeen *VehicleLast
 		lat := float64(*vehicle.Position.Latitude)
 		lon := float64(*vehicle.Position.Longitude)
 
-		seenAt := now
+		prev, ok := vehicleLastSeen.Get(serverID, vehicleID)
+		seenAt, class := now, vehicleReportUntimestamped
 		if vehicle.Timestamp != nil {
 			seenAt = *vehicle.Timestamp
+			class = classifyVehicleReport(prev, ok, seenAt, now)
+		}
+		classes[class]++
+
+		switch class {
+		case vehicleReportRepeated:
+			Series.Gauge(VehicleReportInterval, serverID, vehicleID, strconv.Itoa(serverID)).Set(now.Sub(seenAt).Seconds())
+			continue
+		case vehicleReportBackwards, vehicleReportFuture:
+			if ok {
+				Series.Gauge(VehicleReportInterval, serverID, vehicleID, strconv.Itoa(serverID)).Set(now.Sub(prev.Time).Seconds())
+			}
+			continue
 		}
 
 		interval := now.Sub(seenAt).Seconds()
-		VehicleReportCount.WithLabelValues(vehicleID, strconv.Itoa(serverID)).Inc()
-		VehicleReportInterval.WithLabelValues(vehicleID, strconv.Itoa(serverID)).Set(interval)
+		if class == vehicleReportNew {
+			Series.Counter(VehicleReportCount, serverID, vehicleID, strconv.Itoa(serverID)).Inc()
+		}
+		Series.Gauge(VehicleReportInterval, serverID, vehicleID, strconv.Itoa(serverID)).Set(interval)
 
-		// Compute speed
-		prev, ok := vehicleLastSeen.Get(serverID, vehicleID)
+		// Compute speed and update period
+		agencyID := attribution.agencyOf(vehicle)
+		updatePeriod := time.Duration(0)
 		if ok {
+			updatePeriod = prev.UpdatePeriod
+			if class == vehicleReportNew {
+				updatePeriod = nextUpdatePeriod(prev.UpdatePeriod, seenAt.Sub(prev.Time))
+				Series.Gauge(VehicleUpdatePeriod, serverID, vehicleID, strconv.Itoa(serverID)).Set(updatePeriod.Seconds())
+			}
+
 			timeDelta := seenAt.Sub(prev.Time).Seconds()
-			if timeDelta > 0 {
-				distance := geo.HaversineDistance(prev.Lat, prev.Lon, lat, lon)
-				computedSpeed := distance / timeDelta
-
-				VehicleSpeedGauge.WithLabelValues(vehicleID, agencyID, strconv.Itoa(serverID)).Set(computedSpeed)
-
-				// Compare reported speed with computed speed
-				if vehicle.Position.Speed != nil {
-					reportedSpeed := float64(*vehicle.Position.Speed)
-					if reportedSpeed > 0 {
-						diffRatio := math.Abs(computedSpeed-reportedSpeed) / reportedSpeed
-						VehicleSpeedDiscrepancyRatioGauge.WithLabelValues(vehicleID, agencyID, strconv.Itoa(serverID)).Set(diffRatio)
-					}
+			distance := geo.HaversineDistance(prev.Lat, prev.Lon, lat, lon)
+			computedSpeed := distance / timeDelta
+
+			Series.Gauge(VehicleSpeedGauge, serverID, vehicleID, agencyID, strconv.Itoa(serverID)).Set(computedSpeed)
+
+			// Compare reported speed with computed speed
+			if vehicle.Position.Speed != nil {
+				reportedSpeed := float64(*vehicle.Position.Speed)
+				if reportedSpeed > 0 {
+					diffRatio := math.Abs(computedSpeed-reportedSpeed) / reportedSpeed
+					Series.Gauge(VehicleSpeedDiscrepancyRatioGauge, serverID, vehicleID, agencyID, strconv.Itoa(serverID)).Set(diffRatio)
 				}
 			}
 		}
 
 		// Save last seen data
 		vehicleLastSeen.Set(serverID, vehicleID, LastSeen{
-			Time: seenAt,
-			Lat:  lat,
-			Lon:  lon,
+			Time:         seenAt,
+			Lat:          lat,
+			Lon:          lon,
+			UpdatePeriod: updatePeriod,
 		})
 	}
 
-	TrackedVehiclesGauge.WithLabelValues(strconv.Itoa(serverID)).Set(float64(vehicleLastSeen.Count(serverID)))
+	reportVehicleReportClasses(serverID, classes)
+	Series.Gauge(TrackedVehiclesGauge, serverID, strconv.Itoa(serverID)).Set(float64(vehicleLastSeen.Count(serverID)))
 
 	return nil
 }
@@ -273,15 +395,8 @@ const VehicleStatusStoppedAtStop = 1
 // - InvalidVehicleCoordinatesGauge: for invalid or missing coordinates
 // - StoppedOutOfBoundsVehiclesGauge: for vehicles stopped outside the bounding box
 func trackInvalidVehiclesAndStoppedOutOfBounds(server models.ObaServer, boundingBoxStore *geo.BoundingBoxStore, realtimeStore *gtfs.RealtimeStore) error {
-	realtimeData := realtimeStore.Get()
-	if realtimeData == nil {
-		err := fmt.Errorf("no GTFS-RT data available for server %d", server.ID)
-		report.ReportErrorWithSentryOptions(err, report.SentryReportOptions{
-			Tags: utils.MakeMap("server_id", strconv.Itoa(server.ID)),
-			ExtraContext: map[string]interface{}{
-				"vehicle_position_url": server.VehiclePositionUrl,
-			},
-		})
+	realtimeData, err := getRealtimeData(server, realtimeStore)
+	if err != nil {
 		return err
 	}
 
@@ -316,8 +431,8 @@ func trackInvalidVehiclesAndStoppedOutOfBounds(server models.ObaServer, bounding
 	}
 
 	serverID := strconv.Itoa(server.ID)
-	InvalidVehicleCoordinatesGauge.WithLabelValues(serverID).Set(float64(invalidCount))
-	StoppedOutOfBoundsVehiclesGauge.WithLabelValues(serverID).Set(float64(outOfBoundsCount))
+	Series.Gauge(InvalidVehicleCoordinatesGauge, server.ID, serverID).Set(float64(invalidCount))
+	Series.Gauge(StoppedOutOfBoundsVehiclesGauge, server.ID, serverID).Set(float64(outOfBoundsCount))
 
 	return nil
 }
@@ -1,11 +1,13 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	remoteGtfs "github.com/OneBusAway/go-gtfs"
 	"watchdog.onebusaway.org/internal/geo"
@@ -16,7 +18,7 @@ import (
 var realtimeStore *gtfs.RealtimeStore
 
 func TestMain(m *testing.M) {
-	realtimeStore = gtfs.NewRealtimeStore()
+	realtimeStore = gtfs.NewRealtimeStore(time.Hour)
 
 	absPath, err := filepath.Abs(filepath.Join("..", "..", "testdata", "gtfs_rt_feed_vehicles.pb"))
 	if err != nil {
@@ -36,7 +38,15 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 	realtimeData := models.NewRealtimeData(gtfsRT)
-	realtimeStore.Set(realtimeData)
+	// Tests use server IDs 1 and 999; each server reads only its own snapshot.
+	for _, serverID := range []int{1, 999} {
+		realtimeStore.Set(serverID, &gtfs.RealtimeSnapshot{
+			Data:          realtimeData,
+			FetchedAt:     time.Now().UTC(),
+			FeedTimestamp: gtfsRT.CreatedAt,
+			PayloadSize:   len(data),
+		})
+	}
 
 	exitCode := m.Run()
 	os.Exit(exitCode)
@@ -58,6 +68,32 @@ func TestCountVehiclePositions(t *testing.T) {
 		}
 	})
 
+	t.Run("Missing snapshot for server", func(t *testing.T) {
+		server := models.ObaServer{
+			ID:                 42, // no snapshot stored for this ID
+			VehiclePositionUrl: "Value of VehiclePositionUrl",
+		}
+		if _, err := countVehiclePositions(server, realtimeStore); err == nil {
+			t.Fatal("Expected an error for a server without a GTFS-RT snapshot, got nil")
+		}
+	})
+
+	t.Run("Stale snapshot", func(t *testing.T) {
+		staleStore := gtfs.NewRealtimeStore(time.Minute)
+		snapshot, _ := realtimeStore.Get(1)
+		staleStore.Set(1, &gtfs.RealtimeSnapshot{
+			Data:      snapshot.Data,
+			FetchedAt: time.Now().UTC().Add(-2 * time.Minute),
+		})
+
+		server := models.ObaServer{
+			ID:                 1,
+			VehiclePositionUrl: "Value of VehiclePositionUrl",
+		}
+		if _, err := countVehiclePositions(server, staleStore); err == nil {
+			t.Fatal("Expected an error for a stale GTFS-RT snapshot, got nil")
+		}
+	})
 }
 
 func TestVehiclesForAgencyAPI(t *testing.T) {
@@ -73,7 +109,7 @@ func TestVehiclesForAgencyAPI(t *testing.T) {
 			AgencyID:   "test-agency",
 		}
 
-		count, err := vehiclesForAgencyAPI(server)
+		count, err := vehiclesForAgencyAPI(context.Background(), server, server.AgencyID)
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -95,7 +131,7 @@ func TestVehiclesForAgencyAPI(t *testing.T) {
 			AgencyID:   "test-agency",
 		}
 
-		count, err := vehiclesForAgencyAPI(server)
+		count, err := vehiclesForAgencyAPI(context.Background(), server, server.AgencyID)
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -117,7 +153,7 @@ func TestVehiclesForAgencyAPI(t *testing.T) {
 			AgencyID:   "test-agency",
 		}
 
-		_, err := vehiclesForAgencyAPI(server)
+		_, err := vehiclesForAgencyAPI(context.Background(), server, server.AgencyID)
 		if err == nil {
 			t.Fatal("Expected an error but got nil")
 		}
@@ -132,17 +168,17 @@ func TestCheckVehicleCountMatch(t *testing.T) {
 
 		testServer := createTestServer(obaServer.URL, "Test Server", 999, "test-key", "GTFS-Rt Server URL 1", "test-api-value", "test-api-key", "1")
 
-		err := checkVehicleCountMatch(testServer, realtimeStore)
+		err := checkVehicleCountMatch(context.Background(), testServer, realtimeStore, nil)
 		if err != nil {
 			t.Fatalf("CheckVehicleCountMatch failed: %v", err)
 		}
 
-		realtimeData := realtimeStore.Get()
-		if realtimeData == nil {
+		snapshot, ok := realtimeStore.Get(testServer.ID)
+		if !ok || snapshot.Data == nil {
 			t.Fatalf("Failed to parse GTFS-RT fixture data: %v", err)
 		}
 
-		t.Log("Number of vehicles in GTFS-RT feed:", len(realtimeData.Vehicles))
+		t.Log("Number of vehicles in GTFS-RT feed:", len(snapshot.Data.Vehicles))
 	})
 	t.Run("OBA API Error", func(t *testing.T) {
 		obaServer := setupObaServer(t, `{}`, http.StatusInternalServerError)
@@ -150,7 +186,7 @@ func TestCheckVehicleCountMatch(t *testing.T) {
 
 		testServer := createTestServer(obaServer.URL, "Test Server", 999, "test-key", "GTFS-Rt Server URL 1", "test-api-value", "test-api-key", "1")
 
-		err := checkVehicleCountMatch(testServer, realtimeStore)
+		err := checkVehicleCountMatch(context.Background(), testServer, realtimeStore, nil)
 		if err == nil {
 			t.Fatal("Expected an error but got nil")
 		}
@@ -11,6 +11,8 @@ type LastSeen struct {
 	Time time.Time
 	Lat  float64
 	Lon  float64
+	// UpdatePeriod is the estimated time between two new reports of the vehicle; 0 until it reported twice.
+	UpdatePeriod time.Duration
 }
 
 // VehicleLastSeen stores the most recent known location and timestamp for each vehicle per server.
@@ -81,6 +83,17 @@ func (v *VehicleLastSeen) Count(serverID int) int {
 	return len(v.Store[serverID])
 }
 
+// DeleteServer removes every tracked vehicle of the given server.
+// It is used to evict servers that were removed from the configuration.
+//
+// serverID: ID of the server to forget.
+func (vehicleLastSeen *VehicleLastSeen) DeleteServer(serverID int) {
+	vehicleLastSeen.Mu.Lock()
+	defer vehicleLastSeen.Mu.Unlock()
+
+	delete(vehicleLastSeen.Store, serverID)
+}
+
 // ClearRoutine runs a background process that periodically removes vehicles
 // whose LastSeen timestamps exceed the given threshold.
 //
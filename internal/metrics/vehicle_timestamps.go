@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// vehicleClockSkewTolerance is how far ahead of the watchdog's clock a vehicle timestamp may be
+// before the report is classified as coming from the future. It absorbs small clock differences
+// between the vehicle, the GTFS-RT producer and the watchdog.
+const vehicleClockSkewTolerance = time.Minute
+
+// vehicleUpdatePeriodWeight is the weight of the latest interval in the update period estimate
+// (an exponentially weighted moving average), so that a single late report does not swing it.
+const vehicleUpdatePeriodWeight = 0.3
+
+// Classes of a vehicle report, by its timestamp compared with the previous report of the vehicle,
+// as exported in the `class` label of VehicleReportsByTimestamp.
+const (
+	vehicleReportNew       = "new"       // The timestamp advanced, or the vehicle was not seen before
+	vehicleReportRepeated  = "repeated"  // Same timestamp as the previous report: the vehicle has not updated since
+	vehicleReportBackwards = "backwards" // The timestamp is older than the previous report
+	vehicleReportFuture    = "future"    // The timestamp is ahead of now by more than vehicleClockSkewTolerance
+	// The report has no timestamp, so whether the vehicle updated since its previous report is unknown
+	vehicleReportUntimestamped = "untimestamped"
+)
+
+// classifyVehicleReport classifies a vehicle report timestamped seenAt, received at now, against
+// the previous report of the vehicle (known is false for a vehicle seen for the first time).
+func classifyVehicleReport(previous LastSeen, known bool, seenAt, now time.Time) string {
+	switch {
+	case seenAt.Sub(now) > vehicleClockSkewTolerance:
+		return vehicleReportFuture
+	case !known || seenAt.After(previous.Time):
+		return vehicleReportNew
+	case seenAt.Equal(previous.Time):
+		return vehicleReportRepeated
+	default:
+		return vehicleReportBackwards
+	}
+}
+
+// nextUpdatePeriod folds the interval between two consecutive new reports of a vehicle into its
+// update period estimate. A zero previous estimate means the vehicle has no estimate yet.
+func nextUpdatePeriod(previous, interval time.Duration) time.Duration {
+	if previous <= 0 {
+		return interval
+	}
+	return time.Duration(float64(previous)*(1-vehicleUpdatePeriodWeight) + float64(interval)*vehicleUpdatePeriodWeight)
+}
+
+// reportVehicleReportClasses exports the number of vehicle reports of each class in the latest snapshot.
+func reportVehicleReportClasses(serverID int, classes map[string]int) {
+	for class, count := range classes {
+		Series.Gauge(VehicleReportsByTimestamp, serverID, strconv.Itoa(serverID), class).Set(float64(count))
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestClassifyVehicleReport(t *testing.T) {
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC)
+	previous := LastSeen{Time: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name   string
+		known  bool
+		seenAt time.Time
+		class  string
+	}{
+		{"First report", false, now.Add(-time.Hour), vehicleReportNew},
+		{"Advanced", true, now.Add(-30 * time.Second), vehicleReportNew},
+		{"Same timestamp", true, previous.Time, vehicleReportRepeated},
+		{"Older timestamp", true, now.Add(-2 * time.Minute), vehicleReportBackwards},
+		{"Within clock skew", true, now.Add(30 * time.Second), vehicleReportNew},
+		{"Future", false, now.Add(5 * time.Minute), vehicleReportFuture},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyVehicleReport(previous, tt.known, tt.seenAt, now); got != tt.class {
+				t.Errorf("expected %q, got %q", tt.class, got)
+			}
+		})
+	}
+}
+
+func TestTrackVehicleTelemetryTimestamps(t *testing.T) {
+	server := models.ObaServer{ID: 987}
+	defer Series.DeleteServer(server.ID)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	store := gtfs.NewRealtimeStore(time.Hour)
+	vehicleLastSeen := NewVehicleLastSeen()
+	lat, lon := float32(47.6), float32(-122.3)
+
+	// track stores a snapshot in which vehicle-1 reports at seenAt, and tracks it at now.
+	track := func(seenAt, now time.Time) {
+		t.Helper()
+		store.Set(server.ID, &gtfs.RealtimeSnapshot{
+			FetchedAt: time.Now().UTC(),
+			Data: &models.RealtimeData{Vehicles: []remoteGtfs.Vehicle{{
+				ID:        &remoteGtfs.VehicleID{ID: "vehicle-1"},
+				Position:  &remoteGtfs.Position{Latitude: &lat, Longitude: &lon},
+				Timestamp: &seenAt,
+			}}},
+		})
+		if err := trackVehicleTelemetry(server, vehicleLastSeen, store, nil, now); err != nil {
+			t.Fatalf("trackVehicleTelemetry failed: %v", err)
+		}
+	}
+	classCount := func(class string) float64 {
+		return testutil.ToFloat64(VehicleReportsByTimestamp.WithLabelValues("987", class))
+	}
+
+	track(now.Add(-60*time.Second), now)
+	track(now.Add(-60*time.Second), now.Add(30*time.Second))
+	if classCount(vehicleReportRepeated) != 1 || classCount(vehicleReportNew) != 0 {
+		t.Errorf("expected the second report to be repeated, got %v new and %v repeated", classCount(vehicleReportNew), classCount(vehicleReportRepeated))
+	}
+
+	track(now.Add(-90*time.Second), now.Add(60*time.Second))
+	if classCount(vehicleReportBackwards) != 1 {
+		t.Errorf("expected a report going backwards, got %v", classCount(vehicleReportBackwards))
+	}
+
+	track(now.Add(10*time.Minute), now.Add(60*time.Second))
+	if classCount(vehicleReportFuture) != 1 {
+		t.Errorf("expected a report from the future, got %v", classCount(vehicleReportFuture))
+	}
+	if got, _ := vehicleLastSeen.Get(server.ID, "vehicle-1"); !got.Time.Equal(now.Add(-60 * time.Second)) {
+		t.Errorf("expected the anomalies not to replace the last seen time, got %v", got.Time)
+	}
+
+	track(now, now.Add(90*time.Second))
+	if got := testutil.ToFloat64(VehicleReportCount.WithLabelValues("vehicle-1", "987")); got != 2 {
+		t.Errorf("expected only the 2 new reports to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(VehicleUpdatePeriod.WithLabelValues("vehicle-1", "987")); got != 60 {
+		t.Errorf("expected an update period of 60 seconds, got %v", got)
+	}
+}
+
+func TestTrackVehicleTelemetryWithoutTimestamps(t *testing.T) {
+	server := models.ObaServer{ID: 986}
+	defer Series.DeleteServer(server.ID)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	store := gtfs.NewRealtimeStore(time.Hour)
+	vehicleLastSeen := NewVehicleLastSeen()
+	lat, lon := float32(47.6), float32(-122.3)
+
+	for fetch := 0; fetch < 3; fetch++ {
+		store.Set(server.ID, &gtfs.RealtimeSnapshot{
+			FetchedAt: time.Now().UTC(),
+			Data: &models.RealtimeData{Vehicles: []remoteGtfs.Vehicle{{
+				ID:       &remoteGtfs.VehicleID{ID: "vehicle-1"},
+				Position: &remoteGtfs.Position{Latitude: &lat, Longitude: &lon},
+			}}},
+		})
+		if err := trackVehicleTelemetry(server, vehicleLastSeen, store, nil, now.Add(time.Duration(fetch)*30*time.Second)); err != nil {
+			t.Fatalf("trackVehicleTelemetry failed: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(VehicleReportsByTimestamp.WithLabelValues("986", vehicleReportUntimestamped)); got != 1 {
+		t.Errorf("expected 1 untimestamped report, got %v", got)
+	}
+	if got := testutil.ToFloat64(VehicleReportsByTimestamp.WithLabelValues("986", vehicleReportNew)); got != 0 {
+		t.Errorf("expected no new report, got %v", got)
+	}
+	if VehicleReportCount.DeleteLabelValues("vehicle-1", "986") {
+		t.Error("expected untimestamped reports not to be counted")
+	}
+	if VehicleUpdatePeriod.DeleteLabelValues("vehicle-1", "986") {
+		t.Error("expected untimestamped reports not to estimate the update period")
+	}
+	if got, ok := vehicleLastSeen.Get(server.ID, "vehicle-1"); !ok || !got.Time.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected the vehicle to be tracked as seen at the last fetch, got %v", got.Time)
+	}
+	if !VehicleSpeedGauge.DeleteLabelValues("vehicle-1", "", "986") {
+		t.Error("expected a speed to be computed from the fetch times")
+	}
+}
+
+func TestNextUpdatePeriod(t *testing.T) {
+	if got := nextUpdatePeriod(0, 30*time.Second); got != 30*time.Second {
+		t.Errorf("expected the first interval to be the estimate, got %v", got)
+	}
+	if got := nextUpdatePeriod(30*time.Second, 130*time.Second); got != 60*time.Second {
+		t.Errorf("expected a moving average of 60s, got %v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+// Reasons a vehicle position cannot be matched to a scheduled trip of the static bundle,
+// as exported in the `reason` label of VehicleTripMismatches.
+const (
+	vehicleTripMissing         = "no_trip"          // The vehicle has no trip descriptor, or one without a trip ID
+	vehicleTripUnknown         = "unknown_trip"     // The trip ID is not in the static bundle
+	vehicleTripUnknownRoute    = "unknown_route"    // The route ID of the trip descriptor is not in the static bundle
+	vehicleTripInactiveService = "inactive_service" // The trip's service does not run on the trip's service date
+)
+
+// vehicleTripReasons lists every reason, so that reasons without vehicles are exported as 0.
+var vehicleTripReasons = []string{vehicleTripMissing, vehicleTripUnknown, vehicleTripUnknownRoute, vehicleTripInactiveService}
+
+// vehicleTripMatcher matches the trip descriptors of vehicle positions against a static bundle.
+type vehicleTripMatcher struct {
+	staticData *models.StaticData
+	today      time.Time
+	active     map[time.Time]map[string]bool // Active services, by service date
+}
+
+func newVehicleTripMatcher(staticData *models.StaticData, now time.Time) *vehicleTripMatcher {
+	return &vehicleTripMatcher{
+		staticData: staticData,
+		today:      gtfs.CurrentServiceDate(staticData, now),
+		active:     make(map[time.Time]map[string]bool),
+	}
+}
+
+// activeOn reports whether the service runs on the given service date.
+func (m *vehicleTripMatcher) activeOn(serviceID string, date time.Time) bool {
+	active, ok := m.active[date]
+	if !ok {
+		active = gtfs.ActiveServices(m.staticData, date)
+		m.active[date] = active
+	}
+	return active[serviceID]
+}
+
+// mismatch returns why the vehicle cannot be matched to a scheduled trip, or an empty string if it can.
+// The first failing reason wins, in the order of vehicleTripReasons.
+//
+// ADDED trips are by definition absent from the static bundle, so only their route is checked.
+// The service date of a trip is the start date of its descriptor when set; otherwise the trip may
+// have started today or, running past midnight, yesterday.
+func (m *vehicleTripMatcher) mismatch(vehicle remoteGtfs.Vehicle) string {
+	if vehicle.Trip == nil || vehicle.Trip.ID.ID == "" {
+		return vehicleTripMissing
+	}
+	trip := vehicle.Trip.ID
+	added := trip.ScheduleRelationship == gtfsrt.TripDescriptor_ADDED
+
+	var serviceID string
+	if scheduled, known := m.staticData.Trip(trip.ID); known {
+		serviceID = scheduled.ServiceID
+	} else if !added {
+		return vehicleTripUnknown
+	}
+	if trip.RouteID != "" {
+		if _, ok := m.staticData.RoutesByID[trip.RouteID]; !ok {
+			return vehicleTripUnknownRoute
+		}
+	}
+	if added {
+		return ""
+	}
+
+	if trip.HasStartDate {
+		date := time.Date(trip.StartDate.Year(), trip.StartDate.Month(), trip.StartDate.Day(), 0, 0, 0, 0, time.UTC)
+		if !m.activeOn(serviceID, date) {
+			return vehicleTripInactiveService
+		}
+		return ""
+	}
+	if !m.activeOn(serviceID, m.today) && !m.activeOn(serviceID, m.today.AddDate(0, 0, -1)) {
+		return vehicleTripInactiveService
+	}
+	return ""
+}
+
+// trackVehicleTrips joins the trip descriptor of every vehicle of the latest fresh GTFS-RT snapshot
+// with the trips and routes of the server's static bundle.
+//
+// OBA only shows a vehicle on a trip it can find in its bundle, running on the service date of the
+// trip; every other vehicle adds to `oba_realtime_trips_unmatched_count` without saying why.
+// VehicleTripMismatches exports the number of such vehicles by reason (see vehicleTripReasons).
+//
+// Returns the number of vehicles by reason, or an error if the snapshot or the static bundle is missing.
+func trackVehicleTrips(server models.ObaServer, realtimeStore *gtfs.RealtimeStore, staticStore *gtfs.StaticStore, now time.Time) (map[string]int, error) {
+	snapshot, err := realtimeStore.GetFresh(server.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	staticData, ok := staticStore.Get(server.ID)
+	if !ok || staticData == nil {
+		return nil, fmt.Errorf("no GTFS static data found for server ID %d", server.ID)
+	}
+
+	matcher := newVehicleTripMatcher(staticData, now)
+	mismatches := make(map[string]int, len(vehicleTripReasons))
+	for _, vehicle := range snapshot.Data.Vehicles {
+		if reason := matcher.mismatch(vehicle); reason != "" {
+			mismatches[reason]++
+		}
+	}
+
+	serverID := strconv.Itoa(server.ID)
+	for _, reason := range vehicleTripReasons {
+		Series.Gauge(VehicleTripMismatches, server.ID, serverID, reason).Set(float64(mismatches[reason]))
+	}
+	return mismatches, nil
+}
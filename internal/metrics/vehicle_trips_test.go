@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	remoteGtfs "github.com/OneBusAway/go-gtfs"
+	gtfsrt "github.com/OneBusAway/go-gtfs/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"watchdog.onebusaway.org/internal/gtfs"
+	"watchdog.onebusaway.org/internal/models"
+)
+
+func TestTrackVehicleTrips(t *testing.T) {
+	server := createTestServer("http://example.com", "Test Server", 985, "test-key", "http://example.com", "", "", "")
+	defer Series.DeleteServer(server.ID)
+
+	// Monday 13:00 in Seattle, so Sunday is the previous service date.
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, time.UTC)
+	start, end := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+	staticData := &models.StaticData{
+		Agencies: []remoteGtfs.Agency{{Id: "40", Timezone: "America/Los_Angeles"}},
+		Services: []remoteGtfs.Service{
+			{Id: "weekday", Monday: true, Tuesday: true, Wednesday: true, Thursday: true, Friday: true, StartDate: start, EndDate: end},
+			{Id: "weekend", Saturday: true, Sunday: true, StartDate: start, EndDate: end},
+			{Id: "never", StartDate: start, EndDate: end},
+		},
+		Routes: []remoteGtfs.Route{{Id: "route-1"}},
+		Trips: []models.TripSummary{
+			{ID: "trip-1", RouteID: "route-1", ServiceID: "weekday"},
+			{ID: "trip-2", RouteID: "route-1", ServiceID: "never"},
+			{ID: "trip-3", RouteID: "route-1", ServiceID: "weekend"},
+		},
+	}
+	staticData.BuildIndexes()
+	staticStore := gtfs.NewStaticStore()
+	staticStore.Set(server.ID, staticData)
+
+	vehicle := func(trip remoteGtfs.TripID) remoteGtfs.Vehicle {
+		return remoteGtfs.Vehicle{Trip: &remoteGtfs.Trip{ID: trip}}
+	}
+	monday := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	realtimeStore := gtfs.NewRealtimeStore(time.Minute)
+	realtimeStore.Set(server.ID, &gtfs.RealtimeSnapshot{
+		FetchedAt: now,
+		Data: &models.RealtimeData{Vehicles: []remoteGtfs.Vehicle{
+			{},
+			vehicle(remoteGtfs.TripID{ID: "trip-x"}),
+			vehicle(remoteGtfs.TripID{ID: "trip-1", RouteID: "route-x"}),
+			vehicle(remoteGtfs.TripID{ID: "trip-2"}),
+			vehicle(remoteGtfs.TripID{ID: "trip-1", RouteID: "route-1"}),
+			vehicle(remoteGtfs.TripID{ID: "extra", RouteID: "route-1", ScheduleRelationship: gtfsrt.TripDescriptor_ADDED}),
+			// A weekend trip started on Monday, and one that may have started on Sunday.
+			vehicle(remoteGtfs.TripID{ID: "trip-3", HasStartDate: true, StartDate: monday}),
+			vehicle(remoteGtfs.TripID{ID: "trip-3"}),
+		}},
+	})
+
+	mismatches, err := trackVehicleTrips(server, realtimeStore, staticStore, now)
+	if err != nil {
+		t.Fatalf("trackVehicleTrips failed: %v", err)
+	}
+	expected := map[string]int{vehicleTripMissing: 1, vehicleTripUnknown: 1, vehicleTripUnknownRoute: 1, vehicleTripInactiveService: 2}
+	for reason, count := range expected {
+		if mismatches[reason] != count {
+			t.Errorf("expected %d %s vehicles, got %d", count, reason, mismatches[reason])
+		}
+		if got := testutil.ToFloat64(VehicleTripMismatches.WithLabelValues("985", reason)); got != float64(count) {
+			t.Errorf("expected %d %s vehicles to be exported, got %v", count, reason, got)
+		}
+	}
+
+	t.Run("No bundle", func(t *testing.T) {
+		if _, err := trackVehicleTrips(server, realtimeStore, gtfs.NewStaticStore(), now); err == nil {
+			t.Error("expected an error without a static bundle")
+		}
+	})
+
+	t.Run("Stale snapshot", func(t *testing.T) {
+		if _, err := trackVehicleTrips(server, realtimeStore, staticStore, now.Add(5*time.Minute)); err == nil {
+			t.Error("expected an error for a stale GTFS-RT snapshot")
+		}
+	})
+}
@@ -1,12 +1,16 @@
 package models
 
 import (
+	"sort"
+	"time"
+
 	remoteGtfs "github.com/OneBusAway/go-gtfs"
 )
 
 // StaticData represents the static GTFS data structure.
 // It contains parts we uses from GTFS Static bundels
-// which are stops, agencies, and services.
+// which are stops, agencies, services and routes, along with summaries
+// of trips (including their stop_times) and shapes.
 //
 // IMPORTANT:
 // In the future, we may need to extend this structure
@@ -16,29 +20,356 @@ type StaticData struct {
 	Stops    []remoteGtfs.Stop
 	Agencies []remoteGtfs.Agency
 	Services []remoteGtfs.Service
+	Routes   []remoteGtfs.Route
+
+	// RoutesByID indexes Routes by route ID; the values point into Routes.
+	RoutesByID map[string]*remoteGtfs.Route
+
+	// Trips and Shapes summarize the scheduled trips and shapes of the bundle.
+	// Only summaries are kept, as the full trips (with their stop times) are by far the largest part of a bundle.
+	Trips  []TripSummary
+	Shapes []ShapeSummary
+	// TripsByID indexes Trips by trip ID; the values are positions in Trips. Use Trip to look a trip up.
+	TripsByID map[string]int
+
+	// StopServices holds, for every stop with stop times, the span of the day each service calls
+	// at the stop, indexed by stop ID. It tells which stops are scheduled to have service at a given time.
+	StopServices map[string][]StopServiceSpan
+
+	// FeedInfo holds the content of feed_info.txt, or nil if the bundle has none.
+	FeedInfo *FeedInfo
+
+	// CalendarDates lists the service exceptions of calendar_dates.txt, sorted by date.
+	// They are also merged into Services (AddedDates / RemovedDates); this flat list is kept
+	// for checks that reason about dates rather than services.
+	CalendarDates []CalendarDate
+
+	// Validation is the referential-integrity report of the bundle file, or nil when the data
+	// was not produced by a bundle download.
+	Validation *ValidationReport
+
+	// Bundle describes the downloaded file the data was parsed from.
+	// It is the zero value when the data was not produced by a bundle download.
+	Bundle BundleInfo
+}
+
+// FeedInfo is the content of a bundle's feed_info.txt.
+// When set, FeedStartDate and FeedEndDate are the authoritative validity period of the bundle.
+type FeedInfo struct {
+	PublisherName string
+	PublisherURL  string
+	Lang          string
+	StartDate     time.Time // feed_start_date; zero if not set
+	EndDate       time.Time // feed_end_date; zero if not set
+	Version       string    // feed_version; empty if not set
+}
+
+// CalendarDate is a service exception from calendar_dates.txt.
+type CalendarDate struct {
+	ServiceID string
+	Date      time.Time
+	Added     bool // true when service is added on Date (exception_type 1), false when removed (2)
+}
+
+// TripSummary summarizes a scheduled trip of trips.txt and its stop_times.txt rows.
+type TripSummary struct {
+	ID            string
+	RouteID       string
+	ServiceID     string
+	ShapeID       string        // Empty if the trip has no shape
+	BlockID       string        // Empty if the trip has no block
+	StopTimeCount int           // Number of stop times of the trip
+	FirstStopID   string        // Stop of the first stop time; empty if the trip has none
+	LastStopID    string        // Stop of the last stop time; empty if the trip has none
+	StartTime     time.Duration // Departure from the first stop, since midnight of the service date
+	EndTime       time.Duration // Arrival at the last stop, since midnight of the service date
+}
+
+// StopServiceSpan is the span of the day during which the trips of a service call at a stop.
+type StopServiceSpan struct {
+	ServiceID string
+	First     time.Duration // Earliest arrival at the stop, since midnight of the service date
+	Last      time.Duration // Latest departure from the stop, since midnight of the service date
+}
+
+// ShapeSummary summarizes a shape of shapes.txt.
+type ShapeSummary struct {
+	ID         string
+	PointCount int
+}
+
+// ValidationReport is the result of the referential-integrity validation of a GTFS static bundle.
+type ValidationReport struct {
+	ValidatedAt time.Time `json:"validated_at"`
+	// Counts holds the number of errors of every rule, including rules without errors.
+	Counts map[string]int `json:"counts"`
+	// Issues holds the details of the errors, up to a fixed number of samples per rule.
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// ValidationIssue is a single referential-integrity error of a GTFS static bundle.
+type ValidationIssue struct {
+	Rule      string `json:"rule"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`                // Line of the offending row in File (the header is line 1)
+	EntityID  string `json:"entity_id"`           // ID of the offending entity (trip, stop, route, ...)
+	Reference string `json:"reference,omitempty"` // The unknown or invalid value referenced, if any
+}
+
+// TotalErrors returns the number of errors of every rule.
+func (r *ValidationReport) TotalErrors() int {
+	total := 0
+	for _, count := range r.Counts {
+		total += count
+	}
+	return total
+}
+
+// BundleDiff summarizes the changes between two consecutive GTFS static bundles of a server.
+type BundleDiff struct {
+	ComparedAt          time.Time `json:"compared_at"`
+	PreviousSHA256      string    `json:"previous_sha256,omitempty"`
+	SHA256              string    `json:"sha256,omitempty"`
+	PreviousFeedVersion string    `json:"previous_feed_version,omitempty"`
+	FeedVersion         string    `json:"feed_version,omitempty"`
+
+	Stops StopsDiff `json:"stops"`
+
+	AgenciesAdded   []string `json:"agencies_added"`
+	AgenciesRemoved []string `json:"agencies_removed"`
+
+	RoutesBefore int `json:"routes_before"`
+	RoutesAfter  int `json:"routes_after"`
+
+	// Service date range of each bundle: the earliest service start date and the latest service
+	// end date over calendar.txt and calendar_dates.txt. Shifts are in days; positive means later.
+	PreviousServiceStart  time.Time `json:"previous_service_start"`
+	PreviousServiceEnd    time.Time `json:"previous_service_end"`
+	ServiceStart          time.Time `json:"service_start"`
+	ServiceEnd            time.Time `json:"service_end"`
+	ServiceStartShiftDays int       `json:"service_start_shift_days"`
+	ServiceEndShiftDays   int       `json:"service_end_shift_days"`
+
+	// ThresholdsExceeded lists the change thresholds crossed by this diff, if any.
+	ThresholdsExceeded []string `json:"thresholds_exceeded"`
+}
+
+// StopsDiff summarizes the stop changes between two bundles.
+// The ID lists only hold a sample of the changed stops; the counts are exact.
+type StopsDiff struct {
+	Before     int      `json:"before"`
+	After      int      `json:"after"`
+	Added      int      `json:"added"`
+	Removed    int      `json:"removed"`
+	Moved      int      `json:"moved"`
+	AddedIDs   []string `json:"added_ids"`
+	RemovedIDs []string `json:"removed_ids"`
+	MovedIDs   []string `json:"moved_ids"`
+}
+
+// BundleInfo describes a downloaded GTFS static bundle file.
+//
+// The HTTP validators (ETag, LastModified) are sent back on the next download as
+// If-None-Match / If-Modified-Since headers, and the content hash detects bundles that were
+// re-published unchanged, so that an unchanged bundle is neither parsed nor swapped again.
+type BundleInfo struct {
+	ETag           string    // ETag response header, if any
+	LastModified   string    // Last-Modified response header as received, if any
+	LastModifiedAt time.Time // Parsed Last-Modified header; zero if missing or invalid
+	SHA256         string    // Hex-encoded SHA-256 hash of the bundle file
+	Size           int       // Size of the bundle file in bytes
+	LastChangedAt  time.Time // When a bundle with this content was first downloaded
+	CachedAt       time.Time // When the bundle was downloaded, if it was loaded from the on-disk cache instead; zero otherwise
 }
 
 func NewStaticData(GtfsStaticBundle *remoteGtfs.Static) *StaticData {
-	return &StaticData{
-		Stops:    append([]remoteGtfs.Stop(nil), GtfsStaticBundle.Stops...),
-		Agencies: append([]remoteGtfs.Agency(nil), GtfsStaticBundle.Agencies...),
-		Services: append([]remoteGtfs.Service(nil), GtfsStaticBundle.Services...),
+	trips := make([]TripSummary, 0, len(GtfsStaticBundle.Trips))
+	for _, trip := range GtfsStaticBundle.Trips {
+		trips = append(trips, newTripSummary(trip))
+	}
+	stopServices := newStopServices(GtfsStaticBundle.Trips)
+	shapes := make([]ShapeSummary, 0, len(GtfsStaticBundle.Shapes))
+	for _, shape := range GtfsStaticBundle.Shapes {
+		shapes = append(shapes, ShapeSummary{ID: shape.ID, PointCount: len(shape.Points)})
+	}
+	var calendarDates []CalendarDate
+	for _, service := range GtfsStaticBundle.Services {
+		for _, date := range service.AddedDates {
+			calendarDates = append(calendarDates, CalendarDate{ServiceID: service.Id, Date: date, Added: true})
+		}
+		for _, date := range service.RemovedDates {
+			calendarDates = append(calendarDates, CalendarDate{ServiceID: service.Id, Date: date, Added: false})
+		}
 	}
+	sort.Slice(calendarDates, func(i, j int) bool {
+		if !calendarDates[i].Date.Equal(calendarDates[j].Date) {
+			return calendarDates[i].Date.Before(calendarDates[j].Date)
+		}
+		return calendarDates[i].ServiceID < calendarDates[j].ServiceID
+	})
+
+	staticData := &StaticData{
+		Stops:         append([]remoteGtfs.Stop(nil), GtfsStaticBundle.Stops...),
+		Agencies:      append([]remoteGtfs.Agency(nil), GtfsStaticBundle.Agencies...),
+		Services:      append([]remoteGtfs.Service(nil), GtfsStaticBundle.Services...),
+		Routes:        append([]remoteGtfs.Route(nil), GtfsStaticBundle.Routes...),
+		Trips:         trips,
+		Shapes:        shapes,
+		StopServices:  stopServices,
+		CalendarDates: calendarDates,
+	}
+	staticData.BuildIndexes()
+	return staticData
+}
+
+// BuildIndexes (re)builds RoutesByID and TripsByID from Routes and Trips.
+// NewStaticData calls it; StaticData assembled by hand must call it before the indexes are used.
+func (d *StaticData) BuildIndexes() {
+	d.RoutesByID = make(map[string]*remoteGtfs.Route, len(d.Routes))
+	for i := range d.Routes {
+		d.RoutesByID[d.Routes[i].Id] = &d.Routes[i]
+	}
+	d.TripsByID = make(map[string]int, len(d.Trips))
+	for i, trip := range d.Trips {
+		d.TripsByID[trip.ID] = i
+	}
+}
+
+// Trip returns the summary of the scheduled trip with the given ID, and whether the bundle has it.
+// The returned pointer points into Trips.
+func (d *StaticData) Trip(id string) (*TripSummary, bool) {
+	i, ok := d.TripsByID[id]
+	if !ok {
+		return nil, false
+	}
+	return &d.Trips[i], true
+}
+
+// newStopServices computes the service spans of every stop from the stop times of the trips,
+// sorted by service ID. Trips without a service are left out.
+func newStopServices(trips []remoteGtfs.ScheduledTrip) map[string][]StopServiceSpan {
+	spans := make(map[string]map[string]*StopServiceSpan)
+	for _, trip := range trips {
+		if trip.Service == nil {
+			continue
+		}
+		for _, stopTime := range trip.StopTimes {
+			if stopTime.Stop == nil {
+				continue
+			}
+			byService, ok := spans[stopTime.Stop.Id]
+			if !ok {
+				byService = make(map[string]*StopServiceSpan)
+				spans[stopTime.Stop.Id] = byService
+			}
+			span, ok := byService[trip.Service.Id]
+			if !ok {
+				byService[trip.Service.Id] = &StopServiceSpan{
+					ServiceID: trip.Service.Id,
+					First:     stopTime.ArrivalTime,
+					Last:      stopTime.DepartureTime,
+				}
+				continue
+			}
+			if stopTime.ArrivalTime < span.First {
+				span.First = stopTime.ArrivalTime
+			}
+			if stopTime.DepartureTime > span.Last {
+				span.Last = stopTime.DepartureTime
+			}
+		}
+	}
+
+	stopServices := make(map[string][]StopServiceSpan, len(spans))
+	for stopID, byService := range spans {
+		list := make([]StopServiceSpan, 0, len(byService))
+		for _, span := range byService {
+			list = append(list, *span)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ServiceID < list[j].ServiceID })
+		stopServices[stopID] = list
+	}
+	return stopServices
+}
+
+// newTripSummary summarizes a scheduled trip. Stop times are sorted by stop sequence by the GTFS library.
+func newTripSummary(trip remoteGtfs.ScheduledTrip) TripSummary {
+	summary := TripSummary{
+		ID:            trip.ID,
+		BlockID:       trip.BlockID,
+		StopTimeCount: len(trip.StopTimes),
+	}
+	if trip.Route != nil {
+		summary.RouteID = trip.Route.Id
+	}
+	if trip.Service != nil {
+		summary.ServiceID = trip.Service.Id
+	}
+	if trip.Shape != nil {
+		summary.ShapeID = trip.Shape.ID
+	}
+	if len(trip.StopTimes) > 0 {
+		first, last := trip.StopTimes[0], trip.StopTimes[len(trip.StopTimes)-1]
+		if first.Stop != nil {
+			summary.FirstStopID = first.Stop.Id
+		}
+		if last.Stop != nil {
+			summary.LastStopID = last.Stop.Id
+		}
+		summary.StartTime = first.DepartureTime
+		summary.EndTime = last.ArrivalTime
+	}
+	return summary
 }
 
 // RealtimeData represents the realtime GTFS data structure.
 // It contains parts we uses from GTFS Realtime bundels
-// which are vehicles.
+// which are vehicles, trip updates and alerts.
 // IMPORTANT:
 // In the future, we may need to extend this structure
 // to include more fields from the GTFS Realtime bundle.
 // Don't forget to include them here
 type RealtimeData struct {
 	Vehicles []remoteGtfs.Vehicle
+	// TripUpdates holds the trips that have a TripUpdate entity in the feed.
+	// Trips only referenced by a vehicle position or an alert are not included.
+	TripUpdates []remoteGtfs.Trip
+	Alerts      []remoteGtfs.Alert
 }
 
 func NewRealtimeData(GtfsRealtimeBundle *remoteGtfs.Realtime) *RealtimeData {
+	var tripUpdates []remoteGtfs.Trip
+	for _, trip := range GtfsRealtimeBundle.Trips {
+		if trip.IsEntityInMessage {
+			tripUpdates = append(tripUpdates, trip)
+		}
+	}
 	return &RealtimeData{
-		Vehicles: append([]remoteGtfs.Vehicle(nil), GtfsRealtimeBundle.Vehicles...),
+		Vehicles:    append([]remoteGtfs.Vehicle(nil), GtfsRealtimeBundle.Vehicles...),
+		TripUpdates: tripUpdates,
+		Alerts:      append([]remoteGtfs.Alert(nil), GtfsRealtimeBundle.Alerts...),
 	}
 }
+
+// RealtimeIntegrityReport lists the vehicles of a GTFS-RT vehicle positions feed that break
+// OBA's vehicle-to-trip matching: vehicle IDs reported more than once, and trips claimed by
+// more than one vehicle.
+type RealtimeIntegrityReport struct {
+	// DuplicateVehicles holds the vehicle IDs reported by more than one vehicle position, sorted by ID.
+	DuplicateVehicles []DuplicateVehicle `json:"duplicate_vehicles"`
+	// SharedTrips holds the trips (trip ID and start date) claimed by more than one vehicle, sorted by trip.
+	SharedTrips []SharedTrip `json:"shared_trips"`
+}
+
+// DuplicateVehicle is a vehicle ID reported by several vehicle positions of the same feed.
+type DuplicateVehicle struct {
+	VehicleID string `json:"vehicle_id"`
+	Count     int    `json:"count"` // Number of vehicle positions reporting the ID
+}
+
+// SharedTrip is a trip assigned to several vehicles of the same feed.
+type SharedTrip struct {
+	TripID     string   `json:"trip_id"`
+	StartDate  string   `json:"start_date,omitempty"` // As in the feed (YYYYMMDD); empty if not set
+	VehicleIDs []string `json:"vehicle_ids"`          // Sorted
+}
@@ -1,7 +1,16 @@
 package models
 
+import (
+	"slices"
+	"strings"
+)
+
 // ObaServer represents a OneBusAway server configuration
-// TODO: Some server have multiple Agencies, so we should have a list of Agencies
+//
+// A server often hosts several agencies. They are listed in AgencyIDs; the single AgencyID of
+// older configurations is still supported, and both may be combined (see ConfiguredAgencyIDs).
+// When neither is set, the agencies are discovered from the server's GTFS static bundle or its
+// `agencies-with-coverage` endpoint.
 type ObaServer struct {
 	Name               string `json:"name"`
 	ID                 int    `json:"id"`
@@ -13,6 +22,18 @@ type ObaServer struct {
 	GtfsRtApiKey       string `json:"gtfs_rt_api_key"`
 	GtfsRtApiValue     string `json:"gtfs_rt_api_value"`
 	AgencyID           string `json:"agency_id"`
+
+	// AgencyIDs lists the agencies hosted by the server, in addition to AgencyID.
+	AgencyIDs []string `json:"agency_ids,omitempty"`
+
+	// AlertsUrl is the optional URL of the GTFS-RT Service Alerts feed.
+	AlertsUrl string `json:"alerts_url,omitempty"`
+
+	// EnabledChecks, when non-empty, restricts the checks run for this server to the listed names.
+	EnabledChecks []string `json:"enabled_checks,omitempty"`
+	// DisabledChecks lists the names of checks that must not run for this server.
+	// It takes precedence over EnabledChecks.
+	DisabledChecks []string `json:"disabled_checks,omitempty"`
 }
 
 // NewObaServer creates a new ObaServer instance with the provided configuration
@@ -30,3 +51,29 @@ func NewObaServer(name string, id int, baseURL, apiKey, gtfsURL, tripUpdateURL,
 		AgencyID:           agencyID,
 	}
 }
+
+// CheckEnabled reports whether the check with the given name should run for this server.
+//
+// A check is enabled unless it is listed in DisabledChecks, or EnabledChecks is non-empty
+// and does not list it. The checks runner also runs the dependencies of enabled checks that are
+// not listed in DisabledChecks, and skips the checks depending on a disabled one.
+func (s ObaServer) CheckEnabled(name string) bool {
+	if slices.Contains(s.DisabledChecks, name) {
+		return false
+	}
+	return len(s.EnabledChecks) == 0 || slices.Contains(s.EnabledChecks, name)
+}
+
+// ConfiguredAgencyIDs returns the agency IDs configured for this server: AgencyID first, if set,
+// followed by AgencyIDs, without blanks or duplicates. It returns nil when no agency is configured,
+// in which case the agencies have to be discovered.
+func (s ObaServer) ConfiguredAgencyIDs() []string {
+	var ids []string
+	for _, id := range append([]string{s.AgencyID}, s.AgencyIDs...) {
+		id = strings.TrimSpace(id)
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
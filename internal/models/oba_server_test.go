@@ -1,6 +1,9 @@
 package models
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 func TestNewObaServer(t *testing.T) {
 	name := "Test Server"
@@ -52,3 +55,47 @@ func TestNewObaServer(t *testing.T) {
 		t.Errorf("NewObaServer() ID = %v, want %v", server.ID, id)
 	}
 }
+
+func TestObaServerCheckEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   ObaServer
+		check    string
+		expected bool
+	}{
+		{"All checks enabled by default", ObaServer{}, "server_ping", true},
+		{"Listed in enabled checks", ObaServer{EnabledChecks: []string{"server_ping"}}, "server_ping", true},
+		{"Not listed in enabled checks", ObaServer{EnabledChecks: []string{"server_ping"}}, "vehicle_count", false},
+		{"Listed in disabled checks", ObaServer{DisabledChecks: []string{"vehicle_count"}}, "vehicle_count", false},
+		{"Disabled takes precedence", ObaServer{EnabledChecks: []string{"vehicle_count"}, DisabledChecks: []string{"vehicle_count"}}, "vehicle_count", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.server.CheckEnabled(tt.check); got != tt.expected {
+				t.Errorf("CheckEnabled(%q) = %v, want %v", tt.check, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestObaServerConfiguredAgencyIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   ObaServer
+		expected []string
+	}{
+		{"No agency configured", ObaServer{}, nil},
+		{"Single agency_id", ObaServer{AgencyID: "1"}, []string{"1"}},
+		{"List of agencies", ObaServer{AgencyIDs: []string{"1", "40"}}, []string{"1", "40"}},
+		{"agency_id comes first, without duplicates", ObaServer{AgencyID: "40", AgencyIDs: []string{"1", "40", " "}}, []string{"40", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.server.ConfiguredAgencyIDs(); !slices.Equal(got, tt.expected) {
+				t.Errorf("ConfiguredAgencyIDs() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}